@@ -0,0 +1,725 @@
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/cookoo"
+	clog "github.com/Masterminds/cookoo/log"
+	"github.com/deis/deis/builder/cache"
+	"github.com/deis/deis/builder/git"
+	"github.com/deis/deis/builder/slugs"
+	"gopkg.in/yaml.v2"
+)
+
+// Build steps, as reported in timings and in StepErrors.
+const (
+	StepCheckout  = "checkout"
+	StepConfig    = "config"
+	StepSlugbuild = "slugbuild"
+	StepImage     = "image"
+	StepPush      = "push"
+	StepProcfile  = "procfile"
+	StepRelease   = "release"
+)
+
+// Images used to build and run slugs.
+const (
+	SlugbuilderImage = "deis/slugbuilder"
+	SlugrunnerImage  = "deis/slugrunner"
+)
+
+// slugGroup is the group that slugbuilder runs as. The source and cache
+// directories are shared with it.
+var slugGroup = 2000
+
+// Docker is the part of Docker that builds use. docker.CLI implements it.
+type Docker interface {
+	// Run starts a detached container, and returns its ID. limits are
+	// flags that limit its resources, as returned by Limits.Flags.
+	Run(image string, env, volumes, limits []string) (string, error)
+	// Attach streams a container's output until it exits, and fails if
+	// the container does.
+	Attach(id string, out io.Writer) error
+	// OOMKilled is true if a container was killed for running out of memory.
+	OOMKilled(id string) (bool, error)
+	// CopyFrom copies a file out of a container into a directory.
+	CopyFrom(id, src, dest string) error
+	// Remove removes a container.
+	Remove(id string) error
+	// Build builds and tags the image in a directory, limiting the
+	// resources of its containers. It stops if stop is closed.
+	Build(dir, tag string, noCache bool, limits []string, out io.Writer, stop <-chan bool) error
+	// Push pushes an image to its registry.
+	Push(tag string) error
+}
+
+// StepError is returned when a step of a build fails.
+type StepError struct {
+	// Step is one of the Step* constants.
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("%s failed: %s", e.Step, e.Err)
+}
+
+// Timing records how long a build step took.
+type Timing struct {
+	Step     string
+	Duration time.Duration
+}
+
+// Build is a single build of a push to an application.
+//
+// It is created by PrepareBuild, and each later step of the "build" route
+// records its results on it.
+type Build struct {
+	User string
+	// Repo is the name of the repository, e.g. "myapp.git".
+	Repo string
+	Sha  string
+	// App is the application the push deploys to.
+	App  string
+	UUID string
+	// Options are the push options, as returned by git.ParsePushOptions.
+	Options map[string]string
+	// Registry is the HOST:PORT of the private registry.
+	Registry string
+
+	RepoDir   string
+	SourceDir string
+	CacheDir  string
+	// Caches is the store the application's build cache is in.
+	Caches *cache.Store
+	// Limits are the resources the build may use.
+	Limits *Limits
+
+	Out        io.Writer
+	Docker     Docker
+	Controller Controller
+
+	// Config is the application's configuration.
+	Config *Config
+	// Dockerfile is true if the application was built from its own Dockerfile.
+	Dockerfile bool
+	// Slug is the path of the compiled slug, if the app was built by slugbuilder.
+	Slug     string
+	Procfile ProcessType
+	Release  *BuildHookResponse
+	Timings  []Timing
+
+	started   time.Time
+	container string
+	tmpCache  bool
+	cacheLock *cache.Lock
+}
+
+// ShortSha is the abbreviated commit the build is for.
+func (b *Build) ShortSha() string {
+	if len(b.Sha) > 8 {
+		return b.Sha[:8]
+	}
+	return b.Sha
+}
+
+// Tag is the name the build's image is pushed to the registry as.
+func (b *Build) Tag() string {
+	return fmt.Sprintf("%s/%s:git-%s", b.Registry, b.App, b.ShortSha())
+}
+
+// step runs one step of the build, recording how long it took.
+func (b *Build) step(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	b.Timings = append(b.Timings, Timing{Step: name, Duration: time.Since(start)})
+	if err != nil {
+		return &StepError{Step: name, Err: err}
+	}
+	return nil
+}
+
+func (b *Build) putsStep(format string, v ...interface{}) {
+	fmt.Fprintf(b.Out, "-----> "+format+"\n", v...)
+}
+
+func (b *Build) indent(format string, v ...interface{}) {
+	fmt.Fprintf(b.Out, "       "+format+"\n", v...)
+}
+
+// Cleanup removes everything the build leaves behind, except the image.
+func (b *Build) Cleanup() {
+	if len(b.container) > 0 {
+		b.Docker.Remove(b.container)
+	}
+	if b.tmpCache {
+		os.RemoveAll(b.CacheDir)
+	}
+	if b.cacheLock != nil {
+		b.cacheLock.Release()
+		b.cacheLock = nil
+		// Now that the cache is up to date, make room for it.
+		b.Caches.Trim()
+	}
+	if len(b.SourceDir) > 0 {
+		os.RemoveAll(b.SourceDir)
+	}
+	if len(b.RepoDir) > 0 {
+		gc := exec.Command("git", "gc", "--quiet")
+		gc.Dir = b.RepoDir
+		gc.Run()
+	}
+}
+
+// Summary describes how long the build and each of its steps took.
+func (b *Build) Summary() string {
+	var total time.Duration
+	steps := make([]string, len(b.Timings))
+	for i, t := range b.Timings {
+		total += t.Duration
+		steps[i] = fmt.Sprintf("%s %s", t.Step, seconds(t.Duration))
+	}
+	return fmt.Sprintf("build took %s (%s)", seconds(total), strings.Join(steps, ", "))
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.1fs", d.Seconds())
+}
+
+// RunBuild builds and deploys a push. It is called by the pre-receive hook
+// as `builder build <user> <repo> <sha> [<app>]`.
+//
+// The build's UUID and push options are read from the environment.
+//
+// RunBuild returns one of the Status* status code constants.
+func RunBuild(args []string) int {
+	if len(args) < 3 || len(args) > 4 {
+		fmt.Fprintln(os.Stderr, "Usage: builder build <user> <repo> <sha> [<app>]")
+		return StatusLocalError
+	}
+	user, repo, sha := args[0], args[1], args[2]
+	app := strings.TrimSuffix(repo, ".git")
+	if len(args) == 4 {
+		app = args[3]
+	}
+
+	options, err := git.ParsePushOptions(git.PushOptionsFromEnv(os.Getenv))
+	if err != nil {
+		fmt.Printf(" !     %s\n", err)
+		return StatusLocalError
+	}
+
+	reg, router, cxt := cookoo.Cookoo()
+	// Everything printed reaches the user, so only log problems.
+	clog.Level = clog.LogWarning
+	routes(reg)
+
+	cxt.Put("user", user)
+	cxt.Put("repo", repo)
+	cxt.Put("sha", sha)
+	cxt.Put("app", app)
+	cxt.Put("uuid", os.Getenv("BUILD_UUID"))
+	cxt.Put("pushOptions", options)
+	cxt.Put("out", io.Writer(os.Stdout))
+
+	err = router.HandleRequest("build", cxt, false)
+	if b, ok := cxt.Get("build", nil).(*Build); ok {
+		b.Cleanup()
+		if err == nil {
+			b.indent("%s", b.Summary())
+			fmt.Println()
+		}
+		if events, ok := cxt.Get("events", nil).(*EventPoster); ok {
+			events.Post(b.Event(err))
+		}
+	}
+	if err != nil {
+		fmt.Printf(" !     %s\n", err)
+		return StatusLocalError
+	}
+	return StatusOk
+}
+
+// PrepareBuild checks out the pushed code into a temporary directory.
+//
+// Params:
+// 	- user (string): The Deis user who pushed.
+// 	- repo (string): The repository, e.g. "myapp.git".
+// 	- sha (string): The pushed commit.
+// 	- app (string): The application to deploy to.
+// 	- uuid (string): The build UUID.
+// 	- options (map[string]string): Push options.
+// 	- gitHome (string): The directory repositories are in. Defaults to /home/git.
+// 	- caches (*cache.Store): The build caches. Defaults to $gitHome/cache, unlimited.
+// 	- registry (string): HOST:PORT of the private registry.
+// 	- limits (*Limits): The resources the build may use. Defaults to none.
+// 	- docker (Docker): Runs the build.
+// 	- controller (Controller): Configures and releases the build.
+// 	- out (io.Writer): Build output is written here, for the user.
+//
+// Returns:
+// 	- *Build
+func PrepareBuild(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	if ok, missing := p.RequiresValue("user", "repo", "sha", "app", "registry", "docker", "controller"); !ok {
+		return nil, fmt.Errorf("Missing required fields: %s", strings.Join(missing, ", "))
+	}
+	options, _ := p.Get("options", nil).(map[string]string)
+	if options == nil {
+		options = map[string]string{}
+	}
+
+	b := &Build{
+		User:       p.Get("user", "").(string),
+		Repo:       p.Get("repo", "").(string),
+		Sha:        p.Get("sha", "").(string),
+		App:        p.Get("app", "").(string),
+		UUID:       p.Get("uuid", "").(string),
+		Options:    options,
+		Registry:   p.Get("registry", "").(string),
+		Docker:     p.Get("docker", nil).(Docker),
+		Controller: p.Get("controller", nil).(Controller),
+		Out:        p.Get("out", ioutil.Discard).(io.Writer),
+		started:    time.Now(),
+	}
+	b.Limits, _ = p.Get("limits", nil).(*Limits)
+	gitHome := p.Get("gitHome", "/home/git").(string)
+	b.RepoDir = filepath.Join(gitHome, b.Repo)
+	b.Caches, _ = p.Get("caches", nil).(*cache.Store)
+	if b.Caches == nil {
+		b.Caches = cache.NewStore(filepath.Join(gitHome, "cache"), 0)
+	}
+
+	return b, b.step(StepCheckout, func() error {
+		buildDir := filepath.Join(b.RepoDir, "build")
+		if err := os.MkdirAll(buildDir, 0755); err != nil {
+			return err
+		}
+
+		var err error
+		if b.SourceDir, err = ioutil.TempDir(buildDir, "tmp"); err != nil {
+			return err
+		}
+		if err := b.useCache(buildDir); err != nil {
+			return err
+		}
+		return checkout(b.RepoDir, b.Sha, b.SourceDir)
+	})
+}
+
+// useCache sets up the cache the build mounts into slugbuilder. It holds the
+// application's cache until Cleanup, so that it is not evicted or purged
+// during the build.
+func (b *Build) useCache(buildDir string) error {
+	var err error
+	switch {
+	case b.Options[git.OptionNoCache] == "true":
+		// Build from an empty cache, leaving the app's cache alone for later builds.
+		b.putsStep("Building without cache")
+		if b.CacheDir, err = ioutil.TempDir(buildDir, "cache"); err != nil {
+			return err
+		}
+		b.tmpCache = true
+		return nil
+	case b.Options[git.OptionResetCache] == "true":
+		b.putsStep("Resetting build cache")
+		if err := b.Caches.Purge(b.App); err != nil && err != cache.ErrNotFound {
+			return err
+		}
+	default:
+		b.migrateCache()
+	}
+
+	if b.cacheLock, err = b.Caches.Acquire(b.App); err != nil {
+		return err
+	}
+	b.CacheDir = b.cacheLock.Dir
+	return nil
+}
+
+// migrateCache moves a cache from where older builders kept it, inside the
+// repository, into the cache store.
+func (b *Build) migrateCache() {
+	old := filepath.Join(b.RepoDir, "cache")
+	if _, err := os.Stat(old); err != nil {
+		return
+	}
+	if _, err := b.Caches.Stat(b.App); err == cache.ErrNotFound {
+		if os.MkdirAll(b.Caches.Dir, 0755) == nil && os.Rename(old, filepath.Join(b.Caches.Dir, b.App)) == nil {
+			return
+		}
+	}
+	os.RemoveAll(old)
+}
+
+// checkout extracts a commit of the repository in repoDir into dest.
+func checkout(repoDir, sha, dest string) error {
+	var stderr bytes.Buffer
+	archive := exec.Command("git", "archive", sha)
+	archive.Dir = repoDir
+	archive.Stderr = &stderr
+	extract := exec.Command("tar", "-xmC", dest)
+	extract.Stderr = &stderr
+
+	pipe, err := archive.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	extract.Stdin = pipe
+	if err := extract.Start(); err != nil {
+		return err
+	}
+	archiveErr := archive.Run()
+	if err := extract.Wait(); err != nil || archiveErr != nil {
+		return fmt.Errorf("could not extract %s: %s", sha, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// FetchConfig fetches the application's configuration from the controller.
+//
+// Params:
+// 	- build (*Build): The build.
+//
+// Returns:
+// 	- *Config
+func FetchConfig(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	b := p.Get("build", nil).(*Build)
+	err := b.step(StepConfig, func() error {
+		var err error
+		b.Config, err = b.Controller.Config(b.User, b.App)
+		return err
+	})
+	return b.Config, err
+}
+
+// Slugbuild compiles the application into a slug with deis/slugbuilder, and
+// writes a Dockerfile that runs it.
+//
+// Applications that have their own Dockerfile are left alone.
+//
+// Params:
+// 	- build (*Build): The build.
+//
+// Returns:
+// 	- bool: true if a slug was built.
+func Slugbuild(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	b := p.Get("build", nil).(*Build)
+	dockerfile := filepath.Join(b.SourceDir, "Dockerfile")
+	if _, err := os.Stat(dockerfile); err == nil {
+		b.Dockerfile = true
+		return false, nil
+	}
+
+	return true, b.step(StepSlugbuild, func() error {
+		// Share the source and cache with the slug group. The source
+		// directory is created by TempDir, which only gives its owner access.
+		if err := shareWithGroup(b.SourceDir, true); err != nil {
+			return err
+		}
+		if err := shareWithGroup(b.CacheDir, false); err != nil {
+			return err
+		}
+
+		env := []string{}
+		if b.Config != nil {
+			keys := make([]string, 0, len(b.Config.Values))
+			for k := range b.Config.Values {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				env = append(env, fmt.Sprintf("%s=%v", k, b.Config.Values[k]))
+			}
+		}
+		env = append(env, "SOURCE_VERSION="+b.Sha)
+		if bp := b.Options[git.OptionBuildpack]; len(bp) > 0 {
+			env = append(env, "BUILDPACK_URL="+bp)
+		}
+		volumes := []string{
+			"/etc/environment_proxy:/etc/environment_proxy",
+			b.SourceDir + ":/tmp/app",
+			b.CacheDir + ":/tmp/cache:rw",
+		}
+
+		id, err := b.Docker.Run(SlugbuilderImage, env, volumes, b.Limits.Flags())
+		if err != nil {
+			return err
+		}
+		b.container = id
+		err = b.limit(func() error {
+			return b.Docker.Attach(id, b.Out)
+		}, func() {
+			b.Docker.Remove(id)
+		})
+		if _, ok := err.(*LimitError); ok {
+			b.container = ""
+			return err
+		} else if err != nil {
+			if oom, _ := b.Docker.OOMKilled(id); oom && b.Limits != nil {
+				return &LimitError{Limit: LimitMemory, Value: b.Limits.Memory}
+			}
+			return err
+		}
+		if err := b.Docker.CopyFrom(id, "/tmp/slug.tgz", b.SourceDir); err != nil {
+			return err
+		}
+		b.Slug = filepath.Join(b.SourceDir, "slug.tgz")
+
+		return ioutil.WriteFile(dockerfile, []byte("FROM "+SlugrunnerImage+"\n"), 0644)
+	})
+}
+
+// shareWithGroup gives the slug group read/write access to dir.
+func shareWithGroup(dir string, recursive bool) error {
+	if recursive {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Lchown(path, -1, slugGroup)
+		})
+		if err != nil {
+			return err
+		}
+	} else if err := os.Lchown(dir, -1, slugGroup); err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(dir, info.Mode().Perm()|0070)
+}
+
+// BuildImage builds the application's Docker image.
+//
+// Params:
+// 	- build (*Build): The build.
+//
+// Returns:
+// 	- string: The image tag.
+func BuildImage(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	b := p.Get("build", nil).(*Build)
+	return b.Tag(), b.step(StepImage, func() error {
+		// Inject builder-specific environment variables into the application.
+		f, err := os.OpenFile(filepath.Join(b.SourceDir, "Dockerfile"), os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(f, "\nENV GIT_SHA %s\n", b.Sha)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(b.Out)
+		b.putsStep("Building Docker image")
+		out := &stepWriter{w: b.Out}
+		stop := make(chan bool)
+		err = b.limit(func() error {
+			return b.Docker.Build(b.SourceDir, b.Tag(), b.Options[git.OptionNoCache] == "true", b.Limits.Flags(), out, stop)
+		}, func() {
+			close(stop)
+		})
+		if _, ok := err.(*LimitError); !ok && err != nil && b.Limits != nil && len(b.Limits.Memory) > 0 && len(out.container) > 0 {
+			if oom, _ := b.Docker.OOMKilled(out.container); oom {
+				return &LimitError{Limit: LimitMemory, Value: b.Limits.Memory}
+			}
+		}
+		return err
+	})
+}
+
+// PushImage pushes the application's image to the private registry.
+//
+// Params:
+// 	- build (*Build): The build.
+//
+// Returns:
+// 	- string: The image tag.
+func PushImage(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	b := p.Get("build", nil).(*Build)
+	return b.Tag(), b.step(StepPush, func() error {
+		b.putsStep("Pushing image to private registry")
+		err := b.Docker.Push(b.Tag())
+		fmt.Fprintln(b.Out)
+		return err
+	})
+}
+
+// ArchiveSlug keeps the slug the build compiled, so that it can be downloaded
+// later. Failing to keep it does not fail the build.
+//
+// Params:
+// 	- build (*Build): The build.
+// 	- slugs (*slugs.Store): Where slugs are kept.
+//
+// Returns:
+// 	- bool: true if a slug was kept.
+func ArchiveSlug(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	b := p.Get("build", nil).(*Build)
+	store, ok := p.Get("slugs", nil).(*slugs.Store)
+	if !ok || len(b.Slug) == 0 || len(b.UUID) == 0 {
+		return false, nil
+	}
+	if err := store.Save(b.App, b.UUID, b.Slug); err != nil {
+		clog.Warnf(c, "Could not keep the slug of build %s: %s", b.UUID, err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// DetectProcfile finds the application's process types.
+//
+// They are read from the Procfile in the application, or else from the
+// Procfile or the default process types that the buildpack put in the slug.
+//
+// Params:
+// 	- build (*Build): The build.
+//
+// Returns:
+// 	- ProcessType
+func DetectProcfile(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	b := p.Get("build", nil).(*Build)
+	err := b.step(StepProcfile, func() error {
+		b.Procfile = ProcessType{}
+
+		var err error
+		if data, rerr := ioutil.ReadFile(filepath.Join(b.SourceDir, "Procfile")); rerr == nil {
+			b.Procfile, err = parseProcfile(data)
+			return err
+		}
+		if len(b.Slug) == 0 {
+			return nil
+		}
+
+		files, err := readFromSlug(b.Slug, "./Procfile", "./.release")
+		if err != nil {
+			return err
+		}
+		// Sometimes, the buildpack generates a Procfile instead of populating
+		// bin/release, which is unofficially deprecated for declaring default
+		// process types.
+		if data, ok := files["./Procfile"]; ok {
+			b.Procfile, err = parseProcfile(data)
+			return err
+		}
+		if data, ok := files["./.release"]; ok {
+			var release struct {
+				DefaultProcessTypes ProcessType `yaml:"default_process_types"`
+			}
+			if err := yaml.Unmarshal(data, &release); err != nil {
+				return fmt.Errorf("invalid .release in slug: %s", err)
+			}
+			if release.DefaultProcessTypes != nil {
+				b.Procfile = release.DefaultProcessTypes
+			}
+		}
+		return nil
+	})
+	return b.Procfile, err
+}
+
+func parseProcfile(data []byte) (ProcessType, error) {
+	procfile := ProcessType{}
+	if err := yaml.Unmarshal(data, &procfile); err != nil {
+		return nil, fmt.Errorf("the Procfile is not valid yaml: %s", err)
+	}
+	return procfile, nil
+}
+
+// readFromSlug reads the named files from a gzipped slug tarball.
+func readFromSlug(slug string, names ...string) (map[string][]byte, error) {
+	f, err := os.Open(slug)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if wanted[hdr.Name] {
+			if files[hdr.Name], err = ioutil.ReadAll(tr); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// PublishBuild hands the build to the controller, which releases it.
+//
+// If the no-deploy push option is set, the build is not released.
+//
+// Params:
+// 	- build (*Build): The build.
+//
+// Returns:
+// 	- *BuildHookResponse, or nil if the build was not released.
+func PublishBuild(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	b := p.Get("build", nil).(*Build)
+	if b.Options[git.OptionNoDeploy] == "true" {
+		b.putsStep("Skipping deploy (no-deploy)")
+		b.indent("image %s was built, but %s was not released", b.Tag(), b.App)
+		fmt.Fprintln(b.Out)
+		return nil, nil
+	}
+
+	b.putsStep("Launching... ")
+	err := b.step(StepRelease, func() error {
+		hook := &BuildHook{
+			Sha:         b.ShortSha(),
+			ReceiveUser: b.User,
+			ReceiveRepo: b.App,
+			Image:       b.App,
+			Procfile:    b.Procfile,
+			UUID:        b.UUID,
+			PushOptions: b.Options,
+		}
+		if b.Dockerfile {
+			hook.Dockerfile = "true"
+		}
+		var err error
+		b.Release, err = b.Controller.PublishBuild(hook)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b.indent("done, %s:v%d deployed to Deis", b.App, b.Release.Release["version"])
+	fmt.Fprintln(b.Out)
+	if len(b.Release.Domains) > 0 {
+		b.indent("http://%s", b.Release.Domains[0])
+		fmt.Fprintln(b.Out)
+	}
+	b.indent("To learn more, use `deis help` or visit http://deis.io")
+	fmt.Fprintln(b.Out)
+	return b.Release, nil
+}
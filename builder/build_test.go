@@ -0,0 +1,633 @@
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/cookoo"
+	"github.com/deis/deis/builder/slugs"
+	"github.com/deis/deis/builder/webhook"
+)
+
+// fakeDocker records what the build asks Docker to do.
+type fakeDocker struct {
+	mu    sync.Mutex
+	calls []string
+	env   []string
+	// slug is the content of the slug.tgz that slugbuilder "produces".
+	slug []byte
+	// fail makes the named method fail.
+	fail string
+	// limits are the resource limits of the last container or build.
+	limits []string
+	// oom makes containers report being killed for running out of memory.
+	oom bool
+	// crash makes docker build fail with exit code 137 without running out of
+	// memory.
+	crash bool
+	// hang makes slugbuilder and docker build run until they are stopped.
+	hang    bool
+	stopped chan bool
+}
+
+func (d *fakeDocker) call(name, args string) error {
+	d.mu.Lock()
+	d.calls = append(d.calls, strings.TrimSpace(name+" "+args))
+	d.mu.Unlock()
+	if d.fail == name {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+// recorded returns the calls made so far.
+func (d *fakeDocker) recorded() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.calls...)
+}
+
+func (d *fakeDocker) Run(image string, env, volumes, limits []string) (string, error) {
+	d.env = env
+	d.limits = limits
+	d.stopped = make(chan bool)
+	return "abc123", d.call("run", image)
+}
+
+func (d *fakeDocker) Attach(id string, out io.Writer) error {
+	fmt.Fprintln(out, "-----> Compiling")
+	err := d.call("attach", id)
+	if d.hang {
+		<-d.stopped
+		return errors.New("killed")
+	}
+	return err
+}
+
+func (d *fakeDocker) OOMKilled(id string) (bool, error) {
+	return d.oom && id != "", nil
+}
+
+func (d *fakeDocker) CopyFrom(id, src, dest string) error {
+	if err := d.call("cp", id+":"+src); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dest, filepath.Base(src)), d.slug, 0644)
+}
+
+func (d *fakeDocker) Remove(id string) error {
+	if d.hang {
+		close(d.stopped)
+	}
+	return d.call("rm", id)
+}
+
+func (d *fakeDocker) Build(dir, tag string, noCache bool, limits []string, out io.Writer, stop <-chan bool) error {
+	d.limits = limits
+	err := d.call("build", fmt.Sprintf("%s %t", tag, noCache))
+	if d.hang {
+		<-stop
+		return errors.New("interrupted")
+	}
+	if d.oom || d.crash {
+		fmt.Fprintln(out, "Step 2 : RUN make")
+		fmt.Fprintln(out, " ---> Running in 0123abcd")
+		fmt.Fprintln(out, "The command '/bin/sh -c make' returned a non-zero code: 137")
+		return errors.New("exit status 1")
+	}
+	return err
+}
+
+func (d *fakeDocker) Push(tag string) error {
+	return d.call("push", tag)
+}
+
+// fakeController serves the controller's builder hooks.
+func fakeController(t *testing.T, hooks chan *BuildHook) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Deis-Builder-Auth") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/hooks/config":
+			w.Write([]byte(`{"owner": "bob", "app": "myapp", "values": {"FOO": "bar", "DEBUG": true}}`))
+		case "/v1/hooks/build":
+			var hook BuildHook
+			if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+				t.Errorf("Invalid build hook: %s", err)
+			}
+			hooks <- &hook
+			w.Write([]byte(`{"release": {"version": 3}, "domains": ["myapp.example.com"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// testBuild creates a build with the given source files already checked out.
+func testBuild(t *testing.T, files map[string]string, d Docker, ctrl Controller) *Build {
+	home, err := ioutil.TempDir("", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &Build{
+		User:       "bob",
+		Repo:       "myapp.git",
+		Sha:        "0123456789abcdef",
+		App:        "myapp",
+		UUID:       "de1e7e5",
+		Options:    map[string]string{},
+		Registry:   "10.0.0.1:5000",
+		RepoDir:    filepath.Join(home, "myapp.git"),
+		SourceDir:  filepath.Join(home, "src"),
+		CacheDir:   filepath.Join(home, "cache"),
+		Out:        &bytes.Buffer{},
+		Docker:     d,
+		Controller: ctrl,
+	}
+	for _, dir := range []string{b.SourceDir, b.CacheDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(b.SourceDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+// runSteps runs every step of the "build" route after PrepareBuild.
+func runSteps(b *Build) (cookoo.Context, error) {
+	reg, router, cxt := cookoo.Cookoo()
+	cxt.Put("b", b)
+	reg.Route("test", "Test route").
+		Does(FetchConfig, "config").Using("build").From("cxt:b").
+		Does(Slugbuild, "slugbuild").Using("build").From("cxt:b").
+		Does(BuildImage, "image").Using("build").From("cxt:b").
+		Does(PushImage, "push").Using("build").From("cxt:b").
+		Does(DetectProcfile, "procfile").Using("build").From("cxt:b").
+		Does(PublishBuild, "release").Using("build").From("cxt:b")
+	err := router.HandleRequest("test", cxt, false)
+	return cxt, err
+}
+
+// slug creates a gzipped slug tarball containing the given files.
+func slug(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestBuildSlug(t *testing.T) {
+	slugGroup = os.Getgid()
+	hooks := make(chan *BuildHook, 1)
+	ts := fakeController(t, hooks)
+	defer ts.Close()
+
+	d := &fakeDocker{slug: slug(t, map[string]string{"./.release": "default_process_types:\n  web: bin/web\n"})}
+	b := testBuild(t, map[string]string{"main.go": "package main"}, d, NewControllerClient(ts.URL, "secret"))
+	b.Options["buildpack"] = "https://github.com/heroku/heroku-buildpack-go"
+	defer os.RemoveAll(filepath.Dir(b.SourceDir))
+
+	if _, err := runSteps(b); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"run deis/slugbuilder",
+		"attach abc123",
+		"cp abc123:/tmp/slug.tgz",
+		"build 10.0.0.1:5000/myapp:git-01234567 false",
+		"push 10.0.0.1:5000/myapp:git-01234567",
+	}
+	if calls := d.recorded(); !reflect.DeepEqual(calls, expect) {
+		t.Errorf("Expected docker calls %v, got %v", expect, calls)
+	}
+	expectEnv := []string{"DEBUG=true", "FOO=bar", "SOURCE_VERSION=0123456789abcdef", "BUILDPACK_URL=https://github.com/heroku/heroku-buildpack-go"}
+	if !reflect.DeepEqual(d.env, expectEnv) {
+		t.Errorf("Expected slugbuilder env %v, got %v", expectEnv, d.env)
+	}
+
+	dockerfile, _ := ioutil.ReadFile(filepath.Join(b.SourceDir, "Dockerfile"))
+	if string(dockerfile) != "FROM deis/slugrunner\n\nENV GIT_SHA 0123456789abcdef\n" {
+		t.Errorf("Unexpected Dockerfile %q", dockerfile)
+	}
+
+	hook := <-hooks
+	if hook.Sha != "01234567" || hook.ReceiveRepo != "myapp" || hook.Image != "myapp" || hook.Dockerfile != "" || hook.UUID != "de1e7e5" {
+		t.Errorf("Unexpected build hook %+v", hook)
+	}
+	if !reflect.DeepEqual(hook.Procfile, ProcessType{"web": "bin/web"}) {
+		t.Errorf("Expected the default process types from the slug, got %v", hook.Procfile)
+	}
+	out := b.Out.(*bytes.Buffer).String()
+	for _, line := range []string{"-----> Compiling", "done, myapp:v3 deployed to Deis", "http://myapp.example.com"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Expected output to contain %q:\n%s", line, out)
+		}
+	}
+
+	steps := []string{}
+	for _, timing := range b.Timings {
+		steps = append(steps, timing.Step)
+	}
+	expectSteps := []string{StepConfig, StepSlugbuild, StepImage, StepPush, StepProcfile, StepRelease}
+	if !reflect.DeepEqual(steps, expectSteps) {
+		t.Errorf("Expected timings for %v, got %v", expectSteps, steps)
+	}
+}
+
+func TestBuildDockerfile(t *testing.T) {
+	hooks := make(chan *BuildHook, 1)
+	ts := fakeController(t, hooks)
+	defer ts.Close()
+
+	d := &fakeDocker{}
+	b := testBuild(t, map[string]string{
+		"Dockerfile": "FROM alpine",
+		"Procfile":   "web: ./server\nworker: ./worker\n",
+	}, d, NewControllerClient(ts.URL, "secret"))
+	b.Options["no-cache"] = "true"
+	defer os.RemoveAll(filepath.Dir(b.SourceDir))
+
+	if _, err := runSteps(b); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"build 10.0.0.1:5000/myapp:git-01234567 true", "push 10.0.0.1:5000/myapp:git-01234567"}
+	if calls := d.recorded(); !reflect.DeepEqual(calls, expect) {
+		t.Errorf("Expected docker calls %v, got %v", expect, calls)
+	}
+
+	hook := <-hooks
+	if hook.Dockerfile != "true" {
+		t.Errorf("Expected a Dockerfile build, got %q", hook.Dockerfile)
+	}
+	if !reflect.DeepEqual(hook.Procfile, ProcessType{"web": "./server", "worker": "./worker"}) {
+		t.Errorf("Expected the process types from the Procfile, got %v", hook.Procfile)
+	}
+	if hook.PushOptions["no-cache"] != "true" {
+		t.Errorf("Expected the push options to be passed on, got %v", hook.PushOptions)
+	}
+}
+
+func TestBuildNoDeploy(t *testing.T) {
+	hooks := make(chan *BuildHook, 1)
+	ts := fakeController(t, hooks)
+	defer ts.Close()
+
+	b := testBuild(t, map[string]string{"Dockerfile": "FROM alpine"}, &fakeDocker{}, NewControllerClient(ts.URL, "secret"))
+	b.Options["no-deploy"] = "true"
+	defer os.RemoveAll(filepath.Dir(b.SourceDir))
+
+	cxt, err := runSteps(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) > 0 {
+		t.Error("Expected the build not to be released")
+	}
+	if res := cxt.Get("release", nil); res != nil {
+		t.Errorf("Expected no release, got %v", res)
+	}
+}
+
+func TestBuildStepErrors(t *testing.T) {
+	hooks := make(chan *BuildHook, 1)
+	ts := fakeController(t, hooks)
+	defer ts.Close()
+
+	tests := []struct {
+		ctrl Controller
+		fail string
+		step string
+	}{
+		{NewControllerClient(ts.URL, "wrong"), "", StepConfig},
+		{NewControllerClient(ts.URL, "secret"), "build", StepImage},
+		{NewControllerClient(ts.URL, "secret"), "push", StepPush},
+	}
+	for _, tt := range tests {
+		d := &fakeDocker{fail: tt.fail}
+		b := testBuild(t, map[string]string{"Dockerfile": "FROM alpine"}, d, tt.ctrl)
+		_, err := runSteps(b)
+		os.RemoveAll(filepath.Dir(b.SourceDir))
+
+		serr, ok := err.(*StepError)
+		if !ok {
+			t.Errorf("Expected a *StepError from step %s, got %v", tt.step, err)
+			continue
+		}
+		if serr.Step != tt.step {
+			t.Errorf("Expected step %s to fail, got %s", tt.step, serr.Step)
+		}
+	}
+	if len(hooks) > 0 {
+		t.Error("Expected failed builds not to be released")
+	}
+}
+
+func TestBuildLimits(t *testing.T) {
+	slugGroup = os.Getgid()
+	ts := fakeController(t, make(chan *BuildHook, 4))
+	defer ts.Close()
+
+	limits := &Limits{Memory: "512m", CPUShares: 512, Timeout: 50 * time.Millisecond}
+	tests := []struct {
+		files map[string]string
+		d     *fakeDocker
+		limit string
+	}{
+		{map[string]string{"main.go": "package main"}, &fakeDocker{hang: true}, LimitTimeout},
+		{map[string]string{"main.go": "package main"}, &fakeDocker{oom: true, fail: "attach"}, LimitMemory},
+		{map[string]string{"Dockerfile": "FROM alpine"}, &fakeDocker{hang: true}, LimitTimeout},
+		{map[string]string{"Dockerfile": "FROM alpine"}, &fakeDocker{oom: true}, LimitMemory},
+	}
+	for i, tt := range tests {
+		b := testBuild(t, tt.files, tt.d, NewControllerClient(ts.URL, "secret"))
+		b.Limits = limits
+		b.started = time.Now()
+		_, err := runSteps(b)
+		os.RemoveAll(filepath.Dir(b.SourceDir))
+
+		serr, ok := err.(*StepError)
+		if !ok {
+			t.Errorf("%d: Expected a *StepError, got %v", i, err)
+			continue
+		}
+		if lerr, ok := serr.Err.(*LimitError); !ok || lerr.Limit != tt.limit {
+			t.Errorf("%d: Expected the %s limit to be exceeded, got %v", i, tt.limit, serr.Err)
+		}
+		expect := []string{"--memory=512m", "--memory-swap=512m", "--cpu-shares=512"}
+		if !reflect.DeepEqual(tt.d.limits, expect) {
+			t.Errorf("%d: Expected limits %v, got %v", i, expect, tt.d.limits)
+		}
+	}
+
+	// A build killed for another reason exits with the same code.
+	b := testBuild(t, map[string]string{"Dockerfile": "FROM alpine"}, &fakeDocker{crash: true}, NewControllerClient(ts.URL, "secret"))
+	b.Limits = limits
+	b.started = time.Now()
+	_, err := runSteps(b)
+	os.RemoveAll(filepath.Dir(b.SourceDir))
+	if serr, ok := err.(*StepError); !ok {
+		t.Errorf("Expected a *StepError, got %v", err)
+	} else if _, ok := serr.Err.(*LimitError); ok {
+		t.Errorf("Expected no limit to be exceeded, got %v", serr.Err)
+	}
+}
+
+func TestLoadLimits(t *testing.T) {
+	values := map[string]string{
+		"/deis/builder/buildMemory":             "1G",
+		"/deis/builder/buildTimeout":            "20m",
+		"/deis/builder/apps/myapp/buildMemory":  "2g",
+		"/deis/builder/apps/myapp/buildTimeout": "0",
+		"/deis/builder/apps/bad/buildCPUShares": "lots",
+	}
+	lookup := func(key string) (string, error) {
+		if v, ok := values[key]; ok {
+			return v, nil
+		}
+		return "", errors.New("key not found")
+	}
+
+	tests := map[string]*Limits{
+		"myapp": {Memory: "2g"},
+		"other": {Memory: "1g", Timeout: 20 * time.Minute},
+	}
+	for app, expect := range tests {
+		l, err := loadLimits(lookup, app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(l, expect) {
+			t.Errorf("Expected limits %+v for %s, got %+v", expect, app, l)
+		}
+	}
+	if _, err := loadLimits(lookup, "bad"); err == nil {
+		t.Error("Expected an error for an invalid limit")
+	}
+	if l, _ := loadLimits(func(string) (string, error) { return "", errors.New("key not found") }, "myapp"); l.Timeout != time.Hour {
+		t.Errorf("Expected the default timeout, got %s", l.Timeout)
+	}
+}
+
+func TestArchiveSlug(t *testing.T) {
+	b := testBuild(t, nil, &fakeDocker{}, nil)
+	defer os.RemoveAll(filepath.Dir(b.SourceDir))
+	store := slugs.NewStore(filepath.Join(filepath.Dir(b.SourceDir), "slugs"), 0)
+
+	reg, router, cxt := cookoo.Cookoo()
+	reg.Route("test", "Test route").
+		Does(ArchiveSlug, "archive").Using("build").WithDefault(b).Using("slugs").WithDefault(store)
+
+	// Dockerfile builds have no slug to keep.
+	if err := router.HandleRequest("test", cxt, false); err != nil || cxt.Get("archive", nil) != false {
+		t.Errorf("Expected no slug to be kept, got %v (%v)", cxt.Get("archive", nil), err)
+	}
+
+	b.Slug = filepath.Join(b.SourceDir, "slug.tgz")
+	ioutil.WriteFile(b.Slug, []byte("slug"), 0644)
+	if err := router.HandleRequest("test", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+	f, err := store.Open("myapp", b.UUID)
+	if err != nil {
+		t.Fatalf("Expected the slug to be kept: %s", err)
+	}
+	f.Close()
+}
+
+func TestDetectProcfileFromSlug(t *testing.T) {
+	d := &fakeDocker{}
+	b := testBuild(t, nil, d, nil)
+	defer os.RemoveAll(filepath.Dir(b.SourceDir))
+	b.Slug = filepath.Join(b.SourceDir, "slug.tgz")
+	ioutil.WriteFile(b.Slug, slug(t, map[string]string{
+		"./Procfile": "web: bin/server\n",
+		"./.release": "default_process_types:\n  web: bin/web\n",
+	}), 0644)
+
+	reg, router, cxt := cookoo.Cookoo()
+	reg.Route("test", "Test route").Does(DetectProcfile, "procfile").Using("build").WithDefault(b)
+	if err := router.HandleRequest("test", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+	// A Procfile generated by the buildpack wins over bin/release.
+	if procfile := cxt.Get("procfile", nil).(ProcessType); !reflect.DeepEqual(procfile, ProcessType{"web": "bin/server"}) {
+		t.Errorf("Expected the slug's Procfile, got %v", procfile)
+	}
+}
+
+// gitHome creates a git home with a myapp.git repository, and returns the
+// home and the pushed commit.
+func gitHome(t *testing.T) (string, string) {
+	home, err := ioutil.TempDir("", "githome")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := filepath.Join(home, "myapp.git")
+	work := filepath.Join(home, "work")
+	os.MkdirAll(work, 0755)
+	ioutil.WriteFile(filepath.Join(work, "Procfile"), []byte("web: ./server\n"), 0644)
+	script := fmt.Sprintf(`git init -q --bare %[1]s &&
+		git init -q && git add . &&
+		git -c user.name=test -c user.email=test@example.com commit -q -m init &&
+		git push -q %[1]s HEAD:master && git rev-parse HEAD`, repo)
+	cmd := exec.Command("sh", "-c", script)
+	cmd.Dir = work
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		os.RemoveAll(home)
+		t.Skipf("Could not create a git repository: %s %s", err, out)
+	}
+	return home, strings.TrimSpace(string(out))
+}
+
+// prepare runs PrepareBuild for a push of sha to myapp.
+func prepare(t *testing.T, home, sha string, options map[string]string) *Build {
+	reg, router, cxt := cookoo.Cookoo()
+	reg.Route("test", "Test route").
+		Does(PrepareBuild, "build").
+		Using("user").WithDefault("bob").
+		Using("repo").WithDefault("myapp.git").
+		Using("sha").WithDefault(sha).
+		Using("app").WithDefault("myapp").
+		Using("options").WithDefault(options).
+		Using("gitHome").WithDefault(home).
+		Using("registry").WithDefault("10.0.0.1:5000").
+		Using("docker").WithDefault(&fakeDocker{}).
+		Using("controller").WithDefault(NewControllerClient("http://localhost", "secret"))
+	if err := router.HandleRequest("test", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+	return cxt.Get("build", nil).(*Build)
+}
+
+func TestPrepareBuild(t *testing.T) {
+	home, sha := gitHome(t)
+	defer os.RemoveAll(home)
+
+	b := prepare(t, home, sha, map[string]string{"no-cache": "true"})
+	if _, err := os.Stat(filepath.Join(b.SourceDir, "Procfile")); err != nil {
+		t.Errorf("Expected the pushed code to be checked out: %s", err)
+	}
+	if b.CacheDir == filepath.Join(home, "cache", "myapp") {
+		t.Error("Expected a temporary cache for a no-cache build")
+	}
+
+	b.Cleanup()
+	for _, dir := range []string{b.SourceDir, b.CacheDir} {
+		if _, err := os.Stat(dir); err == nil {
+			t.Errorf("Expected %s to be removed", dir)
+		}
+	}
+}
+
+func TestPrepareBuildCache(t *testing.T) {
+	home, sha := gitHome(t)
+	defer os.RemoveAll(home)
+
+	// Older builders kept the cache in the repository.
+	legacy := filepath.Join(home, "myapp.git", "cache")
+	os.MkdirAll(legacy, 0755)
+	ioutil.WriteFile(filepath.Join(legacy, "vendor"), []byte("gems"), 0644)
+
+	b := prepare(t, home, sha, map[string]string{})
+	if b.CacheDir != filepath.Join(home, "cache", "myapp") {
+		t.Errorf("Expected the app's cache, got %s", b.CacheDir)
+	}
+	if _, err := os.Stat(filepath.Join(b.CacheDir, "vendor")); err != nil {
+		t.Errorf("Expected the old cache to be migrated: %s", err)
+	}
+	if u, err := b.Caches.Stat("myapp"); err != nil || !u.InUse {
+		t.Errorf("Expected the cache to be in use during the build, got %+v (%v)", u, err)
+	}
+	b.Cleanup()
+	if u, err := b.Caches.Stat("myapp"); err != nil || u.InUse {
+		t.Errorf("Expected the cache to be kept and released, got %+v (%v)", u, err)
+	}
+
+	b = prepare(t, home, sha, map[string]string{"reset-cache": "true"})
+	defer b.Cleanup()
+	if _, err := os.Stat(filepath.Join(b.CacheDir, "vendor")); err == nil {
+		t.Error("Expected the cache to be reset")
+	}
+}
+
+func TestBuildEvent(t *testing.T) {
+	b := testBuild(t, nil, &fakeDocker{}, nil)
+	defer os.RemoveAll(filepath.Dir(b.RepoDir))
+	b.Timings = []Timing{{StepSlugbuild, 3 * time.Second}, {StepPush, time.Second}}
+	b.Release = &BuildHookResponse{Release: map[string]int{"version": 4}}
+
+	e := b.Event(nil)
+	if e.Type != webhook.Succeeded || e.Duration != 4 || e.Release != 4 || e.Image != "10.0.0.1:5000/myapp:git-01234567" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+
+	e = b.Event(&StepError{Step: StepPush, Err: errors.New("boom")})
+	if e.Type != webhook.Failed || e.Image != "" || e.Error != "push failed: boom" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
+
+func TestPostEvent(t *testing.T) {
+	events := make(chan *webhook.Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Deis-Builder-Auth") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var e webhook.Event
+		json.NewDecoder(r.Body).Decode(&e)
+		events <- &e
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	reg, router, cxt := cookoo.Cookoo()
+	reg.Route("test", "Test route").
+		Does(CreateEventPoster, "events").
+		Using("url").WithDefault(server.URL+"/events").
+		Using("key").WithDefault("secret").
+		Does(PostEvent, "started").
+		Using("events").From("cxt:events").
+		Using("user").WithDefault("bob").
+		Using("app").WithDefault("myapp").
+		Using("sha").WithDefault("abc123")
+	if err := router.HandleRequest("test", cxt, false); err != nil {
+		t.Fatal(err)
+	}
+
+	e := <-events
+	if e.Type != webhook.Started || e.App != "myapp" || e.User != "bob" || e.Sha != "abc123" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
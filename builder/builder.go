@@ -41,6 +41,10 @@ func Run(cmd string) int {
 	// Build the routes. See routes.go.
 	routes(reg)
 
+	// The shutdown route may stop the SSH service as soon as boot has set up
+	// the signal handler, before Serve runs.
+	sshd.PutCloser(cxt)
+
 	// Bootstrap the background services. If this fails, we stop.
 	if err := router.HandleRequest("boot", cxt, false); err != nil {
 		clog.Errf(cxt, "Fatal errror on boot: %s", err)
@@ -66,6 +70,11 @@ func Run(cmd string) int {
 	cxt.Put("route.sshd.sshPing", "sshPing")
 	cxt.Put("route.sshd.sshGitReceive", "sshGitReceive")
 
+	// Count SSH connections in the builder's metrics.
+	if m, ok := cxt.Get("monitor", nil).(sshd.ConnCounter); ok {
+		cxt.Put(sshd.Conns, m)
+	}
+
 	// Start the SSH service.
 	// TODO: We could refactor Serve to be a command, and then run this as
 	// a route.
@@ -74,5 +83,12 @@ func Run(cmd string) int {
 		return StatusLocalError
 	}
 
+	// Serve only returns without an error once the shutdown route stopped
+	// the SSH service, but pushes may still be running. Wait for the rest of
+	// the shutdown.
+	if done, ok := cxt.Get("stopped", nil).(chan bool); ok {
+		<-done
+	}
+
 	return StatusOk
 }
@@ -0,0 +1,187 @@
+// Package buildlog persists the output of builds.
+//
+// Every build writes its output to a log file named after the application and
+// the build's UUID. While the build runs, the writer holds an exclusive lock
+// on the file. Readers use the lock to tell running builds from finished ones,
+// so a log can be followed until its build ends, even if the build crashes.
+package buildlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultDir is the directory the builder stores logs in.
+const DefaultDir = "/home/git/logs"
+
+// DefaultKeep is the number of logs kept per application by default.
+const DefaultKeep = 20
+
+// ErrNotFound indicates that there is no log for a build.
+var ErrNotFound = errors.New("build log not found")
+
+var legalName = regexp.MustCompile(`^[a-z0-9][-a-z0-9]*$`)
+
+// Store is a directory of build logs.
+//
+// Logs are stored as $Dir/$app/$uuid.log.
+type Store struct {
+	Dir string
+	// Keep is the number of logs kept per application. Zero keeps all logs.
+	Keep int
+	// Poll is how often Follow checks a running build for new output.
+	Poll time.Duration
+}
+
+// NewStore creates a new log store.
+func NewStore(dir string, keep int) *Store {
+	return &Store{Dir: dir, Keep: keep, Poll: 500 * time.Millisecond}
+}
+
+// path returns the path to the log for an app's build.
+func (s *Store) path(app, id string) (string, error) {
+	if !legalName.MatchString(app) {
+		return "", fmt.Errorf("Illegal application name %q", app)
+	}
+	if !legalName.MatchString(id) {
+		return "", fmt.Errorf("Illegal build ID %q", id)
+	}
+	return filepath.Join(s.Dir, app, id+".log"), nil
+}
+
+// Create creates the log for a new build, and locks it until it is closed.
+func (s *Store) Create(app, id string) (*os.File, error) {
+	p, err := s.path(app, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Open opens the log of a build for reading.
+//
+// It returns ErrNotFound if there is no such log.
+func (s *Store) Open(app, id string) (*os.File, error) {
+	p, err := s.path(app, id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Running returns true if the build writing to an open log is still running.
+func Running(f *os.File) bool {
+	fd := int(f.Fd())
+	if err := syscall.Flock(fd, syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		return true
+	}
+	syscall.Flock(fd, syscall.LOCK_UN)
+	return false
+}
+
+// Follow copies the log of a build to out.
+//
+// If the build is running, Follow keeps copying its output until it ends, or
+// until stop is closed. flush, if not nil, is called whenever Follow has
+// copied everything written so far.
+func (s *Store) Follow(out io.Writer, app, id string, flush func(), stop <-chan bool) error {
+	f, err := s.Open(app, id)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for {
+		// Check before copying, so that output written just before the
+		// build ended is not lost.
+		running := Running(f)
+		if _, err := io.Copy(out, f); err != nil {
+			return err
+		}
+		if flush != nil {
+			flush()
+		}
+		if !running {
+			return nil
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(s.Poll):
+		}
+	}
+}
+
+// Prune removes the oldest finished logs of an app, keeping the newest Keep logs.
+func (s *Store) Prune(app string) error {
+	if s.Keep <= 0 {
+		return nil
+	}
+	if !legalName.MatchString(app) {
+		return fmt.Errorf("Illegal application name %q", app)
+	}
+	dir := filepath.Join(s.Dir, app)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	logs := make([]os.FileInfo, 0, len(infos))
+	for _, fi := range infos {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".log") {
+			logs = append(logs, fi)
+		}
+	}
+	if len(logs) <= s.Keep {
+		return nil
+	}
+	sort.Sort(byAge(logs))
+
+	for _, fi := range logs[:len(logs)-s.Keep] {
+		p := filepath.Join(dir, fi.Name())
+		f, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		running := Running(f)
+		f.Close()
+		if !running {
+			os.Remove(p)
+		}
+	}
+	return nil
+}
+
+// byAge sorts files from oldest to newest.
+type byAge []os.FileInfo
+
+func (b byAge) Len() int           { return len(b) }
+func (b byAge) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byAge) Less(i, j int) bool { return b[i].ModTime().Before(b[j].ModTime()) }
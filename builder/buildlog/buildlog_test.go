@@ -0,0 +1,142 @@
+package buildlog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempStore(t *testing.T, keep int) *Store {
+	dir, err := ioutil.TempDir("", "buildlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewStore(dir, keep)
+	s.Poll = 10 * time.Millisecond
+	return s
+}
+
+func TestCreateAndOpen(t *testing.T) {
+	s := tempStore(t, 0)
+	defer os.RemoveAll(s.Dir)
+
+	w, err := s.Create("myapp", "1234-abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("-----> Building\n"))
+
+	r, err := s.Open("myapp", "1234-abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if !Running(r) {
+		t.Error("Expected build to be running while its log is open")
+	}
+
+	w.Close()
+	if Running(r) {
+		t.Error("Expected build to be finished after its log is closed")
+	}
+
+	if _, err := s.Create("myapp", "1234-abcd"); err == nil {
+		t.Error("Expected an error creating an existing log")
+	}
+	if _, err := s.Open("myapp", "nope"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	for _, bad := range [][2]string{{"../etc", "x"}, {"myapp", "../../passwd"}, {"", "x"}} {
+		if _, err := s.Open(bad[0], bad[1]); err == nil || err == ErrNotFound {
+			t.Errorf("Expected illegal name error for %v, got %v", bad, err)
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	s := tempStore(t, 0)
+	defer os.RemoveAll(s.Dir)
+
+	w, err := s.Create("myapp", "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("first\n"))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("second\n"))
+		w.Close()
+	}()
+
+	var out bytes.Buffer
+	if err := s.Follow(&out, "myapp", "abcd", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "first\nsecond\n" {
+		t.Errorf("Expected the whole log, got %q", out.String())
+	}
+}
+
+func TestFollowStop(t *testing.T) {
+	s := tempStore(t, 0)
+	defer os.RemoveAll(s.Dir)
+
+	w, err := s.Create("myapp", "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	stop := make(chan bool)
+	done := make(chan error)
+	go func() { done <- s.Follow(ioutil.Discard, "myapp", "abcd", nil, stop) }()
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Follow to return when stopped")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	s := tempStore(t, 2)
+	defer os.RemoveAll(s.Dir)
+
+	// The oldest build is still running, so it must survive.
+	running, err := s.Create("myapp", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer running.Close()
+
+	base := time.Now().Add(-time.Hour)
+	for i, id := range []string{"a", "b", "c", "d"} {
+		if id != "a" {
+			f, err := s.Create("myapp", id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+		}
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(filepath.Join(s.Dir, "myapp", id+".log"), mtime, mtime)
+	}
+
+	if err := s.Prune("myapp"); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, exists := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		_, err := os.Stat(filepath.Join(s.Dir, "myapp", id+".log"))
+		if exists && err != nil {
+			t.Errorf("Expected log %s to be kept: %s", id, err)
+		} else if !exists && err == nil {
+			t.Errorf("Expected log %s to be pruned", id)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Package cache manages the build caches of applications.
+//
+// Slug builds mount their application's cache into slugbuilder, so that
+// buildpacks can reuse what they downloaded and compiled in earlier builds.
+// Caches are stored as $Dir/$app. While a build uses a cache, it holds an
+// exclusive lock on $Dir/$app.lock, which keeps the cache from being evicted
+// or purged under it.
+//
+// The total size of all caches is kept under a budget by evicting the least
+// recently used caches.
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Masterminds/cookoo"
+	"github.com/Masterminds/cookoo/log"
+)
+
+// DefaultDir is the directory the builder stores caches in.
+const DefaultDir = "/home/git/cache"
+
+// DefaultBudget is the default total size of all caches.
+const DefaultBudget = "10G"
+
+// ErrNotFound indicates that an application has no cache.
+var ErrNotFound = errors.New("build cache not found")
+
+// ErrInUse indicates that a build is using a cache.
+var ErrInUse = errors.New("build cache is in use by a running build")
+
+var legalName = regexp.MustCompile(`^[a-z0-9][-a-z0-9]*$`)
+
+// Store is a directory of build caches.
+type Store struct {
+	Dir string
+	// Budget is the total size, in bytes, of all caches. Zero means unlimited.
+	Budget int64
+}
+
+// NewStore creates a new cache store.
+func NewStore(dir string, budget int64) *Store {
+	return &Store{Dir: dir, Budget: budget}
+}
+
+// CreateStore creates a new cache store.
+//
+// Params:
+// 	- dir (string): The directory caches are stored in.
+// 	- budget (string): The total size of all caches, e.g. "10G". "0" means unlimited.
+//
+// Returns:
+// 	- *Store
+func CreateStore(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	dir := p.Get("dir", DefaultDir).(string)
+	budget, err := ParseSize(p.Get("budget", DefaultBudget).(string))
+	if err != nil {
+		log.Errf(c, "Illegal build cache budget, not limiting caches: %s", err)
+	}
+	return NewStore(dir, budget), nil
+}
+
+// ParseSize parses a size in bytes, with an optional K, M, G or T suffix.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	mult := int64(1)
+	if i := strings.IndexAny(s, "KMGT"); i >= 0 && i == len(s)-1 {
+		mult = 1 << (10 * uint(strings.Index("KMGT", s[i:])+1))
+		s = s[:i]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Illegal size %q", s)
+	}
+	return n * mult, nil
+}
+
+// Usage describes an application's cache.
+type Usage struct {
+	App string `json:"app"`
+	// Size is the size of the cache in bytes.
+	Size int64 `json:"size"`
+	// LastUsed is when a build last finished using the cache.
+	LastUsed time.Time `json:"last_used"`
+	// InUse is true while a build is using the cache.
+	InUse bool `json:"in_use"`
+}
+
+// Lock is a build's hold on a cache.
+type Lock struct {
+	// Dir is the cache directory.
+	Dir string
+	f   *os.File
+}
+
+// Release marks the cache as used now, and releases it.
+func (l *Lock) Release() error {
+	now := time.Now()
+	os.Chtimes(l.Dir, now, now)
+	syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	return l.f.Close()
+}
+
+func (s *Store) path(app string) (string, error) {
+	if !legalName.MatchString(app) {
+		return "", fmt.Errorf("Illegal application name %q", app)
+	}
+	return filepath.Join(s.Dir, app), nil
+}
+
+// lock locks an application's cache. If wait is false and the cache is
+// locked, it returns ErrInUse.
+func (s *Store) lock(app string, wait bool) (*Lock, error) {
+	dir, err := s.path(app)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(dir+".lock", os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, ErrInUse
+		}
+		return nil, err
+	}
+	return &Lock{Dir: dir, f: f}, nil
+}
+
+// Acquire locks an application's cache for a build, creating it if needed.
+// It waits for any other build using the cache to release it.
+func (s *Store) Acquire(app string) (*Lock, error) {
+	l, err := s.lock(app, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		l.Release()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Stat describes an application's cache.
+//
+// It returns ErrNotFound if the application has no cache.
+func (s *Store) Stat(app string) (*Usage, error) {
+	dir, err := s.path(app)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	u := &Usage{App: app, LastUsed: fi.ModTime()}
+	if u.Size, err = dirSize(dir); err != nil {
+		return nil, err
+	}
+	if l, err := s.lock(app, false); err == ErrInUse {
+		u.InUse = true
+	} else if err == nil {
+		l.f.Close()
+	}
+	return u, nil
+}
+
+// List describes all caches.
+func (s *Store) List() ([]*Usage, error) {
+	infos, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return []*Usage{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	caches := []*Usage{}
+	for _, fi := range infos {
+		if !fi.IsDir() || !legalName.MatchString(fi.Name()) {
+			continue
+		}
+		u, err := s.Stat(fi.Name())
+		if err != nil {
+			continue
+		}
+		caches = append(caches, u)
+	}
+	return caches, nil
+}
+
+// Purge removes an application's cache.
+//
+// It returns ErrInUse if a build is using the cache.
+func (s *Store) Purge(app string) error {
+	l, err := s.lock(app, false)
+	if err != nil {
+		return err
+	}
+	defer l.f.Close()
+	if _, err := os.Stat(l.Dir); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return os.RemoveAll(l.Dir)
+}
+
+// Trim evicts the least recently used caches until all caches fit in the
+// budget. Caches in use are never evicted. It returns the evicted caches.
+func (s *Store) Trim() ([]*Usage, error) {
+	evicted := []*Usage{}
+	if s.Budget <= 0 {
+		return evicted, nil
+	}
+	caches, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, u := range caches {
+		total += u.Size
+	}
+	sort.Sort(byLastUsed(caches))
+	for _, u := range caches {
+		if total <= s.Budget {
+			break
+		}
+		if u.InUse {
+			continue
+		}
+		if err := s.Purge(u.App); err != nil {
+			continue
+		}
+		total -= u.Size
+		evicted = append(evicted, u)
+	}
+	return evicted, nil
+}
+
+// dirSize returns the total size of the files in a directory.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Buildpacks may leave files behind that vanish or are unreadable.
+			return nil
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// byLastUsed sorts caches from least to most recently used.
+type byLastUsed []*Usage
+
+func (b byLastUsed) Len() int           { return len(b) }
+func (b byLastUsed) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byLastUsed) Less(i, j int) bool { return b[i].LastUsed.Before(b[j].LastUsed) }
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempStore(t *testing.T, budget int64) *Store {
+	dir, err := ioutil.TempDir("", "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(dir, budget)
+}
+
+// fill creates a released cache of the given size, last used at the given time.
+func fill(t *testing.T, s *Store, app string, size int, used time.Time) {
+	l, err := s.Acquire(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(l.Dir, "blob"), make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l.Release()
+	os.Chtimes(l.Dir, used, used)
+}
+
+func TestParseSize(t *testing.T) {
+	for in, expect := range map[string]int64{"0": 0, "512": 512, "2K": 2048, "10G": 10 << 30, "1gb": 1 << 30} {
+		if n, err := ParseSize(in); err != nil || n != expect {
+			t.Errorf("Expected %s to be %d bytes, got %d (%v)", in, expect, n, err)
+		}
+	}
+	for _, bad := range []string{"", "G", "-1", "10X"} {
+		if _, err := ParseSize(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestAcquireAndStat(t *testing.T) {
+	s := tempStore(t, 0)
+	defer os.RemoveAll(s.Dir)
+
+	if _, err := s.Stat("myapp"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	l, err := s.Acquire("myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(l.Dir, "blob"), make([]byte, 100), 0644)
+
+	u, err := s.Stat("myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Size != 100 || !u.InUse {
+		t.Errorf("Expected 100 bytes in use, got %+v", u)
+	}
+	if err := s.Purge("myapp"); err != ErrInUse {
+		t.Errorf("Expected ErrInUse purging a cache in use, got %v", err)
+	}
+
+	l.Release()
+	if u, _ := s.Stat("myapp"); u.InUse {
+		t.Error("Expected the cache to be released")
+	}
+	if err := s.Purge("myapp"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat("myapp"); err != ErrNotFound {
+		t.Errorf("Expected the cache to be purged, got %v", err)
+	}
+	if _, err := s.Acquire("../etc"); err == nil {
+		t.Error("Expected an illegal name error")
+	}
+}
+
+func TestTrim(t *testing.T) {
+	s := tempStore(t, 250)
+	defer os.RemoveAll(s.Dir)
+
+	base := time.Now().Add(-time.Hour)
+	fill(t, s, "oldest", 100, base)
+	fill(t, s, "old", 100, base.Add(time.Minute))
+	fill(t, s, "new", 100, base.Add(2*time.Minute))
+
+	// The oldest cache is in use, so the next oldest must go instead.
+	l, err := s.Acquire("oldest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release()
+
+	evicted, err := s.Trim()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evicted) != 1 || evicted[0].App != "old" {
+		t.Errorf("Expected only the old cache to be evicted, got %v", evicted)
+	}
+	caches, _ := s.List()
+	if len(caches) != 2 {
+		t.Errorf("Expected two caches to remain, got %d", len(caches))
+	}
+}
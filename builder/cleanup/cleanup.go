@@ -0,0 +1,264 @@
+// Package cleanup removes what the builder keeps for applications that have
+// been destroyed: their git repository, their build cache and their images.
+package cleanup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/cookoo"
+	"github.com/Masterminds/cookoo/log"
+	"github.com/deis/deis/builder/cache"
+	docli "github.com/fsouza/go-dockerclient"
+)
+
+// Images is the part of the Docker client that cleanup uses.
+type Images interface {
+	ListImages(all bool) ([]docli.APIImages, error)
+	RemoveImage(name string) error
+}
+
+// Cleaner removes the data of destroyed applications.
+type Cleaner struct {
+	// GitHome is the directory repositories are in.
+	GitHome string
+	// Caches is the store of build caches.
+	Caches *cache.Store
+	// Registry is the HOST:PORT of the private registry. Application images
+	// are named $Registry/$app.
+	Registry string
+	Images   Images
+	// Logf logs what was removed.
+	Logf func(format string, v ...interface{})
+
+	mu sync.Mutex
+}
+
+// Report describes what was reclaimed for an application.
+type Report struct {
+	App string
+	// Repo is the size of the removed repository in bytes.
+	Repo int64
+	// Cache is the size of the removed build cache in bytes.
+	Cache int64
+	// Images are the removed image tags.
+	Images []string
+	// ImageSize is the size of the removed images in bytes.
+	ImageSize int64
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("%s: repository %s, build cache %s, %d images %s",
+		r.App, formatSize(r.Repo), formatSize(r.Cache), len(r.Images), formatSize(r.ImageSize))
+}
+
+// CreateCleaner creates a new cleaner.
+//
+// Params:
+// 	- gitHome (string): The directory repositories are in. Defaults to /home/git.
+// 	- caches (*cache.Store): The store of build caches.
+// 	- registry (string): HOST:PORT of the private registry.
+// 	- docker (Images): A Docker client, usually a *docker.Client.
+//
+// Returns:
+// 	- *Cleaner
+func CreateCleaner(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	caches, ok := p.Get("caches", nil).(*cache.Store)
+	if !ok {
+		caches = cache.NewStore(cache.DefaultDir, 0)
+	}
+	return &Cleaner{
+		GitHome:  p.Get("gitHome", "/home/git").(string),
+		Caches:   caches,
+		Registry: p.Get("registry", "").(string),
+		Images:   p.Get("docker", nil).(Images),
+		Logf: func(format string, v ...interface{}) {
+			log.Infof(c, format, v...)
+		},
+	}, nil
+}
+
+// AppRemoved removes the data of an application that has been destroyed.
+func (cl *Cleaner) AppRemoved(app string) {
+	if r, err := cl.Remove(app); err != nil {
+		cl.logf("Failed to clean up %s: %s", app, err)
+	} else if r != nil {
+		cl.logf("Reclaimed %s", r)
+	}
+}
+
+// SyncApps logs the applications that have data but are not in apps.
+//
+// Nothing is removed: apps only lists the applications with published
+// containers, which leaves out those scaled to zero and those whose first
+// deploy has not been published yet. Data is only removed when an
+// application is destroyed.
+func (cl *Cleaner) SyncApps(apps []string) {
+	orphans, err := cl.Orphans(apps)
+	if err != nil {
+		cl.logf("Failed to look for destroyed apps: %s", err)
+	}
+	if len(orphans) > 0 {
+		cl.logf("Keeping the data of apps without published containers: %s", strings.Join(orphans, ", "))
+	}
+}
+
+// Remove removes the repository, build cache and images of an application.
+// It returns nil if there was nothing to remove.
+func (cl *Cleaner) Remove(app string) (*Report, error) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	r := &Report{App: app, Images: []string{}}
+	var errs []string
+
+	repo := filepath.Join(cl.GitHome, app+".git")
+	if _, err := os.Stat(repo); err == nil {
+		r.Repo = dirSize(repo)
+		if err := os.RemoveAll(repo); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if u, err := cl.Caches.Stat(app); err == nil {
+		switch err := cl.Caches.Purge(app); err {
+		case nil:
+			r.Cache = u.Size
+		case cache.ErrNotFound:
+		default:
+			errs = append(errs, fmt.Sprintf("build cache: %s", err))
+		}
+	}
+
+	if cl.Images != nil && len(cl.Registry) > 0 {
+		images, err := cl.Images.ListImages(false)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("listing images: %s", err))
+		}
+		for _, img := range images {
+			removed := false
+			for _, tag := range img.RepoTags {
+				if cl.appOf(tag) != app {
+					continue
+				}
+				if err := cl.Images.RemoveImage(tag); err != nil && err != docli.ErrNoSuchImage {
+					errs = append(errs, fmt.Sprintf("removing %s: %s", tag, err))
+					continue
+				}
+				r.Images = append(r.Images, tag)
+				removed = true
+			}
+			if removed {
+				r.ImageSize += img.VirtualSize
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return r, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	if r.Repo == 0 && r.Cache == 0 && len(r.Images) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// Orphans returns the applications that have a repository, a build cache or
+// images, but are not in apps.
+func (cl *Cleaner) Orphans(apps []string) ([]string, error) {
+	keep := map[string]bool{}
+	for _, app := range apps {
+		keep[app] = true
+	}
+
+	found := map[string]bool{}
+	infos, err := ioutil.ReadDir(cl.GitHome)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, fi := range infos {
+		if fi.IsDir() && strings.HasSuffix(fi.Name(), ".git") {
+			found[strings.TrimSuffix(fi.Name(), ".git")] = true
+		}
+	}
+	if caches, err := cl.Caches.List(); err == nil {
+		for _, u := range caches {
+			found[u.App] = true
+		}
+	}
+	if cl.Images != nil && len(cl.Registry) > 0 {
+		if images, err := cl.Images.ListImages(false); err == nil {
+			for _, img := range images {
+				for _, tag := range img.RepoTags {
+					if app := cl.appOf(tag); len(app) > 0 {
+						found[app] = true
+					}
+				}
+			}
+		}
+	}
+
+	names := []string{}
+	for app := range found {
+		if !keep[app] {
+			names = append(names, app)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// appOf returns the application an image tag belongs to, or "" if the image
+// is not an application image.
+func (cl *Cleaner) appOf(tag string) string {
+	prefix := cl.Registry + "/"
+	if !strings.HasPrefix(tag, prefix) {
+		return ""
+	}
+	name := strings.TrimPrefix(tag, prefix)
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+	if strings.Contains(name, "/") {
+		return ""
+	}
+	return name
+}
+
+func (cl *Cleaner) logf(format string, v ...interface{}) {
+	if cl.Logf != nil {
+		cl.Logf(format, v...)
+	}
+}
+
+// dirSize returns the total size of the files in a directory.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// formatSize formats a size in bytes for logs, e.g. "1.5M".
+func formatSize(size int64) string {
+	units := "KMGT"
+	value := float64(size)
+	if value < 1024 {
+		return fmt.Sprintf("%dB", size)
+	}
+	i := -1
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%c", value, units[i])
+}
@@ -0,0 +1,137 @@
+package cleanup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/deis/deis/builder/cache"
+	docli "github.com/fsouza/go-dockerclient"
+)
+
+type fakeImages struct {
+	images  []docli.APIImages
+	removed []string
+}
+
+func (f *fakeImages) ListImages(all bool) ([]docli.APIImages, error) {
+	return f.images, nil
+}
+
+func (f *fakeImages) RemoveImage(name string) error {
+	f.removed = append(f.removed, name)
+	return nil
+}
+
+// testCleaner creates a git home with repositories and caches for the apps.
+func testCleaner(t *testing.T, apps ...string) *Cleaner {
+	home, err := ioutil.TempDir("", "cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := &Cleaner{
+		GitHome:  home,
+		Caches:   cache.NewStore(filepath.Join(home, "cache"), 0),
+		Registry: "10.0.0.1:5000",
+		Images: &fakeImages{images: []docli.APIImages{
+			{ID: "1", RepoTags: []string{"10.0.0.1:5000/myapp:git-1234", "10.0.0.1:5000/myapp:v2"}, VirtualSize: 300},
+			{ID: "2", RepoTags: []string{"10.0.0.1:5000/other:git-5678"}, VirtualSize: 200},
+			{ID: "3", RepoTags: []string{"deis/slugrunner:latest", "10.0.0.1:5000/deis/myapp:v1"}, VirtualSize: 100},
+		}},
+	}
+	for _, app := range apps {
+		repo := filepath.Join(home, app+".git")
+		os.MkdirAll(repo, 0755)
+		ioutil.WriteFile(filepath.Join(repo, "HEAD"), make([]byte, 10), 0644)
+		l, err := cl.Caches.Acquire(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.WriteFile(filepath.Join(l.Dir, "vendor"), make([]byte, 20), 0644)
+		l.Release()
+	}
+	return cl
+}
+
+func TestRemove(t *testing.T) {
+	cl := testCleaner(t, "myapp", "other")
+	defer os.RemoveAll(cl.GitHome)
+
+	r, err := cl.Remove("myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &Report{
+		App:       "myapp",
+		Repo:      10,
+		Cache:     20,
+		Images:    []string{"10.0.0.1:5000/myapp:git-1234", "10.0.0.1:5000/myapp:v2"},
+		ImageSize: 300,
+	}
+	if !reflect.DeepEqual(r, expect) {
+		t.Errorf("Expected %+v, got %+v", expect, r)
+	}
+	if _, err := os.Stat(filepath.Join(cl.GitHome, "myapp.git")); err == nil {
+		t.Error("Expected the repository to be removed")
+	}
+	if _, err := cl.Caches.Stat("myapp"); err != cache.ErrNotFound {
+		t.Errorf("Expected the cache to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cl.GitHome, "other.git")); err != nil {
+		t.Errorf("Expected other apps to be kept: %s", err)
+	}
+
+	if r, err := cl.Remove("gone"); r != nil || err != nil {
+		t.Errorf("Expected nothing to remove, got %v (%v)", r, err)
+	}
+}
+
+func TestRemoveCacheInUse(t *testing.T) {
+	cl := testCleaner(t, "myapp")
+	defer os.RemoveAll(cl.GitHome)
+
+	l, err := cl.Caches.Acquire("myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release()
+
+	if _, err := cl.Remove("myapp"); err == nil {
+		t.Error("Expected an error removing a cache in use")
+	}
+	if _, err := os.Stat(filepath.Join(cl.GitHome, "myapp.git")); err == nil {
+		t.Error("Expected the repository to be removed anyway")
+	}
+}
+
+func TestSyncApps(t *testing.T) {
+	cl := testCleaner(t, "myapp", "other", "third")
+	defer os.RemoveAll(cl.GitHome)
+
+	orphans, err := cl.Orphans([]string{"other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"myapp", "third"}; !reflect.DeepEqual(orphans, expect) {
+		t.Errorf("Expected %v to have no published containers, got %v", expect, orphans)
+	}
+
+	// Apps scaled to zero are not in the list, so their data must be kept.
+	cl.SyncApps([]string{"other"})
+	if removed := cl.Images.(*fakeImages).removed; len(removed) != 0 {
+		t.Errorf("Expected no image to be removed, got %v", removed)
+	}
+	if _, err := os.Stat(filepath.Join(cl.GitHome, "myapp.git")); err != nil {
+		t.Errorf("Expected the repository to be kept, got %v", err)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for size, expect := range map[int64]string{0: "0B", 1023: "1023B", 1536: "1.5K", 5 << 30: "5.0G"} {
+		if s := formatSize(size); s != expect {
+			t.Errorf("Expected %s, got %s", expect, s)
+		}
+	}
+}
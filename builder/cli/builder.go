@@ -9,5 +9,10 @@ import (
 
 func main() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
+
+	// The pre-receive hook runs `builder build` for each push.
+	if len(os.Args) > 1 && os.Args[1] == "build" {
+		os.Exit(builder.RunBuild(os.Args[2:]))
+	}
 	os.Exit(builder.Run("boot"))
 }
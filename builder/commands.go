@@ -3,6 +3,7 @@ package builder
 import (
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/Masterminds/cookoo"
@@ -24,34 +25,54 @@ func Sleep(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
 	return true, nil
 }
 
-// KillOnExit kills PIDs when the program exits.
+// ShutdownOnSignal runs a route when the builder is told to stop.
 //
-// Otherwise, this blocks until an os.Interrupt or os.Kill is received.
+// It starts a goroutine that waits for SIGTERM or an os.Interrupt, runs the
+// route, and then closes the returned channel. The process should not exit
+// until the channel is closed.
 //
 // Params:
-//  This treats Params as a map of process names (unimportant) to PIDs. It then
-// attempts to kill all of the pids that it receives.
-func KillOnExit(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+// 	- route (string): The name of the route that shuts the builder down.
+//
+// Returns:
+// 	- chan bool: Closed when the shutdown route has finished.
+func ShutdownOnSignal(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	route := p.Get("route", "shutdown").(string)
+	router := c.Get("cookoo.Router", nil).(*cookoo.Router)
+
 	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, os.Interrupt, os.Kill)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
 
+	done := make(chan bool)
 	safely.GoDo(c, func() {
 		log.Info(c, "Builder is running.")
 
-		<-sigs
-
-		c.Log("info", "Builder received signal to stop.")
-		pids := p.AsMap()
-		killed := 0
-		for name, pid := range pids {
-			if pid, ok := pid.(int); ok {
-				if proc, err := os.FindProcess(pid); err == nil {
-					log.Infof(c, "Killing %s (pid=%d)", name, pid)
-					proc.Kill()
-					killed++
-				}
-			}
+		sig := <-sigs
+		log.Infof(c, "Builder received %s. Shutting down.", sig)
+		if err := router.HandleRequest(route, c, false); err != nil {
+			log.Errf(c, "Error during shutdown: %s", err)
 		}
+		close(done)
 	})
-	return nil, nil
+	return done, nil
+}
+
+// KillProcesses kills PIDs.
+//
+// Params:
+//  This treats Params as a map of process names (unimportant) to PIDs. It then
+// attempts to kill all of the pids that it receives.
+func KillProcesses(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	pids := p.AsMap()
+	killed := 0
+	for name, pid := range pids {
+		if pid, ok := pid.(int); ok {
+			if proc, err := os.FindProcess(pid); err == nil {
+				log.Infof(c, "Killing %s (pid=%d)", name, pid)
+				proc.Kill()
+				killed++
+			}
+		}
+	}
+	return killed, nil
 }
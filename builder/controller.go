@@ -0,0 +1,131 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/cookoo"
+)
+
+const (
+	contentType string = "application/json"
+	userAgent   string = "deis-builder"
+)
+
+// Controller is the part of the controller's API that builds use.
+type Controller interface {
+	// Config fetches the configuration of an application.
+	Config(user, app string) (*Config, error)
+	// PublishBuild tells the controller about a new build, which it releases.
+	PublishBuild(hook *BuildHook) (*BuildHookResponse, error)
+}
+
+// ControllerClient talks to the controller's builder hooks.
+type ControllerClient struct {
+	// URL is the base URL of the controller, e.g. http://10.0.0.1:8000
+	URL string
+	// Key is the builder key the controller authenticates the builder with.
+	Key string
+
+	client *http.Client
+}
+
+// shellshock matches values trying to exploit Shellshock.
+var shellshock = regexp.MustCompile(`\(\)\s+\{[^\}]+\};\s+(.*)`)
+
+// NewControllerClient creates a new controller client.
+func NewControllerClient(url, key string) *ControllerClient {
+	return &ControllerClient{URL: strings.TrimSuffix(url, "/"), Key: key, client: &http.Client{}}
+}
+
+// CreateControllerClient creates a new controller client.
+//
+// Params:
+// 	- url (string): The base URL of the controller.
+// 	- key (string): The builder key.
+//
+// Returns:
+// 	- *ControllerClient
+func CreateControllerClient(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	if ok, missing := p.RequiresValue("url", "key"); !ok {
+		return nil, fmt.Errorf("Missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return NewControllerClient(p.Get("url", "").(string), p.Get("key", "").(string)), nil
+}
+
+// Config fetches the configuration of an application.
+func (cc *ControllerClient) Config(user, app string) (*Config, error) {
+	body, err := cc.post("/v1/hooks/config", &ConfigHook{ReceiveUser: user, ReceiveRepo: app})
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseConfig(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config from controller: %s", err)
+	}
+	return config, nil
+}
+
+// PublishBuild tells the controller about a new build, which it releases.
+func (cc *ControllerClient) PublishBuild(hook *BuildHook) (*BuildHookResponse, error) {
+	data, err := json.Marshal(hook)
+	if err != nil {
+		return nil, err
+	}
+	if shellshock.Match(data) {
+		return nil, fmt.Errorf("an environment variable in the app is trying to exploit Shellshock")
+	}
+
+	body, err := cc.post("/v1/hooks/build", hook)
+	if err != nil {
+		return nil, err
+	}
+	var res BuildHookResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("invalid build hook response from controller: %s", err)
+	}
+	return &res, nil
+}
+
+// post sends a JSON request to a builder hook, and returns the response body.
+func (cc *ControllerClient) post(path string, v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", cc.URL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", contentType)
+	req.Header.Add("Accept", contentType)
+	req.Header.Add("User-Agent", userAgent)
+	req.Header.Add("X-Deis-Builder-Auth", cc.Key)
+
+	client := cc.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach the controller: %s", err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusServiceUnavailable:
+		return nil, fmt.Errorf("check the controller. Is it running? (%s)", res.Status)
+	case res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated:
+		return nil, fmt.Errorf("controller returned %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
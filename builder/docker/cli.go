@@ -0,0 +1,137 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CLI runs containers and builds images with the docker command line client.
+//
+// The build pipeline uses the CLI rather than the API so that build output is
+// streamed to the user exactly as `docker` prints it.
+type CLI struct {
+	// Bin is the docker binary. It defaults to "docker".
+	Bin string
+}
+
+// Run starts a detached container, and returns its ID.
+//
+// env is a list of KEY=VALUE pairs, volumes a list of HOST:CONTAINER[:MODE]
+// bind mounts and limits a list of flags such as --memory=512m.
+func (d *CLI) Run(image string, env, volumes, limits []string) (string, error) {
+	args := append([]string{"run", "-d"}, limits...)
+	for _, v := range volumes {
+		args = append(args, "-v", v)
+	}
+	for _, e := range env {
+		args = append(args, "-e", e)
+	}
+	args = append(args, image)
+
+	out, err := d.output(args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Attach streams a container's output to out until it exits. It returns an
+// error if the container exits with a non-zero status.
+func (d *CLI) Attach(id string, out io.Writer) error {
+	cmd := exec.Command(d.bin(), "attach", id)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("container %s failed: %s", id, err)
+	}
+	return nil
+}
+
+// OOMKilled is true if a container was killed for running out of memory.
+func (d *CLI) OOMKilled(id string) (bool, error) {
+	out, err := d.output("inspect", "--format={{.State.OOMKilled}}", id)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) == "true", nil
+}
+
+// CopyFrom copies a file out of a container into the directory dest.
+func (d *CLI) CopyFrom(id, src, dest string) error {
+	_, err := d.output("cp", id+":"+src, dest)
+	return err
+}
+
+// Remove forcibly removes a container.
+func (d *CLI) Remove(id string) error {
+	_, err := d.output("rm", "-f", id)
+	return err
+}
+
+// Build builds the image in dir and tags it, streaming output to out.
+//
+// limits are flags that limit the resources of the build's containers. The
+// build is interrupted if stop is closed.
+func (d *CLI) Build(dir, tag string, noCache bool, limits []string, out io.Writer, stop <-chan bool) error {
+	args := append([]string{"build"}, limits...)
+	if noCache {
+		args = append(args, "--no-cache")
+	}
+	args = append(args, "-t", tag, dir)
+
+	cmd := exec.Command(d.bin(), args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("docker build failed: %s", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-stop:
+		// The daemon cancels the build when the client goes away.
+		cmd.Process.Signal(os.Interrupt)
+		err = <-done
+	}
+	if err != nil {
+		return fmt.Errorf("docker build failed: %s", err)
+	}
+	return nil
+}
+
+// Push pushes an image to its registry.
+func (d *CLI) Push(tag string) error {
+	_, err := d.output("push", tag)
+	return err
+}
+
+func (d *CLI) bin() string {
+	if len(d.Bin) > 0 {
+		return d.Bin
+	}
+	return "docker"
+}
+
+// output runs a docker command, returning its standard output. On failure,
+// the error includes whatever docker printed.
+func (d *CLI) output(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(d.bin(), args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) == 0 {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return "", fmt.Errorf("docker %s: %s (%s)", args[0], err, msg)
+	}
+	return stdout.String(), nil
+}
@@ -49,6 +49,17 @@ type Setter interface {
 	Set(string, string, uint64) (*etcd.Response, error)
 }
 
+// Deleter deletes a value in Etcd.
+type Deleter interface {
+	Delete(string, bool) (*etcd.Response, error)
+}
+
+// SetterDeleter performs set and delete operations.
+type SetterDeleter interface {
+	Setter
+	Deleter
+}
+
 // GetterSetter performs get and set operations.
 type GetterSetter interface {
 	Getter
@@ -114,6 +125,93 @@ func Get(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
 	return res, nil
 }
 
+// GetValue fetches the value of a single etcd key.
+//
+// Unlike Get, a missing key is not an error. The default value is returned
+// instead.
+//
+// Params:
+// 	- client (Getter): Etcd client
+// 	- key (string): The key to fetch
+// 	- default (string): The value to return if the key is not set.
+//
+// Returns:
+// 	- string value of the key
+func GetValue(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	client := p.Get("client", nil).(Getter)
+	key := p.Get("key", "").(string)
+	def := p.Get("default", "").(string)
+
+	res, err := client.Get(key, false, false)
+	if err != nil || res.Node == nil || res.Node.Dir {
+		log.Debugf(c, "Using default value for %s", key)
+		return def, nil
+	}
+	return res.Node.Value, nil
+}
+
+// ValueFunc returns a function that reads the current value of an etcd key.
+//
+// This is useful for long-running services that need a value which may change
+// after boot.
+//
+// Params:
+// 	- client (Getter): Etcd client
+// 	- key (string): The key to read
+//
+// Returns:
+// 	- func() (string, error)
+func ValueFunc(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	client := p.Get("client", nil).(Getter)
+	key := p.Get("key", "").(string)
+
+	return func() (string, error) {
+		return valueOf(client, key)
+	}, nil
+}
+
+// LookupFunc returns a function that reads the current value of any etcd key.
+//
+// Params:
+// 	- client (Getter): Etcd client
+//
+// Returns:
+// 	- func(string) (string, error)
+func LookupFunc(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	client := p.Get("client", nil).(Getter)
+
+	return func(key string) (string, error) {
+		return valueOf(client, key)
+	}, nil
+}
+
+// PingFunc returns a function that checks that etcd answers.
+//
+// Params:
+// 	- client (Getter): Etcd client
+//
+// Returns:
+// 	- func() error
+func PingFunc(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	client := p.Get("client", nil).(Getter)
+
+	return func() error {
+		_, err := client.Get("/deis", false, false)
+		return err
+	}, nil
+}
+
+func valueOf(client Getter, key string) (string, error) {
+	res, err := client.Get(key, false, false)
+	if err != nil {
+		return "", err
+	}
+	if res.Node == nil || res.Node.Dir {
+		return "", fmt.Errorf("Expected %s to be a value", key)
+	}
+	return res.Node.Value, nil
+}
+
 // IsRunning checks to see if etcd is running.
 //
 // It will test `count` times before giving up.
@@ -317,19 +415,23 @@ func genSSHKeys(c cookoo.Context) error {
 // If `port` is specified, this will notify etcd at 10 second intervals that
 // the builder is listening at $HOST:$PORT, setting the TTL to 20 seconds.
 //
-// This will notify etcd as long as the local sshd is running.
+// This will notify etcd as long as the local sshd is running, or until the
+// returned Registration is stopped.
 //
 // Params:
 // 	- base (string): The base path to write the data: $base/host and $base/port.
 // 	- host (string): The hostname
 // 	- port (string): The port
-// 	- client (Setter): The client to use to write the data to etcd.
+// 	- client (SetterDeleter): The client to use to write the data to etcd.
 // 	- sshPid (int): The PID for SSHD. If SSHD dies, this stops notifying.
+//
+// Returns:
+// 	- *Registration, or false if no port was given.
 func UpdateHostPort(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
 	base := p.Get("base", "").(string)
 	host := p.Get("host", "").(string)
 	port := p.Get("port", "").(string)
-	client := p.Get("client", nil).(Setter)
+	client := p.Get("client", nil).(SetterDeleter)
 	sshd := p.Get("sshdPid", 0).(int)
 
 	// If no port is specified, we don't do anything.
@@ -345,23 +447,65 @@ func UpdateHostPort(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Int
 		return false, err
 	}
 
+	reg := &Registration{stop: make(chan bool), done: make(chan bool)}
+
 	// Update etcd every ten seconds with this builder's host/port.
 	safely.GoDo(c, func() {
+		defer close(reg.done)
 		ticker := time.NewTicker(10 * time.Second)
-		for range ticker.C {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-reg.stop:
+				log.Infof(c, "Removing %s/host and %s/port from etcd.", base, base)
+				for _, key := range []string{base + "/host", base + "/port"} {
+					if _, err := client.Delete(key, false); err != nil {
+						log.Errf(c, "Etcd error deleting %s: %s", key, err)
+					}
+				}
+				return
+			case <-ticker.C:
+			}
 			if _, err := os.FindProcess(sshd); err != nil {
 				log.Errf(c, "Lost SSHd process: %s", err)
-				break
-			} else {
-				if err := setHostPort(client, base, host, port, ttl); err != nil {
-					log.Errf(c, "Etcd error setting host/port: %s", err)
-					continue
-				}
+				return
+			}
+			if err := setHostPort(client, base, host, port, ttl); err != nil {
+				log.Errf(c, "Etcd error setting host/port: %s", err)
 			}
 		}
-		ticker.Stop()
 	})
 
+	return reg, nil
+}
+
+// Registration is the builder's published address in etcd.
+type Registration struct {
+	stop chan bool
+	done chan bool
+}
+
+// Stop stops refreshing the registration and removes it from etcd, so that
+// no new pushes are routed to this builder.
+func (r *Registration) Stop() {
+	close(r.stop)
+	<-r.done
+}
+
+// Deregister removes the builder's address from etcd.
+//
+// Params:
+// 	- registration (*Registration): The registration returned by UpdateHostPort.
+// 		If this is not a *Registration, nothing is done.
+//
+// Returns:
+// 	- bool: true if the builder was deregistered.
+func Deregister(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	reg, ok := p.Get("registration", nil).(*Registration)
+	if !ok {
+		return false, nil
+	}
+	reg.Stop()
 	return true, nil
 }
 
@@ -404,103 +548,152 @@ func MakeDir(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt)
 	return res, nil
 }
 
-// Watch watches a given path, and executes a git check-repos for each event.
+// Etcd error codes the watcher handles.
+const (
+	errKeyNotFound       = 100
+	errEventIndexCleared = 401
+)
+
+// GetterWatcher performs get and watch operations.
+type GetterWatcher interface {
+	Getter
+	Watcher
+}
+
+// AppHandler reacts to applications being destroyed.
+type AppHandler interface {
+	// AppRemoved is called when an application is destroyed.
+	AppRemoved(app string)
+	// SyncApps is called with all existing applications when watching
+	// starts, and whenever removals may have been missed.
+	SyncApps(apps []string)
+}
+
+// WatchApps watches the applications in etcd, and tells the handler when one
+// is destroyed.
+//
+// Each application has a directory under path, which the controller removes
+// when the application is destroyed. Events are watched from the index after
+// the last one seen, so none are lost between watches. If etcd has already
+// forgotten that index, the handler is synced with the current applications,
+// and watching resumes from there.
 //
 // It starts the watcher and then returns. The watcher runs on its own
-// goroutine. To stop the watching, send the returned channel a bool.
+// goroutine until the returned channel is closed.
 //
 // Params:
-// - client (Watcher): An Etcd client.
-// - path (string): The path to watch
+// 	- client (GetterWatcher): An Etcd client.
+// 	- path (string): The path applications are in. Defaults to /deis/services.
+// 	- handler (AppHandler): Is told about destroyed applications.
 //
 // Returns:
-// 	- chan bool: Send this a message to stop the watcher.
-func Watch(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
-	// etcdctl -C $ETCD watch --recursive /deis/services
-	path := p.Get("path", "/deis/services").(string)
-	cli, ok := p.Has("client")
-	if !ok {
-		return nil, errors.New("No etcd client found.")
-	}
-	client := cli.(Watcher)
+// 	- chan bool: Close this to stop the watcher.
+func WatchApps(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	path := strings.TrimSuffix(p.Get("path", "/deis/services").(string), "/")
+	client := p.Get("client", nil).(GetterWatcher)
+	handler := p.Get("handler", nil).(AppHandler)
 
-	// Stupid hack because etcd watch seems to be broken, constantly complaining
-	// that the JSON it received is malformed.
+	stop := make(chan bool)
 	safely.GoDo(c, func() {
-		for {
-			response, err := client.Watch(path, 0, true, nil, nil)
+		watchApps(c, client, path, handler, stop)
+	})
+	return stop, nil
+}
+
+func watchApps(c cookoo.Context, client GetterWatcher, path string, handler AppHandler, stop chan bool) {
+	var index uint64
+	wait := retrySleep
+	pause := func() bool {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(wait):
+		}
+		if wait < 30*time.Second {
+			wait *= 2
+		}
+		return true
+	}
+
+	for {
+		if index == 0 {
+			apps, next, err := listApps(client, path)
+			if e, ok := err.(*etcd.EtcdError); ok && e.ErrorCode == errKeyNotFound {
+				// No app has been created yet. Without a list of apps to
+				// keep, nothing is removed; just wait for apps to appear.
+				index = e.Index + 1
+				continue
+			}
 			if err != nil {
-				log.Errf(c, "Etcd Watch failed: %s", err)
-				time.Sleep(50 * time.Millisecond)
+				log.Errf(c, "Could not list apps in %s: %s", path, err)
+				if !pause() {
+					return
+				}
 				continue
 			}
+			handler.SyncApps(apps)
+			index = next
+		}
 
-			if response.Node == nil {
-				log.Infof(c, "Unexpected Etcd message: %v", response)
+		res, err := client.Watch(path, index, true, nil, stop)
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		if err != nil {
+			if e, ok := err.(*etcd.EtcdError); ok && e.ErrorCode == errEventIndexCleared {
+				log.Infof(c, "Missed events in %s, resyncing apps.", path)
+				index = 0
+				continue
 			}
-			git := exec.Command("/home/git/check-repos")
-			if out, err := git.CombinedOutput(); err != nil {
-				log.Errf(c, "Failed git check-repos: %s", err)
-				log.Infof(c, "Output: %s", out)
+			log.Errf(c, "Etcd watch of %s failed: %s", path, err)
+			if !pause() {
+				return
 			}
+			continue
 		}
+		wait = retrySleep
+		if res.Node == nil {
+			log.Infof(c, "Unexpected Etcd message: %v", res)
+			continue
+		}
+		index = res.Node.ModifiedIndex + 1
 
-	})
-
-	return nil, nil
-
-	/* Watch seems to be broken. So we do this stupid watch loop instead.
-	receiver := make(chan *etcd.Response)
-	stop := make(chan bool)
-	// Buffer the channels so that we don't hang waiting for go-etcd to
-	// read off the channel.
-	stopetcd := make(chan bool, 1)
-	stopwatch := make(chan bool, 1)
-
-
-	// Watch for errors.
-	safely.GoDo(c, func() {
-		// When a receiver is passed in, no *Response is ever returned. Instead,
-		// Watch acts like an error channel, and receiver gets all of the messages.
-		_, err := client.Watch(path, 0, true, receiver, stopetcd)
-		if err != nil {
-			log.Infof(c, "Watcher stopped with error '%s'", err)
-			stopwatch <- true
-			//close(stopwatch)
+		if app := appOf(path, res.Node.Key); len(app) > 0 && (res.Action == "delete" || res.Action == "expire") {
+			log.Infof(c, "App %s was destroyed.", app)
+			handler.AppRemoved(app)
 		}
-	})
-	// Watch for events
-	safely.GoDo(c, func() {
-		for {
-			select {
-			case msg := <-receiver:
-				if msg.Node != nil {
-					log.Infof(c, "Received notification %s for %s", msg.Action, msg.Node.Key)
-				} else {
-					log.Infof(c, "Received unexpected etcd message: %v", msg)
-				}
-				git := exec.Command("/home/git/check-repos")
-				if out, err := git.CombinedOutput(); err != nil {
-					log.Errf(c, "Failed git check-repos: %s", err)
-					log.Infof(c, "Output: %s", out)
-				}
-			case <-stopwatch:
-				c.Logf("debug", "Received signal to stop watching events.")
-				return
-			}
+	}
+}
+
+// listApps lists the applications under path, and returns the index to watch
+// from.
+func listApps(client Getter, path string) ([]string, uint64, error) {
+	res, err := client.Get(path, false, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	if res.Node == nil || !res.Node.Dir {
+		return nil, 0, fmt.Errorf("Expected %s to be a dir", path)
+	}
+	apps := make([]string, 0, len(res.Node.Nodes))
+	for _, n := range res.Node.Nodes {
+		if app := appOf(path, n.Key); len(app) > 0 {
+			apps = append(apps, app)
 		}
-	})
-	// Fan out stop requests.
-	safely.GoDo(c, func() {
-		<-stop
-		stopwatch <- true
-		stopetcd <- true
-		close(stopwatch)
-		close(stopetcd)
-	})
+	}
+	return apps, res.EtcdIndex + 1, nil
+}
 
-	return stop, nil
-	*/
+// appOf returns the application a key directly under path is for, or "" if
+// key is not an application's directory.
+func appOf(path, key string) string {
+	rest := strings.TrimPrefix(key, path+"/")
+	if rest == key || len(rest) == 0 || strings.Contains(rest, "/") {
+		return ""
+	}
+	return rest
 }
 
 // checkRetry overrides etcd.DefaultCheckRetry.
@@ -1,7 +1,11 @@
 package etcd
 
 import (
+	"errors"
+	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Masterminds/cookoo"
 	"github.com/coreos/go-etcd/etcd"
@@ -14,6 +18,8 @@ func TestInterfaces(t *testing.T) {
 	var _ Getter = cli
 	var _ = cli
 	var _ GetterSetter = cli
+	var _ SetterDeleter = cli
+	var _ GetterWatcher = cli
 }
 
 func TestCreateClient(t *testing.T) {
@@ -70,6 +76,83 @@ func TestSet(t *testing.T) {
 		t.Errorf("Expected instance of *etcd.Response. Got %T", tt)
 	}
 }
+func TestGetValue(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+
+	reg.Route("test", "Test route").
+		Does(GetValue, "res").
+		Using("client").WithDefault(&stubClient{}).
+		Using("key").WithDefault("/deis/builder/branchMap").
+		Using("default").WithDefault("master=$APP")
+
+	if err := router.HandleRequest("test", cxt, true); err != nil {
+		t.Error(err)
+	}
+
+	// The stub always returns a directory, so we expect the default.
+	if res := cxt.Get("res", "").(string); res != "master=$APP" {
+		t.Errorf("Expected default value, got %q", res)
+	}
+}
+
+func TestValueFunc(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+
+	reg.Route("test", "Test route").
+		Does(ValueFunc, "res").
+		Using("client").WithDefault(&stubClient{}).
+		Using("key").WithDefault("/deis/controller/builderKey")
+
+	if err := router.HandleRequest("test", cxt, true); err != nil {
+		t.Error(err)
+	}
+
+	fn, ok := cxt.Get("res", nil).(func() (string, error))
+	if !ok {
+		t.Fatalf("Expected a func() (string, error), got %T", cxt.Get("res", nil))
+	}
+	// The stub always returns a directory, which has no value.
+	if _, err := fn(); err == nil {
+		t.Error("Expected an error reading a directory")
+	}
+}
+
+func TestLookupFunc(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+
+	reg.Route("test", "Test route").
+		Does(LookupFunc, "res").
+		Using("client").WithDefault(&stubClient{})
+
+	if err := router.HandleRequest("test", cxt, true); err != nil {
+		t.Error(err)
+	}
+
+	fn, ok := cxt.Get("res", nil).(func(string) (string, error))
+	if !ok {
+		t.Fatalf("Expected a func(string) (string, error), got %T", cxt.Get("res", nil))
+	}
+	if _, err := fn("/deis/builder/webhooks"); err == nil {
+		t.Error("Expected an error reading a directory")
+	}
+}
+
+func TestPingFunc(t *testing.T) {
+	reg, router, cxt := cookoo.Cookoo()
+
+	reg.Route("test", "Test route").
+		Does(PingFunc, "res").
+		Using("client").WithDefault(&stubClient{})
+
+	if err := router.HandleRequest("test", cxt, true); err != nil {
+		t.Error(err)
+	}
+
+	if err := cxt.Get("res", nil).(func() error)(); err != nil {
+		t.Errorf("Expected etcd to answer, got %s", err)
+	}
+}
+
 func TestMakeDir(t *testing.T) {
 	reg, router, cxt := cookoo.Cookoo()
 
@@ -90,8 +173,125 @@ func TestMakeDir(t *testing.T) {
 	}
 }
 
+func TestDeregister(t *testing.T) {
+	cli := &stubClient{}
+	reg, router, cxt := cookoo.Cookoo()
+
+	reg.Route("test", "Test route").
+		Does(UpdateHostPort, "registration").
+		Using("client").WithDefault(cli).
+		Using("base").WithDefault("/deis/builder").
+		Using("host").WithDefault("10.0.0.1").
+		Using("port").WithDefault("2223").
+		Does(Deregister, "res").
+		Using("registration").From("cxt:registration")
+
+	if err := router.HandleRequest("test", cxt, true); err != nil {
+		t.Fatal(err)
+	}
+	if cxt.Get("res", false) != true {
+		t.Error("Expected the builder to be deregistered")
+	}
+	expect := []string{"/deis/builder/host", "/deis/builder/port"}
+	if len(cli.deleted) != 2 || cli.deleted[0] != expect[0] || cli.deleted[1] != expect[1] {
+		t.Errorf("Expected %v to be deleted, got %v", expect, cli.deleted)
+	}
+}
+
+// watchClient lists two apps, then replays watch results.
+type watchClient struct {
+	results []interface{}
+	indexes []uint64
+
+	mu sync.Mutex
+}
+
+func (w *watchClient) Get(key string, sort, recurse bool) (*etcd.Response, error) {
+	return &etcd.Response{
+		EtcdIndex: 10,
+		Node: &etcd.Node{Key: key, Dir: true, Nodes: etcd.Nodes{
+			{Key: key + "/myapp", Dir: true},
+			{Key: key + "/other", Dir: true},
+		}},
+	}, nil
+}
+
+func (w *watchClient) Watch(prefix string, index uint64, recursive bool, receiver chan *etcd.Response, stop chan bool) (*etcd.Response, error) {
+	w.mu.Lock()
+	w.indexes = append(w.indexes, index)
+	w.mu.Unlock()
+	if len(w.results) == 0 {
+		<-stop
+		return nil, errors.New("stopped")
+	}
+	r := w.results[0]
+	w.results = w.results[1:]
+	if err, ok := r.(error); ok {
+		return nil, err
+	}
+	return r.(*etcd.Response), nil
+}
+
+type appRecorder struct {
+	removed []string
+	synced  [][]string
+	done    chan bool
+}
+
+func (a *appRecorder) AppRemoved(app string) {
+	a.removed = append(a.removed, app)
+	if app == "other" {
+		close(a.done)
+	}
+}
+
+func (a *appRecorder) SyncApps(apps []string) {
+	a.synced = append(a.synced, apps)
+}
+
+func TestWatchApps(t *testing.T) {
+	client := &watchClient{results: []interface{}{
+		// A container of myapp goes away: not an app deletion.
+		&etcd.Response{Action: "delete", Node: &etcd.Node{Key: "/deis/services/myapp/myapp_v2.web.1", ModifiedIndex: 11}},
+		&etcd.Response{Action: "delete", Node: &etcd.Node{Key: "/deis/services/myapp", Dir: true, ModifiedIndex: 12}},
+		&etcd.EtcdError{ErrorCode: errEventIndexCleared},
+		&etcd.Response{Action: "expire", Node: &etcd.Node{Key: "/deis/services/other", Dir: true, ModifiedIndex: 20}},
+	}}
+	handler := &appRecorder{done: make(chan bool)}
+
+	reg, router, cxt := cookoo.Cookoo()
+	reg.Route("test", "Test route").
+		Does(WatchApps, "stop").
+		Using("client").WithDefault(client).
+		Using("handler").WithDefault(handler)
+	if err := router.HandleRequest("test", cxt, true); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-handler.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the watcher")
+	}
+	close(cxt.Get("stop", nil).(chan bool))
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if expect := []string{"myapp", "other"}; !reflect.DeepEqual(handler.removed, expect) {
+		t.Errorf("Expected %v to be removed, got %v", expect, handler.removed)
+	}
+	// The watcher syncs when it starts, and when it missed events.
+	if len(handler.synced) != 2 || !reflect.DeepEqual(handler.synced[0], []string{"myapp", "other"}) {
+		t.Errorf("Expected two syncs of both apps, got %v", handler.synced)
+	}
+	if expect := []uint64{11, 12, 13, 11}; !reflect.DeepEqual(client.indexes[:4], expect) {
+		t.Errorf("Expected to watch from indexes %v, got %v", expect, client.indexes)
+	}
+}
+
 // stubClient implements EtcdGetter and EtcdDirCreator
 type stubClient struct {
+	deleted []string
 }
 
 func (s *stubClient) Get(key string, sort, recurse bool) (*etcd.Response, error) {
@@ -106,6 +306,11 @@ func (s *stubClient) Set(key string, value string, ttl uint64) (*etcd.Response,
 	return s.response("set"), nil
 }
 
+func (s *stubClient) Delete(key string, recursive bool) (*etcd.Response, error) {
+	s.deleted = append(s.deleted, key)
+	return s.response("delete"), nil
+}
+
 func (s *stubClient) response(a string) *etcd.Response {
 	// This is totally fake data. It may or may not reflect what etcd really
 	// returns.
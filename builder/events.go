@@ -0,0 +1,135 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/cookoo"
+	clog "github.com/Masterminds/cookoo/log"
+	"github.com/deis/deis/builder/httpd"
+	"github.com/deis/deis/builder/webhook"
+)
+
+// EventPoster hands build events to the builder daemon, which delivers them
+// to webhooks. Builds run in the pre-receive hook, and must not keep the push
+// waiting while webhooks are retried.
+type EventPoster struct {
+	// URL is the events endpoint of the builder's HTTP API.
+	URL string
+	// Key is the builder key.
+	Key string
+
+	client *http.Client
+}
+
+// CreateEventPoster creates a new event poster.
+//
+// Params:
+// 	- url (string): The events endpoint of the builder's HTTP API.
+// 	- key (string): The builder key.
+//
+// Returns:
+// 	- *EventPoster
+func CreateEventPoster(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	if ok, missing := p.RequiresValue("url", "key"); !ok {
+		return nil, fmt.Errorf("Missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return &EventPoster{
+		URL:    p.Get("url", "").(string),
+		Key:    p.Get("key", "").(string),
+		client: &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+// Post sends an event to the builder daemon.
+func (ep *EventPoster) Post(e *webhook.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", ep.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(httpd.AuthHeader, ep.Key)
+
+	client := ep.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("builder returned %s", res.Status)
+	}
+	return nil
+}
+
+// PostEvent sends a build event to webhooks, through the builder daemon.
+//
+// Failing to post the event does not fail the build.
+//
+// Params:
+// 	- events (*EventPoster): Sends the event.
+// 	- event (string): The event type, e.g. webhook.Started.
+// 	- user (string): The Deis user who pushed.
+// 	- app (string): The application.
+// 	- sha (string): The pushed commit.
+// 	- uuid (string): The build UUID.
+//
+// Returns:
+// 	- *webhook.Event
+func PostEvent(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	ep := p.Get("events", nil).(*EventPoster)
+	e := &webhook.Event{
+		Type: p.Get("event", webhook.Started).(string),
+		User: p.Get("user", "").(string),
+		App:  p.Get("app", "").(string),
+		Sha:  p.Get("sha", "").(string),
+		UUID: p.Get("uuid", "").(string),
+	}
+	if err := ep.Post(e); err != nil {
+		clog.Warnf(c, "Could not post %s event: %s", e.Type, err)
+	}
+	return e, nil
+}
+
+// Event describes the outcome of a build for webhooks. err is the error the
+// build failed with, if any.
+func (b *Build) Event(err error) *webhook.Event {
+	e := &webhook.Event{
+		Type: webhook.Succeeded,
+		App:  b.App,
+		Sha:  b.Sha,
+		User: b.User,
+		UUID: b.UUID,
+	}
+	pushFailed := false
+	if se, ok := err.(*StepError); ok && se.Step == StepPush {
+		pushFailed = true
+	}
+	var total time.Duration
+	for _, t := range b.Timings {
+		total += t.Duration
+		if t.Step == StepPush && !pushFailed {
+			e.Image = b.Tag()
+		}
+	}
+	e.Duration = total.Seconds()
+	if b.Release != nil {
+		e.Release = b.Release.Release["version"]
+	}
+	if err != nil {
+		e.Type = webhook.Failed
+		e.Error = err.Error()
+	}
+	return e
+}
@@ -0,0 +1,161 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultBranchMap is the branch mapping used when none is configured.
+//
+// It preserves the historical behavior of deploying pushes to master to the
+// application that owns the repository.
+const DefaultBranchMap = "master=$APP"
+
+// Policies for branches that do not match any rule in a BranchMap.
+const (
+	// UnmappedReject rejects the push of an unmapped branch.
+	UnmappedReject = "reject"
+	// UnmappedIgnore accepts the push of an unmapped branch, but does not build it.
+	UnmappedIgnore = "ignore"
+)
+
+// ErrBranchIgnored indicates that a ref was accepted, but should not be built.
+var ErrBranchIgnored = errors.New("branch ignored")
+
+// BranchRule maps branches matching Pattern to the application named by App.
+//
+// Pattern is a path.Match pattern that is compared against the branch name
+// (e.g. "master" or "review/*"). App is a template for the application name.
+// The following variables are expanded in it:
+//
+// 	$APP: The name of the application that owns the repository.
+// 	$BRANCH: The branch name, sanitized so that it is a legal application name.
+type BranchRule struct {
+	Pattern string
+	App     string
+}
+
+// BranchMap maps pushed branches to the applications they deploy to.
+type BranchMap struct {
+	Rules []BranchRule
+	// Unmapped is the policy for branches that match no rule. It is one of
+	// UnmappedReject or UnmappedIgnore.
+	Unmapped string
+}
+
+// ParseBranchMap parses a branch mapping.
+//
+// The mapping is a whitespace or comma separated list of PATTERN=APP rules,
+// for example:
+//
+// 	master=$APP review/*=$APP-$BRANCH
+//
+// Rules are evaluated in order, and the first matching rule wins. An empty
+// mapping is equivalent to DefaultBranchMap.
+func ParseBranchMap(mapping, unmapped string) (*BranchMap, error) {
+	if len(strings.TrimSpace(mapping)) == 0 {
+		mapping = DefaultBranchMap
+	}
+
+	switch unmapped {
+	case "":
+		unmapped = UnmappedReject
+	case UnmappedReject, UnmappedIgnore:
+	default:
+		return nil, fmt.Errorf("Unknown policy for unmapped branches: %q", unmapped)
+	}
+
+	fields := strings.FieldsFunc(mapping, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+
+	bm := &BranchMap{Unmapped: unmapped, Rules: make([]BranchRule, 0, len(fields))}
+	for _, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return nil, fmt.Errorf("Illegal branch rule %q: expected PATTERN=APP", field)
+		}
+		if _, err := path.Match(parts[0], ""); err != nil {
+			return nil, fmt.Errorf("Illegal branch pattern %q: %s", parts[0], err)
+		}
+		bm.Rules = append(bm.Rules, BranchRule{Pattern: parts[0], App: parts[1]})
+	}
+	return bm, nil
+}
+
+// Resolve returns the name of the application that a push of ref to the
+// repository owned by app should deploy to.
+//
+// Refs that are not branches (tags, notes, etc.) are never deployed, and
+// return ErrBranchIgnored. Branches that match no rule return
+// ErrBranchIgnored or a descriptive error, depending on the Unmapped policy.
+func (b *BranchMap) Resolve(app, ref string) (string, error) {
+	if !strings.HasPrefix(ref, "refs/heads/") {
+		return "", ErrBranchIgnored
+	}
+	branch := strings.TrimPrefix(ref, "refs/heads/")
+
+	for _, rule := range b.Rules {
+		if ok, _ := path.Match(rule.Pattern, branch); !ok {
+			continue
+		}
+		sanitized := AppName(branch)
+		// a branch with no legal characters would otherwise deploy to the
+		// application the rest of the rule names, such as $APP itself
+		if len(sanitized) == 0 && strings.Contains(rule.App, "$BRANCH") {
+			return "", fmt.Errorf("Branch %s has no characters allowed in application names", branch)
+		}
+		name := strings.NewReplacer("$APP", app, "$BRANCH", sanitized).Replace(rule.App)
+		name = AppName(name)
+		if len(name) == 0 {
+			return "", fmt.Errorf("Branch %s maps to an empty application name", branch)
+		}
+		return name, nil
+	}
+
+	if b.Unmapped == UnmappedIgnore {
+		return "", ErrBranchIgnored
+	}
+	return "", fmt.Errorf("Branch %s is not mapped to an application. Push to one of: %s", branch, b.patterns())
+}
+
+// Only returns the application that every push to the repository owned by
+// app deploys to, if the branch does not matter, as with DefaultBranchMap.
+// It returns false if rules map branches to different applications.
+func (b *BranchMap) Only(app string) (string, bool) {
+	only := ""
+	for _, rule := range b.Rules {
+		if strings.Contains(rule.App, "$BRANCH") {
+			return "", false
+		}
+		name := AppName(strings.Replace(rule.App, "$APP", app, -1))
+		if only != "" && name != only {
+			return "", false
+		}
+		only = name
+	}
+	return only, only != ""
+}
+
+// patterns returns a printable list of the branch patterns in the map.
+func (b *BranchMap) patterns() string {
+	p := make([]string, len(b.Rules))
+	for i, rule := range b.Rules {
+		p[i] = rule.Pattern
+	}
+	return strings.Join(p, ", ")
+}
+
+var illegalAppChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// AppName sanitizes a string so that it is a legal Deis application name.
+//
+// Application names may only contain lowercase letters, numbers and hyphens,
+// so runs of any other characters are replaced with a single hyphen.
+func AppName(name string) string {
+	name = illegalAppChars.ReplaceAllString(strings.ToLower(name), "-")
+	return strings.Trim(name, "-")
+}
@@ -0,0 +1,113 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestParseBranchMapDefault(t *testing.T) {
+	bm, err := ParseBranchMap("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bm.Unmapped != UnmappedReject {
+		t.Errorf("Expected default policy %q, got %q", UnmappedReject, bm.Unmapped)
+	}
+	if len(bm.Rules) != 1 || bm.Rules[0].Pattern != "master" || bm.Rules[0].App != "$APP" {
+		t.Errorf("Expected default rule master=$APP, got %v", bm.Rules)
+	}
+}
+
+func TestParseBranchMapErrors(t *testing.T) {
+	bad := []struct{ mapping, unmapped string }{
+		{"master", ""},
+		{"master=", ""},
+		{"=$APP", ""},
+		{"[=$APP", ""},
+		{"master=$APP", "explode"},
+	}
+	for _, b := range bad {
+		if _, err := ParseBranchMap(b.mapping, b.unmapped); err == nil {
+			t.Errorf("Expected error for mapping %q with policy %q", b.mapping, b.unmapped)
+		}
+	}
+}
+
+func TestBranchMapResolve(t *testing.T) {
+	bm, err := ParseBranchMap("master=$APP, review/*=$APP-$BRANCH staging=$APP-staging", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]string{
+		"refs/heads/master":         "myapp",
+		"refs/heads/review/foo":     "myapp-review-foo",
+		"refs/heads/review/Foo_Bar": "myapp-review-foo-bar",
+		"refs/heads/staging":        "myapp-staging",
+	}
+	for ref, app := range expect {
+		got, err := bm.Resolve("myapp", ref)
+		if err != nil {
+			t.Errorf("Unexpected error resolving %s: %s", ref, err)
+		} else if got != app {
+			t.Errorf("Expected %s to map to %s, got %s", ref, app, got)
+		}
+	}
+
+	if _, err := bm.Resolve("myapp", "refs/tags/v1.0"); err != ErrBranchIgnored {
+		t.Errorf("Expected tags to be ignored, got %v", err)
+	}
+	if _, err := bm.Resolve("myapp", "refs/heads/feature"); err == nil || err == ErrBranchIgnored {
+		t.Errorf("Expected unmapped branch to be rejected, got %v", err)
+	}
+
+	bm.Unmapped = UnmappedIgnore
+	if _, err := bm.Resolve("myapp", "refs/heads/feature"); err != ErrBranchIgnored {
+		t.Errorf("Expected unmapped branch to be ignored, got %v", err)
+	}
+}
+
+func TestBranchMapResolveEmptyBranch(t *testing.T) {
+	bm, err := ParseBranchMap("master=$APP *=$APP-$BRANCH", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"refs/heads/_", "refs/heads/--"} {
+		if app, err := bm.Resolve("myapp", ref); err == nil || err == ErrBranchIgnored {
+			t.Errorf("Expected %s to be rejected instead of deploying to %q, got %v", ref, app, err)
+		}
+	}
+}
+
+func TestBranchMapOnly(t *testing.T) {
+	only := map[string]string{
+		"":                          "myapp",
+		"master=prod":               "prod",
+		"master=$APP staging=$APP":  "myapp",
+		"master=prod staging=stage": "",
+		"review/*=$APP-$BRANCH":     "",
+	}
+	for mapping, expected := range only {
+		bm, err := ParseBranchMap(mapping, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if app, ok := bm.Only("myapp"); app != expected || ok != (expected != "") {
+			t.Errorf("Expected %q to deploy only to %q, got %q", mapping, expected, app)
+		}
+	}
+}
+
+func TestAppName(t *testing.T) {
+	names := map[string]string{
+		"myapp":            "myapp",
+		"MyApp":            "myapp",
+		"review/foo":       "review-foo",
+		"--feature__x--":   "feature-x",
+		"fix/#123 the bug": "fix-123-the-bug",
+	}
+	for in, out := range names {
+		if got := AppName(in); got != out {
+			t.Errorf("Expected %q to become %q, got %q", in, out, got)
+		}
+	}
+}
@@ -13,10 +13,13 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"text/template"
+	"time"
 
 	"github.com/Masterminds/cookoo"
 	"github.com/Masterminds/cookoo/log"
+	"github.com/deis/deis/builder/webhook"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -25,36 +28,56 @@ import (
 // This is overridable. The following template variables are passed into it:
 //
 // 	.GitHome: the path to Git's home directory.
+//
+// Each pushed ref is mapped to an application with map-branch, which reads
+// the branch mapping from the environment (see BranchMap).
+//
+// The hook does no locking of its own. Receive queues pushes so that only one
+// runs per repository at a time.
 var PrereceiveHookTpl = `#!/bin/bash
 strip_remote_prefix() {
     stdbuf -i0 -o0 -e0 sed "s/^/"$'\e[1G'"/"
 }
 
+# reject invalid push options (git push -o) before building anything
+if ! push-options check; then
+  echo "      ERROR: invalid push options - push denied"
+  exit 1
+fi
+
 while read oldrev newrev refname
 do
-  LOCKFILE="/tmp/$RECEIVE_REPO.lock"
-  if ( set -o noclobber; echo "$$" > "$LOCKFILE" ) 2> /dev/null; then
-	trap 'rm -f "$LOCKFILE"; exit 1' INT TERM EXIT
-
-	# check for authorization on this repo
-	{{.GitHome}}/receiver "$RECEIVE_REPO" "$newrev" "$RECEIVE_USER" "$RECEIVE_FINGERPRINT"
-	rc=$?
-	if [[ $rc != 0 ]] ; then
-	  echo "      ERROR: failed on rev $newrev - push denied"
-	  exit $rc
-	fi
-	# builder assumes that we are running this script from $GITHOME
-	cd {{.GitHome}}
-	# if we're processing a receive-pack on an existing repo, run a build
-	if [[ $SSH_ORIGINAL_COMMAND == git-receive-pack* ]]; then
-		{{.GitHome}}/builder "$RECEIVE_USER" "$RECEIVE_REPO" "$newrev" 2>&1 | strip_remote_prefix
-	fi
-
-	rm -f "$LOCKFILE"
-	trap - INT TERM EXIT
-  else
-	echo "Another git push is ongoing. Aborting..."
-	exit 1
+  # deleting a ref never triggers a build
+  if [[ $newrev =~ ^0+$ ]]; then
+	continue
+  fi
+
+  # find the application this ref deploys to
+  APP_NAME=$(map-branch "$RECEIVE_REPO" "$refname")
+  rc=$?
+  if [[ $rc != 0 ]] ; then
+	echo "      ERROR: failed on ref $refname - push denied"
+	exit $rc
+  fi
+  if [[ -z $APP_NAME ]]; then
+	continue
+  fi
+
+  # check for authorization on this repo
+  {{.GitHome}}/receiver "$RECEIVE_REPO" "$newrev" "$RECEIVE_USER" "$RECEIVE_FINGERPRINT" "$APP_NAME"
+  rc=$?
+  if [[ $rc != 0 ]] ; then
+	echo "      ERROR: failed on rev $newrev - push denied"
+	exit $rc
+  fi
+  # builder assumes that we are running this script from $GITHOME
+  cd {{.GitHome}}
+  # if we're processing a receive-pack on an existing repo, run a build
+  if [[ $SSH_ORIGINAL_COMMAND == git-receive-pack* ]]; then
+	# name the build, so that its log can be fetched later
+	export BUILD_UUID=$(cat /proc/sys/kernel/random/uuid)
+	echo "-----> Build $BUILD_UUID: run 'deis builds:logs $BUILD_UUID -a $APP_NAME' to view its log" | strip_remote_prefix
+	builder build "$RECEIVE_USER" "$RECEIVE_REPO" "$newrev" "$APP_NAME" 2>&1 | build-log "$APP_NAME" "$BUILD_UUID" | strip_remote_prefix
   fi
 done
 `
@@ -70,6 +93,14 @@ done
 // 	- gitHome (string): Defaults to /home/git.
 // 	- fingerprint (string): The fingerprint of the user's SSH key.
 // 	- user (string): The name of the Deis user.
+// 	- branchMap (string): Rules mapping branches to applications. See ParseBranchMap.
+// 	- unmappedBranches (string): Policy for unmapped branches, "reject" or "ignore".
+// 	- createApps (string): If "true", applications that a branch maps to are
+// 		created if they do not already exist.
+// 	- queue (*Queue): The build queue. If this is nil, pushes are not queued.
+// 	- hooks (*webhook.Notifier): Told when a push has to wait in the queue.
+// 	- logDir (string): The directory build logs are stored in.
+// 	- logRetention (string): The number of build logs kept per application.
 //
 // Returns:
 // 	- nothing
@@ -83,6 +114,21 @@ func Receive(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt)
 	gitHome := p.Get("gitHome", "/home/git").(string)
 	fingerprint := p.Get("fingerprint", nil).(string)
 	user := p.Get("user", "").(string)
+	branchMap := p.Get("branchMap", "").(string)
+	unmapped := p.Get("unmappedBranches", "").(string)
+	createApps := p.Get("createApps", "").(string)
+	queue, _ := p.Get("queue", nil).(*Queue)
+	hooks, _ := p.Get("hooks", nil).(*webhook.Notifier)
+	logDir := p.Get("logDir", "").(string)
+	logRetention := p.Get("logRetention", "").(string)
+
+	// Fail before receiving anything if the mapping cannot be used by the hook.
+	bm, err := ParseBranchMap(branchMap, unmapped)
+	if err != nil {
+		log.Errf(c, "Invalid branch mapping: %s", err)
+		channel.Stderr().Write([]byte("The builder's branch mapping is misconfigured. Contact your administrator.\n"))
+		return nil, err
+	}
 
 	repo, err := cleanRepoName(repoName)
 	if err != nil {
@@ -92,6 +138,30 @@ func Receive(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt)
 	}
 	repo += ".git"
 
+	// Only pushes build, so fetches skip the queue.
+	var ticket *Ticket
+	if queue != nil && operation == "git-receive-pack" {
+		ticket = queue.Enqueue(repo)
+		report := queueReporter(channel.Stderr(), repo, ticket)
+		stopWatching := make(chan bool)
+		go watchClient(channel, ticket, stopWatching)
+		queued := false
+		err := ticket.Wait(func(st Status) {
+			if !queued && hooks != nil {
+				hooks.Notify(&webhook.Event{Type: webhook.Queued, App: queuedApp(bm, repo), User: user})
+			}
+			queued = true
+			report(st)
+		})
+		close(stopWatching)
+		if err != nil {
+			log.Infof(c, "Push to %s was dropped from the queue: %s", repo, err)
+			fmt.Fprintf(channel.Stderr(), "-----> This push was %s. Aborting...\n", err)
+			return nil, err
+		}
+		defer ticket.Done()
+	}
+
 	if _, err := createRepo(c, filepath.Join(gitHome, repo), gitHome); err != nil {
 		log.Infof(c, "Did not create new repo: %s", err)
 	}
@@ -107,15 +177,32 @@ func Receive(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt)
 		fmt.Sprintf("RECEIVE_FINGERPRINT=%s", fingerprint),
 		fmt.Sprintf("SSH_ORIGINAL_COMMAND=%s '%s'", operation, repo),
 		fmt.Sprintf("SSH_CONNECTION=%s", c.Get("SSH_CONNECTION", "0 0 0 0").(string)),
+		fmt.Sprintf("DEIS_BRANCH_MAP=%s", branchMap),
+		fmt.Sprintf("DEIS_UNMAPPED_BRANCHES=%s", unmapped),
+		fmt.Sprintf("DEIS_BRANCH_CREATE_APPS=%s", createApps),
+		fmt.Sprintf("DEIS_BUILD_LOG_DIR=%s", logDir),
+		fmt.Sprintf("DEIS_BUILD_LOG_RETENTION=%s", logRetention),
 	}
 	cmd.Env = append(cmd.Env, os.Environ()...)
 
+	// Run the push in its own process group, so that the hook and the build
+	// can be killed along with it.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
 	done := plumbCommand(cmd, channel, &errbuff)
 
 	if err := cmd.Start(); err != nil {
 		log.Warnf(c, "Failed git receive immediately: %s %s", err, errbuff.Bytes())
 		return nil, err
 	}
+	if ticket != nil {
+		pid := cmd.Process.Pid
+		ticket.OnCancel(func(msg string) {
+			log.Warnf(c, "Killing push to %s (pid=%d): %s", repo, pid, msg)
+			fmt.Fprintf(channel.Stderr(), "\n-----> %s\n", msg)
+			syscall.Kill(-pid, syscall.SIGKILL)
+		})
+	}
 	fmt.Printf("Waiting for git-receive to run.\n")
 	done.Wait()
 	fmt.Printf("Waiting for deploy.\n")
@@ -131,6 +218,63 @@ func Receive(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt)
 	return nil, nil
 }
 
+// queuedApp returns the application a queued push to the repository is
+// reported for. The pushed branches are not known until the push starts, so
+// this is the application the branch mapping deploys every branch to, or the
+// application that owns the repository if the mapping depends on the branch.
+func queuedApp(bm *BranchMap, repo string) string {
+	app := strings.TrimSuffix(repo, ".git")
+	if only, ok := bm.Only(app); ok {
+		return only
+	}
+	return app
+}
+
+// queueReporter returns a function that tells the user about their place in
+// the queue. If the user cannot be told, the push is abandoned.
+func queueReporter(out io.Writer, repo string, ticket *Ticket) func(Status) {
+	app := strings.TrimSuffix(repo, ".git")
+	return func(st Status) {
+		var err error
+		switch {
+		case st.Stale:
+			_, err = fmt.Fprintf(out, "-----> The previous push to %s appears to be stuck. Cancelling it and waiting for it to stop.\n", app)
+		case st.Repo:
+			_, err = fmt.Fprintf(out, "-----> Another push to %s is in progress. Queued at position %d.\n", app, st.Position+1)
+		default:
+			_, err = fmt.Fprintf(out, "-----> All builders are busy. Queued at position %d.\n", st.Position+1)
+		}
+		if err != nil {
+			ticket.Abandon()
+		}
+	}
+}
+
+// clientProbeInterval is how often watchClient checks that a queued push's
+// client is still connected.
+var clientProbeInterval = 5 * time.Second
+
+// watchClient abandons a queued push once its client disconnects, until stop
+// is closed.
+//
+// The client sends nothing while it waits for the push to start, so it is
+// probed with a keepalive request, which fails once the channel is closed.
+func watchClient(channel ssh.Channel, ticket *Ticket, stop chan bool) {
+	ticker := time.NewTicker(clientProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := channel.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				ticket.Abandon()
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
 func execAs(user, cmd string, args ...string) *exec.Cmd {
 	fullCmd := cmd + " " + strings.Join(args, " ")
 	return exec.Command("su", user, "-c", fullCmd)
@@ -182,15 +326,35 @@ func initRepo(repoPath, gitHome string, c cookoo.Context) (bool, error) {
 		return false, err
 	}
 
-	hook, err := prereceiveHook(map[string]string{"GitHome": gitHome})
-	if err != nil {
+	if err := configureRepo(repoPath, gitHome); err != nil {
 		return true, err
 	}
-	ioutil.WriteFile(filepath.Join(repoPath, "hooks", "pre-receive"), hook, 0755)
 
 	return true, nil
 }
 
+// configureRepo (re)writes the pre-receive hook and the configuration of a repo.
+//
+// This is done on every push so that repos created by older builders pick up
+// changes to PrereceiveHookTpl and to the repo configuration.
+func configureRepo(repoPath, gitHome string) error {
+	hook, err := prereceiveHook(map[string]string{"GitHome": gitHome})
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(repoPath, "hooks", "pre-receive"), hook, 0755); err != nil {
+		return err
+	}
+
+	// Let clients send push options (git push -o) to the hook.
+	cmd := exec.Command("git", "config", "receive.advertisePushOptions", "true")
+	cmd.Dir = repoPath
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Failed to configure repo: %s %s", err, out)
+	}
+	return nil
+}
+
 // createRepo creates a new Git repo if it is not present already.
 //
 // Largely inspired by gitreceived from Flynn.
@@ -206,7 +370,7 @@ func createRepo(c cookoo.Context, repoPath, gitHome string) (bool, error) {
 			configPath := filepath.Join(repoPath, "config")
 			if _, cerr := os.Stat(configPath); cerr == nil {
 				log.Debugf(c, "Directory '%s' already exists.", repoPath)
-				return true, nil
+				return true, configureRepo(repoPath, gitHome)
 			} else {
 				log.Warnf(c, "No config file found at `%s`; removing it and recreating.", repoPath)
 				if err := os.RemoveAll(repoPath); err != nil {
@@ -0,0 +1,97 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Push options understood by the builder. Users set them with `git push -o`.
+const (
+	// OptionNoCache builds without the application's build cache.
+	OptionNoCache = "no-cache"
+	// OptionResetCache empties the application's build cache before building.
+	OptionResetCache = "reset-cache"
+	// OptionNoDeploy builds and stores the image, but does not release it.
+	OptionNoDeploy = "no-deploy"
+	// OptionBuildpack overrides the buildpack used for this build.
+	OptionBuildpack = "buildpack"
+	// OptionMessage is a free-form description recorded with the build.
+	OptionMessage = "message"
+)
+
+// maxMessage is the maximum length of a message push option.
+const maxMessage = 1024
+
+// pushOptionNames lists the supported push options, for error messages.
+var pushOptionNames = []string{OptionBuildpack, OptionMessage, OptionNoCache, OptionNoDeploy, OptionResetCache}
+
+// buildpackURL matches buildpack URLs that are safe to hand to the build.
+var buildpackURL = regexp.MustCompile(`^(https?|git)://[-A-Za-z0-9._~:/?#@!&=+%,]+$`)
+
+// ParsePushOptions validates the push options of a push, and returns them
+// as a map.
+//
+// Options are either flags (e.g. "no-cache") or KEY=VALUE pairs (e.g.
+// "buildpack=https://github.com/heroku/heroku-buildpack-go"). Flags that are
+// set map to "true"; flags explicitly set to false are omitted. If an option
+// is given more than once, the last value wins.
+func ParsePushOptions(opts []string) (map[string]string, error) {
+	parsed := map[string]string{}
+	for _, opt := range opts {
+		parts := strings.SplitN(opt, "=", 2)
+		key := parts[0]
+		value, hasValue := "", len(parts) == 2
+		if hasValue {
+			value = parts[1]
+		}
+
+		switch key {
+		case OptionNoCache, OptionNoDeploy, OptionResetCache:
+			set := true
+			if hasValue {
+				var err error
+				if set, err = strconv.ParseBool(value); err != nil {
+					return nil, fmt.Errorf("Push option %s takes no value, or true/false", key)
+				}
+			}
+			if set {
+				parsed[key] = "true"
+			} else {
+				delete(parsed, key)
+			}
+		case OptionBuildpack:
+			if !buildpackURL.MatchString(value) {
+				return nil, fmt.Errorf("Push option %s must be an http(s) or git URL", key)
+			}
+			parsed[key] = value
+		case OptionMessage:
+			if len(value) > maxMessage {
+				return nil, fmt.Errorf("Push option %s may be at most %d bytes", key, maxMessage)
+			}
+			if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+				return nil, fmt.Errorf("Push option %s may not contain control characters", key)
+			}
+			parsed[key] = value
+		default:
+			return nil, fmt.Errorf("Unknown push option %q. Supported options: %s", key, strings.Join(pushOptionNames, ", "))
+		}
+	}
+	return parsed, nil
+}
+
+// PushOptionsFromEnv returns the push options git passes to hooks in the
+// GIT_PUSH_OPTION_COUNT and GIT_PUSH_OPTION_<n> environment variables.
+func PushOptionsFromEnv(getenv func(string) string) []string {
+	count, err := strconv.Atoi(getenv("GIT_PUSH_OPTION_COUNT"))
+	if err != nil || count < 0 {
+		return []string{}
+	}
+	opts := make([]string, count)
+	for i := range opts {
+		opts[i] = getenv(fmt.Sprintf("GIT_PUSH_OPTION_%d", i))
+	}
+	return opts
+}
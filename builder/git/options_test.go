@@ -0,0 +1,63 @@
+package git
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePushOptions(t *testing.T) {
+	opts, err := ParsePushOptions([]string{
+		"no-cache",
+		"no-deploy=true",
+		"no-deploy=false",
+		"buildpack=https://github.com/heroku/heroku-buildpack-go#v22",
+		"message=Fix the login page",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]string{
+		"no-cache":  "true",
+		"buildpack": "https://github.com/heroku/heroku-buildpack-go#v22",
+		"message":   "Fix the login page",
+	}
+	if !reflect.DeepEqual(opts, expect) {
+		t.Errorf("Expected %v, got %v", expect, opts)
+	}
+}
+
+func TestParsePushOptionsErrors(t *testing.T) {
+	bad := []string{
+		"explode",
+		"no-cache=maybe",
+		"buildpack=",
+		"buildpack=file:///etc/passwd",
+		"buildpack=https://example.com/$(reboot)",
+		"buildpack=https://example.com/a b",
+		"message=line\nbreak",
+	}
+	for _, opt := range bad {
+		if _, err := ParsePushOptions([]string{opt}); err == nil {
+			t.Errorf("Expected an error for push option %q", opt)
+		}
+	}
+}
+
+func TestPushOptionsFromEnv(t *testing.T) {
+	env := map[string]string{
+		"GIT_PUSH_OPTION_COUNT": "2",
+		"GIT_PUSH_OPTION_0":     "no-cache",
+		"GIT_PUSH_OPTION_1":     "message=hi",
+	}
+	getenv := func(k string) string { return env[k] }
+
+	expect := []string{"no-cache", "message=hi"}
+	if opts := PushOptionsFromEnv(getenv); !reflect.DeepEqual(opts, expect) {
+		t.Errorf("Expected %v, got %v", expect, opts)
+	}
+
+	if opts := PushOptionsFromEnv(func(string) string { return "" }); len(opts) != 0 {
+		t.Errorf("Expected no options without git's variables, got %v", opts)
+	}
+}
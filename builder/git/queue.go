@@ -0,0 +1,399 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/cookoo"
+	"github.com/Masterminds/cookoo/log"
+)
+
+// ErrSuperseded indicates that a queued push was replaced by a newer push to
+// the same repository before it could start.
+var ErrSuperseded = errors.New("superseded by a newer push")
+
+// ErrShuttingDown indicates that a queued push was dropped because the
+// builder is shutting down.
+var ErrShuttingDown = errors.New("rejected because the builder is shutting down")
+
+// ErrAbandoned indicates that a queued push was dropped because the client
+// that made it went away.
+var ErrAbandoned = errors.New("abandoned by the client")
+
+// Messages passed to a push's cancel function.
+const (
+	CancelStale    = "This push took too long and was cancelled."
+	CancelShutdown = "The builder is shutting down, so this push was cancelled. Please push again."
+)
+
+// Queue orders pushes so that only one build per repository runs at a time,
+// and at most Max builds run concurrently on this builder.
+//
+// Pushes wait in arrival order. A push that could run but is held back by the
+// global limit also holds back every push that arrived after it, so no push
+// starves.
+type Queue struct {
+	// Max is the maximum number of concurrent builds. Zero means unlimited.
+	Max int
+	// Supersede causes a push to replace any push to the same repository that
+	// is still waiting, instead of queueing behind it.
+	Supersede bool
+	// StaleAfter is how long a build may hold its repository before it is
+	// considered stuck and cancelled. Zero disables the check.
+	StaleAfter time.Duration
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	running int
+	pending []*Ticket
+	active  map[string]*Ticket
+	closed  bool
+	// tick is how often waiting pushes re-check the queue for stale builds.
+	tick time.Duration
+}
+
+// NewQueue creates a new build queue.
+func NewQueue(max int, supersede bool, staleAfter time.Duration) *Queue {
+	q := &Queue{
+		Max:        max,
+		Supersede:  supersede,
+		StaleAfter: staleAfter,
+		active:     map[string]*Ticket{},
+		tick:       time.Second,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// CreateQueue creates the build queue shared by all pushes to this builder.
+//
+// Settings are passed as strings, as they are usually read from etcd.
+//
+// Params:
+// 	- max (string): Maximum number of concurrent builds. "0" means unlimited.
+// 	- supersede (string): If "true", a push replaces a waiting push to the same repo.
+// 	- staleAfter (string): Duration after which a running build is considered
+// 		stuck, e.g. "1h". "0" disables the check.
+//
+// Returns:
+// 	- *Queue
+func CreateQueue(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	max, err := strconv.Atoi(p.Get("max", "0").(string))
+	if err != nil || max < 0 {
+		return nil, fmt.Errorf("Illegal maximum number of concurrent builds: %v", p.Get("max", ""))
+	}
+	staleAfter, err := time.ParseDuration(p.Get("staleAfter", "0").(string))
+	if err != nil {
+		return nil, fmt.Errorf("Illegal stale build timeout: %s", err)
+	}
+	supersede := p.Get("supersede", "false").(string) == "true"
+
+	log.Infof(c, "Build queue: max=%d supersede=%t staleAfter=%s", max, supersede, staleAfter)
+	return NewQueue(max, supersede, staleAfter), nil
+}
+
+// DrainQueue stops the build queue and waits for running builds to finish.
+//
+// Queued pushes are rejected right away. Builds that are still running when
+// the timeout expires are cancelled, and their users are told to push again.
+//
+// Params:
+// 	- queue (*Queue): The build queue.
+// 	- timeout (string): How long to wait for running builds, e.g. "5m".
+//
+// Returns:
+// 	- bool: true if every build finished on its own.
+func DrainQueue(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	q, ok := p.Get("queue", nil).(*Queue)
+	if !ok {
+		return true, nil
+	}
+	timeout, err := time.ParseDuration(p.Get("timeout", "0").(string))
+	if err != nil {
+		log.Errf(c, "Illegal shutdown timeout, not waiting for builds: %s", err)
+	}
+
+	q.Close()
+	log.Infof(c, "Waiting up to %s for running builds to finish.", timeout)
+	if q.WaitIdle(timeout) {
+		return true, nil
+	}
+
+	n := q.CancelAll(CancelShutdown)
+	log.Warnf(c, "Cancelled %d running builds.", n)
+	if !q.WaitIdle(cancelGrace) {
+		log.Errf(c, "Builds are still running after being cancelled.")
+	}
+	return false, nil
+}
+
+// cancelGrace is how long DrainQueue waits for cancelled builds to exit.
+const cancelGrace = 10 * time.Second
+
+// Ticket is a place in a Queue.
+type Ticket struct {
+	Repo string
+
+	q          *Queue
+	started    time.Time
+	superseded bool
+	abandoned  bool
+	released   bool
+	cancelling bool
+	cancel     func(string)
+}
+
+// Status describes why a Ticket is waiting.
+type Status struct {
+	// Position is the number of pushes ahead of this one.
+	Position int
+	// Repo is true if the push is waiting for another push to the same repository.
+	Repo bool
+	// Stale is true if the push holding the repository is stuck, and is
+	// being cancelled. The push waits until the stuck one has exited.
+	Stale bool
+}
+
+// Enqueue adds a push to the repository to the end of the queue.
+func (q *Queue) Enqueue(repo string) *Ticket {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	t := &Ticket{Repo: repo, q: q}
+	if q.Supersede {
+		kept := q.pending[:0]
+		for _, p := range q.pending {
+			if p.Repo == repo {
+				p.superseded = true
+				continue
+			}
+			kept = append(kept, p)
+		}
+		q.pending = kept
+		q.cond.Broadcast()
+	}
+	q.pending = append(q.pending, t)
+	return t
+}
+
+// Wait blocks until the push may start.
+//
+// Every time the push's place in the queue changes, report is called with
+// its new status. report is called without holding the queue lock, so a slow
+// client does not hold up other pushes.
+//
+// Wait returns ErrSuperseded if a newer push replaced this one,
+// ErrShuttingDown if the queue was closed, and ErrAbandoned if the push was
+// abandoned.
+func (t *Ticket) Wait(report func(Status)) error {
+	q := t.q
+
+	stop := make(chan bool)
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(q.tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				q.cond.Broadcast()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	last := Status{Position: -1}
+	for {
+		if t.superseded {
+			return ErrSuperseded
+		}
+		if t.abandoned {
+			q.removePending(t)
+			q.cond.Broadcast()
+			return ErrAbandoned
+		}
+		if q.closed {
+			q.removePending(t)
+			return ErrShuttingDown
+		}
+
+		st, ok := q.status(t)
+		if report != nil && !ok && st != last {
+			// Report outside the lock, then look at the queue again, since
+			// it may have changed in the meantime.
+			last = st
+			q.mu.Unlock()
+			report(st)
+			q.mu.Lock()
+			continue
+		}
+		if ok {
+			q.removePending(t)
+			q.active[t.Repo] = t
+			q.running++
+			t.started = time.Now()
+			return nil
+		}
+		last = st
+		q.cond.Wait()
+	}
+}
+
+// Abandon drops a push that is still waiting, such as when its client
+// disconnected. It has no effect once the push has started.
+func (t *Ticket) Abandon() {
+	q := t.q
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t.started.IsZero() {
+		t.abandoned = true
+		q.cond.Broadcast()
+	}
+}
+
+// OnCancel registers the function that cancels the push if it goes stale, or
+// if the builder shuts down before it finishes. fn is passed a message for
+// the user.
+func (t *Ticket) OnCancel(fn func(string)) {
+	t.q.mu.Lock()
+	t.cancel = fn
+	t.q.mu.Unlock()
+}
+
+// Done releases the push's hold on its repository and on a build slot.
+func (t *Ticket) Done() {
+	q := t.q
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.release(t)
+}
+
+// Stats returns the number of builds running and of pushes waiting.
+func (q *Queue) Stats() (running, waiting int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.running, len(q.pending)
+}
+
+// Close stops the queue. Pushes that are waiting, and pushes that arrive
+// later, fail with ErrShuttingDown. Running builds are not affected.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// WaitIdle blocks until no builds are running, or until the timeout expires.
+// It returns false if builds are still running.
+func (q *Queue) WaitIdle(timeout time.Duration) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	expired := false
+	timer := time.AfterFunc(timeout, func() {
+		q.mu.Lock()
+		expired = true
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	for q.running > 0 && !expired {
+		q.cond.Wait()
+	}
+	return q.running == 0
+}
+
+// CancelAll cancels every running build, passing msg to its cancel function.
+// It returns the number of builds cancelled.
+func (q *Queue) CancelAll(msg string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for _, t := range q.active {
+		if t.cancel != nil {
+			go t.cancel(msg)
+			n++
+		}
+	}
+	return n
+}
+
+// status computes whether t may start, and if not, why.
+//
+// Callers must hold the queue lock.
+func (q *Queue) status(t *Ticket) (Status, bool) {
+	st := Status{}
+	blocked := false
+
+	if active, ok := q.active[t.Repo]; ok {
+		st.Repo = true
+		blocked = true
+		if q.StaleAfter > 0 && time.Since(active.started) > q.StaleAfter {
+			// The build holding the repository is stuck. Cancel it, but
+			// keep its place until it has exited and called Done, so that
+			// two builds never write the repository at once.
+			if active.cancel != nil && !active.cancelling {
+				active.cancelling = true
+				go active.cancel(CancelStale)
+			}
+			st.Stale = true
+		}
+	}
+
+	for _, p := range q.pending {
+		if p == t {
+			break
+		}
+		if p.Repo == t.Repo {
+			st.Repo = true
+			blocked = true
+			st.Position++
+		} else if _, busy := q.active[p.Repo]; !busy {
+			// An earlier push is only waiting for a build slot.
+			blocked = true
+			st.Position++
+		}
+	}
+
+	if q.Max > 0 && q.running >= q.Max {
+		blocked = true
+	}
+	return st, !blocked
+}
+
+// release frees the resources held by a running push.
+//
+// Callers must hold the queue lock.
+func (q *Queue) release(t *Ticket) {
+	if t.released || t.started.IsZero() {
+		return
+	}
+	t.released = true
+	if q.active[t.Repo] == t {
+		delete(q.active, t.Repo)
+	}
+	q.running--
+	q.cond.Broadcast()
+}
+
+// removePending removes a ticket from the pending list.
+//
+// Callers must hold the queue lock.
+func (q *Queue) removePending(t *Ticket) {
+	for i, p := range q.pending {
+		if p == t {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return
+		}
+	}
+}
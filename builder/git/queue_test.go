@@ -0,0 +1,251 @@
+package git
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitAsync waits on a ticket in the background, returning the result of
+// Wait on the returned channel.
+func waitAsync(t *Ticket, report func(Status)) chan error {
+	res := make(chan error, 1)
+	go func() { res <- t.Wait(report) }()
+	return res
+}
+
+func expectBlocked(t *testing.T, res chan error, msg string) {
+	select {
+	case err := <-res:
+		t.Fatalf("%s: expected push to wait, but Wait returned %v", msg, err)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func expectStarted(t *testing.T, res chan error, msg string) {
+	select {
+	case err := <-res:
+		if err != nil {
+			t.Fatalf("%s: unexpected error %s", msg, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("%s: push never started", msg)
+	}
+}
+
+func TestQueueSerializesRepo(t *testing.T) {
+	q := NewQueue(0, false, 0)
+
+	first := q.Enqueue("myapp.git")
+	if err := first.Wait(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var reports []Status
+	second := q.Enqueue("myapp.git")
+	res := waitAsync(second, func(st Status) { reports = append(reports, st) })
+	expectBlocked(t, res, "same repo")
+
+	// Other repos are not held back.
+	other := q.Enqueue("otherapp.git")
+	expectStarted(t, waitAsync(other, nil), "other repo")
+	other.Done()
+
+	first.Done()
+	expectStarted(t, res, "same repo")
+	second.Done()
+
+	if len(reports) != 1 || !reports[0].Repo || reports[0].Position != 0 {
+		t.Errorf("Expected one report of waiting for the repo, got %v", reports)
+	}
+}
+
+func TestQueueMax(t *testing.T) {
+	q := NewQueue(1, false, 0)
+
+	first := q.Enqueue("a.git")
+	if err := first.Wait(nil); err != nil {
+		t.Fatal(err)
+	}
+	second := q.Enqueue("b.git")
+	third := q.Enqueue("c.git")
+
+	var reports []Status
+	res2 := waitAsync(second, nil)
+	res3 := waitAsync(third, func(st Status) { reports = append(reports, st) })
+	expectBlocked(t, res2, "second")
+	expectBlocked(t, res3, "third")
+
+	if running, waiting := q.Stats(); running != 1 || waiting != 2 {
+		t.Errorf("Expected 1 running and 2 waiting, got %d and %d", running, waiting)
+	}
+
+	first.Done()
+	expectStarted(t, res2, "second")
+	expectBlocked(t, res3, "third")
+
+	second.Done()
+	expectStarted(t, res3, "third")
+	third.Done()
+
+	if len(reports) == 0 || reports[0].Repo || reports[0].Position != 1 {
+		t.Errorf("Expected third push to start at position 1, got %v", reports)
+	}
+}
+
+func TestQueueSupersede(t *testing.T) {
+	q := NewQueue(0, true, 0)
+
+	first := q.Enqueue("myapp.git")
+	if err := first.Wait(nil); err != nil {
+		t.Fatal(err)
+	}
+	second := q.Enqueue("myapp.git")
+	res2 := waitAsync(second, nil)
+	expectBlocked(t, res2, "second")
+
+	third := q.Enqueue("myapp.git")
+	select {
+	case err := <-res2:
+		if err != ErrSuperseded {
+			t.Errorf("Expected ErrSuperseded, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected second push to be superseded")
+	}
+
+	res3 := waitAsync(third, nil)
+	expectBlocked(t, res3, "third")
+	first.Done()
+	expectStarted(t, res3, "third")
+	third.Done()
+}
+
+func TestQueueStale(t *testing.T) {
+	q := NewQueue(0, false, 20*time.Millisecond)
+	q.tick = 10 * time.Millisecond
+
+	cancelled := make(chan bool, 4)
+	first := q.Enqueue("myapp.git")
+	if err := first.Wait(nil); err != nil {
+		t.Fatal(err)
+	}
+	first.OnCancel(func(msg string) { cancelled <- msg == CancelStale })
+
+	var mu sync.Mutex
+	stale := 0
+	second := q.Enqueue("myapp.git")
+	res := waitAsync(second, func(st Status) {
+		mu.Lock()
+		defer mu.Unlock()
+		if st.Stale {
+			stale++
+		}
+	})
+
+	select {
+	case ok := <-cancelled:
+		if !ok {
+			t.Error("Expected the stale push to be cancelled with CancelStale")
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the stale push to be cancelled")
+	}
+	// The stale push keeps the repository until it has exited.
+	expectBlocked(t, res, "second")
+	if len(cancelled) != 0 {
+		t.Error("Expected the stale push to be cancelled once")
+	}
+
+	first.Done()
+	expectStarted(t, res, "second")
+	mu.Lock()
+	if stale != 1 {
+		t.Errorf("Expected the stale push to be reported once, got %d", stale)
+	}
+	mu.Unlock()
+	if q.running != 1 {
+		t.Errorf("Expected one running build, got %d", q.running)
+	}
+	second.Done()
+}
+
+func TestQueueShutdown(t *testing.T) {
+	q := NewQueue(1, false, 0)
+
+	first := q.Enqueue("myapp.git")
+	if err := first.Wait(nil); err != nil {
+		t.Fatal(err)
+	}
+	cancelled := make(chan string, 1)
+	first.OnCancel(func(msg string) {
+		cancelled <- msg
+		first.Done()
+	})
+
+	res := waitAsync(q.Enqueue("other.git"), nil)
+	expectBlocked(t, res, "second")
+
+	q.Close()
+	select {
+	case err := <-res:
+		if err != ErrShuttingDown {
+			t.Errorf("Expected ErrShuttingDown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the queued push to be rejected")
+	}
+	if err := q.Enqueue("late.git").Wait(nil); err != ErrShuttingDown {
+		t.Errorf("Expected ErrShuttingDown for a new push, got %v", err)
+	}
+
+	if q.WaitIdle(20 * time.Millisecond) {
+		t.Fatal("Expected the running build to hold up WaitIdle")
+	}
+	if n := q.CancelAll(CancelShutdown); n != 1 {
+		t.Errorf("Expected one build to be cancelled, got %d", n)
+	}
+	if msg := <-cancelled; msg != CancelShutdown {
+		t.Errorf("Unexpected cancel message %q", msg)
+	}
+	if !q.WaitIdle(time.Second) {
+		t.Error("Expected the queue to be idle after cancelling")
+	}
+}
+
+func TestQueueAbandon(t *testing.T) {
+	q := NewQueue(1, false, 0)
+
+	first := q.Enqueue("myapp.git")
+	if err := first.Wait(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// A client that does not read its reports must not hold up the queue.
+	stalled := make(chan bool)
+	second := q.Enqueue("other.git")
+	res := waitAsync(second, func(Status) { <-stalled })
+	expectBlocked(t, res, "stalled")
+	if running, waiting := q.Stats(); running != 1 || waiting != 1 {
+		t.Errorf("Expected 1 running and 1 waiting, got %d and %d", running, waiting)
+	}
+
+	second.Abandon()
+	close(stalled)
+	select {
+	case err := <-res:
+		if err != ErrAbandoned {
+			t.Errorf("Expected ErrAbandoned, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the abandoned push to be dropped")
+	}
+	if _, waiting := q.Stats(); waiting != 0 {
+		t.Errorf("Expected the abandoned push to leave the queue, got %d waiting", waiting)
+	}
+
+	first.Done()
+	third := q.Enqueue("third.git")
+	expectStarted(t, waitAsync(third, nil), "after abandon")
+	third.Done()
+}
@@ -0,0 +1,276 @@
+// Package httpd provides the builder's HTTP API.
+//
+// The API is used by the controller, which proxies it to users. Every request
+// but health checks must carry the builder key in the X-Deis-Builder-Auth
+// header, the same key the builder uses to authenticate to the controller.
+package httpd
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/cookoo"
+	"github.com/Masterminds/cookoo/log"
+	"github.com/Masterminds/cookoo/safely"
+	"github.com/deis/deis/builder/buildlog"
+	"github.com/deis/deis/builder/cache"
+	"github.com/deis/deis/builder/slugs"
+	"github.com/deis/deis/builder/status"
+	"github.com/deis/deis/builder/webhook"
+)
+
+// AuthHeader is the header that carries the builder key.
+const AuthHeader = "X-Deis-Builder-Auth"
+
+// Server serves the builder's HTTP API.
+type Server struct {
+	// Logs is the store of build logs.
+	Logs *buildlog.Store
+	// Caches is the store of build caches.
+	Caches *cache.Store
+	// Slugs is the store of compiled slugs. If it is nil, no slugs are served.
+	Slugs *slugs.Store
+	// Hooks delivers build events to webhooks. If it is nil, events are dropped.
+	Hooks *webhook.Notifier
+	// Monitor checks readiness and collects metrics. If it is nil, the
+	// builder reports itself ready and has no metrics.
+	Monitor *status.Monitor
+	// Key returns the current builder key.
+	Key func() (string, error)
+
+	mux *http.ServeMux
+}
+
+// NewServer creates a new API server.
+func NewServer(logs *buildlog.Store, caches *cache.Store, key func() (string, error)) *Server {
+	s := &Server{Logs: logs, Caches: caches, Key: key, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/logs/", s.serveLog)
+	s.mux.HandleFunc("/caches/", s.serveCache)
+	s.mux.HandleFunc("/slugs/", s.serveSlug)
+	s.mux.HandleFunc("/events", s.serveEvent)
+	s.mux.HandleFunc("/health", s.serveHealth)
+	s.mux.HandleFunc("/metrics", s.serveMetrics)
+	return s
+}
+
+// ServeHTTP authenticates a request, then dispatches it to its handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Health checks come from load balancers and schedulers, which do not
+	// have the key. They reveal nothing about applications.
+	if r.URL.Path == "/health" {
+		s.mux.ServeHTTP(w, r)
+		return
+	}
+	key, err := s.Key()
+	if err != nil || len(key) == 0 {
+		http.Error(w, "builder key unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	given := r.Header.Get(AuthHeader)
+	if subtle.ConstantTimeCompare([]byte(given), []byte(key)) != 1 {
+		http.Error(w, "invalid builder key", http.StatusUnauthorized)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// serveLog serves GET /logs/$app/$uuid.
+//
+// If the query parameter follow is "true", the output of a running build is
+// streamed until the build ends.
+func (s *Server) serveLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/logs/"), "/"), "/")
+	if len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	app, id := parts[0], parts[1]
+
+	f, err := s.Logs.Open(app, id)
+	if err == buildlog.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if r.URL.Query().Get("follow") != "true" {
+		defer f.Close()
+		io.Copy(w, f)
+		return
+	}
+	f.Close()
+
+	var flush func()
+	if fl, ok := w.(http.Flusher); ok {
+		flush = fl.Flush
+	}
+	var stop <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		stop = cn.CloseNotify()
+	}
+	s.Logs.Follow(w, app, id, flush, stop)
+}
+
+// serveCache serves GET /caches/$app, which describes an application's
+// build cache, and DELETE /caches/$app, which purges it.
+func (s *Server) serveCache(w http.ResponseWriter, r *http.Request) {
+	app := strings.Trim(strings.TrimPrefix(r.URL.Path, "/caches/"), "/")
+	if len(app) == 0 || strings.Contains(app, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		u, err := s.Caches.Stat(app)
+		if err == cache.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(u)
+	case "DELETE":
+		switch err := s.Caches.Purge(app); err {
+		case nil:
+			w.WriteHeader(http.StatusNoContent)
+		case cache.ErrNotFound:
+			http.NotFound(w, r)
+		case cache.ErrInUse:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveSlug serves GET /slugs/$app/$uuid, the slug compiled by a build.
+func (s *Server) serveSlug(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/slugs/"), "/"), "/")
+	if len(parts) != 2 || s.Slugs == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := s.Slugs.Open(parts[0], parts[1])
+	if err == slugs.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/gzip")
+	if fi, err := f.Stat(); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+	}
+	io.Copy(w, f)
+}
+
+// serveEvent serves POST /events, through which builds report their progress
+// to be sent to webhooks.
+func (s *Server) serveEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var e webhook.Event
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil || len(e.Type) == 0 || len(e.App) == 0 {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+	if s.Hooks != nil {
+		s.Hooks.Notify(&e)
+	}
+	if s.Monitor != nil {
+		s.Monitor.Record(&e)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// serveHealth serves GET /health, which reports whether the builder is ready
+// to take pushes. It answers 503 Service Unavailable if it is not.
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h := &status.Health{Ready: true, Checks: map[string]string{}}
+	if s.Monitor != nil {
+		h = s.Monitor.Health()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !h.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(h)
+}
+
+// serveMetrics serves GET /metrics, the builder's connection and build metrics.
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.Monitor == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Monitor.Metrics())
+}
+
+// Serve starts the builder's HTTP API in the background.
+//
+// Params:
+// 	- address (string): The address to listen on, e.g. ":2224".
+// 	- logDir (string): The directory build logs are stored in.
+// 	- caches (*cache.Store): The store of build caches.
+// 	- slugDir (string): The directory compiled slugs are kept in.
+// 	- hooks (*webhook.Notifier): Delivers build events to webhooks.
+// 	- monitor (*status.Monitor): Checks readiness and collects metrics.
+// 	- key (func() (string, error)): Returns the current builder key.
+//
+// Returns:
+// 	- *Server
+func Serve(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	addr := p.Get("address", ":2224").(string)
+	logDir := p.Get("logDir", buildlog.DefaultDir).(string)
+	caches, ok := p.Get("caches", nil).(*cache.Store)
+	if !ok {
+		caches = cache.NewStore(cache.DefaultDir, 0)
+	}
+	key := p.Get("key", nil).(func() (string, error))
+
+	s := NewServer(buildlog.NewStore(logDir, 0), caches, key)
+	s.Slugs = slugs.NewStore(p.Get("slugDir", slugs.DefaultDir).(string), 0)
+	s.Hooks, _ = p.Get("hooks", nil).(*webhook.Notifier)
+	s.Monitor, _ = p.Get("monitor", nil).(*status.Monitor)
+	safely.GoDo(c, func() {
+		log.Infof(c, "HTTP API listening on %s", addr)
+		if err := http.ListenAndServe(addr, s); err != nil {
+			log.Errf(c, "HTTP API stopped: %s", err)
+		}
+	})
+	return s, nil
+}
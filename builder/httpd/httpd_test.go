@@ -0,0 +1,227 @@
+package httpd
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deis/deis/builder/buildlog"
+	"github.com/deis/deis/builder/cache"
+	"github.com/deis/deis/builder/slugs"
+	"github.com/deis/deis/builder/status"
+	"github.com/deis/deis/builder/webhook"
+)
+
+func testServer(t *testing.T) (*Server, *buildlog.Store) {
+	dir, err := ioutil.TempDir("", "httpd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := buildlog.NewStore(dir, 0)
+	key := func() (string, error) { return "secret", nil }
+	caches := cache.NewStore(filepath.Join(dir, "caches"), 0)
+	return NewServer(logs, caches, key), logs
+}
+
+func get(s *Server, path, key string) *httptest.ResponseRecorder {
+	return request(s, "GET", path, key)
+}
+
+func request(s *Server, method, path, key string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	if len(key) > 0 {
+		req.Header.Set(AuthHeader, key)
+	}
+	res := httptest.NewRecorder()
+	s.ServeHTTP(res, req)
+	return res
+}
+
+func TestAuth(t *testing.T) {
+	s, logs := testServer(t)
+	defer os.RemoveAll(logs.Dir)
+
+	for _, key := range []string{"", "wrong"} {
+		if res := get(s, "/logs/myapp/abcd", key); res.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for key %q, got %d", key, res.Code)
+		}
+	}
+}
+
+func TestServeLog(t *testing.T) {
+	s, logs := testServer(t)
+	defer os.RemoveAll(logs.Dir)
+
+	f, err := logs.Create("myapp", "abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("-----> Building\n"))
+	f.Close()
+
+	for _, path := range []string{"/logs/myapp/abcd", "/logs/myapp/abcd?follow=true"} {
+		res := get(s, path, "secret")
+		if res.Code != http.StatusOK {
+			t.Errorf("Expected 200 for %s, got %d", path, res.Code)
+		}
+		if res.Body.String() != "-----> Building\n" {
+			t.Errorf("Unexpected log for %s: %q", path, res.Body.String())
+		}
+	}
+
+	if res := get(s, "/logs/myapp/nope", "secret"); res.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing log, got %d", res.Code)
+	}
+	if res := get(s, "/logs/myapp", "secret"); res.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a malformed path, got %d", res.Code)
+	}
+}
+
+func TestServeCache(t *testing.T) {
+	s, logs := testServer(t)
+	defer os.RemoveAll(logs.Dir)
+
+	if res := get(s, "/caches/myapp", "secret"); res.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing cache, got %d", res.Code)
+	}
+
+	l, err := s.Caches.Acquire("myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(l.Dir, "blob"), make([]byte, 10), 0644)
+
+	res := get(s, "/caches/myapp", "secret")
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", res.Code)
+	}
+	var u cache.Usage
+	if err := json.Unmarshal(res.Body.Bytes(), &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.App != "myapp" || u.Size != 10 || !u.InUse {
+		t.Errorf("Unexpected cache usage %+v", u)
+	}
+	if res := request(s, "DELETE", "/caches/myapp", "secret"); res.Code != http.StatusConflict {
+		t.Errorf("Expected 409 purging a cache in use, got %d", res.Code)
+	}
+
+	l.Release()
+	if res := request(s, "DELETE", "/caches/myapp", "secret"); res.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", res.Code)
+	}
+	if res := request(s, "DELETE", "/caches/myapp", "secret"); res.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 purging a missing cache, got %d", res.Code)
+	}
+}
+
+func TestServeSlug(t *testing.T) {
+	s, logs := testServer(t)
+	defer os.RemoveAll(logs.Dir)
+
+	if res := get(s, "/slugs/myapp/abcd", "secret"); res.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a slug store, got %d", res.Code)
+	}
+
+	s.Slugs = slugs.NewStore(filepath.Join(logs.Dir, "slugs"), 0)
+	src := filepath.Join(logs.Dir, "slug.tgz")
+	ioutil.WriteFile(src, []byte("slug"), 0644)
+	if err := s.Slugs.Save("myapp", "abcd", src); err != nil {
+		t.Fatal(err)
+	}
+
+	res := get(s, "/slugs/myapp/abcd", "secret")
+	if res.Code != http.StatusOK || res.Body.String() != "slug" {
+		t.Errorf("Expected the slug, got %d %q", res.Code, res.Body.String())
+	}
+	if ct := res.Header().Get("Content-Type"); ct != "application/gzip" {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+	if res := get(s, "/slugs/myapp/nope", "secret"); res.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing slug, got %d", res.Code)
+	}
+}
+
+func TestServeEvent(t *testing.T) {
+	s, logs := testServer(t)
+	defer os.RemoveAll(logs.Dir)
+
+	events := make(chan string, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events <- r.Header.Get(webhook.EventHeader)
+	}))
+	defer hook.Close()
+	s.Hooks = webhook.NewNotifier(func(key string) (string, error) {
+		if key == webhook.PlatformKey {
+			return hook.URL, nil
+		}
+		return "", os.ErrNotExist
+	})
+
+	post := func(body string) int {
+		req, _ := http.NewRequest("POST", "/events", strings.NewReader(body))
+		req.Header.Set(AuthHeader, "secret")
+		res := httptest.NewRecorder()
+		s.ServeHTTP(res, req)
+		return res.Code
+	}
+	if code := post(`{"event": "started"}`); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an event without an app, got %d", code)
+	}
+	if code := post(`{"event": "started", "app": "myapp", "user": "bob"}`); code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", code)
+	}
+	select {
+	case e := <-events:
+		if e != webhook.Started {
+			t.Errorf("Expected a started event, got %q", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the event to be delivered to the webhook")
+	}
+}
+
+func TestServeHealthAndMetrics(t *testing.T) {
+	s, logs := testServer(t)
+	defer os.RemoveAll(logs.Dir)
+
+	s.Monitor = status.NewMonitor()
+	s.Monitor.Add("docker", func() error { return nil })
+
+	// Health checks do not need the builder key.
+	res := get(s, "/health", "")
+	var h status.Health
+	if err := json.NewDecoder(res.Body).Decode(&h); err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != http.StatusOK || !h.Ready || h.Checks["docker"] != "ok" {
+		t.Errorf("Expected a ready builder, got %d %+v", res.Code, h)
+	}
+
+	s.Monitor.Add("etcd", func() error { return errors.New("unreachable") })
+	if res := get(s, "/health", ""); res.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when a check fails, got %d", res.Code)
+	}
+
+	if res := get(s, "/metrics", ""); res.Code != http.StatusUnauthorized {
+		t.Errorf("Expected metrics to need the builder key, got %d", res.Code)
+	}
+	req, _ := http.NewRequest("POST", "/events", strings.NewReader(`{"event": "failed", "app": "myapp", "duration": 12.5}`))
+	req.Header.Set(AuthHeader, "secret")
+	s.ServeHTTP(httptest.NewRecorder(), req)
+
+	var m status.Metrics
+	if err := json.NewDecoder(get(s, "/metrics", "secret").Body).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if a := m.Apps["myapp"]; m.Failures != 1 || a.Failures != 1 || a.LastDuration != 12.5 {
+		t.Errorf("Expected the failed build to be counted, got %+v", m)
+	}
+}
@@ -0,0 +1,182 @@
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/cookoo"
+)
+
+// Build limits, as named in etcd and in LimitErrors. Platform limits are set
+// in /deis/builder/$name, and override for one application in
+// /deis/builder/apps/$app/$name.
+const (
+	LimitMemory    = "buildMemory"
+	LimitCPUShares = "buildCPUShares"
+	LimitTimeout   = "buildTimeout"
+)
+
+// DefaultBuildTimeout is how long a build may take unless buildTimeout is set.
+const DefaultBuildTimeout = "1h"
+
+// memoryRe matches the memory sizes Docker accepts, e.g. "512m".
+var memoryRe = regexp.MustCompile(`^[0-9]+[bkmg]?$`)
+
+// Limits are the resources a build may use. Zero values are unlimited.
+type Limits struct {
+	// Memory is the memory limit of build containers, in Docker's format.
+	Memory string
+	// CPUShares is the relative CPU weight of build containers.
+	CPUShares int
+	// Timeout is how long compiling the slug and building the image may take.
+	Timeout time.Duration
+}
+
+// Flags returns the docker run and docker build flags that enforce the
+// memory and CPU limits.
+func (l *Limits) Flags() []string {
+	flags := []string{}
+	if l == nil {
+		return flags
+	}
+	if len(l.Memory) > 0 {
+		// Without a swap limit, Docker allows as much swap again.
+		flags = append(flags, "--memory="+l.Memory, "--memory-swap="+l.Memory)
+	}
+	if l.CPUShares > 0 {
+		flags = append(flags, fmt.Sprintf("--cpu-shares=%d", l.CPUShares))
+	}
+	return flags
+}
+
+// LimitError is returned when a build is stopped for exceeding one of its limits.
+type LimitError struct {
+	// Limit is one of the Limit* constants.
+	Limit string
+	// Value is the limit that was exceeded, e.g. "512m".
+	Value string
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case LimitMemory:
+		return fmt.Sprintf("build ran out of memory, exceeding its limit of %s (%s)", e.Value, e.Limit)
+	case LimitTimeout:
+		return fmt.Sprintf("build timed out after %s (%s)", e.Value, e.Limit)
+	}
+	return fmt.Sprintf("build exceeded its limit of %s (%s)", e.Value, e.Limit)
+}
+
+// LoadLimits reads an application's build limits from etcd.
+//
+// Each limit is read from /deis/builder/apps/$app, falling back to the
+// platform limit in /deis/builder.
+//
+// Params:
+// 	- lookup (func(string) (string, error)): Reads an etcd key, as returned by etcd.LookupFunc.
+// 	- app (string): The application.
+//
+// Returns:
+// 	- *Limits
+func LoadLimits(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	if ok, missing := p.RequiresValue("lookup", "app"); !ok {
+		return nil, fmt.Errorf("Missing required fields: %s", strings.Join(missing, ", "))
+	}
+	return loadLimits(p.Get("lookup", nil).(func(string) (string, error)), p.Get("app", "").(string))
+}
+
+func loadLimits(lookup func(string) (string, error), app string) (*Limits, error) {
+	get := func(name string) string {
+		if v, err := lookup(fmt.Sprintf("/deis/builder/apps/%s/%s", app, name)); err == nil && len(strings.TrimSpace(v)) > 0 {
+			return strings.TrimSpace(v)
+		}
+		if v, err := lookup("/deis/builder/" + name); err == nil {
+			return strings.TrimSpace(v)
+		}
+		return ""
+	}
+
+	l := &Limits{}
+	if v := strings.ToLower(get(LimitMemory)); len(v) > 0 && v != "0" {
+		if !memoryRe.MatchString(v) {
+			return nil, fmt.Errorf("invalid %s %q, expected a size such as 512m", LimitMemory, v)
+		}
+		l.Memory = v
+	}
+	if v := get(LimitCPUShares); len(v) > 0 {
+		shares, err := strconv.Atoi(v)
+		if err != nil || shares < 0 {
+			return nil, fmt.Errorf("invalid %s %q, expected a number such as 512", LimitCPUShares, v)
+		}
+		l.CPUShares = shares
+	}
+	v := get(LimitTimeout)
+	if len(v) == 0 {
+		v = DefaultBuildTimeout
+	}
+	if v != "0" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid %s %q, expected a duration such as 20m", LimitTimeout, v)
+		}
+		l.Timeout = timeout
+	}
+	return l, nil
+}
+
+// limit runs fn, a step that stops when cancel is called, and cancels it if
+// the build runs out of time.
+func (b *Build) limit(fn func() error, cancel func()) error {
+	if b.Limits == nil || b.Limits.Timeout == 0 {
+		return fn()
+	}
+	left := b.started.Add(b.Limits.Timeout).Sub(time.Now())
+	timeout := &LimitError{Limit: LimitTimeout, Value: b.Limits.Timeout.String()}
+	if left <= 0 {
+		return timeout
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(left):
+		cancel()
+		<-done
+		return timeout
+	}
+}
+
+// runningIn matches the line docker build prints with the container a step
+// runs in.
+var runningIn = regexp.MustCompile(`^ ---> Running in ([0-9a-f]+)\s*$`)
+
+// stepWriter passes the output of docker build through to w, remembering the
+// container the last step ran in. Docker keeps the container of a step that
+// failed, so its state tells why the step failed.
+type stepWriter struct {
+	w         io.Writer
+	line      []byte
+	container string
+}
+
+func (s *stepWriter) Write(p []byte) (int, error) {
+	s.line = append(s.line, p...)
+	for {
+		i := bytes.IndexByte(s.line, '\n')
+		if i < 0 {
+			break
+		}
+		if m := runningIn.FindSubmatch(s.line[:i]); m != nil {
+			s.container = string(m[1])
+		}
+		s.line = s.line[i+1:]
+	}
+	return s.w.Write(p)
+}
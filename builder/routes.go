@@ -1,16 +1,24 @@
 package builder
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/Masterminds/cookoo"
 	"github.com/Masterminds/cookoo/fmt"
+	"github.com/deis/deis/builder/buildlog"
+	"github.com/deis/deis/builder/cache"
+	"github.com/deis/deis/builder/cleanup"
 	"github.com/deis/deis/builder/confd"
 	"github.com/deis/deis/builder/docker"
 	"github.com/deis/deis/builder/env"
 	"github.com/deis/deis/builder/etcd"
 	"github.com/deis/deis/builder/git"
+	"github.com/deis/deis/builder/httpd"
+	"github.com/deis/deis/builder/slugs"
 	"github.com/deis/deis/builder/sshd"
+	"github.com/deis/deis/builder/status"
+	"github.com/deis/deis/builder/webhook"
 )
 
 // routes builds the Cookoo registry.
@@ -36,6 +44,7 @@ func routes(reg *cookoo.Registry) {
 					{Name: "ETCD_PORT", DefaultValue: "4001"},
 					{Name: "ETCD_PATH", DefaultValue: "/deis/builder"},
 					{Name: "ETCD_TTL", DefaultValue: "20"},
+					{Name: "HTTP_PORT", DefaultValue: "2224"},
 				},
 			},
 			cookoo.Cmd{ // This depends on others being processed first.
@@ -125,6 +134,124 @@ func routes(reg *cookoo.Registry) {
 				},
 			},
 
+			// QUEUE: Pushes wait in the build queue. It serializes pushes to
+			// the same repo and limits the number of concurrent builds.
+			cookoo.Cmd{
+				Name: "maxConcurrentBuilds",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/builder/maxConcurrentBuilds"},
+					{Name: "default", DefaultValue: "4"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "supersedeQueuedPushes",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/builder/supersedeQueuedPushes"},
+					{Name: "default", DefaultValue: "false"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "staleBuildTimeout",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/builder/staleBuildTimeout"},
+					{Name: "default", DefaultValue: "1h"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "buildQueue",
+				Fn:   git.CreateQueue,
+				Using: []cookoo.Param{
+					{Name: "max", From: "cxt:maxConcurrentBuilds"},
+					{Name: "supersede", From: "cxt:supersedeQueuedPushes"},
+					{Name: "staleAfter", From: "cxt:staleBuildTimeout"},
+				},
+			},
+
+			// HTTPD: Serve the builder's HTTP API to the controller.
+			cookoo.Cmd{
+				Name: "httpAddress",
+				Fn:   fmt.Sprintf,
+				Using: []cookoo.Param{
+					{Name: "format", DefaultValue: ":%s"},
+					{Name: "0", From: "cxt:HTTP_PORT"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "builderKey",
+				Fn:   etcd.ValueFunc,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/controller/builderKey"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "cacheBudget",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/builder/cacheBudget"},
+					{Name: "default", DefaultValue: cache.DefaultBudget},
+				},
+			},
+			cookoo.Cmd{
+				Name: "caches",
+				Fn:   cache.CreateStore,
+				Using: []cookoo.Param{
+					{Name: "dir", DefaultValue: cache.DefaultDir},
+					{Name: "budget", From: "cxt:cacheBudget"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "webhookLookup",
+				Fn:   etcd.LookupFunc,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "webhooks",
+				Fn:   webhook.CreateNotifier,
+				Using: []cookoo.Param{
+					{Name: "lookup", From: "cxt:webhookLookup"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "etcdPing",
+				Fn:   etcd.PingFunc,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "monitor",
+				Fn:   status.CreateMonitor,
+				Using: []cookoo.Param{
+					{Name: "docker", From: "cxt:docker"},
+					{Name: "images", DefaultValue: []string{SlugbuilderImage, SlugrunnerImage}},
+					{Name: "etcd", From: "cxt:etcdPing"},
+					{Name: "queue", From: "cxt:buildQueue"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "httpd",
+				Fn:   httpd.Serve,
+				Using: []cookoo.Param{
+					{Name: "address", From: "cxt:httpAddress"},
+					{Name: "logDir", DefaultValue: buildlog.DefaultDir},
+					{Name: "slugDir", DefaultValue: slugs.DefaultDir},
+					{Name: "caches", From: "cxt:caches"},
+					{Name: "hooks", From: "cxt:webhooks"},
+					{Name: "monitor", From: "cxt:monitor"},
+					{Name: "key", From: "cxt:builderKey"},
+				},
+			},
+
 			// SSHD: Create and configure host keys.
 			cookoo.Cmd{
 				Name: "installSshHostKeys",
@@ -138,6 +265,14 @@ func routes(reg *cookoo.Registry) {
 				Name: sshd.HostKeys,
 				Fn:   sshd.ParseHostKeys,
 			},
+			cookoo.Cmd{
+				Name: "hostKeysCheck",
+				Fn:   status.CheckHostKeys,
+				Using: []cookoo.Param{
+					{Name: "monitor", From: "cxt:monitor"},
+					{Name: "keys", From: "cxt:" + sshd.HostKeys},
+				},
+			},
 			cookoo.Cmd{
 				Name: sshd.ServerConfig,
 				Fn:   sshd.Configure,
@@ -175,13 +310,48 @@ func routes(reg *cookoo.Registry) {
 				},
 			},
 
-			// ETDCD: Now watch for events on etcd, and trigger a git check-repos for
-			// each. For the most part, this runs in the background.
+			// CLEANUP: Watch etcd for destroyed apps, and remove their repos,
+			// caches and images. This runs in the background.
+			cookoo.Cmd{
+				Name: "registryHost",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/registry/host"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "registryPort",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/registry/port"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "registry",
+				Fn:   fmt.Sprintf,
+				Using: []cookoo.Param{
+					{Name: "format", DefaultValue: "%s:%s"},
+					{Name: "0", From: "cxt:registryHost"},
+					{Name: "1", From: "cxt:registryPort"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "cleaner",
+				Fn:   cleanup.CreateCleaner,
+				Using: []cookoo.Param{
+					{Name: "caches", From: "cxt:caches"},
+					{Name: "registry", From: "cxt:registry"},
+					{Name: "docker", From: "cxt:docker"},
+				},
+			},
 			cookoo.Cmd{
 				Name: "Cleanup",
-				Fn:   etcd.Watch,
+				Fn:   etcd.WatchApps,
 				Using: []cookoo.Param{
 					{Name: "client", From: "cxt:client"},
+					{Name: "handler", From: "cxt:cleaner"},
 				},
 			},
 			// If there's an EXTERNAL_PORT, we publish info to etcd.
@@ -204,18 +374,324 @@ func routes(reg *cookoo.Registry) {
 				},
 			},
 
-			// DAEMON: Finally, we wait around for a signal, and then cleanup.
 			cookoo.Cmd{
-				Name: "listen",
-				Fn:   KillOnExit,
+				Name: "shutdownTimeout",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/builder/shutdownTimeout"},
+					{Name: "default", DefaultValue: "5m"},
+				},
+			},
+
+			// DAEMON: Finally, we wait around for a signal, and then run the
+			// "shutdown" route.
+			cookoo.Cmd{
+				Name: "stopped",
+				Fn:   ShutdownOnSignal,
+				Using: []cookoo.Param{
+					{Name: "route", DefaultValue: "shutdown"},
+				},
+			},
+		},
+	})
+
+	// The "shutdown" route stops the builder gracefully. It runs when the
+	// builder receives SIGTERM, e.g. from `docker stop`.
+	reg.AddRoute(cookoo.Route{
+		Name: "shutdown",
+		Help: "Shut down the builder",
+		Does: []cookoo.Task{
+			// Stop advertising this builder first, so that no new pushes are
+			// routed to it.
+			cookoo.Cmd{
+				Name: "deregister",
+				Fn:   etcd.Deregister,
+				Using: []cookoo.Param{
+					{Name: "registration", From: "cxt:etcdupdate"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "sshdstop",
+				Fn:   sshd.Stop,
+			},
+			// Let running builds finish, cancelling them after a timeout.
+			cookoo.Cmd{
+				Name: "drain",
+				Fn:   git.DrainQueue,
+				Using: []cookoo.Param{
+					{Name: "queue", From: "cxt:buildQueue"},
+					{Name: "timeout", From: "cxt:shutdownTimeout"},
+				},
+			},
+			// Deliver the events of the last builds.
+			cookoo.Cmd{
+				Name: "flushWebhooks",
+				Fn:   webhook.Flush,
+				Using: []cookoo.Param{
+					{Name: "notifier", From: "cxt:webhooks"},
+					{Name: "timeout", DefaultValue: "30s"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "kill",
+				Fn:   KillProcesses,
 				Using: []cookoo.Param{
 					{Name: "docker", From: "cxt:dockerstart"},
-					{Name: "sshd", From: "cxt:sshdstart"},
 				},
 			},
 		},
 	})
 
+	// The "build" route builds and deploys a push. It is run by the
+	// pre-receive hook, through `builder build`, rather than by the daemon.
+	reg.AddRoute(cookoo.Route{
+		Name: "build",
+		Help: "Build and deploy a push",
+		Does: []cookoo.Task{
+			cookoo.Cmd{
+				Name: "vars",
+				Fn:   env.Get,
+				Using: []cookoo.Param{
+					{Name: "HOST", DefaultValue: "127.0.0.1"},
+					{Name: "ETCD_PORT", DefaultValue: "4001"},
+					{Name: "HTTP_PORT", DefaultValue: "2224"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "vars2",
+				Fn:   env.Get,
+				Using: []cookoo.Param{
+					{Name: "ETCD", DefaultValue: "$HOST:$ETCD_PORT"},
+				},
+			},
+			cookoo.Cmd{
+				Name:  "client",
+				Fn:    etcd.CreateClient,
+				Using: []cookoo.Param{{Name: "url", DefaultValue: "http://127.0.0.1:4001", From: "cxt:ETCD"}},
+			},
+
+			// Find the controller and the registry.
+			cookoo.Cmd{
+				Name: "controllerProtocol",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/controller/protocol"},
+					{Name: "default", DefaultValue: "http"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "controllerHost",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/controller/host"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "controllerPort",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/controller/port"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "builderKey",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/controller/builderKey"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "registryHost",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/registry/host"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "registryPort",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/registry/port"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "controllerURL",
+				Fn:   fmt.Sprintf,
+				Using: []cookoo.Param{
+					{Name: "format", DefaultValue: "%s://%s:%s"},
+					{Name: "0", From: "cxt:controllerProtocol"},
+					{Name: "1", From: "cxt:controllerHost"},
+					{Name: "2", From: "cxt:controllerPort"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "registry",
+				Fn:   fmt.Sprintf,
+				Using: []cookoo.Param{
+					{Name: "format", DefaultValue: "%s:%s"},
+					{Name: "0", From: "cxt:registryHost"},
+					{Name: "1", From: "cxt:registryPort"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "controller",
+				Fn:   CreateControllerClient,
+				Using: []cookoo.Param{
+					{Name: "url", From: "cxt:controllerURL"},
+					{Name: "key", From: "cxt:builderKey"},
+				},
+			},
+
+			// Report the build's progress to webhooks, through the daemon.
+			cookoo.Cmd{
+				Name: "eventsURL",
+				Fn:   fmt.Sprintf,
+				Using: []cookoo.Param{
+					{Name: "format", DefaultValue: "http://127.0.0.1:%s/events"},
+					{Name: "0", From: "cxt:HTTP_PORT"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "events",
+				Fn:   CreateEventPoster,
+				Using: []cookoo.Param{
+					{Name: "url", From: "cxt:eventsURL"},
+					{Name: "key", From: "cxt:builderKey"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "started",
+				Fn:   PostEvent,
+				Using: []cookoo.Param{
+					{Name: "events", From: "cxt:events"},
+					{Name: "event", DefaultValue: webhook.Started},
+					{Name: "user", From: "cxt:user"},
+					{Name: "app", From: "cxt:app"},
+					{Name: "sha", From: "cxt:sha"},
+					{Name: "uuid", From: "cxt:uuid"},
+				},
+			},
+
+			cookoo.Cmd{
+				Name: "cacheBudget",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/builder/cacheBudget"},
+					{Name: "default", DefaultValue: cache.DefaultBudget},
+				},
+			},
+			cookoo.Cmd{
+				Name: "caches",
+				Fn:   cache.CreateStore,
+				Using: []cookoo.Param{
+					{Name: "dir", DefaultValue: cache.DefaultDir},
+					{Name: "budget", From: "cxt:cacheBudget"},
+				},
+			},
+
+			cookoo.Cmd{
+				Name: "slugRetention",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/builder/slugRetention"},
+					{Name: "default", DefaultValue: strconv.Itoa(slugs.DefaultKeep)},
+				},
+			},
+			cookoo.Cmd{
+				Name: "slugs",
+				Fn:   slugs.CreateStore,
+				Using: []cookoo.Param{
+					{Name: "dir", DefaultValue: slugs.DefaultDir},
+					{Name: "keep", From: "cxt:slugRetention"},
+				},
+			},
+
+			// Limit the resources the build may use.
+			cookoo.Cmd{
+				Name: "lookup",
+				Fn:   etcd.LookupFunc,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "limits",
+				Fn:   LoadLimits,
+				Using: []cookoo.Param{
+					{Name: "lookup", From: "cxt:lookup"},
+					{Name: "app", From: "cxt:app"},
+				},
+			},
+
+			// BUILD: Each step records its results on the build.
+			cookoo.Cmd{
+				Name: "build",
+				Fn:   PrepareBuild,
+				Using: []cookoo.Param{
+					{Name: "user", From: "cxt:user"},
+					{Name: "repo", From: "cxt:repo"},
+					{Name: "sha", From: "cxt:sha"},
+					{Name: "app", From: "cxt:app"},
+					{Name: "uuid", From: "cxt:uuid"},
+					{Name: "options", From: "cxt:pushOptions"},
+					{Name: "caches", From: "cxt:caches"},
+					{Name: "registry", From: "cxt:registry"},
+					{Name: "limits", From: "cxt:limits"},
+					{Name: "docker", DefaultValue: &docker.CLI{}},
+					{Name: "controller", From: "cxt:controller"},
+					{Name: "out", From: "cxt:out"},
+				},
+			},
+			cookoo.Cmd{
+				Name:  "config",
+				Fn:    FetchConfig,
+				Using: []cookoo.Param{{Name: "build", From: "cxt:build"}},
+			},
+			cookoo.Cmd{
+				Name:  "slugbuild",
+				Fn:    Slugbuild,
+				Using: []cookoo.Param{{Name: "build", From: "cxt:build"}},
+			},
+			cookoo.Cmd{
+				Name:  "image",
+				Fn:    BuildImage,
+				Using: []cookoo.Param{{Name: "build", From: "cxt:build"}},
+			},
+			cookoo.Cmd{
+				Name:  "push",
+				Fn:    PushImage,
+				Using: []cookoo.Param{{Name: "build", From: "cxt:build"}},
+			},
+			cookoo.Cmd{
+				Name: "archive",
+				Fn:   ArchiveSlug,
+				Using: []cookoo.Param{
+					{Name: "build", From: "cxt:build"},
+					{Name: "slugs", From: "cxt:slugs"},
+				},
+			},
+			cookoo.Cmd{
+				Name:  "procfile",
+				Fn:    DetectProcfile,
+				Using: []cookoo.Param{{Name: "build", From: "cxt:build"}},
+			},
+			cookoo.Cmd{
+				Name:  "release",
+				Fn:    PublishBuild,
+				Using: []cookoo.Param{{Name: "build", From: "cxt:build"}},
+			},
+		},
+	})
+
 	// This route is called during a user authentication for SSH.
 	// The rough pattern is that we parse the local authorized keys file, and
 	// then validate that the supplied user key matches an authorized key.
@@ -292,6 +768,44 @@ func routes(reg *cookoo.Registry) {
 					{Name: "fingerprint", From: "cxt:fingerprint"},
 				},
 			},
+			// Branch mapping settings are read on every push so that
+			// changes take effect without restarting the builder.
+			cookoo.Cmd{
+				Name: "branchMap",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/builder/branchMap"},
+					{Name: "default", DefaultValue: git.DefaultBranchMap},
+				},
+			},
+			cookoo.Cmd{
+				Name: "unmappedBranches",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/builder/unmappedBranches"},
+					{Name: "default", DefaultValue: git.UnmappedReject},
+				},
+			},
+			cookoo.Cmd{
+				Name: "branchCreateApps",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/builder/branchCreateApps"},
+					{Name: "default", DefaultValue: "false"},
+				},
+			},
+			cookoo.Cmd{
+				Name: "buildLogRetention",
+				Fn:   etcd.GetValue,
+				Using: []cookoo.Param{
+					{Name: "client", From: "cxt:client"},
+					{Name: "key", DefaultValue: "/deis/builder/buildLogRetention"},
+					{Name: "default", DefaultValue: strconv.Itoa(buildlog.DefaultKeep)},
+				},
+			},
 			cookoo.Cmd{
 				Name: "receive",
 				Fn:   git.Receive,
@@ -303,6 +817,13 @@ func routes(reg *cookoo.Registry) {
 					{Name: "fingerprint", From: "cxt:fingerprint"},
 					{Name: "permissions", From: "cxt:authN"},
 					{Name: "user", From: "cxt:username"},
+					{Name: "branchMap", From: "cxt:branchMap"},
+					{Name: "unmappedBranches", From: "cxt:unmappedBranches"},
+					{Name: "createApps", From: "cxt:branchCreateApps"},
+					{Name: "queue", From: "cxt:buildQueue"},
+					{Name: "hooks", From: "cxt:webhooks"},
+					{Name: "logDir", DefaultValue: buildlog.DefaultDir},
+					{Name: "logRetention", From: "cxt:buildLogRetention"},
 				},
 			},
 		},
@@ -0,0 +1,166 @@
+// Package slugs keeps the slugs that builds compile, so that the exact
+// artifact behind a release can be downloaded and audited.
+package slugs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/cookoo"
+)
+
+// DefaultDir is the directory the builder stores slugs in.
+const DefaultDir = "/home/git/slugs"
+
+// DefaultKeep is the number of slugs kept per application by default.
+const DefaultKeep = 5
+
+// ErrNotFound indicates that there is no slug for a build.
+var ErrNotFound = errors.New("slug not found")
+
+var legalName = regexp.MustCompile(`^[a-z0-9][-a-z0-9]*$`)
+
+// Store is a directory of slugs.
+//
+// Slugs are stored as $Dir/$app/$uuid.tgz.
+type Store struct {
+	Dir string
+	// Keep is the number of slugs kept per application. Zero keeps all slugs.
+	Keep int
+}
+
+// NewStore creates a new slug store.
+func NewStore(dir string, keep int) *Store {
+	return &Store{Dir: dir, Keep: keep}
+}
+
+// CreateStore creates a new slug store.
+//
+// Params:
+// 	- dir (string): The directory slugs are stored in. Defaults to DefaultDir.
+// 	- keep (string): The number of slugs kept per application; "0" keeps all.
+//
+// Returns:
+// 	- *Store
+func CreateStore(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	keep := DefaultKeep
+	if v := p.Get("keep", "").(string); len(v) > 0 {
+		var err error
+		if keep, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("Invalid slug retention %q", v)
+		}
+	}
+	return NewStore(p.Get("dir", DefaultDir).(string), keep), nil
+}
+
+// path returns the path to the slug of an app's build.
+func (s *Store) path(app, id string) (string, error) {
+	if !legalName.MatchString(app) {
+		return "", fmt.Errorf("Illegal application name %q", app)
+	}
+	if !legalName.MatchString(id) {
+		return "", fmt.Errorf("Illegal build ID %q", id)
+	}
+	return filepath.Join(s.Dir, app, id+".tgz"), nil
+}
+
+// Save copies the slug at src into the store, then prunes the app's oldest slugs.
+func (s *Store) Save(app, id, src string) error {
+	p, err := s.path(app, id)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// Write to a temporary file first, so that a partial slug is never served.
+	out, err := ioutil.TempFile(filepath.Dir(p), ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(out.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), p)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	return s.Prune(app)
+}
+
+// Open opens the slug of a build for reading.
+//
+// It returns ErrNotFound if there is no such slug.
+func (s *Store) Open(app, id string) (*os.File, error) {
+	p, err := s.path(app, id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Prune removes the oldest slugs of an app, keeping the newest Keep slugs.
+func (s *Store) Prune(app string) error {
+	if s.Keep <= 0 {
+		return nil
+	}
+	if !legalName.MatchString(app) {
+		return fmt.Errorf("Illegal application name %q", app)
+	}
+	dir := filepath.Join(s.Dir, app)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	slugs := make([]os.FileInfo, 0, len(infos))
+	for _, fi := range infos {
+		if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".tgz") {
+			slugs = append(slugs, fi)
+		}
+	}
+	if len(slugs) <= s.Keep {
+		return nil
+	}
+	sort.Sort(byAge(slugs))
+
+	for _, fi := range slugs[:len(slugs)-s.Keep] {
+		os.Remove(filepath.Join(dir, fi.Name()))
+	}
+	return nil
+}
+
+// byAge sorts files from oldest to newest.
+type byAge []os.FileInfo
+
+func (b byAge) Len() int           { return len(b) }
+func (b byAge) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byAge) Less(i, j int) bool { return b[i].ModTime().Before(b[j].ModTime()) }
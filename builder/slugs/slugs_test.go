@@ -0,0 +1,75 @@
+package slugs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempStore(t *testing.T, keep int) *Store {
+	dir, err := ioutil.TempDir("", "slugs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewStore(dir, keep)
+}
+
+func TestSaveAndOpen(t *testing.T) {
+	s := tempStore(t, 0)
+	defer os.RemoveAll(s.Dir)
+
+	src := filepath.Join(s.Dir, "slug.tgz")
+	ioutil.WriteFile(src, []byte("slug"), 0600)
+	if err := s.Save("myapp", "1234-abcd", src); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := s.Open("myapp", "1234-abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if data, _ := ioutil.ReadAll(f); string(data) != "slug" {
+		t.Errorf("Expected the saved slug, got %q", data)
+	}
+
+	if _, err := s.Open("myapp", "nope"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	for _, bad := range [][2]string{{"../etc", "x"}, {"myapp", "../../passwd"}, {"", "x"}} {
+		if _, err := s.Open(bad[0], bad[1]); err == nil || err == ErrNotFound {
+			t.Errorf("Expected illegal name error for %v, got %v", bad, err)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	s := tempStore(t, 2)
+	defer os.RemoveAll(s.Dir)
+
+	src := filepath.Join(s.Dir, "slug.tgz")
+	ioutil.WriteFile(src, []byte("slug"), 0600)
+	base := time.Now().Add(-time.Hour)
+	for i, id := range []string{"a", "b", "c"} {
+		if err := s.Save("myapp", id, src); err != nil {
+			t.Fatal(err)
+		}
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(filepath.Join(s.Dir, "myapp", id+".tgz"), mtime, mtime)
+	}
+	// Saving a slug prunes the oldest ones.
+	if err := s.Save("myapp", "d", src); err != nil {
+		t.Fatal(err)
+	}
+
+	for id, exists := range map[string]bool{"a": false, "b": false, "c": true, "d": true} {
+		_, err := os.Stat(filepath.Join(s.Dir, "myapp", id+".tgz"))
+		if exists && err != nil {
+			t.Errorf("Expected slug %s to be kept: %s", id, err)
+		} else if !exists && err == nil {
+			t.Errorf("Expected slug %s to be pruned", id)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/deis/deis/builder/buildlog"
+)
+
+func usage(s string) {
+	fmt.Fprintf(os.Stderr, "Usage: %s <app> <uuid>\n", s)
+}
+
+// build-log copies a build's output from stdin to stdout, and persists it in
+// the build log store.
+//
+// A failure to persist the log never fails the build.
+func main() {
+	if len(os.Args) != 3 {
+		usage(os.Args[0])
+		os.Exit(1)
+	}
+	app, id := os.Args[1], os.Args[2]
+
+	dir := os.Getenv("DEIS_BUILD_LOG_DIR")
+	if dir == "" {
+		dir = buildlog.DefaultDir
+	}
+	keep, err := strconv.Atoi(os.Getenv("DEIS_BUILD_LOG_RETENTION"))
+	if err != nil {
+		keep = buildlog.DefaultKeep
+	}
+	store := buildlog.NewStore(dir, keep)
+
+	f, err := store.Create(app, id)
+	if err != nil {
+		fmt.Printf(" !     Build log will not be saved: %s\n", err)
+		io.Copy(os.Stdout, os.Stdin)
+		return
+	}
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	store.Prune(app)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			os.Stdout.Write(buf[:n])
+			if f != nil {
+				if _, werr := f.Write(buf[:n]); werr != nil {
+					fmt.Printf(" !     Build log truncated: %s\n", werr)
+					f.Close()
+					f = nil
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
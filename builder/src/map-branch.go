@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/deis/deis/builder/git"
+)
+
+func usage(s string) {
+	fmt.Fprintf(os.Stderr, "Usage: %s <repo> <refname>\n", s)
+}
+
+func main() {
+	if len(os.Args) != 3 {
+		usage(os.Args[0])
+		os.Exit(1)
+	}
+
+	repo := strings.TrimSuffix(os.Args[1], ".git")
+	ref := os.Args[2]
+
+	branches, err := git.ParseBranchMap(os.Getenv("DEIS_BRANCH_MAP"), os.Getenv("DEIS_UNMAPPED_BRANCHES"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	app, err := branches.Resolve(repo, ref)
+	if err == git.ErrBranchIgnored {
+		fmt.Fprintf(os.Stderr, "Accepted %s without deploying: it is not mapped to an application.\n", ref)
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println(app)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/deis/deis/builder/git"
+)
+
+func usage(s string) {
+	fmt.Fprintf(os.Stderr, "Usage: %s check | get <option>\n", s)
+}
+
+// push-options reads the push options of the current push from the
+// environment git passes to hooks.
+//
+// "check" fails if any option is invalid. "get" prints the value of a single
+// option, or nothing if it is not set.
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Args[0])
+		os.Exit(1)
+	}
+
+	opts, err := git.ParsePushOptions(git.PushOptionsFromEnv(os.Getenv))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "check":
+	case "get":
+		if len(os.Args) != 3 {
+			usage(os.Args[0])
+			os.Exit(1)
+		}
+		fmt.Print(opts[os.Args[2]])
+	default:
+		usage(os.Args[0])
+		os.Exit(1)
+	}
+}
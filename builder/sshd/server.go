@@ -29,8 +29,18 @@ const (
 	Address string = "ssh.Address"
 	// ServerConfig is the context key for ServerConfig object.
 	ServerConfig string = "ssh.ServerConfig"
+	// Conns is the context key for the ConnCounter.
+	Conns string = "ssh.Conns"
+	// Closer is the context key for the channel that stops the server.
+	Closer string = "sshd.Closer"
 )
 
+// ConnCounter counts open connections.
+type ConnCounter interface {
+	ConnOpened()
+	ConnClosed()
+}
+
 // PrereceiveHookTmpl is a pre-receive hook.
 const PrereceiveHookTpl = `#!/bin/bash
 strip_remote_prefix() {
@@ -39,7 +49,10 @@ strip_remote_prefix() {
 
 echo "pre-receive hook START"
 set -eo pipefail; while read oldrev newrev refname; do
-[[ $refname = "refs/heads/master" ]] && git archive $newrev | {{.Receiver}} "$RECEIVE_REPO" "$newrev" | strip_remote_prefix
+app=$(map-branch "$RECEIVE_REPO" "$refname")
+if [[ -n $app ]]; then
+  git archive $newrev | {{.Receiver}} "$RECEIVE_REPO" "$newrev" "$app" | strip_remote_prefix
+fi
 done
 echo "pre-receive hook END"
 `
@@ -50,7 +63,10 @@ echo "pre-receive hook END"
 // a Cookoo app. It assumes that certain things have been configured for it,
 // like an ssh.ServerConfig. Once it runs, it will block until the main
 // process terminates. If you want to stop it prior to that, you can grab
-// the closer ("sshd.Closer") out of the context and send it a signal.
+// the closer ("sshd.Closer") out of the context and send it a signal, or run
+// the Stop command. Serve then returns, but connections that are already open
+// keep running in the background. If accepting connections fails, Serve
+// returns the error.
 //
 // Currently, the service is not generic. It only runs git hooks.
 //
@@ -58,9 +74,10 @@ echo "pre-receive hook END"
 // 	- ssh.Hostkeys ([]ssh.Signer): Host key, as an unparsed byte slice.
 // 	- ssh.Address (string): Address/port
 // 	- ssh.ServerConfig (*ssh.ServerConfig): The server config to use.
-//
-// This puts the following variables into the context:
-// 	- ssh.Closer (chan interface{}): Send a message to this to shutdown the server.
+// 	- ssh.Conns (ConnCounter): Optional. Counts connections.
+// 	- sshd.Closer (chan interface{}): Optional. Send a message to this to
+// 		shutdown the server. If it is missing, Serve creates it, so callers
+// 		that may stop the server before Serve runs should call PutCloser first.
 func Serve(reg *cookoo.Registry, router *cookoo.Router, c cookoo.Context) cookoo.Interrupt {
 	hostkeys := c.Get(HostKeys, []ssh.Signer{}).([]ssh.Signer)
 	addr := c.Get(Address, "0.0.0.0:2223").(string)
@@ -80,41 +97,65 @@ func Serve(reg *cookoo.Registry, router *cookoo.Router, c cookoo.Context) cookoo
 		c:       c,
 		gitHome: "/home/git",
 	}
+	srv.conns, _ = c.Get(Conns, nil).(ConnCounter)
 
-	closer := make(chan interface{}, 1)
-	c.Put("sshd.Closer", closer)
+	closer := PutCloser(c)
 
 	log.Infof(c, "Listening on %s", addr)
-	srv.listen(listener, cfg, closer)
+	return srv.listen(listener, cfg, closer)
+}
 
-	return nil
+// PutCloser puts the channel that stops the server into the context, unless
+// it is already there, and returns it.
+//
+// Call it before Serve runs if Stop may run at the same time, so that a stop
+// sent before Serve starts listening is not lost.
+func PutCloser(c cookoo.Context) chan interface{} {
+	if closer, ok := c.Get(Closer, nil).(chan interface{}); ok {
+		return closer
+	}
+	closer := make(chan interface{}, 1)
+	c.Put(Closer, closer)
+	return closer
 }
 
 // server is the struct that encapsulates the SSH server.
 type server struct {
 	c          cookoo.Context
 	gitHome    string
+	conns      ConnCounter
 	hookTpl    *template.Template
 	createLock sync.Mutex
 }
 
 // listen handles accepting and managing connections. However, since closer
 // is len(1), it will not block the sender.
+//
+// When closer receives a message, the listener is closed, so no new
+// connections are accepted. Connections that are already open are not
+// interrupted.
 func (s *server) listen(l net.Listener, conf *ssh.ServerConfig, closer chan interface{}) error {
 	cxt := s.c
 	log.Info(cxt, "Accepting new connections.")
 	defer l.Close()
 
-	// FIXME: Since Accept blocks, closer may not be checked often enough.
+	// Closing the listener is the only way to interrupt a blocking Accept.
+	closing := make(chan bool)
+	safely.GoDo(cxt, func() {
+		<-closer
+		log.Info(cxt, "Shutting down SSHD listener.")
+		close(closing)
+		l.Close()
+	})
+
 	for {
-		log.Info(cxt, "Checking closer.")
-		if len(closer) > 0 {
-			<-closer
-			log.Info(cxt, "Shutting down SSHD listener.")
-			return nil
-		}
 		conn, err := l.Accept()
 		if err != nil {
+			select {
+			case <-closing:
+				return nil
+			default:
+			}
 			log.Warnf(cxt, "Error during Accept: %s", err)
 			// We shouldn't kill the listener because of an error.
 			return err
@@ -131,6 +172,10 @@ func (s *server) listen(l net.Listener, conf *ssh.ServerConfig, closer chan inte
 func (s *server) handleConn(conn net.Conn, conf *ssh.ServerConfig) {
 	defer conn.Close()
 	log.Info(s.c, "Accepted connection.")
+	if s.conns != nil {
+		s.conns.ConnOpened()
+		defer s.conns.ConnClosed()
+	}
 	_, chans, reqs, err := ssh.NewServerConn(conn, conf)
 	if err != nil {
 		// Handshake failure.
@@ -148,12 +193,15 @@ func (s *server) handleConn(conn net.Conn, conf *ssh.ServerConfig) {
 		log.Infof(s.c, "Channel type: %s\n", incoming.ChannelType())
 		if incoming.ChannelType() != "session" {
 			incoming.Reject(ssh.UnknownChannelType, "Unknown channel type")
+			continue
 		}
 
 		channel, req, err := incoming.Accept()
 		if err != nil {
-			// Should close request and move on.
-			panic(err)
+			// The client may have gone away. Other channels on the same
+			// connection are still served.
+			log.Warnf(s.c, "Failed to accept channel: %s", err)
+			continue
 		}
 		safely.GoDo(s.c, func() { s.answer(channel, req, condata) })
 	}
@@ -322,6 +370,27 @@ func parseEnv(pay []byte) ([]byte, []byte) {
 
 }
 
+// Stop stops the SSH server from accepting new connections.
+//
+// Connections that are already open, and the pushes running on them, are
+// left to finish. If the server is not running, this does nothing.
+//
+// Returns:
+// 	- bool: true if the server was asked to stop.
+func Stop(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	closer, ok := c.Get(Closer, nil).(chan interface{})
+	if !ok {
+		log.Info(c, "SSHD is not running.")
+		return false, nil
+	}
+	select {
+	case closer <- true:
+	default:
+		// A stop is already pending.
+	}
+	return true, nil
+}
+
 // Ping handles a simple test SSH exec.
 //
 // Returns the string PONG and exit status 0.
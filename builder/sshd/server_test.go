@@ -68,10 +68,88 @@ func TestServer(t *testing.T) {
 		t.Fatalf("expected a failed run with command 'illegal command'")
 	}
 
-	closer := cxt.Get("sshd.Closer", nil).(chan interface{})
+	closer := cxt.Get(Closer, nil).(chan interface{})
 	closer <- true
 }
 
+func TestStop(t *testing.T) {
+	key, err := sshTestingHostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{NoClientAuth: true}
+	cfg.AddHostKey(key)
+
+	reg, router, cxt := cookoo.Cookoo()
+	cxt.Put(ServerConfig, cfg)
+	cxt.Put(Address, "127.0.0.1:2245")
+
+	PutCloser(cxt)
+	done := make(chan cookoo.Interrupt)
+	go func() { done <- Serve(reg, router, cxt) }()
+	time.Sleep(200 * time.Millisecond)
+
+	if stopped, _ := Stop(cxt, cookoo.NewParamsWithValues(nil)); stopped != true {
+		t.Fatal("Expected Stop to find the running server")
+	}
+
+	// Serve must return even though nobody connects after the stop.
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected a clean shutdown, got %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected Serve to return after Stop")
+	}
+	if _, err := net.Dial("tcp", "127.0.0.1:2245"); err == nil {
+		t.Error("Expected new connections to be refused")
+	}
+}
+
+func TestStopBeforeServe(t *testing.T) {
+	key, err := sshTestingHostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{NoClientAuth: true}
+	cfg.AddHostKey(key)
+
+	reg, router, cxt := cookoo.Cookoo()
+	cxt.Put(ServerConfig, cfg)
+	cxt.Put(Address, "127.0.0.1:2246")
+
+	PutCloser(cxt)
+	if stopped, _ := Stop(cxt, cookoo.NewParamsWithValues(nil)); stopped != true {
+		t.Fatal("Expected Stop to find the server's closer")
+	}
+
+	done := make(chan cookoo.Interrupt)
+	go func() { done <- Serve(reg, router, cxt) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected a clean shutdown, got %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a stop sent before Serve to stop the server")
+	}
+}
+
+func TestListenError(t *testing.T) {
+	_, _, cxt := cookoo.Cookoo()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	srv := &server{c: cxt}
+	if err := srv.listen(l, &ssh.ServerConfig{}, make(chan interface{}, 1)); err == nil {
+		t.Error("Expected a failed Accept to be returned")
+	}
+}
+
 // sshTestingHostKey loads the testing key.
 func sshTestingHostKey() (ssh.Signer, error) {
 	return ssh.ParsePrivateKey([]byte(testingHostKey))
@@ -102,6 +180,7 @@ func runServer(config *ssh.ServerConfig, t *testing.T) cookoo.Context {
 		},
 	})
 
+	PutCloser(cxt)
 	go func() {
 		if err := Serve(reg, router, cxt); err != nil {
 			t.Fatalf("Failed serving with %s", err)
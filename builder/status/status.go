@@ -0,0 +1,263 @@
+// Package status reports whether the builder is ready to take pushes, and
+// collects metrics about its connections and builds.
+package status
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/cookoo"
+	"github.com/deis/deis/builder/webhook"
+	docli "github.com/fsouza/go-dockerclient"
+	"golang.org/x/crypto/ssh"
+)
+
+// Check is a readiness check. It returns an error if the builder is not ready.
+type Check func() error
+
+// Docker is the part of the Docker client that readiness checks use.
+type Docker interface {
+	Ping() error
+	InspectImage(name string) (*docli.Image, error)
+}
+
+// Queue reports the builds that are running and waiting. git.Queue implements it.
+type Queue interface {
+	Stats() (running, waiting int)
+}
+
+// Monitor runs readiness checks and collects metrics.
+type Monitor struct {
+	// Timeout is how long each check may take.
+	Timeout time.Duration
+	// Queue is the build queue. If it is nil, no builds are reported as running.
+	Queue Queue
+
+	mu          sync.Mutex
+	checks      map[string]Check
+	started     time.Time
+	connections int
+	connTotal   int64
+	apps        map[string]*AppMetrics
+}
+
+// Health is the result of the readiness checks.
+type Health struct {
+	// Ready is true if every check passed.
+	Ready bool `json:"ready"`
+	// Checks maps each check to "ok" or to why it failed.
+	Checks map[string]string `json:"checks"`
+}
+
+// AppMetrics are the metrics of the builds of one application.
+type AppMetrics struct {
+	Builds   int `json:"builds"`
+	Failures int `json:"failures"`
+	// LastDuration is how long the last build took, in seconds.
+	LastDuration float64 `json:"last_duration"`
+	// TotalDuration is how long all builds took, in seconds.
+	TotalDuration float64   `json:"total_duration"`
+	LastBuild     time.Time `json:"last_build"`
+}
+
+// Metrics are the builder's metrics.
+type Metrics struct {
+	// Uptime is how long the builder has been running, in seconds.
+	Uptime float64 `json:"uptime"`
+	// Connections is the number of open SSH connections.
+	Connections int `json:"connections"`
+	// ConnectionsTotal is the number of SSH connections accepted so far.
+	ConnectionsTotal int64 `json:"connections_total"`
+	BuildsRunning    int   `json:"builds_running"`
+	BuildsWaiting    int   `json:"builds_waiting"`
+	// Builds and Failures count the finished builds of all applications.
+	Builds   int                   `json:"builds"`
+	Failures int                   `json:"failures"`
+	Apps     map[string]AppMetrics `json:"apps"`
+}
+
+// NewMonitor creates a new monitor without any checks.
+func NewMonitor() *Monitor {
+	return &Monitor{
+		Timeout: 5 * time.Second,
+		checks:  map[string]Check{},
+		started: time.Now(),
+		apps:    map[string]*AppMetrics{},
+	}
+}
+
+// CreateMonitor creates a monitor that checks that Docker and etcd are
+// reachable and that the images builds need are present.
+//
+// Params:
+// 	- docker (Docker): A Docker client, usually a *docker.Client.
+// 	- images ([]string): The images builds need.
+// 	- etcd (func() error): Checks that etcd is reachable, as returned by etcd.PingFunc.
+// 	- queue (Queue): The build queue.
+//
+// Returns:
+// 	- *Monitor
+func CreateMonitor(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	m := NewMonitor()
+	m.Queue, _ = p.Get("queue", nil).(Queue)
+	if d, ok := p.Get("docker", nil).(Docker); ok {
+		m.Add("docker", DockerCheck(d))
+		m.Add("images", ImageCheck(d, p.Get("images", []string{}).([]string)...))
+	}
+	if ping, ok := p.Get("etcd", nil).(func() error); ok {
+		m.Add("etcd", Check(ping))
+	}
+	return m, nil
+}
+
+// CheckHostKeys adds a readiness check that SSH host keys are loaded.
+//
+// Params:
+// 	- monitor (*Monitor): The monitor.
+// 	- keys ([]ssh.Signer): The host keys.
+//
+// Returns:
+// 	- int: The number of host keys.
+func CheckHostKeys(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	m := p.Get("monitor", nil).(*Monitor)
+	keys, _ := p.Get("keys", nil).([]ssh.Signer)
+	n := len(keys)
+	m.Add("hostkeys", func() error {
+		if n == 0 {
+			return fmt.Errorf("no SSH host keys loaded")
+		}
+		return nil
+	})
+	return n, nil
+}
+
+// DockerCheck checks that the Docker daemon answers.
+func DockerCheck(d Docker) Check {
+	return d.Ping
+}
+
+// ImageCheck checks that images are present.
+func ImageCheck(d Docker, images ...string) Check {
+	return func() error {
+		for _, img := range images {
+			if _, err := d.InspectImage(img); err != nil {
+				return fmt.Errorf("image %s: %s", img, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Add adds or replaces a readiness check.
+func (m *Monitor) Add(name string, check Check) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checks[name] = check
+}
+
+// Health runs every readiness check at once. A check that takes longer than
+// Timeout fails.
+func (m *Monitor) Health() *Health {
+	m.mu.Lock()
+	checks := make(map[string]Check, len(m.checks))
+	for name, check := range m.checks {
+		checks[name] = check
+	}
+	m.mu.Unlock()
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(checks))
+	for name, check := range checks {
+		go func(name string, check Check) {
+			results <- result{name, check()}
+		}(name, check)
+	}
+
+	h := &Health{Ready: true, Checks: map[string]string{}}
+	timeout := time.After(m.Timeout)
+	for range checks {
+		select {
+		case r := <-results:
+			h.Checks[r.name] = "ok"
+			if r.err != nil {
+				h.Checks[r.name] = r.err.Error()
+				h.Ready = false
+			}
+		case <-timeout:
+			for name := range checks {
+				if _, ok := h.Checks[name]; !ok {
+					h.Checks[name] = fmt.Sprintf("timed out after %s", m.Timeout)
+				}
+			}
+			h.Ready = false
+			return h
+		}
+	}
+	return h
+}
+
+// ConnOpened counts an SSH connection.
+func (m *Monitor) ConnOpened() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connections++
+	m.connTotal++
+}
+
+// ConnClosed counts an SSH connection closing.
+func (m *Monitor) ConnClosed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connections--
+}
+
+// Record counts a finished build. Other events are ignored.
+func (m *Monitor) Record(e *webhook.Event) {
+	if e.Type != webhook.Succeeded && e.Type != webhook.Failed {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.apps[e.App]
+	if !ok {
+		a = &AppMetrics{}
+		m.apps[e.App] = a
+	}
+	a.Builds++
+	if e.Type == webhook.Failed {
+		a.Failures++
+	}
+	a.LastDuration = e.Duration
+	a.TotalDuration += e.Duration
+	a.LastBuild = e.Time
+	if a.LastBuild.IsZero() {
+		a.LastBuild = time.Now().UTC()
+	}
+}
+
+// Metrics returns the current metrics.
+func (m *Monitor) Metrics() *Metrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ms := &Metrics{
+		Uptime:           time.Since(m.started).Seconds(),
+		Connections:      m.connections,
+		ConnectionsTotal: m.connTotal,
+		Apps:             make(map[string]AppMetrics, len(m.apps)),
+	}
+	if m.Queue != nil {
+		ms.BuildsRunning, ms.BuildsWaiting = m.Queue.Stats()
+	}
+	for app, a := range m.apps {
+		ms.Apps[app] = *a
+		ms.Builds += a.Builds
+		ms.Failures += a.Failures
+	}
+	return ms
+}
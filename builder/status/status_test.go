@@ -0,0 +1,94 @@
+package status
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/deis/deis/builder/webhook"
+	docli "github.com/fsouza/go-dockerclient"
+)
+
+type fakeDocker struct {
+	images map[string]bool
+}
+
+func (d *fakeDocker) Ping() error {
+	return nil
+}
+
+func (d *fakeDocker) InspectImage(name string) (*docli.Image, error) {
+	if !d.images[name] {
+		return nil, docli.ErrNoSuchImage
+	}
+	return &docli.Image{ID: name}, nil
+}
+
+type fakeQueue struct{}
+
+func (fakeQueue) Stats() (int, int) {
+	return 2, 1
+}
+
+func TestHealth(t *testing.T) {
+	m := NewMonitor()
+	m.Timeout = 50 * time.Millisecond
+	d := &fakeDocker{images: map[string]bool{"deis/slugbuilder": true}}
+	m.Add("docker", DockerCheck(d))
+	m.Add("images", ImageCheck(d, "deis/slugbuilder", "deis/slugrunner"))
+	m.Add("etcd", func() error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	h := m.Health()
+	if h.Ready {
+		t.Error("Expected the builder not to be ready")
+	}
+	if h.Checks["docker"] != "ok" {
+		t.Errorf("Expected docker to be ok, got %q", h.Checks["docker"])
+	}
+	if h.Checks["images"] != "image deis/slugrunner: no such image" {
+		t.Errorf("Expected slugrunner to be missing, got %q", h.Checks["images"])
+	}
+	if h.Checks["etcd"] != "timed out after 50ms" {
+		t.Errorf("Expected etcd to time out, got %q", h.Checks["etcd"])
+	}
+
+	d.images["deis/slugrunner"] = true
+	m.Add("etcd", func() error { return nil })
+	if h := m.Health(); !h.Ready {
+		t.Errorf("Expected the builder to be ready, got %+v", h)
+	}
+	m.Add("hostkeys", func() error { return errors.New("no SSH host keys loaded") })
+	if h := m.Health(); h.Ready {
+		t.Error("Expected a failed check to make the builder unready")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	m := NewMonitor()
+	m.Queue = fakeQueue{}
+	m.ConnOpened()
+	m.ConnOpened()
+	m.ConnClosed()
+	m.Record(&webhook.Event{Type: webhook.Started, App: "myapp"})
+	m.Record(&webhook.Event{Type: webhook.Succeeded, App: "myapp", Duration: 10})
+	m.Record(&webhook.Event{Type: webhook.Failed, App: "myapp", Duration: 4})
+	m.Record(&webhook.Event{Type: webhook.Succeeded, App: "other", Duration: 1})
+
+	ms := m.Metrics()
+	if ms.Connections != 1 || ms.ConnectionsTotal != 2 {
+		t.Errorf("Expected 1 of 2 connections open, got %d of %d", ms.Connections, ms.ConnectionsTotal)
+	}
+	if ms.BuildsRunning != 2 || ms.BuildsWaiting != 1 {
+		t.Errorf("Expected the queue's builds, got %d running and %d waiting", ms.BuildsRunning, ms.BuildsWaiting)
+	}
+	if ms.Builds != 3 || ms.Failures != 1 {
+		t.Errorf("Expected 3 builds and 1 failure, got %d and %d", ms.Builds, ms.Failures)
+	}
+	a := ms.Apps["myapp"]
+	if a.Builds != 2 || a.Failures != 1 || a.LastDuration != 4 || a.TotalDuration != 14 || a.LastBuild.IsZero() {
+		t.Errorf("Unexpected metrics for myapp: %+v", a)
+	}
+}
@@ -18,12 +18,14 @@ type ConfigHook struct {
 
 // BuildHook represents a controller's build-hook object.
 type BuildHook struct {
-	Sha         string      `json:"sha"`
-	ReceiveUser string      `json:"receive_user"`
-	ReceiveRepo string      `json:"receive_repo"`
-	Image       string      `json:"image"`
-	Procfile    ProcessType `json:"procfile"`
-	Dockerfile  string      `json:"dockerfile"`
+	Sha         string            `json:"sha"`
+	ReceiveUser string            `json:"receive_user"`
+	ReceiveRepo string            `json:"receive_repo"`
+	Image       string            `json:"image"`
+	Procfile    ProcessType       `json:"procfile"`
+	Dockerfile  string            `json:"dockerfile"`
+	UUID        string            `json:"uuid,omitempty"`
+	PushOptions map[string]string `json:"push_options,omitempty"`
 }
 
 // BuildHookResponse represents a controller's build-hook response object.
@@ -87,21 +87,3 @@ func GetDefaultType(bytes []byte) (string, error) {
 
 	return string(retVal), nil
 }
-
-// ParseControllerConfig returns configuration key/value pair strings from a config.
-func ParseControllerConfig(bytes []byte) ([]string, error) {
-	var controllerConfig Config
-	if err := json.Unmarshal(bytes, &controllerConfig); err != nil {
-		return []string{}, err
-	}
-
-	if controllerConfig.Values == nil {
-		return []string{""}, nil
-	}
-
-	retVal := []string{}
-	for k, v := range controllerConfig.Values {
-		retVal = append(retVal, fmt.Sprintf(" -e %s=\"%v\"", k, v))
-	}
-	return retVal, nil
-}
@@ -19,15 +19,6 @@ func (cb *ClosingBuffer) Close() error {
 	return nil
 }
 
-func stringInSlice(list []string, s string) bool {
-	for _, li := range list {
-		if li == s {
-			return true
-		}
-	}
-	return false
-}
-
 func TestYamlToJSONGood(t *testing.T) {
 	goodProcfiles := [][]byte{
 		[]byte(`web: while true; do echo hello; sleep 1; done`),
@@ -136,34 +127,6 @@ default_process_types:
 	}
 }
 
-func TestParseControllerConfigGood(t *testing.T) {
-	// mock controller config response
-	resp := []byte(`{"owner": "test",
-		"app": "example-go",
-		"values": {"FOO": "bar", "CAR": "star"},
-		"memory": {},
-		"cpu": {},
-		"tags": {},
-		"created": "2014-01-01T00:00:00UTC",
-		"updated": "2014-01-01T00:00:00UTC",
-		"uuid": "de1bf5b5-4a72-4f94-a10c-d2a3741cdf75"
-	}`)
-
-	config, err := ParseControllerConfig(resp)
-
-	if err != nil {
-		t.Errorf("expected to pass, got '%v'", err)
-	}
-
-	if len(config) != 2 {
-		t.Errorf("expected 2, got %d", len(config))
-	}
-
-	if !stringInSlice(config, " -e CAR=\"star\"") {
-		t.Error("expected ' -e CAR=\"star\"' in slice")
-	}
-}
-
 func TestTimeSerialize(t *testing.T) {
 	time, err := json.Marshal(&dtime.Time{Time: time.Now().UTC()})
 
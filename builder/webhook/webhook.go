@@ -0,0 +1,321 @@
+// Package webhook notifies external services about builds.
+//
+// Webhooks are configured in etcd, as lists of URLs separated by spaces or
+// commas. Platform-wide webhooks are in /deis/builder/webhooks, and the
+// webhooks of an application in /deis/builder/apps/$app/webhooks. Both are
+// read for every event, so changes take effect immediately.
+//
+// Events are POSTed as JSON. If /deis/builder/webhookSecret is set, the body
+// is signed with it, and the signature is sent in the X-Deis-Signature header
+// as "sha256=" followed by the hex-encoded HMAC-SHA256 of the body.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/cookoo"
+	"github.com/Masterminds/cookoo/log"
+)
+
+// Build events.
+const (
+	// Queued is sent when a push has to wait for another build.
+	Queued = "queued"
+	// Started is sent when a build starts.
+	Started = "started"
+	// Succeeded is sent when a build has been built and released.
+	Succeeded = "succeeded"
+	// Failed is sent when a build fails.
+	Failed = "failed"
+)
+
+// Headers sent with each event.
+const (
+	EventHeader     = "X-Deis-Event"
+	SignatureHeader = "X-Deis-Signature"
+)
+
+// Etcd keys webhooks are configured in.
+const (
+	PlatformKey = "/deis/builder/webhooks"
+	AppKey      = "/deis/builder/apps/%s/webhooks"
+	SecretKey   = "/deis/builder/webhookSecret"
+)
+
+// Event is the payload sent to webhooks.
+type Event struct {
+	// Type is one of Queued, Started, Succeeded or Failed.
+	Type string `json:"event"`
+	App  string `json:"app"`
+	// Sha is the pushed commit. Queued events have none, because the push
+	// has not been received yet.
+	Sha  string `json:"sha,omitempty"`
+	User string `json:"user"`
+	UUID string `json:"uuid,omitempty"`
+	// Duration is how long the build took, in seconds.
+	Duration float64 `json:"duration,omitempty"`
+	// Image is the image the build pushed to the registry.
+	Image string `json:"image,omitempty"`
+	// Release is the version of the release the build created.
+	Release int `json:"release,omitempty"`
+	// Error describes why a build failed.
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// Notifier delivers events to webhooks in the background.
+type Notifier struct {
+	// Lookup reads the current value of an etcd key.
+	Lookup func(key string) (string, error)
+	// Attempts is the number of times delivery to a webhook is tried.
+	Attempts int
+	// Backoff is the wait before the first retry. It doubles with each retry.
+	Backoff time.Duration
+	// MaxPending is the number of events an application may have waiting for
+	// delivery. Beyond it, the oldest waiting event is dropped.
+	MaxPending int
+	// Logf logs delivery problems.
+	Logf func(format string, v ...interface{})
+
+	client *http.Client
+	wg     sync.WaitGroup
+
+	// The events of each application are delivered one at a time, in the
+	// order they were sent, by a worker of their own. The worker exits once
+	// the application has no events left.
+	mu      sync.Mutex
+	pending map[string][]*Event
+}
+
+// NewNotifier creates a notifier that reads its configuration with lookup.
+func NewNotifier(lookup func(string) (string, error)) *Notifier {
+	return &Notifier{
+		Lookup:     lookup,
+		Attempts:   5,
+		Backoff:    2 * time.Second,
+		MaxPending: 100,
+		Logf:       func(string, ...interface{}) {},
+		client:     &http.Client{Timeout: 10 * time.Second},
+		pending:    map[string][]*Event{},
+	}
+}
+
+// CreateNotifier creates a new notifier.
+//
+// Params:
+// 	- lookup (func(string) (string, error)): Reads the current value of an etcd key.
+//
+// Returns:
+// 	- *Notifier
+func CreateNotifier(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	n := NewNotifier(p.Get("lookup", nil).(func(string) (string, error)))
+	n.Logf = func(format string, v ...interface{}) {
+		log.Warnf(c, format, v...)
+	}
+	return n, nil
+}
+
+// Flush waits for pending deliveries, e.g. before the builder exits.
+//
+// Params:
+// 	- notifier (*Notifier): The notifier.
+// 	- timeout (string): How long to wait, e.g. "30s".
+//
+// Returns:
+// 	- bool: true if all deliveries finished.
+func Flush(c cookoo.Context, p *cookoo.Params) (interface{}, cookoo.Interrupt) {
+	n, ok := p.Get("notifier", nil).(*Notifier)
+	if !ok {
+		return true, nil
+	}
+	timeout, err := time.ParseDuration(p.Get("timeout", "30s").(string))
+	if err != nil {
+		return false, err
+	}
+	if !n.Wait(timeout) {
+		log.Warnf(c, "Gave up on webhook deliveries after %s", timeout)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Notify sends an event to the platform's and the application's webhooks.
+// It returns immediately; delivery happens in the background.
+//
+// The events of an application are delivered in the order they were sent. An
+// event is sent to all its webhooks at once, and the application's next event
+// waits until they are done. Applications do not wait for each other, so a
+// webhook that hangs only holds up the events of its own applications.
+func (n *Notifier) Notify(e *Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	n.wg.Add(1)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.pending == nil {
+		n.pending = map[string][]*Event{}
+	}
+	queue, busy := n.pending[e.App]
+	if n.MaxPending > 0 && len(queue) >= n.MaxPending {
+		dropped := queue[0]
+		queue = queue[1:]
+		n.Logf("Dropped %s event for %s: more than %d events are waiting for delivery", dropped.Type, dropped.App, n.MaxPending)
+		n.wg.Done()
+	}
+	n.pending[e.App] = append(queue, e)
+	if !busy {
+		go n.work(e.App)
+	}
+}
+
+// work delivers the pending events of an application in order.
+func (n *Notifier) work(app string) {
+	for {
+		n.mu.Lock()
+		queue := n.pending[app]
+		if len(queue) == 0 {
+			delete(n.pending, app)
+			n.mu.Unlock()
+			return
+		}
+		e := queue[0]
+		n.pending[app] = queue[1:]
+		n.mu.Unlock()
+
+		n.send(e)
+		n.wg.Done()
+	}
+}
+
+// send delivers an event to its webhooks, and waits until they are done.
+func (n *Notifier) send(e *Event) {
+	urls := n.URLs(e.App)
+	if len(urls) == 0 {
+		return
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		n.Logf("Could not encode %s event for %s: %s", e.Type, e.App, err)
+		return
+	}
+	secret, _ := n.Lookup(SecretKey)
+	var wg sync.WaitGroup
+	for _, u := range urls {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			if err := n.deliver(u, e.Type, body, secret); err != nil {
+				n.Logf("Could not deliver %s event for %s to %s: %s", e.Type, e.App, u, err)
+			}
+		}(u)
+	}
+	wg.Wait()
+}
+
+// Wait waits up to timeout for pending deliveries. It returns false if they
+// did not finish in time.
+func (n *Notifier) Wait(timeout time.Duration) bool {
+	done := make(chan bool)
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// URLs returns the webhooks an application's events are sent to.
+func (n *Notifier) URLs(app string) []string {
+	seen := map[string]bool{}
+	urls := []string{}
+	for _, key := range []string{PlatformKey, fmt.Sprintf(AppKey, app)} {
+		v, err := n.Lookup(key)
+		if err != nil {
+			continue
+		}
+		for _, u := range strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' || r == '\n' }) {
+			if seen[u] {
+				continue
+			}
+			seen[u] = true
+			if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+				n.Logf("Ignoring webhook %q in %s: not an http(s) URL", u, key)
+				continue
+			}
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// deliver POSTs an event to a webhook, retrying with exponential backoff if
+// the webhook cannot be reached or fails with a server error.
+func (n *Notifier) deliver(u, event string, body []byte, secret string) error {
+	client := n.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	wait := n.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		if retry, err = n.post(client, u, event, body, secret); err == nil || !retry {
+			return err
+		}
+		if attempt >= n.Attempts {
+			return fmt.Errorf("%s (gave up after %d attempts)", err, attempt)
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// post sends an event once. It returns whether a failure is worth retrying.
+func (n *Notifier) post(client *http.Client, u, event string, body []byte, secret string) (bool, error) {
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "deis-builder")
+	req.Header.Set(EventHeader, event)
+	if len(secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(secret, body))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode >= 500 || res.StatusCode == 429:
+		return true, fmt.Errorf("webhook returned %s", res.Status)
+	default:
+		return false, fmt.Errorf("webhook returned %s", res.Status)
+	}
+}
+
+// Sign returns the signature of a payload, as sent in the X-Deis-Signature header.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
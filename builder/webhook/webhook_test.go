@@ -0,0 +1,233 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// settings returns a lookup function serving fixed etcd values.
+func settings(values map[string]string) func(string) (string, error) {
+	return func(key string) (string, error) {
+		v, ok := values[key]
+		if !ok {
+			return "", errors.New("key not found")
+		}
+		return v, nil
+	}
+}
+
+func TestURLs(t *testing.T) {
+	n := NewNotifier(settings(map[string]string{
+		PlatformKey:                         "http://ci.example.com/hook, https://chat.example.com/deis",
+		"/deis/builder/apps/myapp/webhooks": "http://ci.example.com/hook ftp://example.com/nope",
+	}))
+
+	expect := []string{"http://ci.example.com/hook", "https://chat.example.com/deis"}
+	if urls := n.URLs("myapp"); !reflect.DeepEqual(urls, expect) {
+		t.Errorf("Expected %v, got %v", expect, urls)
+	}
+	if urls := NewNotifier(settings(nil)).URLs("myapp"); len(urls) != 0 {
+		t.Errorf("Expected no webhooks, got %v", urls)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+	var received []*Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		// Fail the first attempt, to exercise retries.
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if sig := r.Header.Get(SignatureHeader); sig != Sign("s3cret", body) {
+			t.Errorf("Unexpected signature %q", sig)
+		}
+		if r.Header.Get(EventHeader) != Succeeded {
+			t.Errorf("Unexpected event header %q", r.Header.Get(EventHeader))
+		}
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Error(err)
+		}
+		received = append(received, &e)
+	}))
+	defer server.Close()
+
+	n := NewNotifier(settings(map[string]string{
+		"/deis/builder/apps/myapp/webhooks": server.URL,
+		SecretKey:                           "s3cret",
+	}))
+	n.Backoff = time.Millisecond
+	n.Notify(&Event{Type: Succeeded, App: "myapp", Sha: "abc123", User: "bob", Release: 3})
+	if !n.Wait(5 * time.Second) {
+		t.Fatal("Timed out waiting for delivery")
+	}
+
+	if attempts != 2 || len(received) != 1 {
+		t.Fatalf("Expected one delivery after a retry, got %d attempts and %d events", attempts, len(received))
+	}
+	e := received[0]
+	if e.App != "myapp" || e.Sha != "abc123" || e.User != "bob" || e.Release != 3 || e.Time.IsZero() {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
+
+func TestNotifyInOrder(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := r.Header.Get(EventHeader)
+		// A slow first delivery must not let later events overtake it.
+		if event == Queued {
+			time.Sleep(50 * time.Millisecond)
+		}
+		mu.Lock()
+		received = append(received, event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	n := NewNotifier(settings(map[string]string{PlatformKey: server.URL}))
+	for _, event := range []string{Queued, Started, Succeeded} {
+		n.Notify(&Event{Type: event, App: "myapp"})
+	}
+	if !n.Wait(5 * time.Second) {
+		t.Fatal("Timed out waiting for delivery")
+	}
+
+	expected := []string{Queued, Started, Succeeded}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Expected %v, got %v", expected, received)
+	}
+}
+
+func TestNotifyGivesUp(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var logged []string
+	for _, path := range []string{"/down", "/gone"} {
+		attempts = 0
+		n := NewNotifier(settings(map[string]string{PlatformKey: server.URL + path}))
+		n.Backoff = time.Millisecond
+		n.Attempts = 3
+		n.Logf = func(format string, v ...interface{}) { logged = append(logged, format) }
+		n.Notify(&Event{Type: Failed, App: "myapp"})
+		n.Wait(5 * time.Second)
+
+		// Client errors are not retried.
+		expect := 3
+		if path == "/gone" {
+			expect = 1
+		}
+		if attempts != expect {
+			t.Errorf("Expected %d attempts for %s, got %d", expect, path, attempts)
+		}
+	}
+	if len(logged) != 2 {
+		t.Errorf("Expected both failures to be logged, got %v", logged)
+	}
+}
+
+func TestNotifyAppsIndependently(t *testing.T) {
+	hang := make(chan bool)
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hang" {
+			<-hang
+		}
+		received <- r.URL.Path + " " + r.Header.Get(EventHeader)
+	}))
+	defer server.Close()
+	defer close(hang)
+
+	n := NewNotifier(settings(map[string]string{
+		"/deis/builder/apps/stuck/webhooks": server.URL + "/hang",
+		"/deis/builder/apps/myapp/webhooks": server.URL + "/ok",
+	}))
+	n.Notify(&Event{Type: Started, App: "stuck"})
+	n.Notify(&Event{Type: Failed, App: "stuck"})
+	n.Notify(&Event{Type: Started, App: "myapp"})
+	n.Notify(&Event{Type: Succeeded, App: "myapp"})
+
+	// A webhook that hangs must not hold up the events of other applications.
+	for _, expect := range []string{"/ok " + Started, "/ok " + Succeeded} {
+		select {
+		case got := <-received:
+			if got != expect {
+				t.Errorf("Expected %q, got %q", expect, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %q", expect)
+		}
+	}
+}
+
+func TestNotifyMaxPending(t *testing.T) {
+	hang := make(chan bool)
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := r.Header.Get(EventHeader)
+		if event == Queued {
+			<-hang
+		}
+		mu.Lock()
+		received = append(received, event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	n := NewNotifier(settings(map[string]string{PlatformKey: server.URL}))
+	n.MaxPending = 2
+	var logged []string
+	n.Logf = func(format string, v ...interface{}) { logged = append(logged, format) }
+
+	// The queued event hangs, and the backlog behind it is capped.
+	n.Notify(&Event{Type: Queued, App: "myapp"})
+	for {
+		n.mu.Lock()
+		waiting := len(n.pending["myapp"])
+		n.mu.Unlock()
+		if waiting == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for _, event := range []string{Started, Failed, Succeeded} {
+		n.Notify(&Event{Type: event, App: "myapp"})
+	}
+	close(hang)
+	if !n.Wait(5 * time.Second) {
+		t.Fatal("Timed out waiting for delivery")
+	}
+
+	expected := []string{Queued, Failed, Succeeded}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("Expected %v, got %v", expected, received)
+	}
+	if len(logged) != 1 {
+		t.Errorf("Expected the dropped event to be logged, got %v", logged)
+	}
+}
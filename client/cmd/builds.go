@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 
@@ -31,7 +34,11 @@ func BuildsList(appID string, results int) error {
 	fmt.Printf("=== %s Builds%s", appID, limitCount(len(builds), count))
 
 	for _, build := range builds {
-		fmt.Println(build.UUID, build.Created)
+		if len(build.PushOptions) > 0 {
+			fmt.Println(build.UUID, build.Created, formatPushOptions(build.PushOptions))
+		} else {
+			fmt.Println(build.UUID, build.Created)
+		}
 	}
 	return nil
 }
@@ -76,7 +83,152 @@ func BuildsCreate(appID, image, procfile string) error {
 	return nil
 }
 
+// BuildsLogs prints the log of an app's build.
+func BuildsLogs(appID, uuid string, follow bool) error {
+	c, appID, err := load(appID)
+
+	if err != nil {
+		return err
+	}
+
+	return builds.Logs(c, appID, uuid, follow, os.Stdout)
+}
+
+// BuildsCache shows the size of an app's build cache, or purges it.
+func BuildsCache(appID string, purge bool) error {
+	c, appID, err := load(appID)
+
+	if err != nil {
+		return err
+	}
+
+	if purge {
+		fmt.Printf("Purging build cache for %s... ", appID)
+		if err = builds.PurgeCache(c, appID); err != nil {
+			return err
+		}
+		fmt.Println("done")
+		return nil
+	}
+
+	cache, err := builds.Cache(c, appID)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("=== %s Build Cache\n", appID)
+	fmt.Println("size:     ", formatSize(cache.Size))
+	fmt.Println("last used:", cache.LastUsed)
+	fmt.Println("in use:   ", cache.InUse)
+	return nil
+}
+
+// BuildsPromote deploys the current build of another app to an app.
+func BuildsPromote(appID, from string) error {
+	c, appID, err := load(appID)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Promoting %s to %s... ", from, appID)
+	quit := progress()
+	build, err := builds.Promote(c, appID, from)
+	quit <- true
+	<-quit
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("done")
+	fmt.Println("build:", build.UUID)
+
+	return nil
+}
+
+// BuildsSlug downloads the slug compiled by an app's build.
+//
+// The slug is written to output, which defaults to <app>-<uuid>.tgz in the
+// current directory. If output is "-", it is written to standard output.
+func BuildsSlug(appID, uuid, output string) error {
+	c, appID, err := load(appID)
+
+	if err != nil {
+		return err
+	}
+
+	if output == "-" {
+		return builds.Slug(c, appID, uuid, os.Stdout)
+	}
+
+	if output == "" {
+		output = fmt.Sprintf("%s-%s.tgz", appID, uuid)
+	}
+
+	f, err := os.Create(output)
+
+	if err != nil {
+		return err
+	}
+
+	if err = builds.Slug(c, appID, uuid, f); err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Println("Saved slug to", output)
+
+	return nil
+}
+
 func parseProcfile(procfile []byte) (map[string]string, error) {
 	procfileMap := make(map[string]string)
 	return procfileMap, yaml.Unmarshal(procfile, &procfileMap)
 }
+
+// formatPushOptions formats the push options of a build for display.
+//
+// Flags are shown by name, and options with a value as key=value, with the
+// value quoted if it contains spaces.
+func formatPushOptions(opts map[string]string) string {
+	keys := make([]string, 0, len(opts))
+	for key := range opts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		value := opts[key]
+		switch {
+		case value == "true":
+			parts[i] = key
+		case strings.ContainsAny(value, " \t\""):
+			parts[i] = key + "=" + strconv.Quote(value)
+		default:
+			parts[i] = key + "=" + value
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatSize formats a size in bytes for display, e.g. "1.5 MB".
+func formatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	i := 0
+	for ; value >= 1024 && i < len(units)-1; i++ {
+		value /= 1024
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", size)
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestFormatPushOptions(t *testing.T) {
+	t.Parallel()
+
+	opts := map[string]string{
+		"no-cache":  "true",
+		"message":   "Fix the login page",
+		"buildpack": "https://github.com/heroku/heroku-buildpack-go",
+	}
+	expected := `buildpack=https://github.com/heroku/heroku-buildpack-go message="Fix the login page" no-cache`
+
+	if actual := formatPushOptions(opts); actual != expected {
+		t.Errorf("Expected %s, Got %s", expected, actual)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	t.Parallel()
+
+	tests := map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1536:            "1.5 KB",
+		3 * 1024 * 1024: "3.0 MB",
+		10 << 40:        "10.0 TB",
+	}
+
+	for size, expected := range tests {
+		if actual := formatSize(size); actual != expected {
+			t.Errorf("Expected %s, Got %s", expected, actual)
+		}
+	}
+}
@@ -2,15 +2,16 @@ package api
 
 // Build is the structure of the build object.
 type Build struct {
-	App        string            `json:"app"`
-	Created    string            `json:"created"`
-	Dockerfile string            `json:"dockerfile,omitempty"`
-	Image      string            `json:"image,omitempty"`
-	Owner      string            `json:"owner"`
-	Procfile   map[string]string `json:"procfile"`
-	Sha        string            `json:"sha,omitempty"`
-	Updated    string            `json:"updated"`
-	UUID       string            `json:"uuid"`
+	App         string            `json:"app"`
+	Created     string            `json:"created"`
+	Dockerfile  string            `json:"dockerfile,omitempty"`
+	Image       string            `json:"image,omitempty"`
+	Owner       string            `json:"owner"`
+	Procfile    map[string]string `json:"procfile"`
+	PushOptions map[string]string `json:"push_options,omitempty"`
+	Sha         string            `json:"sha,omitempty"`
+	Updated     string            `json:"updated"`
+	UUID        string            `json:"uuid"`
 }
 
 // CreateBuildRequest is the structure of POST /v1/apps/<app id>/builds/.
@@ -18,3 +19,17 @@ type CreateBuildRequest struct {
 	Image    string            `json:"image"`
 	Procfile map[string]string `json:"procfile,omitempty"`
 }
+
+// PromoteBuildRequest is the structure of POST /v1/apps/<app id>/builds/promote/.
+type PromoteBuildRequest struct {
+	From string `json:"from"`
+}
+
+// BuildCache is the structure of GET /v1/apps/<app id>/builds/cache.
+type BuildCache struct {
+	App string `json:"app"`
+	// Size is the size of the cache in bytes.
+	Size     int64  `json:"size"`
+	LastUsed string `json:"last_used"`
+	InUse    bool   `json:"in_use"`
+}
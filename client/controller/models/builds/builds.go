@@ -3,6 +3,7 @@ package builds
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/deis/deis/client/controller/api"
 	"github.com/deis/deis/client/controller/client"
@@ -52,3 +53,92 @@ func New(c *client.Client, appID string, image string,
 
 	return build, nil
 }
+
+// Logs copies the log of an app's build to out.
+//
+// If follow is true and the build is still running, its output is copied
+// until it ends.
+func Logs(c *client.Client, appID, uuid string, follow bool, out io.Writer) error {
+	u := fmt.Sprintf("/v1/apps/%s/builds/%s/logs", appID, uuid)
+
+	if follow {
+		u += "?follow=true"
+	}
+
+	res, err := c.Request("GET", u, nil)
+
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	_, err = io.Copy(out, res.Body)
+	return err
+}
+
+// Promote creates a build for an app from the current build of another app,
+// deploying the same image without rebuilding it.
+func Promote(c *client.Client, appID, from string) (api.Build, error) {
+	u := fmt.Sprintf("/v1/apps/%s/builds/promote/", appID)
+
+	body, err := json.Marshal(api.PromoteBuildRequest{From: from})
+
+	if err != nil {
+		return api.Build{}, err
+	}
+
+	resBody, err := c.BasicRequest("POST", u, body)
+
+	if err != nil {
+		return api.Build{}, err
+	}
+
+	build := api.Build{}
+	if err = json.Unmarshal([]byte(resBody), &build); err != nil {
+		return api.Build{}, err
+	}
+
+	return build, nil
+}
+
+// Slug copies the slug compiled by an app's build, a gzipped tarball, to out.
+func Slug(c *client.Client, appID, uuid string, out io.Writer) error {
+	u := fmt.Sprintf("/v1/apps/%s/builds/%s/slug", appID, uuid)
+
+	res, err := c.Request("GET", u, nil)
+
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	_, err = io.Copy(out, res.Body)
+	return err
+}
+
+// Cache describes an app's build cache.
+func Cache(c *client.Client, appID string) (api.BuildCache, error) {
+	u := fmt.Sprintf("/v1/apps/%s/builds/cache", appID)
+
+	body, err := c.BasicRequest("GET", u, nil)
+
+	if err != nil {
+		return api.BuildCache{}, err
+	}
+
+	cache := api.BuildCache{}
+	if err = json.Unmarshal([]byte(body), &cache); err != nil {
+		return api.BuildCache{}, err
+	}
+
+	return cache, nil
+}
+
+// PurgeCache empties an app's build cache, so that its next build starts
+// from scratch.
+func PurgeCache(c *client.Client, appID string) error {
+	u := fmt.Sprintf("/v1/apps/%s/builds/cache", appID)
+
+	_, err := c.BasicRequest("DELETE", u, nil)
+	return err
+}
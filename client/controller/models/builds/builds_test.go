@@ -1,6 +1,7 @@
 package builds
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -51,6 +52,20 @@ const buildFixture string = `
     "uuid": "de1bf5b5-4a72-4f94-a10c-d2a3741cdf75"
 }`
 
+const buildLogFixture string = "-----> Building Docker image\n"
+
+const buildCacheFixture string = `
+{
+    "app": "example-go",
+    "size": 1048576,
+    "last_used": "2014-01-01T00:00:00Z",
+    "in_use": false
+}`
+
+const buildSlugFixture string = "\x1f\x8b\x08\x00slug"
+
+const buildPromoteExpected string = `{"from":"example-go-staging"}`
+
 const buildExpected string = `{"image":"deis/example-go","procfile":{"web":"example-go"}}`
 
 type fakeHTTPServer struct{}
@@ -84,6 +99,47 @@ func (fakeHTTPServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if req.URL.Path == "/v1/apps/example-go/builds/de1bf5b5-4a72-4f94-a10c-d2a3741cdf75/logs" && req.Method == "GET" {
+		if req.URL.Query().Get("follow") == "true" {
+			res.Write([]byte(buildLogFixture + "done\n"))
+		} else {
+			res.Write([]byte(buildLogFixture))
+		}
+		return
+	}
+
+	if req.URL.Path == "/v1/apps/example-go/builds/promote/" && req.Method == "POST" {
+		body, err := ioutil.ReadAll(req.Body)
+
+		if err != nil || string(body) != buildPromoteExpected {
+			fmt.Printf("Expected '%s', Got '%s'\n", buildPromoteExpected, body)
+			res.WriteHeader(http.StatusInternalServerError)
+			res.Write(nil)
+			return
+		}
+
+		res.WriteHeader(http.StatusCreated)
+		res.Write([]byte(buildFixture))
+		return
+	}
+
+	if req.URL.Path == "/v1/apps/example-go/builds/de1bf5b5-4a72-4f94-a10c-d2a3741cdf75/slug" && req.Method == "GET" {
+		res.Header().Set("Content-Type", "application/gzip")
+		res.Write([]byte(buildSlugFixture))
+		return
+	}
+
+	if req.URL.Path == "/v1/apps/example-go/builds/cache" && req.Method == "GET" {
+		res.Write([]byte(buildCacheFixture))
+		return
+	}
+
+	if req.URL.Path == "/v1/apps/example-go/builds/cache" && req.Method == "DELETE" {
+		res.WriteHeader(http.StatusNoContent)
+		res.Write(nil)
+		return
+	}
+
 	fmt.Printf("Unrecognized URL %s\n", req.URL)
 	res.WriteHeader(http.StatusNotFound)
 	res.Write(nil)
@@ -176,3 +232,132 @@ func TestBuildCreate(t *testing.T) {
 		t.Error(fmt.Errorf("Expected %v, Got %v", expected, actual))
 	}
 }
+
+func TestBuildLogs(t *testing.T) {
+	t.Parallel()
+
+	handler := fakeHTTPServer{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpClient := client.CreateHTTPClient(false)
+
+	client := client.Client{HTTPClient: httpClient, ControllerURL: *u, Token: "abc"}
+
+	tests := map[bool]string{
+		false: buildLogFixture,
+		true:  buildLogFixture + "done\n",
+	}
+
+	for follow, expected := range tests {
+		var actual bytes.Buffer
+
+		if err := Logs(&client, "example-go", "de1bf5b5-4a72-4f94-a10c-d2a3741cdf75", follow, &actual); err != nil {
+			t.Fatal(err)
+		}
+
+		if actual.String() != expected {
+			t.Errorf("Expected %q, Got %q", expected, actual.String())
+		}
+	}
+}
+
+func TestBuildCache(t *testing.T) {
+	t.Parallel()
+
+	expected := api.BuildCache{
+		App:      "example-go",
+		Size:     1048576,
+		LastUsed: "2014-01-01T00:00:00Z",
+	}
+
+	handler := fakeHTTPServer{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpClient := client.CreateHTTPClient(false)
+
+	client := client.Client{HTTPClient: httpClient, ControllerURL: *u, Token: "abc"}
+
+	actual, err := Cache(&client, "example-go")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Error(fmt.Errorf("Expected %v, Got %v", expected, actual))
+	}
+
+	if err = PurgeCache(&client, "example-go"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildPromote(t *testing.T) {
+	t.Parallel()
+
+	handler := fakeHTTPServer{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpClient := client.CreateHTTPClient(false)
+
+	client := client.Client{HTTPClient: httpClient, ControllerURL: *u, Token: "abc"}
+
+	actual, err := Promote(&client, "example-go", "example-go-staging")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual.App != "example-go" || actual.Image != "deis/example-go:latest" {
+		t.Errorf("Unexpected build %v", actual)
+	}
+}
+
+func TestBuildSlug(t *testing.T) {
+	t.Parallel()
+
+	handler := fakeHTTPServer{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpClient := client.CreateHTTPClient(false)
+
+	client := client.Client{HTTPClient: httpClient, ControllerURL: *u, Token: "abc"}
+
+	var actual bytes.Buffer
+
+	if err := Slug(&client, "example-go", "de1bf5b5-4a72-4f94-a10c-d2a3741cdf75", &actual); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual.String() != buildSlugFixture {
+		t.Errorf("Expected %q, Got %q", buildSlugFixture, actual.String())
+	}
+}
@@ -12,6 +12,10 @@ Valid commands for builds:
 
 builds:list        list build history for an application
 builds:create      imports an image and deploys as a new release
+builds:logs        view the log of a build
+builds:cache       view or purge the build cache of an application
+builds:promote     deploys the current build of another application
+builds:slug        downloads the slug compiled by a build
 
 Use 'deis help [command]' to learn more.
 `
@@ -21,6 +25,14 @@ Use 'deis help [command]' to learn more.
 		return buildsList(argv)
 	case "builds:create":
 		return buildsCreate(argv)
+	case "builds:logs":
+		return buildsLogs(argv)
+	case "builds:cache":
+		return buildsCache(argv)
+	case "builds:promote":
+		return buildsPromote(argv)
+	case "builds:slug":
+		return buildsSlug(argv)
 	default:
 		if printHelp(argv, usage) {
 			return nil
@@ -97,3 +109,113 @@ Options:
 
 	return cmd.BuildsCreate(app, image, procfile)
 }
+
+func buildsLogs(argv []string) error {
+	usage := `
+Prints the log of a build. Builds created by 'git push' print their UUID
+when they start.
+
+Usage: deis builds:logs <uuid> [options]
+
+Arguments:
+  <uuid>
+    the UUID of the build.
+
+Options:
+  -a --app=<app>
+    the uniquely identifiable name for the application.
+  -f --follow
+    if the build is running, keep printing its output until it finishes.
+`
+
+	args, err := docopt.Parse(usage, argv, true, "", false, true)
+
+	if err != nil {
+		return err
+	}
+
+	app := safeGetValue(args, "--app")
+	uuid := safeGetValue(args, "<uuid>")
+	follow := args["--follow"].(bool)
+
+	return cmd.BuildsLogs(app, uuid, follow)
+}
+
+func buildsCache(argv []string) error {
+	usage := `
+Shows the size of an application's build cache, which buildpacks use to speed
+up builds. Purging the cache makes the next build start from scratch.
+
+Usage: deis builds:cache [options]
+
+Options:
+  -a --app=<app>
+    the uniquely identifiable name for the application.
+  --purge
+    empty the build cache.
+`
+
+	args, err := docopt.Parse(usage, argv, true, "", false, true)
+
+	if err != nil {
+		return err
+	}
+
+	return cmd.BuildsCache(safeGetValue(args, "--app"), args["--purge"].(bool))
+}
+
+func buildsPromote(argv []string) error {
+	usage := `
+Deploys the current build of another application as a new release, without
+rebuilding it. The exact image and process types that run in the other
+application, for example a staging application, are deployed with this
+application's configuration.
+
+Usage: deis builds:promote --from=<app> [options]
+
+Options:
+  --from=<app>
+    the application whose current build is deployed.
+  -a --app=<app>
+    the uniquely identifiable name for the application.
+`
+
+	args, err := docopt.Parse(usage, argv, true, "", false, true)
+
+	if err != nil {
+		return err
+	}
+
+	return cmd.BuildsPromote(safeGetValue(args, "--app"), safeGetValue(args, "--from"))
+}
+
+func buildsSlug(argv []string) error {
+	usage := `
+Downloads the slug, a gzipped tarball, compiled by a build. The builder keeps
+the slugs of the most recent builds of each application.
+
+Usage: deis builds:slug <uuid> [options]
+
+Arguments:
+  <uuid>
+    the UUID of the build.
+
+Options:
+  -a --app=<app>
+    the uniquely identifiable name for the application.
+  -o --output=<file>
+    where to save the slug, or "-" for standard output. Defaults to <app>-<uuid>.tgz.
+`
+
+	args, err := docopt.Parse(usage, argv, true, "", false, true)
+
+	if err != nil {
+		return err
+	}
+
+	app := safeGetValue(args, "--app")
+	uuid := safeGetValue(args, "<uuid>")
+	output := safeGetValue(args, "--output")
+
+	return cmd.BuildsSlug(app, uuid, output)
+}
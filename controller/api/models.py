@@ -540,6 +540,76 @@ class App(UuidAuditedModel):
             raise EnvironmentError('Error accessing deis-logger')
         return r.content
 
+    def build_logs(self, uuid, follow=False):
+        """Return a streaming response with the log of a build of this application."""
+        url = "http://{}:{}/logs/{}/{}".format(settings.BUILDER_HOST, settings.BUILDER_HTTP_PORT,
+                                               self.id, uuid)
+        params = {'follow': 'true'} if follow else {}
+        try:
+            r = requests.get(url, params=params, stream=True,
+                             headers={'X-Deis-Builder-Auth': settings.BUILDER_KEY})
+        # Handle HTTP request errors
+        except requests.exceptions.RequestException as e:
+            logger.error("Error accessing deis-builder using url '{}': {}".format(url, e))
+            raise e
+        # Handle logs not found
+        if r.status_code == 404:
+            logger.info("GET {} returned a {} status code".format(url, r.status_code))
+            raise EnvironmentError('Could not locate build log')
+        # Handle unanticipated status codes
+        if r.status_code != 200:
+            logger.error("Error accessing deis-builder: GET {} returned a {} status code"
+                         .format(url, r.status_code))
+            raise EnvironmentError('Error accessing deis-builder')
+        return r
+
+    def build_slug(self, uuid):
+        """Return a streaming response with the slug compiled by a build of this application."""
+        url = "http://{}:{}/slugs/{}/{}".format(settings.BUILDER_HOST, settings.BUILDER_HTTP_PORT,
+                                                self.id, uuid)
+        try:
+            r = requests.get(url, stream=True,
+                             headers={'X-Deis-Builder-Auth': settings.BUILDER_KEY})
+        # Handle HTTP request errors
+        except requests.exceptions.RequestException as e:
+            logger.error("Error accessing deis-builder using url '{}': {}".format(url, e))
+            raise e
+        # Handle slug not found
+        if r.status_code == 404:
+            logger.info("GET {} returned a {} status code".format(url, r.status_code))
+            raise EnvironmentError('Could not locate slug')
+        # Handle unanticipated status codes
+        if r.status_code != 200:
+            logger.error("Error accessing deis-builder: GET {} returned a {} status code"
+                         .format(url, r.status_code))
+            raise EnvironmentError('Error accessing deis-builder')
+        return r
+
+    def build_cache(self, purge=False):
+        """Describe the build cache of this application, or purge it."""
+        url = "http://{}:{}/caches/{}".format(settings.BUILDER_HOST, settings.BUILDER_HTTP_PORT,
+                                              self.id)
+        verb, method = ('DELETE', requests.delete) if purge else ('GET', requests.get)
+        try:
+            r = method(url, headers={'X-Deis-Builder-Auth': settings.BUILDER_KEY})
+        # Handle HTTP request errors
+        except requests.exceptions.RequestException as e:
+            logger.error("Error accessing deis-builder using url '{}': {}".format(url, e))
+            raise e
+        # Handle cache not found
+        if r.status_code == 404:
+            logger.info("{} {} returned a {} status code".format(verb, url, r.status_code))
+            raise EnvironmentError('Could not locate build cache')
+        # Handle a cache in use by a running build
+        if r.status_code == 409:
+            raise EnvironmentError('Build cache is in use')
+        # Handle unanticipated status codes
+        if r.status_code not in (200, 204):
+            logger.error("Error accessing deis-builder: {} {} returned a {} status code"
+                         .format(verb, url, r.status_code))
+            raise EnvironmentError('Error accessing deis-builder')
+        return None if purge else r.json()
+
     def run(self, user, command):
         """Run a one-off command in an ephemeral app container."""
         # FIXME: remove the need for SSH private keys by using
@@ -743,6 +813,8 @@ class Build(UuidAuditedModel):
     sha = models.CharField(max_length=40, blank=True)
     procfile = JSONField(default={}, blank=True)
     dockerfile = models.TextField(blank=True)
+    # options given with `git push -o`
+    push_options = JSONField(default={}, blank=True)
 
     class Meta:
         get_latest_by = 'created'
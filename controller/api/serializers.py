@@ -155,14 +155,15 @@ class BuildSerializer(ModelSerializer):
     app = serializers.SlugRelatedField(slug_field='id', queryset=models.App.objects.all())
     owner = serializers.ReadOnlyField(source='owner.username')
     procfile = JSONFieldSerializer(required=False)
+    push_options = JSONFieldSerializer(required=False)
     created = serializers.DateTimeField(format=settings.DEIS_DATETIME_FORMAT, read_only=True)
     updated = serializers.DateTimeField(format=settings.DEIS_DATETIME_FORMAT, read_only=True)
 
     class Meta:
         """Metadata options for a :class:`BuildSerializer`."""
         model = models.Build
-        fields = ['owner', 'app', 'image', 'sha', 'procfile', 'dockerfile', 'created',
-                  'updated', 'uuid']
+        fields = ['owner', 'app', 'image', 'sha', 'procfile', 'dockerfile', 'push_options',
+                  'created', 'updated', 'uuid']
         read_only_fields = ['uuid']
 
 
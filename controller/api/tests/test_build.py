@@ -8,9 +8,11 @@ from __future__ import unicode_literals
 
 import json
 
+from django.conf import settings
 from django.contrib.auth.models import User
 from django.test import TransactionTestCase
 import mock
+import requests
 from rest_framework.authtoken.models import Token
 
 from api.models import Build
@@ -292,3 +294,184 @@ class BuildTest(TransactionTestCase):
                                    HTTP_AUTHORIZATION='token {}'.format(self.token))
         self.assertEqual(response.status_code, 200)
         self.assertEqual(len(response.data['results']), 0)
+
+    @mock.patch('requests.get')
+    def test_build_logs(self, mock_get):
+        url = '/v1/apps'
+        response = self.client.post(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 201)
+        app_id = response.data['id']
+        build_id = '7a4c1b4e-5e2d-4d0e-9a3b-4c3c0f8f2a61'
+        url = "/v1/apps/{app_id}/builds/{build_id}/logs".format(**locals())
+
+        # test logs - 404 from deis-builder
+        mock_response = mock.Mock()
+        mock_response.status_code = 404
+        mock_get.return_value = mock_response
+        response = self.client.get(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 404)
+
+        # test logs - unanticipated status code from deis-builder
+        mock_response.status_code = 401
+        response = self.client.get(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 500)
+
+        # test logs - success accessing deis-builder
+        mock_response.status_code = 200
+        mock_response.iter_content.return_value = iter(['-----> Building\n', 'done\n'])
+        response = self.client.get(url + '?follow=true',
+                                   HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 200)
+        self.assertEqual(''.join(response.streaming_content), '-----> Building\ndone\n')
+        self.assertEqual(mock_get.call_args[1]['params'], {'follow': 'true'})
+        self.assertEqual(mock_get.call_args[1]['headers'],
+                         {'X-Deis-Builder-Auth': settings.BUILDER_KEY})
+
+        # test logs - HTTP request error while accessing deis-builder
+        mock_get.side_effect = requests.exceptions.RequestException('Boom!')
+        response = self.client.get(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 500)
+
+        # test logs - only users of the app may read its build logs
+        mock_get.side_effect = None
+        user = User.objects.get(username='autotest2')
+        token = Token.objects.get(user=user).key
+        response = self.client.get(url, HTTP_AUTHORIZATION='token {}'.format(token))
+        self.assertEqual(response.status_code, 403)
+
+    @mock.patch('requests.delete')
+    @mock.patch('requests.get')
+    def test_build_cache(self, mock_get, mock_delete):
+        url = '/v1/apps'
+        response = self.client.post(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 201)
+        app_id = response.data['id']
+        url = "/v1/apps/{app_id}/builds/cache".format(**locals())
+
+        # test cache - no cache yet
+        mock_response = mock.Mock()
+        mock_response.status_code = 404
+        mock_get.return_value = mock_response
+        response = self.client.get(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 404)
+
+        # test cache - success accessing deis-builder
+        usage = {'app': app_id, 'size': 1024, 'last_used': '2015-06-01T12:00:00Z',
+                 'in_use': False}
+        mock_response.status_code = 200
+        mock_response.json.return_value = usage
+        response = self.client.get(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 200)
+        self.assertEqual(response.data, usage)
+        self.assertEqual(mock_get.call_args[1]['headers'],
+                         {'X-Deis-Builder-Auth': settings.BUILDER_KEY})
+
+        # test purge - a running build uses the cache
+        mock_response = mock.Mock()
+        mock_response.status_code = 409
+        mock_delete.return_value = mock_response
+        response = self.client.delete(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 409)
+
+        # test purge - success
+        mock_response.status_code = 204
+        response = self.client.delete(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 204)
+
+        # test purge - unanticipated status code from deis-builder
+        mock_response.status_code = 401
+        response = self.client.delete(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 500)
+
+        # test cache - only users of the app may manage its build cache
+        user = User.objects.get(username='autotest2')
+        token = Token.objects.get(user=user).key
+        response = self.client.delete(url, HTTP_AUTHORIZATION='token {}'.format(token))
+        self.assertEqual(response.status_code, 403)
+
+    @mock.patch('requests.get')
+    def test_build_slug(self, mock_get):
+        url = '/v1/apps'
+        response = self.client.post(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 201)
+        app_id = response.data['id']
+        build_id = '7a4c1b4e-5e2d-4d0e-9a3b-4c3c0f8f2a61'
+        url = "/v1/apps/{app_id}/builds/{build_id}/slug".format(**locals())
+
+        # test slug - not kept by deis-builder
+        mock_response = mock.Mock()
+        mock_response.status_code = 404
+        mock_get.return_value = mock_response
+        response = self.client.get(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 404)
+
+        # test slug - success accessing deis-builder
+        mock_response.status_code = 200
+        mock_response.headers = {'content-length': '4'}
+        mock_response.iter_content.return_value = iter(['\x1f\x8b', '\x08\x00'])
+        response = self.client.get(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 200)
+        self.assertEqual(response['Content-Type'], 'application/gzip')
+        self.assertEqual(response['Content-Disposition'],
+                         'attachment; filename="{}-{}.tgz"'.format(app_id, build_id))
+        self.assertEqual(b''.join(response.streaming_content), b'\x1f\x8b\x08\x00')
+        self.assertEqual(mock_get.call_args[0][0], "http://{}:{}/slugs/{}/{}".format(
+            settings.BUILDER_HOST, settings.BUILDER_HTTP_PORT, app_id, build_id))
+
+        # test slug - only users of the app may download its slugs
+        user = User.objects.get(username='autotest2')
+        token = Token.objects.get(user=user).key
+        response = self.client.get(url, HTTP_AUTHORIZATION='token {}'.format(token))
+        self.assertEqual(response.status_code, 403)
+
+    @mock.patch('requests.post', mock_status_ok)
+    def test_build_promote(self):
+        for app_id in ('staging', 'prod'):
+            body = {'id': app_id}
+            response = self.client.post('/v1/apps', json.dumps(body),
+                                        content_type='application/json',
+                                        HTTP_AUTHORIZATION='token {}'.format(self.token))
+            self.assertEqual(response.status_code, 201)
+        url = '/v1/apps/prod/builds/promote'
+
+        # test promote - the source app has no build yet
+        body = {'from': 'staging'}
+        response = self.client.post(url, json.dumps(body), content_type='application/json',
+                                    HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 400)
+
+        # test promote - the source app must exist
+        response = self.client.post(url, json.dumps({'from': 'nope'}),
+                                    content_type='application/json',
+                                    HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 404)
+
+        # test promote - success
+        build = {'image': 'staging', 'sha': 'a' * 40, 'procfile': {'web': 'bin/web'},
+                 'dockerfile': ''}
+        response = self.client.post('/v1/apps/staging/builds', json.dumps(build),
+                                    content_type='application/json',
+                                    HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 201)
+        response = self.client.post(url, json.dumps(body), content_type='application/json',
+                                    HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 201)
+        self.assertIn('x-deis-release', response._headers)
+        self.assertEqual(response.data['app'], 'prod')
+        self.assertDictContainsSubset(build, response.data)
+        release = Build.objects.get(uuid=response.data['uuid']).app.release_set.latest()
+        self.assertEqual(release.version, 2)
+        self.assertEqual(release.build.sha, 'a' * 40)
+
+        # test promote - cannot promote an app to itself
+        response = self.client.post('/v1/apps/staging/builds/promote', json.dumps(body),
+                                    content_type='application/json',
+                                    HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 400)
+
+        # test promote - only users of both apps may promote
+        user = User.objects.get(username='autotest2')
+        token = Token.objects.get(user=user).key
+        response = self.client.post(url, json.dumps(body), content_type='application/json',
+                                    HTTP_AUTHORIZATION='token {}'.format(token))
+        self.assertEqual(response.status_code, 403)
@@ -92,6 +92,36 @@ class HookTest(TransactionTestCase):
                                     HTTP_X_DEIS_BUILDER_AUTH=settings.BUILDER_KEY)
         self.assertEqual(response.status_code, 403)
 
+    def test_app_hook(self):
+        """Test creating an App for a pushed branch via an API Hook"""
+        url = '/v1/apps'
+        response = self.client.post(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 201)
+        app_id = response.data['id']
+        body = {'receive_user': 'autotest',
+                'receive_repo': '{app_id}-review-foo'.format(**locals()),
+                'source_repo': app_id}
+        url = '/v1/hooks/app'
+        # post without an auth token
+        response = self.client.post(url, json.dumps(body), content_type='application/json')
+        self.assertEqual(response.status_code, 401)
+        # post with the builder auth key
+        response = self.client.post(url, json.dumps(body), content_type='application/json',
+                                    HTTP_X_DEIS_BUILDER_AUTH=settings.BUILDER_KEY)
+        self.assertEqual(response.status_code, 201)
+        self.assertEqual(response.data['id'], body['receive_repo'])
+        self.assertEqual(response.data['owner'], 'autotest')
+        # pushing to the branch again leaves the app alone
+        response = self.client.post(url, json.dumps(body), content_type='application/json',
+                                    HTTP_X_DEIS_BUILDER_AUTH=settings.BUILDER_KEY)
+        self.assertEqual(response.status_code, 200)
+        # a user without access to the source app may not create branch apps
+        body['receive_user'] = 'autotest2'
+        body['receive_repo'] = '{app_id}-review-bar'.format(**locals())
+        response = self.client.post(url, json.dumps(body), content_type='application/json',
+                                    HTTP_X_DEIS_BUILDER_AUTH=settings.BUILDER_KEY)
+        self.assertEqual(response.status_code, 403)
+
     @mock.patch('requests.post', mock_status_ok)
     def test_build_hook(self):
         """Test creating a Build via an API Hook"""
@@ -115,6 +145,46 @@ class HookTest(TransactionTestCase):
         self.assertIn('version', response.data['release'])
         self.assertIn('domains', response.data)
 
+    def test_build_hook_uuid(self):
+        """Test that the builder can name the builds it creates"""
+        url = '/v1/apps'
+        response = self.client.post(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 201)
+        app_id = response.data['id']
+        url = '/v1/hooks/builds'
+        uuid = '7a4c1b4e-5e2d-4d0e-9a3b-4c3c0f8f2a61'
+        body = {'receive_user': 'autotest',
+                'receive_repo': app_id,
+                'image': '{app_id}:v2'.format(**locals()),
+                'uuid': uuid}
+        response = self.client.post(url, json.dumps(body), content_type='application/json',
+                                    HTTP_X_DEIS_BUILDER_AUTH=settings.BUILDER_KEY)
+        self.assertEqual(response.status_code, 200)
+        url = "/v1/apps/{app_id}/builds/{uuid}".format(**locals())
+        response = self.client.get(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 200)
+        self.assertEqual(response.data['uuid'], uuid)
+
+    def test_build_hook_push_options(self):
+        """Test that push options are recorded with the build"""
+        url = '/v1/apps'
+        response = self.client.post(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 201)
+        app_id = response.data['id']
+        url = '/v1/hooks/builds'
+        PUSH_OPTIONS = {'no-cache': 'true', 'message': 'Fix the login page'}
+        body = {'receive_user': 'autotest',
+                'receive_repo': app_id,
+                'image': '{app_id}:v2'.format(**locals()),
+                'push_options': PUSH_OPTIONS}
+        response = self.client.post(url, json.dumps(body), content_type='application/json',
+                                    HTTP_X_DEIS_BUILDER_AUTH=settings.BUILDER_KEY)
+        self.assertEqual(response.status_code, 200)
+        url = '/v1/apps/{app_id}/builds'.format(**locals())
+        response = self.client.get(url, HTTP_AUTHORIZATION='token {}'.format(self.token))
+        self.assertEqual(response.status_code, 200)
+        self.assertEqual(response.data['results'][0]['push_options'], PUSH_OPTIONS)
+
     def test_build_hook_procfile(self):
         """Test creating a Procfile build via an API Hook"""
         url = '/v1/apps'
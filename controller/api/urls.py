@@ -19,6 +19,14 @@ urlpatterns = patterns(
     # application release components
     url(r"^apps/(?P<id>{})/config/?".format(settings.APP_URL_REGEX),
         views.ConfigViewSet.as_view({'get': 'retrieve', 'post': 'create'})),
+    url(r"^apps/(?P<id>{})/builds/cache/?".format(settings.APP_URL_REGEX),
+        views.BuildViewSet.as_view({'get': 'cache', 'delete': 'cache'})),
+    url(r"^apps/(?P<id>{})/builds/promote/?".format(settings.APP_URL_REGEX),
+        views.BuildViewSet.as_view({'post': 'promote'})),
+    url(r"^apps/(?P<id>{})/builds/(?P<uuid>[-_\w]+)/logs/?".format(settings.APP_URL_REGEX),
+        views.BuildViewSet.as_view({'get': 'logs'})),
+    url(r"^apps/(?P<id>{})/builds/(?P<uuid>[-_\w]+)/slug/?".format(settings.APP_URL_REGEX),
+        views.BuildViewSet.as_view({'get': 'slug'})),
     url(r"^apps/(?P<id>{})/builds/(?P<uuid>[-_\w]+)/?".format(settings.APP_URL_REGEX),
         views.BuildViewSet.as_view({'get': 'retrieve'})),
     url(r"^apps/(?P<id>{})/builds/?".format(settings.APP_URL_REGEX),
@@ -74,6 +82,8 @@ urlpatterns = patterns(
     # hooks
     url(r'^hooks/push/?',
         views.PushHookViewSet.as_view({'post': 'create'})),
+    url(r'^hooks/app/?',
+        views.AppHookViewSet.as_view({'post': 'create'})),
     url(r'^hooks/build/?',
         views.BuildHookViewSet.as_view({'post': 'create'})),
     url(r'^hooks/config/?',
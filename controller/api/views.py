@@ -3,6 +3,7 @@ RESTful view classes for presenting Deis API objects.
 """
 from django.conf import settings
 from django.core.exceptions import ValidationError
+from django.http import StreamingHttpResponse
 from django.contrib.auth.models import User
 from django.shortcuts import get_object_or_404
 from guardian.shortcuts import assign_perm, get_objects_for_user, \
@@ -256,6 +257,111 @@ class BuildViewSet(ReleasableViewSet):
         self.release = build.create(self.request.user)
         super(BuildViewSet, self).post_save(build)
 
+    def logs(self, request, **kwargs):
+        app = self.get_app()
+        follow = request.query_params.get('follow') == 'true'
+        try:
+            r = app.build_logs(kwargs['uuid'], follow)
+        except requests.exceptions.RequestException:
+            return Response("Error accessing build log {}".format(kwargs['uuid']),
+                            status=status.HTTP_500_INTERNAL_SERVER_ERROR,
+                            content_type='text/plain')
+        except EnvironmentError as e:
+            if e.message == 'Error accessing deis-builder':
+                return Response("Error accessing build log {}".format(kwargs['uuid']),
+                                status=status.HTTP_500_INTERNAL_SERVER_ERROR,
+                                content_type='text/plain')
+            else:
+                return Response("No build log {} for {}".format(kwargs['uuid'], app.id),
+                                status=status.HTTP_404_NOT_FOUND,
+                                content_type='text/plain')
+        # stream the log, so that a running build can be followed
+        return StreamingHttpResponse(r.iter_content(chunk_size=None), content_type='text/plain')
+
+    def cache(self, request, **kwargs):
+        app = self.get_app()
+        purge = request.method == 'DELETE'
+        try:
+            usage = app.build_cache(purge)
+        except requests.exceptions.RequestException:
+            return Response("Error accessing build cache for {}".format(app.id),
+                            status=status.HTTP_500_INTERNAL_SERVER_ERROR,
+                            content_type='text/plain')
+        except EnvironmentError as e:
+            if e.message == 'Build cache is in use':
+                return Response("The build cache for {} is in use by a running build"
+                                .format(app.id),
+                                status=status.HTTP_409_CONFLICT,
+                                content_type='text/plain')
+            elif e.message == 'Error accessing deis-builder':
+                return Response("Error accessing build cache for {}".format(app.id),
+                                status=status.HTTP_500_INTERNAL_SERVER_ERROR,
+                                content_type='text/plain')
+            else:
+                return Response("No build cache for {}".format(app.id),
+                                status=status.HTTP_404_NOT_FOUND,
+                                content_type='text/plain')
+        if purge:
+            return Response(status=status.HTTP_204_NO_CONTENT)
+        return Response(usage, status=status.HTTP_200_OK)
+
+    def slug(self, request, **kwargs):
+        app = self.get_app()
+        try:
+            r = app.build_slug(kwargs['uuid'])
+        except requests.exceptions.RequestException:
+            return Response("Error accessing slug {}".format(kwargs['uuid']),
+                            status=status.HTTP_500_INTERNAL_SERVER_ERROR,
+                            content_type='text/plain')
+        except EnvironmentError as e:
+            if e.message == 'Error accessing deis-builder':
+                return Response("Error accessing slug {}".format(kwargs['uuid']),
+                                status=status.HTTP_500_INTERNAL_SERVER_ERROR,
+                                content_type='text/plain')
+            else:
+                return Response("No slug {} for {}".format(kwargs['uuid'], app.id),
+                                status=status.HTTP_404_NOT_FOUND,
+                                content_type='text/plain')
+        response = StreamingHttpResponse(r.iter_content(chunk_size=64 * 1024),
+                                         content_type='application/gzip')
+        response['Content-Disposition'] = 'attachment; filename="{}-{}.tgz"'.format(
+            app.id, kwargs['uuid'])
+        if 'content-length' in r.headers:
+            response['Content-Length'] = r.headers['content-length']
+        return response
+
+    def promote(self, request, **kwargs):
+        """
+        Create a build of this application from the current build of another one, so that
+        the exact image tested there is deployed without being rebuilt.
+        """
+        app = self.get_app()
+        source_id = request.data.get('from')
+        if not source_id:
+            return Response({'detail': 'the application to promote from is required'},
+                            status=status.HTTP_400_BAD_REQUEST)
+        source = get_object_or_404(models.App, id=source_id)
+        self.check_object_permissions(request, source)
+        if source == app:
+            return Response({'detail': 'cannot promote an application to itself'},
+                            status=status.HTTP_400_BAD_REQUEST)
+        source_build = source.release_set.latest().build
+        if source_build is None:
+            return Response({'detail': '{} has no build to promote'.format(source.id)},
+                            status=status.HTTP_400_BAD_REQUEST)
+
+        build = models.Build.objects.create(
+            owner=request.user, app=app, image=source_build.image, sha=source_build.sha,
+            procfile=source_build.procfile, dockerfile=source_build.dockerfile)
+        try:
+            self.release = build.create(request.user)
+        except RuntimeError as e:
+            build.delete()
+            return Response({'detail': str(e)}, status=status.HTTP_503_SERVICE_UNAVAILABLE)
+        data = self.get_serializer(build).data
+        return Response(data, status=status.HTTP_201_CREATED,
+                        headers=self.get_success_headers(data))
+
 
 class ConfigViewSet(ReleasableViewSet):
     """A viewset for interacting with Config objects."""
@@ -377,6 +483,27 @@ class PushHookViewSet(BaseHookViewSet):
         return super(PushHookViewSet, self).create(request, *args, **kwargs)
 
 
+class AppHookViewSet(BaseHookViewSet):
+    """API hook to create a new :class:`~api.models.App` for a pushed branch"""
+    model = models.App
+    serializer_class = serializers.AppSerializer
+
+    def create(self, request, *args, **kwargs):
+        request.user = get_object_or_404(User, username=request.data['receive_user'])
+        # an existing app is left alone; the push hook checks access to it
+        if models.App.objects.filter(id=request.data['receive_repo']).exists():
+            return Response(status=status.HTTP_200_OK)
+        # only users of the app owning the repository may create branch apps from it
+        source = get_object_or_404(models.App, id=request.data['source_repo'])
+        if not permissions.is_app_user(request, source):
+            raise PermissionDenied()
+        request.data['id'] = request.data['receive_repo']
+        return super(AppHookViewSet, self).create(request, *args, **kwargs)
+
+    def post_save(self, app):
+        app.create()
+
+
 class BuildHookViewSet(BaseHookViewSet):
     """API hook to create new :class:`~api.models.Build`"""
     model = models.Build
@@ -396,6 +523,13 @@ class BuildHookViewSet(BaseHookViewSet):
                     'domains': ['.'.join([app.id, settings.DEIS_DOMAIN])]}
         return Response(response, status=status.HTTP_200_OK)
 
+    def perform_create(self, serializer):
+        # the builder names its builds, so that their logs can be found by build UUID
+        kwargs = {'owner': self.user}
+        if self.request.data.get('uuid'):
+            kwargs['uuid'] = self.request.data['uuid']
+        self.post_save(serializer.save(**kwargs))
+
     def post_save(self, build):
         build.create(self.user)
 
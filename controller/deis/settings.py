@@ -317,6 +317,10 @@ REGISTRY_PORT = 5000
 LOGGER_HOST = 'localhost'
 LOGGER_PORT = 8088
 
+# builder settings
+BUILDER_HOST = 'localhost'
+BUILDER_HTTP_PORT = 2224
+
 # check if we can register users with `deis register`
 REGISTRATION_ENABLED = True
 
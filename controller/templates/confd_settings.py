@@ -45,6 +45,8 @@ DATABASES = {
 
 LOGGER_HOST = '{{ getv "/deis/logs/host"}}'
 
+BUILDER_HOST = '{{ if exists "/deis/builder/host" }}{{ getv "/deis/builder/host" }}{{ else }}127.0.0.1{{ end }}'
+
 {{ if exists "/deis/controller/registrationMode" }}
 REGISTRATION_MODE = '{{ getv "/deis/controller/registrationMode" }}'
 {{ end }}
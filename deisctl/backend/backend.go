@@ -1,18 +1,24 @@
 package backend
 
 import (
+	"encoding/json"
 	"io"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Backend interface is used to interact with the cluster control plane
+//
+// The operations on units write their progress and errors to two writers
+// as they go, and return the result of each unit once they are done.
 type Backend interface {
-	Create([]string, *sync.WaitGroup, io.Writer, io.Writer)
-	Destroy([]string, *sync.WaitGroup, io.Writer, io.Writer)
-	Start([]string, *sync.WaitGroup, io.Writer, io.Writer)
-	Stop([]string, *sync.WaitGroup, io.Writer, io.Writer)
-	Scale(string, int, *sync.WaitGroup, io.Writer, io.Writer)
-	RollingRestart(string, *sync.WaitGroup, io.Writer, io.Writer)
+	Create([]string, io.Writer, io.Writer) []Result
+	Destroy([]string, io.Writer, io.Writer) []Result
+	Start([]string, io.Writer, io.Writer) []Result
+	Stop([]string, io.Writer, io.Writer) []Result
+	Scale(string, int, ScaleOptions, io.Writer, io.Writer) []Result
+	RollingRestart(string, RollingRestartOptions, io.Writer, io.Writer) []Result
 	SSH(string) error
 	SSHExec(string, string) error
 	Dock(string, []string) error
@@ -20,5 +26,141 @@ type Backend interface {
 	ListUnits() error
 	ListUnitFiles() error
 	Status(string) error
-	Journal(string) error
+	Journal([]string, JournalOptions, io.Writer, io.Writer) error
+}
+
+// Result is the outcome of an operation on one unit.
+type Result struct {
+	Unit string
+	// Action is the operation, such as create, start, stop or destroy.
+	Action string
+	// State is the state the operation left the unit in, such as running.
+	State    string
+	Err      error
+	Duration time.Duration
+}
+
+// MarshalJSON encodes the error of a result as its message, and its duration
+// in seconds.
+func (r Result) MarshalJSON() ([]byte, error) {
+	var msg string
+	if r.Err != nil {
+		msg = r.Err.Error()
+	}
+	return json.Marshal(struct {
+		Unit     string  `json:"unit"`
+		Action   string  `json:"action"`
+		State    string  `json:"state,omitempty"`
+		Error    string  `json:"error,omitempty"`
+		Duration float64 `json:"duration"`
+	}{r.Unit, r.Action, r.State, msg, r.Duration.Seconds()})
+}
+
+// Failed returns the results that have an error.
+func Failed(results []Result) []Result {
+	var failed []Result
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// Each runs an operation on targets concurrently, and returns the result of
+// each, in the order of targets. The operation returns the name of the unit
+// it acted on and the state it left it in.
+func Each(action string, targets []string, op func(target string) (unit, state string, err error)) []Result {
+	results := make([]Result, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			start := time.Now()
+			unit, state, err := op(target)
+			if unit == "" {
+				unit = target
+			}
+			results[i] = Result{Unit: unit, Action: action, State: state, Err: err, Duration: time.Since(start)}
+		}(i, target)
+	}
+	wg.Wait()
+	return results
+}
+
+// RollingRestartOptions control how the instances of a component are restarted.
+type RollingRestartOptions struct {
+	// BatchSize is how many instances restart at once.
+	BatchSize int
+	// HealthTimeout is how long a batch has to become healthy: its units
+	// running and the etcd key each instance publishes itself in refreshed.
+	HealthTimeout time.Duration
+	// AbortOnFailure stops the restart at the first unhealthy batch, leaving
+	// the remaining instances untouched.
+	AbortOnFailure bool
+}
+
+// UnitState is the state of an installed unit.
+type UnitState struct {
+	Name string `json:"name"`
+	// Machine is the ID of the machine the unit is scheduled on, if any.
+	Machine     string `json:"machine,omitempty"`
+	ActiveState string `json:"active"`
+	SubState    string `json:"sub"`
+	// MachineMetadata are the key=value pairs a machine must have to run
+	// the unit, as in its X-Fleet section.
+	MachineMetadata []string `json:"machineMetadata,omitempty"`
+}
+
+// Machine is a host of the cluster.
+type Machine struct {
+	ID       string            `json:"id"`
+	IP       string            `json:"ip"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Inspector is implemented by backends that report the state of the cluster,
+// rather than only printing it.
+type Inspector interface {
+	UnitStates() ([]UnitState, error)
+	Machines() ([]Machine, error)
+}
+
+// Satisfies is true if the machine has all the key=value metadata.
+func (m Machine) Satisfies(metadata []string) bool {
+	for _, kv := range metadata {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || m.Metadata[parts[0]] != parts[1] {
+			return false
+		}
+	}
+	return true
+}
+
+// UnitFile is a unit as a backend would install it.
+type UnitFile struct {
+	Name     string
+	Contents string
+	// Hash identifies the contents, as fleet list-unit-files shows it.
+	Hash string
+	// MachineMetadata are the key=value pairs a machine must have to run
+	// the unit.
+	MachineMetadata []string
+}
+
+// Planner is implemented by backends that can tell what they would install,
+// for dry runs.
+type Planner interface {
+	Inspector
+	// UnitFile renders the unit file of a target, such as router@1.
+	UnitFile(string) (UnitFile, error)
+}
+
+// Registry is implemented by backends that keep the unit files of installed
+// units, so they can be compared with the unit files of the local templates.
+type Registry interface {
+	Planner
+	// InstalledUnitFiles returns the unit files of the installed units.
+	InstalledUnitFiles() ([]UnitFile, error)
 }
@@ -0,0 +1,289 @@
+// Package docker implements a deisctl backend that runs the Deis platform on a
+// single host by driving Docker directly, without CoreOS or fleet.
+//
+// Units are read from the same unit files the fleet backend schedules. Their
+// docker run commands are run with the local Docker daemon, and installed
+// units are remembered in $HOME/.deis/docker/units.
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/coreos/fleet/unit"
+
+	"github.com/deis/deis/deisctl/config"
+	"github.com/deis/deis/pkg/prettyprint"
+)
+
+var stateFmt = prettyprint.Colorize("{{.Yellow}}%v:{{.Default}} %v/%v")
+
+// DockerClient manages Deis components as Docker containers on this host.
+type DockerClient struct {
+	configBackend config.Backend
+
+	templatePaths []string
+	// unitDir holds the unit files of installed units.
+	unitDir string
+	// hostIP is the address components advertise, in place of the CoreOS
+	// private IPv4 address.
+	hostIP string
+	docker commandRunner
+	out    *tabwriter.Writer
+}
+
+// NewClient returns a client that runs components with the local Docker daemon.
+//
+// Components advertise the address in $DEISCTL_HOST_IP, or else the first
+// non-loopback IPv4 address of this host.
+func NewClient(cb config.Backend) (*DockerClient, error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return nil, fmt.Errorf("the docker backend needs the docker command: %v", err)
+	}
+
+	// path hierarchy for finding systemd service templates
+	templatePaths := []string{
+		os.Getenv("DEISCTL_UNITS"),
+		path.Join(os.Getenv("HOME"), ".deis", "units"),
+		"/var/lib/deis/units",
+	}
+
+	out := new(tabwriter.Writer)
+	out.Init(os.Stdout, 0, 8, 1, '\t', 0)
+
+	return &DockerClient{
+		configBackend: cb,
+		templatePaths: templatePaths,
+		unitDir:       path.Join(os.Getenv("HOME"), ".deis", "docker", "units"),
+		hostIP:        hostIP(),
+		docker:        dockerCLI{},
+		out:           out,
+	}, nil
+}
+
+// hostIP returns the address components should advertise.
+func hostIP() string {
+	if ip := os.Getenv("DEISCTL_HOST_IP"); ip != "" {
+		return ip
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+				return ipnet.IP.String()
+			}
+		}
+	}
+	return "127.0.0.1"
+}
+
+// commandRunner runs docker commands.
+type commandRunner interface {
+	// Output runs docker and returns what it printed.
+	Output(args ...string) (string, error)
+	// Run runs docker attached to the terminal.
+	Run(args ...string) error
+	// Stream runs docker and writes its output to out.
+	Stream(out io.Writer, args ...string) error
+}
+
+type dockerCLI struct{}
+
+func (dockerCLI) Output(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("docker %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("docker %s: %v", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+func (dockerCLI) Run(args ...string) error {
+	cmd := exec.Command("docker", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (dockerCLI) Stream(out io.Writer, args ...string) error {
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker %s: %v", args[0], err)
+	}
+	return nil
+}
+
+// Units returns the installed units whose names start with target, or with
+// "deis-" and target.
+func (c *DockerClient) Units(target string) (units []string, err error) {
+	installed, err := c.installedUnits()
+	if err != nil {
+		return
+	}
+	canonTarget := strings.ToLower(target)
+	if !strings.HasPrefix(canonTarget, "deis-") {
+		canonTarget = "deis-" + canonTarget
+	}
+	for _, prefix := range []string{target, canonTarget} {
+		for _, u := range installed {
+			if strings.HasPrefix(u, prefix) {
+				units = append(units, u)
+			}
+		}
+		if len(units) > 0 {
+			return
+		}
+	}
+	return nil, fmt.Errorf("could not find unit: %s", target)
+}
+
+// installedUnits returns the names of the installed units, sorted.
+func (c *DockerClient) installedUnits() ([]string, error) {
+	infos, err := ioutil.ReadDir(c.unitDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var units []string
+	for _, fi := range infos {
+		if strings.HasSuffix(fi.Name(), ".service") {
+			units = append(units, fi.Name())
+		}
+	}
+	sort.Strings(units)
+	return units, nil
+}
+
+// container reads how an installed unit runs in Docker.
+func (c *DockerClient) container(name string) (*container, error) {
+	data, err := ioutil.ReadFile(path.Join(c.unitDir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not find unit: %s", name)
+	} else if err != nil {
+		return nil, err
+	}
+	uf, err := unit.NewUnitFile(string(data))
+	if err != nil {
+		return nil, err
+	}
+	vars := map[string]string{"COREOS_PRIVATE_IPV4": c.hostIP, "COREOS_PUBLIC_IPV4": c.hostIP}
+	return parseUnit(name, uf, c.image, vars)
+}
+
+// image returns the image of a component, such as /deis/builder, as
+// /run/deis/bin/get_image does on CoreOS.
+func (c *DockerClient) image(component string) (string, error) {
+	if img, err := c.configBackend.Get(component + "/image"); err == nil && img != "" {
+		return strings.TrimPrefix(img, "/"), nil
+	}
+	release, err := c.configBackend.Get("/deis/platform/version")
+	if err != nil || release == "" {
+		return "", fmt.Errorf("no image for %s, set the platform version with \"deisctl config platform set version=<version>\"", component)
+	}
+	return strings.TrimPrefix(component, "/") + ":" + release, nil
+}
+
+// unitState returns the systemd-like active and sub states of a container.
+func (c *DockerClient) unitState(name string) (active, sub string) {
+	out, err := c.docker.Output("inspect", "--format={{.State.Running}} {{.State.ExitCode}}", name)
+	if err != nil {
+		return "inactive", "dead"
+	}
+	fields := strings.Fields(out)
+	switch {
+	case len(fields) == 2 && fields[0] == "true":
+		return "active", "running"
+	case len(fields) == 2 && fields[1] != "0":
+		return "failed", "failed"
+	}
+	return "inactive", "dead"
+}
+
+// exists is true if a container or image exists.
+func (c *DockerClient) exists(name string) bool {
+	_, err := c.docker.Output("inspect", name)
+	return err == nil
+}
+
+// pull pulls an image unless it is present.
+func (c *DockerClient) pull(image string, out io.Writer) error {
+	if c.exists(image) {
+		return nil
+	}
+	fmt.Fprintf(out, "Pulling %s...\n", image)
+	_, err := c.docker.Output("pull", image)
+	return err
+}
+
+func splitTarget(target string) (component string, num int, err error) {
+	// see if we were provided a specific target
+	r := regexp.MustCompile(`^(?:deis-)?([a-z-]+)(@\d+)?(\.service)?$`)
+	match := r.FindStringSubmatch(target)
+	if len(match) < 3 {
+		err = fmt.Errorf("Could not parse target: %v", target)
+		return
+	}
+	if match[2] == "" {
+		return match[1], 0, nil
+	}
+	num, err = strconv.Atoi(match[2][1:])
+	return match[1], num, err
+}
+
+// formatUnitName returns a properly formatted systemd service name
+// using the given component type and number
+func formatUnitName(component string, num int) string {
+	component = strings.TrimPrefix(component, "deis-")
+	if num == 0 {
+		return "deis-" + component + ".service"
+	}
+	return "deis-" + component + "@" + strconv.Itoa(num) + ".service"
+}
+
+// expandTargets expands @* targets to all installed units.
+func (c *DockerClient) expandTargets(targets []string) (expanded []string, err error) {
+	for _, t := range targets {
+		if !strings.HasPrefix(t, "deis-") {
+			t = "deis-" + t
+		}
+		if strings.HasSuffix(t, "@*") {
+			var units []string
+			if units, err = c.Units(strings.TrimSuffix(t, "@*")); err != nil {
+				return
+			}
+			expanded = append(expanded, units...)
+		} else {
+			expanded = append(expanded, t)
+		}
+	}
+	return
+}
+
+// unitName returns the unit name of a target.
+func unitName(target string) (string, error) {
+	component, num, err := splitTarget(target)
+	if err != nil {
+		return "", err
+	}
+	return formatUnitName(component, num), nil
+}
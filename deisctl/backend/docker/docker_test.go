@@ -0,0 +1,228 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/config/model"
+	"github.com/deis/deis/deisctl/test/mock"
+)
+
+// fakeDocker records docker commands and keeps track of containers.
+type fakeDocker struct {
+	mu         sync.Mutex
+	commands   []string
+	containers map[string]bool // name to running
+}
+
+func (d *fakeDocker) Output(args ...string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.commands = append(d.commands, strings.Join(args, " "))
+
+	switch args[0] {
+	case "inspect":
+		name := args[len(args)-1]
+		if strings.Contains(name, ":") {
+			return "[]", nil
+		}
+		running, ok := d.containers[name]
+		if !ok {
+			return "", fmt.Errorf("docker inspect: no such container %s", name)
+		}
+		if running {
+			return "true 0\n", nil
+		}
+		return "false 0\n", nil
+	case "run":
+		name, _, err := runTarget(args[1:])
+		if err != nil {
+			return "", err
+		}
+		d.containers[name] = args[1] == "-d"
+	case "stop":
+		d.containers[args[len(args)-1]] = false
+	case "rm":
+		delete(d.containers, args[len(args)-1])
+	}
+	return "", nil
+}
+
+func (d *fakeDocker) Run(args ...string) error {
+	_, err := d.Output(args...)
+	return err
+}
+
+// Stream prints the container of docker logs as its log.
+func (d *fakeDocker) Stream(out io.Writer, args ...string) error {
+	if _, err := d.Output(args...); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "2015-06-01T12:00:00.000000000Z %s started\n", args[len(args)-1])
+	return err
+}
+
+func newTestClient(t *testing.T) (*DockerClient, *fakeDocker, func()) {
+	dir, err := ioutil.TempDir("", "deisctl-docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &fakeDocker{containers: map[string]bool{}}
+	out := new(tabwriter.Writer)
+	out.Init(ioutil.Discard, 0, 8, 1, '\t', 0)
+	c := &DockerClient{
+		configBackend: mock.ConfigBackend{Expected: mock.Store{
+			&model.ConfigNode{Key: "/deis/platform/version", Value: "v1.12.2"},
+		}},
+		templatePaths: []string{path.Join("..", "..", "units")},
+		unitDir:       path.Join(dir, "units"),
+		hostIP:        "10.0.0.2",
+		docker:        d,
+		out:           out,
+	}
+	return c, d, func() { os.RemoveAll(dir) }
+}
+
+func TestLifecycle(t *testing.T) {
+	c, d, cleanup := newTestClient(t)
+	defer cleanup()
+
+	var out, ew bytes.Buffer
+
+	c.Create([]string{"builder"}, &out, &ew)
+	units, err := c.Units("builder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(units, []string{"deis-builder.service"}) {
+		t.Fatalf("Expected deis-builder.service, Got %v", units)
+	}
+
+	results := c.Start([]string{"builder"}, &out, &ew)
+	if len(results) != 1 || results[0].Unit != "deis-builder.service" || results[0].State != "running" {
+		t.Errorf("Expected deis-builder.service to start running, Got %v", results)
+	}
+	if ew.Len() > 0 {
+		t.Fatal(ew.String())
+	}
+	if running, ok := d.containers["deis-builder-data"]; !ok || running {
+		t.Error("Expected deis-builder-data to be created")
+	}
+	if !d.containers["deis-builder"] {
+		t.Error("Expected deis-builder to be running")
+	}
+	if !strings.Contains(out.String(), "active/running") {
+		t.Errorf("Expected active/running, Got %s", out.String())
+	}
+
+	c.Stop([]string{"builder"}, &out, &ew)
+	if d.containers["deis-builder"] {
+		t.Error("Expected deis-builder to be stopped")
+	}
+	if !contains(d.commands, "stop -t 360 deis-builder") {
+		t.Errorf("Expected the stop timeout of the unit, Got %v", d.commands)
+	}
+
+	c.Destroy([]string{"builder"}, &out, &ew)
+	if _, ok := d.containers["deis-builder"]; ok {
+		t.Error("Expected deis-builder to be removed")
+	}
+	if _, ok := d.containers["deis-builder-data"]; !ok {
+		t.Error("Expected deis-builder-data to be kept")
+	}
+	if _, err := c.Units("builder"); err == nil {
+		t.Error("Expected deis-builder.service to be uninstalled")
+	}
+	if ew.Len() > 0 {
+		t.Fatal(ew.String())
+	}
+}
+
+func TestCreateConflicts(t *testing.T) {
+	c, _, cleanup := newTestClient(t)
+	defer cleanup()
+
+	var out, ew bytes.Buffer
+
+	results := c.Scale("router", 2, backend.ScaleOptions{}, &out, &ew)
+	if failed := backend.Failed(results); len(failed) == 0 || failed[0].Unit != "deis-router@2.service" || failed[0].Action != "create" {
+		t.Errorf("Expected creating router@2 to fail, Got %v", results)
+	}
+	if !strings.Contains(ew.String(), "conflicts with deis-router@1.service") {
+		t.Errorf("Expected a conflict, Got %q", ew.String())
+	}
+	units, err := c.Units("router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(units, []string{"deis-router@1.service"}) {
+		t.Errorf("Expected deis-router@1.service, Got %v", units)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	c, d, cleanup := newTestClient(t)
+	defer cleanup()
+
+	var out, ew bytes.Buffer
+	c.Create([]string{"builder", "router@1"}, &out, &ew)
+	out.Reset()
+
+	opts := backend.JournalOptions{Lines: 10, Follow: true}
+	if err := c.Journal([]string{"builder", "router"}, opts, &out, &ew); err != nil {
+		t.Fatal(err)
+	}
+	if !contains(d.commands, "logs --timestamps --tail=10 -f deis-router") {
+		t.Errorf("Expected the logs of deis-router to be followed, Got %v", d.commands)
+	}
+	for _, name := range []string{"deis-builder.service", "deis-router@1.service"} {
+		if !strings.Contains(out.String(), name) {
+			t.Errorf("Expected the log of %s, Got %s", name, out.String())
+		}
+	}
+}
+
+func TestImage(t *testing.T) {
+	t.Parallel()
+
+	c := &DockerClient{configBackend: mock.ConfigBackend{Expected: mock.Store{
+		&model.ConfigNode{Key: "/deis/platform/version", Value: "v1.12.2"},
+		&model.ConfigNode{Key: "/deis/router/image", Value: "example/router:latest"},
+	}}}
+	for component, expected := range map[string]string{
+		"/deis/builder": "deis/builder:v1.12.2",
+		"/deis/router":  "example/router:latest",
+	} {
+		img, err := c.image(component)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img != expected {
+			t.Errorf("Expected %s, Got %s", expected, img)
+		}
+	}
+
+	c.configBackend = mock.ConfigBackend{}
+	if _, err := c.image("/deis/builder"); err == nil {
+		t.Error("Expected an error without a platform version")
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,363 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/coreos/fleet/unit"
+
+	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/backend/fleet"
+	"github.com/deis/deis/deisctl/units"
+	"github.com/deis/deis/pkg/prettyprint"
+)
+
+// Create installs the unit files of the given components.
+func (c *DockerClient) Create(targets []string, out, ew io.Writer) []backend.Result {
+	if err := os.MkdirAll(c.unitDir, 0755); err != nil {
+		fmt.Fprintf(ew, "Error creating: %s\n", err)
+		return []backend.Result{{Unit: strings.Join(targets, " "), Action: "create", Err: err}}
+	}
+	var results []backend.Result
+	for _, target := range targets {
+		start := time.Now()
+		name, err := c.create(target)
+		if err != nil {
+			fmt.Fprintf(ew, "Error creating: %s\n", err)
+			if name == "" {
+				name = target
+			}
+			return append(results, backend.Result{Unit: name, Action: "create", Err: err, Duration: time.Since(start)})
+		}
+		tpl := prettyprint.Colorize("{{.Yellow}}%v:{{.Default}} loaded")
+		fmt.Fprintln(out, fmt.Sprintf(tpl, name))
+		results = append(results, backend.Result{Unit: name, Action: "create", State: "loaded", Duration: time.Since(start)})
+	}
+	return results
+}
+
+// create installs the unit file of a target.
+func (c *DockerClient) create(target string) (string, error) {
+	name, err := unitName(target)
+	if err != nil {
+		return "", err
+	}
+	component, _, _ := splitTarget(target)
+	params, err := fleet.ReadUnitParams(c.configBackend, component)
+	if err != nil {
+		return name, err
+	}
+	uf, err := fleet.NewUnit(component, c.templatePaths, false, params)
+	if err != nil {
+		return name, err
+	}
+	if err := c.checkConflicts(name, uf); err != nil {
+		return name, err
+	}
+	return name, ioutil.WriteFile(path.Join(c.unitDir, name), []byte(uf.String()), 0644)
+}
+
+// checkConflicts returns an error if an installed unit conflicts with a new
+// one. Fleet schedules conflicting units on different hosts, but here every
+// unit runs on this host.
+func (c *DockerClient) checkConflicts(name string, uf *unit.UnitFile) error {
+	installed, err := c.installedUnits()
+	if err != nil {
+		return err
+	}
+	for _, opt := range uf.Options {
+		if opt.Section != "X-Fleet" || opt.Name != "Conflicts" {
+			continue
+		}
+		for _, pattern := range strings.Fields(opt.Value) {
+			for _, u := range installed {
+				if ok, _ := path.Match(pattern, u); ok && u != name {
+					return fmt.Errorf("%s conflicts with %s, and the docker backend runs every unit on this host", name, u)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// UnitFile renders the unit file of a target, as Create would install it.
+func (c *DockerClient) UnitFile(target string) (backend.UnitFile, error) {
+	name, err := unitName(target)
+	if err != nil {
+		return backend.UnitFile{}, err
+	}
+	component, _, _ := splitTarget(target)
+	params, err := fleet.ReadUnitParams(c.configBackend, component)
+	if err != nil {
+		return backend.UnitFile{}, err
+	}
+	uf, err := fleet.NewUnit(component, c.templatePaths, false, params)
+	if err != nil {
+		return backend.UnitFile{}, err
+	}
+	return backend.UnitFile{Name: name, Contents: uf.String(), Hash: uf.Hash().String()}, nil
+}
+
+// Start runs the containers of units and waits for them to be running.
+func (c *DockerClient) Start(targets []string, out, ew io.Writer) []backend.Result {
+	expandedTargets, err := c.expandTargets(targets)
+	if err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return []backend.Result{{Unit: strings.Join(targets, " "), Action: "start", Err: err}}
+	}
+	return backend.Each("start", expandedTargets, func(target string) (string, string, error) {
+		return c.doStart(target, out, ew)
+	})
+}
+
+func (c *DockerClient) doStart(target string, out, ew io.Writer) (string, string, error) {
+	name, err := unitName(target)
+	if err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return name, "", err
+	}
+	ctr, err := c.container(name)
+	if err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return name, "", err
+	}
+
+	// create data containers and the like once
+	for _, setup := range ctr.Setup {
+		setupName, image, err := runTarget(setup)
+		if err != nil {
+			fmt.Fprintln(ew, err.Error())
+			return name, "", err
+		}
+		if setupName != "" && c.exists(setupName) {
+			continue
+		}
+		if err := c.pull(image, out); err != nil {
+			fmt.Fprintln(ew, err.Error())
+			return name, "", err
+		}
+		if _, err := c.docker.Output(append([]string{"run"}, setup...)...); err != nil {
+			fmt.Fprintln(ew, err.Error())
+			return name, "", err
+		}
+	}
+
+	if err := c.pull(ctr.Image, out); err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return name, "", err
+	}
+	if c.exists(ctr.Name) {
+		if _, err := c.docker.Output("rm", "-f", ctr.Name); err != nil {
+			fmt.Fprintln(ew, err.Error())
+			return name, "", err
+		}
+	}
+	if _, err := c.docker.Output(append([]string{"run"}, ctr.Run...)...); err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return name, "", err
+	}
+
+	active, sub := c.unitState(ctr.Name)
+	fmt.Fprintln(out, prettyprint.Overwritef(stateFmt, name, active, sub))
+	if sub != "running" {
+		o := prettyprint.Colorize("{{.Red}}The service '%s' failed while starting.{{.Default}}\n")
+		fmt.Fprintf(ew, o, target)
+		return name, sub, fmt.Errorf("%s failed while starting", name)
+	}
+	return name, sub, nil
+}
+
+// Stop stops the containers of units.
+func (c *DockerClient) Stop(targets []string, out, ew io.Writer) []backend.Result {
+	expandedTargets, err := c.expandTargets(targets)
+	if err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return []backend.Result{{Unit: strings.Join(targets, " "), Action: "stop", Err: err}}
+	}
+	return backend.Each("stop", expandedTargets, func(target string) (string, string, error) {
+		return c.doStop(target, out, ew)
+	})
+}
+
+func (c *DockerClient) doStop(target string, out, ew io.Writer) (string, string, error) {
+	name, err := unitName(target)
+	if err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return name, "", err
+	}
+	ctr, err := c.container(name)
+	if err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return name, "", err
+	}
+	if c.exists(ctr.Name) {
+		args := []string{"stop"}
+		if ctr.StopTimeout != "" {
+			args = append(args, "-t", ctr.StopTimeout)
+		}
+		if _, err := c.docker.Output(append(args, ctr.Name)...); err != nil {
+			fmt.Fprintln(ew, err.Error())
+			return name, "", err
+		}
+	}
+	active, sub := c.unitState(ctr.Name)
+	fmt.Fprintln(out, prettyprint.Overwritef(stateFmt, name, active, sub))
+	return name, sub, nil
+}
+
+// Destroy removes the containers and unit files of units.
+func (c *DockerClient) Destroy(targets []string, out, ew io.Writer) []backend.Result {
+	expandedTargets, err := c.expandTargets(targets)
+	if err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return []backend.Result{{Unit: strings.Join(targets, " "), Action: "destroy", Err: err}}
+	}
+	return backend.Each("destroy", expandedTargets, func(target string) (string, string, error) {
+		return c.doDestroy(target, out, ew)
+	})
+}
+
+func (c *DockerClient) doDestroy(target string, out, ew io.Writer) (string, string, error) {
+	name, err := unitName(target)
+	if err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return name, "", err
+	}
+	// a unit whose file cannot be read is still uninstalled
+	if ctr, err := c.container(name); err == nil && c.exists(ctr.Name) {
+		if _, err := c.docker.Output("rm", "-f", ctr.Name); err != nil {
+			fmt.Fprintln(ew, err.Error())
+			return name, "", err
+		}
+	}
+	if err := os.Remove(path.Join(c.unitDir, name)); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintln(ew, err.Error())
+		return name, "", err
+	}
+	tpl := prettyprint.Colorize("{{.Yellow}}%v:{{.Default}} destroyed")
+	fmt.Fprintln(out, fmt.Sprintf(tpl, name))
+	return name, "destroyed", nil
+}
+
+// Scale creates or destroys units to match the desired number. Every instance
+// runs on this host, so they cannot be spread or placed on other machines.
+func (c *DockerClient) Scale(component string, requested int, opts backend.ScaleOptions, out, ew io.Writer) []backend.Result {
+	if requested < 0 {
+		fmt.Fprintln(ew, "cannot scale below 0")
+		return []backend.Result{{Unit: component, Action: "scale", Err: errors.New("cannot scale below 0")}}
+	}
+	states, err := c.UnitStates()
+	if err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return []backend.Result{{Unit: component, Action: "scale", Err: err}}
+	}
+	instances := backend.Instances(component, states)
+	machines, _ := c.Machines()
+
+	var results []backend.Result
+	switch {
+	case requested == len(instances):
+	case requested > len(instances):
+		if err := backend.CheckPlacement(component, requested, nil, machines, opts); err != nil {
+			fmt.Fprintln(ew, err.Error())
+			return []backend.Result{{Unit: component, Action: "scale", Err: err}}
+		}
+		for _, target := range backend.NewInstances(component, instances, requested-len(instances)) {
+			results = append(results, c.Create([]string{target}, out, ew)...)
+			results = append(results, c.Start([]string{target}, out, ew)...)
+		}
+	default:
+		for _, target := range backend.PickScaleDown(component, instances, machines, len(instances)-requested, opts) {
+			results = append(results, c.Destroy([]string{target}, out, ew)...)
+		}
+	}
+	return results
+}
+
+// healthInterval is how often a rolling restart checks restarted instances.
+var healthInterval = time.Second
+
+// RollingRestart restarts the instances of a templated component in batches,
+// moving on to the next batch once the last one is healthy.
+func (c *DockerClient) RollingRestart(component string, opts backend.RollingRestartOptions, out, ew io.Writer) []backend.Result {
+	if strings.Contains(component, "@") {
+		fmt.Fprintf(ew, "invalid component %s\n", component)
+		return []backend.Result{{Unit: component, Action: "restart", Err: fmt.Errorf("invalid component %s", component)}}
+	}
+	names, err := c.Units(component + "@")
+	if err != nil {
+		fmt.Fprintf(ew, "%s has no instances to restart\n", component)
+		return []backend.Result{{Unit: component, Action: "restart", Err: fmt.Errorf("%s has no instances to restart", component)}}
+	}
+	size := opts.BatchSize
+	if size < 1 {
+		size = 1
+	}
+	publishes := units.Components[component].Publishes
+	var results []backend.Result
+	for i := 0; i < len(names); i += size {
+		end := i + size
+		if end > len(names) {
+			end = len(names)
+		}
+		batch := names[i:end]
+		results = append(results, c.Stop(batch, out, ew)...)
+		if publishes != "" {
+			c.configBackend.Delete(fmt.Sprintf(publishes, c.hostIP))
+		}
+		results = append(results, c.Start(batch, out, ew)...)
+
+		start := time.Now()
+		deadline := start.Add(opts.HealthTimeout)
+		for _, name := range batch {
+			err = c.waitHealthy(publishes, name, deadline)
+			r := backend.Result{Unit: name, Action: "health", State: "healthy", Err: err, Duration: time.Since(start)}
+			if err != nil {
+				r.State = ""
+				results = append(results, r)
+				break
+			}
+			results = append(results, r)
+		}
+		if err != nil {
+			fmt.Fprintln(ew, err.Error())
+			if opts.AbortOnFailure {
+				if rest := names[end:]; len(rest) > 0 {
+					fmt.Fprintf(ew, "Aborted rolling restart, left untouched: %s\n", strings.Join(rest, ", "))
+				}
+				return results
+			}
+		}
+	}
+	return results
+}
+
+// waitHealthy waits until a unit is running and has published itself in etcd.
+func (c *DockerClient) waitHealthy(publishes, name string, deadline time.Time) error {
+	ctr, err := c.container(name)
+	if err != nil {
+		return err
+	}
+	for {
+		switch active, sub := c.unitState(ctr.Name); {
+		case sub == "failed":
+			return fmt.Errorf("%s failed while restarting", name)
+		case active == "active" && publishes == "":
+			return nil
+		case active == "active":
+			if v, err := c.configBackend.Get(fmt.Sprintf(publishes, c.hostIP)); err == nil && v != "" {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s was not healthy in time", name)
+		}
+		time.Sleep(healthInterval)
+	}
+}
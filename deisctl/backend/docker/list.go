@@ -0,0 +1,223 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/fleet/unit"
+
+	"github.com/deis/deis/deisctl/backend"
+)
+
+// errNoSSH is returned by SSH, since every component runs on this host.
+var errNoSSH = errors.New("the docker backend runs every component on this host; use \"deisctl dock\" to open a shell in a container")
+
+// journalWindow is how long log lines are held to merge the logs of several
+// containers in timestamp order.
+var journalWindow = 500 * time.Millisecond
+
+// ListUnits prints the installed units and the states of their containers.
+func (c *DockerClient) ListUnits() error {
+	units, err := c.installedUnits()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, "UNIT\tMACHINE\tLOAD\tACTIVE\tSUB")
+	for _, name := range units {
+		active, sub := "-", "-"
+		if ctr, err := c.container(name); err == nil {
+			active, sub = c.unitState(ctr.Name)
+		}
+		fmt.Fprintf(c.out, "%s\tlocal/%s\tloaded\t%s\t%s\n", name, c.hostIP, active, sub)
+	}
+	c.out.Flush()
+	return nil
+}
+
+// ListUnitFiles prints the installed units and the containers they run.
+func (c *DockerClient) ListUnitFiles() error {
+	units, err := c.installedUnits()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, "UNIT\tCONTAINER\tIMAGE")
+	for _, name := range units {
+		ctr, err := c.container(name)
+		if err != nil {
+			fmt.Fprintf(c.out, "%s\t-\t%v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(c.out, "%s\t%s\t%s\n", name, ctr.Name, ctr.Image)
+	}
+	c.out.Flush()
+	return nil
+}
+
+// InstalledUnitFiles returns the unit files of installed units, as they were
+// installed.
+func (c *DockerClient) InstalledUnitFiles() ([]backend.UnitFile, error) {
+	units, err := c.installedUnits()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]backend.UnitFile, len(units))
+	for i, name := range units {
+		data, err := ioutil.ReadFile(path.Join(c.unitDir, name))
+		if err != nil {
+			return nil, err
+		}
+		uf, err := unit.NewUnitFile(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		result[i] = backend.UnitFile{Name: name, Contents: uf.String(), Hash: uf.Hash().String()}
+	}
+	return result, nil
+}
+
+// UnitStates returns the state of the containers of installed units.
+func (c *DockerClient) UnitStates() ([]backend.UnitState, error) {
+	units, err := c.installedUnits()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]backend.UnitState, len(units))
+	for i, name := range units {
+		s := backend.UnitState{Name: name, Machine: localMachine, ActiveState: "-", SubState: "-"}
+		if ctr, err := c.container(name); err == nil {
+			s.ActiveState, s.SubState = c.unitState(ctr.Name)
+		}
+		result[i] = s
+	}
+	return result, nil
+}
+
+// Machines returns this host, the only machine of the platform.
+func (c *DockerClient) Machines() ([]backend.Machine, error) {
+	return []backend.Machine{{ID: localMachine, IP: c.hostIP}}, nil
+}
+
+// localMachine is the machine ID of this host.
+const localMachine = "local"
+
+// ListMachines prints this host, the only machine of the platform.
+func (c *DockerClient) ListMachines() error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "local"
+	}
+	fmt.Fprintln(c.out, "MACHINE\tIP\tMETADATA")
+	fmt.Fprintf(c.out, "%s\t%s\t-\n", hostname, c.hostIP)
+	c.out.Flush()
+	return nil
+}
+
+// Status prints the state of the containers of target unit(s).
+func (c *DockerClient) Status(target string) error {
+	units, err := c.Units(target)
+	if err != nil {
+		return err
+	}
+	for _, name := range units {
+		ctr, err := c.container(name)
+		if err != nil {
+			return err
+		}
+		active, sub := c.unitState(ctr.Name)
+		fmt.Printf("%s - %s\n   Active: %s (%s)\n", name, ctr.Name, active, sub)
+		if c.exists(ctr.Name) {
+			c.docker.Run("ps", "-a", "--filter", "name=^/"+ctr.Name+"$")
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// Journal prints the logs of the containers of target units, streamed at the
+// same time and merged.
+func (c *DockerClient) Journal(targets []string, opts backend.JournalOptions, out, ew io.Writer) error {
+	var names, containers []string
+	seen := map[string]bool{}
+	for _, target := range targets {
+		units, err := c.Units(target)
+		if err != nil {
+			return err
+		}
+		for _, name := range units {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			ctr, err := c.container(name)
+			if err != nil {
+				return err
+			}
+			names = append(names, name)
+			containers = append(containers, ctr.Name)
+		}
+	}
+
+	args := []string{"logs", "--timestamps"}
+	if opts.Lines > 0 {
+		args = append(args, "--tail="+strconv.Itoa(opts.Lines))
+	}
+	if opts.Since != "" {
+		args = append(args, "--since="+opts.Since)
+	}
+	if opts.Follow {
+		args = append(args, "-f")
+	}
+
+	mux := backend.NewJournalMux(out, journalWindow)
+	writers := mux.Writers(names)
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer writers[i].Close()
+			errs[i] = c.docker.Stream(writers[i], append(append([]string(nil), args...), containers[i])...)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			fmt.Fprintln(ew, err)
+		}
+	}
+	return mux.Wait()
+}
+
+// SSH is not supported, since every component runs on this host.
+func (c *DockerClient) SSH(name string) error {
+	return errNoSSH
+}
+
+// SSHExec is not supported, since every component runs on this host.
+func (c *DockerClient) SSHExec(name, cmd string) error {
+	return errNoSSH
+}
+
+// Dock runs 'docker exec -it' in the container of a unit.
+func (c *DockerClient) Dock(target string, cmd []string) error {
+	units, err := c.Units(target)
+	if err != nil {
+		return err
+	}
+	ctr, err := c.container(units[0])
+	if err != nil {
+		return err
+	}
+	if len(cmd) == 0 {
+		cmd = []string{"sh"}
+	}
+	return c.docker.Run(append([]string{"exec", "-it", ctr.Name}, cmd...)...)
+}
@@ -0,0 +1,265 @@
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/fleet/unit"
+)
+
+// container is how a unit runs in Docker, as read from the docker commands
+// of its unit file.
+type container struct {
+	// Name is the name of the unit's container.
+	Name string
+	// Image is the image the container runs.
+	Image string
+	// Run are the "docker run" arguments of the container.
+	Run []string
+	// Setup are the "docker run" arguments of containers the unit creates
+	// before it starts, such as data containers.
+	Setup [][]string
+	// StopTimeout is the "docker stop -t" timeout of the unit, if it has one.
+	StopTimeout string
+}
+
+// getImageRe matches the helper units use to look up the image of a component.
+var getImageRe = regexp.MustCompile("(?:`|\\$\\()/run/deis/bin/get_image (/deis/[a-z0-9-]+)(?:`|\\))")
+
+// shellRe matches a command run by the shell, such as /bin/sh -c "...".
+var shellRe = regexp.MustCompile(`^(?:/usr)?(?:/bin/)?(?:ba)?sh -c `)
+
+// varRe matches shell variables.
+var varRe = regexp.MustCompile(`\$(?:\{([A-Za-z_][A-Za-z0-9_]*)\}|([A-Za-z_][A-Za-z0-9_]*))`)
+
+// boolFlags are the "docker run" flags that take no value.
+var boolFlags = map[string]bool{
+	"-d": true, "--detach": true, "-i": true, "--interactive": true, "-t": true, "--tty": true,
+	"-it": true, "-ti": true, "-P": true, "--publish-all": true, "--privileged": true, "--rm": true,
+	"--read-only": true, "--init": true,
+}
+
+// parseUnit reads how a unit runs in Docker from its ExecStartPre, ExecStart
+// and ExecStop commands.
+//
+// image looks up the image of a component, as /run/deis/bin/get_image does.
+// vars are the environment variables the commands see, such as
+// COREOS_PRIVATE_IPV4. Commands other than docker run and docker stop, such
+// as etcdctl calls, are ignored.
+func parseUnit(name string, uf *unit.UnitFile, image func(string) (string, error), vars map[string]string) (*container, error) {
+	c := &container{}
+	for _, opt := range uf.Options {
+		if opt.Section != "Service" {
+			continue
+		}
+		if opt.Name != "ExecStartPre" && opt.Name != "ExecStart" && opt.Name != "ExecStop" {
+			continue
+		}
+		cmds, err := dockerCommands(opt.Value, image, vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		for _, args := range cmds {
+			switch {
+			case args[0] == "run" && opt.Name == "ExecStart":
+				c.Run = args[1:]
+			case args[0] == "run" && opt.Name == "ExecStartPre":
+				c.Setup = append(c.Setup, args[1:])
+			case args[0] == "stop" && opt.Name == "ExecStop":
+				for i, a := range args {
+					if (a == "-t" || a == "--time") && i+1 < len(args) {
+						c.StopTimeout = args[i+1]
+					} else if strings.HasPrefix(a, "--time=") {
+						c.StopTimeout = strings.TrimPrefix(a, "--time=")
+					}
+				}
+			}
+		}
+	}
+	if c.Run == nil {
+		return nil, fmt.Errorf("%s does not run a Docker container", name)
+	}
+
+	var err error
+	if c.Name, c.Image, err = runTarget(c.Run); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if c.Name == "" {
+		return nil, fmt.Errorf("%s does not name its container", name)
+	}
+	// The container is detached instead of supervised by systemd, so it is
+	// kept when it stops, to read its logs.
+	run := []string{"-d"}
+	for _, a := range c.Run {
+		if a != "--rm" {
+			run = append(run, a)
+		}
+	}
+	c.Run = run
+	return c, nil
+}
+
+// dockerCommands returns the arguments of the docker commands in an Exec
+// command, after the word "docker".
+func dockerCommands(cmd string, image func(string) (string, error), vars map[string]string) ([][]string, error) {
+	cmd = strings.TrimLeft(cmd, "-@+!")
+	if sh := shellRe.FindString(cmd); sh != "" {
+		cmd = strings.TrimSpace(strings.TrimPrefix(cmd, sh))
+		if words, err := splitWords(cmd); err == nil && len(words) == 1 {
+			cmd = words[0]
+		}
+	}
+
+	var lookupErr error
+	cmd = getImageRe.ReplaceAllStringFunc(cmd, func(s string) string {
+		img, err := image(getImageRe.FindStringSubmatch(s)[1])
+		if err != nil {
+			lookupErr = err
+		}
+		return img
+	})
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+
+	env := make(map[string]string, len(vars))
+	for k, v := range vars {
+		env[k] = v
+	}
+	var cmds [][]string
+	for _, segment := range splitCommands(cmd) {
+		words, err := splitWords(segment)
+		if err != nil {
+			return nil, err
+		}
+		for i, w := range words {
+			words[i] = varRe.ReplaceAllStringFunc(w, func(s string) string {
+				m := varRe.FindStringSubmatch(s)
+				if v, ok := env[m[1]+m[2]]; ok {
+					return v
+				}
+				return s
+			})
+		}
+		// Assignments such as IMAGE=... are seen by later commands.
+		for len(words) > 0 && isAssignment(words[0]) {
+			kv := strings.SplitN(words[0], "=", 2)
+			env[kv[0]] = kv[1]
+			words = words[1:]
+		}
+		if len(words) > 1 && (words[0] == "docker" || words[0] == "/usr/bin/docker") {
+			cmds = append(cmds, words[1:])
+		}
+	}
+	return cmds, nil
+}
+
+// runTarget returns the container name and image of "docker run" arguments.
+func runTarget(args []string) (name, image string, err error) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--name" && i+1 < len(args):
+			name = args[i+1]
+			i++
+		case strings.HasPrefix(a, "--name="):
+			name = strings.TrimPrefix(a, "--name=")
+		case !strings.HasPrefix(a, "-"):
+			return name, a, nil
+		case boolFlags[a] || strings.Contains(a, "="):
+		default:
+			i++
+		}
+	}
+	return "", "", fmt.Errorf("no image in docker run %s", strings.Join(args, " "))
+}
+
+// isAssignment is true if a word assigns a shell variable.
+func isAssignment(w string) bool {
+	i := strings.Index(w, "=")
+	return i > 0 && !strings.ContainsAny(w[:i], "-/$ .")
+}
+
+// splitCommands splits a shell command line on ;, && and || outside quotes.
+func splitCommands(s string) []string {
+	var cmds []string
+	var quote rune
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch ch := rune(s[i]); {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			} else if ch == '\\' && quote == '"' {
+				i++
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '\\':
+			i++
+		case ch == ';':
+			cmds = append(cmds, s[start:i])
+			start = i + 1
+		case (ch == '&' || ch == '|') && i+1 < len(s) && rune(s[i+1]) == ch:
+			cmds = append(cmds, s[start:i])
+			start = i + 2
+			i++
+		}
+	}
+	return append(cmds, s[start:])
+}
+
+// splitWords splits a command into words the way the shell does, without
+// expanding anything. Redirections are dropped.
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var w []rune
+	inWord := false
+	var quote rune
+	flush := func() {
+		if inWord {
+			word := string(w)
+			if !isRedirection(word) {
+				words = append(words, word)
+			}
+		}
+		w, inWord = nil, false
+	}
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		ch := rs[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			} else if ch == '\\' && quote == '"' && i+1 < len(rs) && strings.ContainsRune(`"\$`+"`", rs[i+1]) {
+				i++
+				w = append(w, rs[i])
+			} else {
+				w = append(w, ch)
+			}
+		case ch == '"' || ch == '\'':
+			quote, inWord = ch, true
+		case ch == '\\' && i+1 < len(rs):
+			i++
+			w, inWord = append(w, rs[i]), true
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			flush()
+		default:
+			w, inWord = append(w, ch), true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %s", strconv.Quote(s))
+	}
+	flush()
+	return words, nil
+}
+
+// isRedirection is true if a word redirects output, e.g. ">/dev/null".
+func isRedirection(w string) bool {
+	w = strings.TrimLeft(w, "0123456789&")
+	return strings.HasPrefix(w, ">") || strings.HasPrefix(w, "<")
+}
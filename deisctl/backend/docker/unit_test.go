@@ -0,0 +1,115 @@
+package docker
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/coreos/fleet/unit"
+	"github.com/deis/deis/deisctl/backend/fleet"
+	"github.com/deis/deis/deisctl/units"
+)
+
+func testImage(component string) (string, error) {
+	return strings.TrimPrefix(component, "/") + ":v1.12.2", nil
+}
+
+// readUnit renders the unit template of a component, such as deis-router.
+func readUnit(t *testing.T, name string) *unit.UnitFile {
+	uf, err := fleet.NewUnit(strings.TrimPrefix(name, "deis-"), []string{path.Join("..", "..", "units")}, false, fleet.UnitParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uf
+}
+
+func TestParseUnit(t *testing.T) {
+	t.Parallel()
+
+	vars := map[string]string{"COREOS_PRIVATE_IPV4": "10.0.0.2"}
+	c, err := parseUnit("deis-builder.service", readUnit(t, "deis-builder"), testImage, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Name != "deis-builder" {
+		t.Errorf("Expected container deis-builder, Got %s", c.Name)
+	}
+	if c.Image != "deis/builder:v1.12.2" {
+		t.Errorf("Expected image deis/builder:v1.12.2, Got %s", c.Image)
+	}
+	if c.StopTimeout != "360" {
+		t.Errorf("Expected stop timeout 360, Got %s", c.StopTimeout)
+	}
+	expected := []string{"-d", "--name", "deis-builder", "-p", "2223:2223", "-p", "2224:2224",
+		"--volumes-from=deis-builder-data", "-c", "800", "-e", "EXTERNAL_PORT=2223", "-e", "HOST=10.0.0.2",
+		"--privileged", "-v", "/etc/environment_proxy:/etc/environment_proxy", "deis/builder:v1.12.2"}
+	if !reflect.DeepEqual(c.Run, expected) {
+		t.Errorf("Expected %v, Got %v", expected, c.Run)
+	}
+	setup := [][]string{{"--name", "deis-builder-data", "-v", "/var/lib/docker", "alpine:3.2", "/bin/true"}}
+	if !reflect.DeepEqual(c.Setup, setup) {
+		t.Errorf("Expected %v, Got %v", setup, c.Setup)
+	}
+}
+
+func TestParseUnits(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range units.Names {
+		uf := readUnit(t, name)
+		c, err := parseUnit(name+".service", uf, testImage, nil)
+		// units that do not run a container cannot be run by this backend
+		if strings.HasPrefix(name, "deis-kube-") || name == "deis-store-volume" {
+			if err == nil {
+				t.Errorf("%s: Expected an error", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if c.Name == "" || c.Image == "" {
+			t.Errorf("%s: Expected a container and an image, Got %q and %q", name, c.Name, c.Image)
+		}
+	}
+}
+
+func TestParseUnitImageError(t *testing.T) {
+	t.Parallel()
+
+	image := func(string) (string, error) { return "", fmt.Errorf("no version") }
+	if _, err := parseUnit("deis-router.service", readUnit(t, "deis-router"), image, nil); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	t.Parallel()
+
+	words, err := splitWords(`docker run -e "A=b c" 'd e' f\ g >/dev/null 2>&1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"docker", "run", "-e", "A=b c", "d e", "f g"}
+	if !reflect.DeepEqual(words, expected) {
+		t.Errorf("Expected %v, Got %v", expected, words)
+	}
+
+	if _, err := splitWords(`docker run "foo`); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestSplitCommands(t *testing.T) {
+	t.Parallel()
+
+	cmds := splitCommands(`a && b || c; d "e && f"`)
+	expected := []string{"a ", " b ", " c", ` d "e && f"`}
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("Expected %v, Got %v", expected, cmds)
+	}
+}
@@ -5,49 +5,50 @@ import (
 	"io"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/coreos/fleet/job"
 	"github.com/coreos/fleet/schema"
 	"github.com/coreos/fleet/unit"
 
+	"github.com/deis/deis/deisctl/backend"
 	"github.com/deis/deis/pkg/prettyprint"
 )
 
 // Create schedules unit files for the given components.
-func (c *FleetClient) Create(
-	targets []string, wg *sync.WaitGroup, out, ew io.Writer) {
+func (c *FleetClient) Create(targets []string, out, ew io.Writer) []backend.Result {
 
-	units := make([]*schema.Unit, len(targets))
+	units := make(map[string]*schema.Unit, len(targets))
+	names := make([]string, len(targets))
 
 	for i, target := range targets {
 		unitName, unitFile, err := c.createUnitFile(target)
 		if err != nil {
 			fmt.Fprintf(ew, "Error creating: %s\n", err)
-			return
+			return []backend.Result{{Unit: target, Action: "create", Err: err}}
 		}
-		units[i] = &schema.Unit{
+		names[i] = unitName
+		units[unitName] = &schema.Unit{
 			Name:    unitName,
 			Options: schema.MapUnitFileToSchemaUnitOptions(unitFile),
 		}
 	}
 
-	for _, unit := range units {
-		wg.Add(1)
-		go doCreate(c, unit, wg, out, ew)
-	}
+	return backend.Each("create", names, func(name string) (string, string, error) {
+		if err := doCreate(c, units[name], out, ew); err != nil {
+			return name, "", err
+		}
+		return name, "loaded", nil
+	})
 }
 
-func doCreate(c *FleetClient, unit *schema.Unit, wg *sync.WaitGroup, out, ew io.Writer) {
-	defer wg.Done()
-
+func doCreate(c *FleetClient, unit *schema.Unit, out, ew io.Writer) error {
 	// create unit definition
 	if err := c.Fleet.CreateUnit(unit); err != nil {
 		// ignore units that already exist
 		if err.Error() != "job already exists" {
 			fmt.Fprintln(ew, err.Error())
-			return
+			return err
 		}
 	}
 
@@ -58,7 +59,7 @@ func doCreate(c *FleetClient, unit *schema.Unit, wg *sync.WaitGroup, out, ew io.
 	// schedule the unit
 	if err := c.Fleet.SetUnitTargetState(unit.Name, desiredState); err != nil {
 		fmt.Fprintln(ew, err)
-		return
+		return err
 	}
 
 	// loop until the unit actually exists in unit states
@@ -77,6 +78,7 @@ outerLoop:
 	}
 
 	fmt.Fprintln(out, msg)
+	return nil
 }
 
 func (c *FleetClient) createUnitFile(target string) (unitName string, uf *unit.UnitFile, err error) {
@@ -105,7 +107,11 @@ func (c *FleetClient) createServiceUnit(component string, num int) (name string,
 	if err != nil {
 		return "", nil, err
 	}
-	uf, err = NewUnit(component, c.templatePaths, decorate)
+	params, err := ReadUnitParams(c.configBackend, component)
+	if err != nil {
+		return "", nil, err
+	}
+	uf, err = NewUnit(component, c.templatePaths, decorate, params)
 	if err != nil {
 		return
 	}
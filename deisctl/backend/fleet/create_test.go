@@ -38,14 +38,11 @@ func TestCreate(t *testing.T) {
 	c := &FleetClient{templatePaths: []string{name}, Fleet: &testFleetClient, configBackend: testConfigBackend}
 
 	var errOutput string
-	var wg sync.WaitGroup
 
 	logMutex := sync.Mutex{}
 
 	se := newOutErr()
-	c.Create([]string{"controller", "builder", "router@1"}, &wg, se.out, se.ew)
-
-	wg.Wait()
+	c.Create([]string{"controller", "builder", "router@1"}, se.out, se.ew)
 
 	logMutex.Lock()
 	if errOutput != "" {
@@ -4,41 +4,37 @@ import (
 	"fmt"
 	"io"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/deis/deis/deisctl/backend"
 	"github.com/deis/deis/pkg/prettyprint"
 )
 
 // Destroy units for a given target
-func (c *FleetClient) Destroy(targets []string, wg *sync.WaitGroup, out, ew io.Writer) {
+func (c *FleetClient) Destroy(targets []string, out, ew io.Writer) []backend.Result {
 	// expand @* targets
 	expandedTargets, err := c.expandTargets(targets)
 	if err != nil {
 		fmt.Fprintln(ew, err.Error())
-		return
+		return []backend.Result{{Unit: strings.Join(targets, " "), Action: "destroy", Err: err}}
 	}
 
-	for _, target := range expandedTargets {
-		wg.Add(1)
-		go doDestroy(c, target, wg, out, ew)
-	}
-	return
+	return backend.Each("destroy", expandedTargets, func(target string) (string, string, error) {
+		return doDestroy(c, target, out, ew)
+	})
 }
 
-func doDestroy(c *FleetClient, target string, wg *sync.WaitGroup, out, ew io.Writer) {
-	defer wg.Done()
-
+func doDestroy(c *FleetClient, target string, out, ew io.Writer) (string, string, error) {
 	// prepare string representation
 	component, num, err := splitTarget(target)
 	if err != nil {
 		fmt.Fprintln(ew, err.Error())
-		return
+		return "", "", err
 	}
 	name, err := formatUnitName(component, num)
 	if err != nil {
 		fmt.Fprintln(ew, err.Error())
-		return
+		return "", "", err
 	}
 	tpl := prettyprint.Colorize("{{.Yellow}}%v:{{.Default}} destroyed")
 	destroyed := fmt.Sprintf(tpl, name)
@@ -60,6 +56,6 @@ outerLoop:
 			}
 		}
 		fmt.Fprintln(out, destroyed)
-		return
+		return name, "destroyed", nil
 	}
 }
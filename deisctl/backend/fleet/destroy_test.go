@@ -27,14 +27,11 @@ func TestDestroy(t *testing.T) {
 	c := &FleetClient{Fleet: &testFleetClient}
 
 	var errOutput string
-	var wg sync.WaitGroup
 
 	logMutex := sync.Mutex{}
 
 	oe := newOutErr()
-	c.Destroy([]string{"controller", "registry", "router@1"}, &wg, oe.out, oe.ew)
-
-	wg.Wait()
+	c.Destroy([]string{"controller", "registry", "router@1"}, oe.out, oe.ew)
 
 	logMutex.Lock()
 	if errOutput != "" {
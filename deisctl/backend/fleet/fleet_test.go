@@ -125,6 +125,14 @@ func (c *stubFleetClient) DestroyUnit(name string) error {
 	}
 	c.unitsMutex.Unlock()
 
+	c.unitStatesMutex.Lock()
+	for i := len(c.testUnitStates) - 1; i >= 0; i-- {
+		if c.testUnitStates[i].Name == name {
+			c.testUnitStates = append(c.testUnitStates[:i], c.testUnitStates[i+1:]...)
+		}
+	}
+	c.unitStatesMutex.Unlock()
+
 	return nil
 }
 
@@ -0,0 +1,110 @@
+package fleet
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/coreos/fleet/schema"
+
+	"github.com/deis/deis/deisctl/backend"
+)
+
+// UnitStates returns the state of every unit fleet knows.
+func (c *FleetClient) UnitStates() ([]backend.UnitState, error) {
+	units, err := c.Fleet.Units()
+	if err != nil {
+		return nil, err
+	}
+	states, err := c.Fleet.UnitStates()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []backend.UnitState
+	for _, u := range units {
+		s := backend.UnitState{Name: u.Name, Machine: u.MachineID, ActiveState: "-", SubState: "-"}
+		for _, us := range states {
+			if us.Name == u.Name {
+				s.Machine = us.MachineID
+				s.ActiveState = us.SystemdActiveState
+				s.SubState = us.SystemdSubState
+				break
+			}
+		}
+		s.MachineMetadata = machineMetadata(u.Options)
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// Machines returns the machines of the cluster.
+func (c *FleetClient) Machines() ([]backend.Machine, error) {
+	machines, err := c.Fleet.Machines()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]backend.Machine, len(machines))
+	for i, ms := range machines {
+		result[i] = backend.Machine{ID: ms.ID, IP: ms.PublicIP, Metadata: ms.Metadata}
+	}
+	return result, nil
+}
+
+// UnitFile renders the unit file of a target, as Create would schedule it.
+func (c *FleetClient) UnitFile(target string) (backend.UnitFile, error) {
+	name, uf, err := c.createUnitFile(target)
+	if err != nil {
+		return backend.UnitFile{}, err
+	}
+	return backend.UnitFile{
+		Name:            name,
+		Contents:        uf.String(),
+		Hash:            uf.Hash().String(),
+		MachineMetadata: machineMetadata(schema.MapUnitFileToSchemaUnitOptions(uf)),
+	}, nil
+}
+
+// InstalledUnitFiles returns the Deis unit files held by the fleet registry,
+// as they were submitted.
+func (c *FleetClient) InstalledUnitFiles() ([]backend.UnitFile, error) {
+	units, err := c.Fleet.Units()
+	if err != nil {
+		return nil, err
+	}
+	var result []backend.UnitFile
+	for _, u := range units {
+		if !strings.HasPrefix(u.Name, "deis-") {
+			continue
+		}
+		uf := schema.MapSchemaUnitOptionsToUnitFile(u.Options)
+		result = append(result, backend.UnitFile{
+			Name:            u.Name,
+			Contents:        uf.String(),
+			Hash:            uf.Hash().String(),
+			MachineMetadata: machineMetadata(u.Options),
+		})
+	}
+	sort.Sort(byName(result))
+	return result, nil
+}
+
+// byName sorts unit files by name.
+type byName []backend.UnitFile
+
+func (n byName) Len() int           { return len(n) }
+func (n byName) Less(i, j int) bool { return n[i].Name < n[j].Name }
+func (n byName) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+
+// machineMetadata returns the key=value pairs of the X-Fleet MachineMetadata
+// options of a unit.
+func machineMetadata(options []*schema.UnitOption) []string {
+	var metadata []string
+	for _, o := range options {
+		if o.Section == "X-Fleet" && o.Name == "MachineMetadata" {
+			for _, kv := range strings.Fields(o.Value) {
+				metadata = append(metadata, strings.Trim(kv, `"`))
+			}
+		}
+	}
+	return metadata
+}
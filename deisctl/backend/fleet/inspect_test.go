@@ -0,0 +1,151 @@
+package fleet
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/test/mock"
+
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/schema"
+	"github.com/coreos/fleet/unit"
+)
+
+func TestUnitStates(t *testing.T) {
+	t.Parallel()
+
+	testUnits := []*schema.Unit{
+		&schema.Unit{
+			Name: "deis-router@1.service",
+			Options: []*schema.UnitOption{
+				{Section: "X-Fleet", Name: "MachineMetadata", Value: `"controlPlane=true" "dataPlane=true"`},
+			},
+		},
+		&schema.Unit{Name: "deis-builder.service"},
+	}
+	testUnitStates := []*schema.UnitState{
+		&schema.UnitState{
+			Name:               "deis-router@1.service",
+			MachineID:          "123456",
+			SystemdActiveState: "active",
+			SystemdSubState:    "running",
+		},
+	}
+
+	c := &FleetClient{Fleet: &stubFleetClient{testUnits: testUnits, testUnitStates: testUnitStates,
+		unitsMutex: &sync.Mutex{}, unitStatesMutex: &sync.Mutex{}}}
+	states, err := c.UnitStates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []backend.UnitState{
+		{
+			Name:            "deis-router@1.service",
+			Machine:         "123456",
+			ActiveState:     "active",
+			SubState:        "running",
+			MachineMetadata: []string{"controlPlane=true", "dataPlane=true"},
+		},
+		{Name: "deis-builder.service", ActiveState: "-", SubState: "-"},
+	}
+	if !reflect.DeepEqual(states, expected) {
+		t.Errorf("Expected %v, Got %v", expected, states)
+	}
+}
+
+func TestMachines(t *testing.T) {
+	t.Parallel()
+
+	testMachines := []machine.MachineState{
+		machine.MachineState{ID: "123456", PublicIP: "1.1.1.1", Metadata: map[string]string{"controlPlane": "true"}},
+	}
+
+	c := &FleetClient{Fleet: &stubFleetClient{testMachineStates: testMachines}}
+	machines, err := c.Machines()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []backend.Machine{{ID: "123456", IP: "1.1.1.1", Metadata: map[string]string{"controlPlane": "true"}}}
+	if !reflect.DeepEqual(machines, expected) {
+		t.Errorf("Expected %v, Got %v", expected, machines)
+	}
+}
+
+func TestUnitFile(t *testing.T) {
+	t.Parallel()
+
+	name, err := ioutil.TempDir("", "deisctl-fleetctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(name)
+	contents := "[Unit]\nDescription=deis-router\n\n[X-Fleet]\nMachineMetadata=\"routerMesh=true\"\n"
+	if err := ioutil.WriteFile(path.Join(name, "deis-router.service"), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &FleetClient{templatePaths: []string{name}, Fleet: &stubFleetClient{}, configBackend: mock.ConfigBackend{}}
+	uf, err := c.UnitFile("router@2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uf.Name != "deis-router@2.service" {
+		t.Errorf("Expected deis-router@2.service, Got %s", uf.Name)
+	}
+	if !strings.Contains(uf.Contents, "Description=deis-router") {
+		t.Errorf("Expected the rendered unit file, Got %s", uf.Contents)
+	}
+	if !reflect.DeepEqual(uf.MachineMetadata, []string{"routerMesh=true"}) {
+		t.Errorf("Expected [routerMesh=true], Got %v", uf.MachineMetadata)
+	}
+}
+
+func TestInstalledUnitFiles(t *testing.T) {
+	t.Parallel()
+
+	name, err := ioutil.TempDir("", "deisctl-fleetctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(name)
+	contents := "[Unit]\nDescription=deis-router\n\n[Service]\nExecStart=/bin/router\n"
+	if err := ioutil.WriteFile(path.Join(name, "deis-router.service"), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	local, err := unit.NewUnitFile(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testUnits := []*schema.Unit{
+		&schema.Unit{Name: "deis-router@1.service", Options: schema.MapUnitFileToSchemaUnitOptions(local)},
+		&schema.Unit{Name: "myapp_v1.web.1.service"},
+	}
+	c := &FleetClient{templatePaths: []string{name}, configBackend: mock.ConfigBackend{},
+		Fleet: &stubFleetClient{testUnits: testUnits, unitsMutex: &sync.Mutex{}}}
+	installed, err := c.InstalledUnitFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(installed) != 1 || installed[0].Name != "deis-router@1.service" {
+		t.Fatalf("Expected only deis-router@1.service, Got %v", installed)
+	}
+
+	// the unit as fleet holds it has the hash of the unit rendered locally
+	uf, err := c.UnitFile("router@1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if installed[0].Hash != uf.Hash || installed[0].Contents != uf.Contents {
+		t.Errorf("Expected %s, Got %s", uf.Hash, installed[0].Hash)
+	}
+}
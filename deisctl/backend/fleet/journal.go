@@ -2,34 +2,101 @@ package fleet
 
 import (
 	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deis/deis/deisctl/backend"
 )
 
-// Journal prints the systemd journal of target unit(s)
-func (c *FleetClient) Journal(target string) (err error) {
-	units, err := c.Units(target)
-	if err != nil {
-		return
+// journalWindow is how long entries are held to merge the journals of
+// several units in timestamp order.
+var journalWindow = 500 * time.Millisecond
+
+// journalSince is what the since option may contain, so it can be passed on
+// to journalctl safely.
+var journalSince = regexp.MustCompile(`^[0-9A-Za-z:+. -]+$`)
+
+// Journal prints the systemd journals of target units, streamed from their
+// machines at the same time and merged.
+func (c *FleetClient) Journal(targets []string, opts backend.JournalOptions, out, ew io.Writer) error {
+	if opts.Since != "" && !journalSince.MatchString(opts.Since) {
+		return fmt.Errorf("invalid time for since: %s", opts.Since)
 	}
-	for _, unit := range units {
-		c.runJournal(unit)
+	var units []string
+	seen := map[string]bool{}
+	for _, target := range targets {
+		found, err := c.Units(target)
+		if err != nil {
+			return err
+		}
+		for _, name := range found {
+			if !seen[name] {
+				seen[name] = true
+				units = append(units, name)
+			}
+		}
 	}
-	return
-}
 
-// runJournal tails the systemd journal for a given unit
-func (c *FleetClient) runJournal(name string) (exit int) {
-	u, err := c.Fleet.Unit(name)
-	if suToGlobal(*u) {
-		fmt.Fprintf(c.errWriter, "Unable to get journal for global unit %s. Check on a host directly using journalctl.\n", name)
-		return 1
+	var names, machines []string
+	for _, name := range units {
+		u, err := c.Fleet.Unit(name)
+		if err == nil && u != nil && suToGlobal(*u) {
+			fmt.Fprintf(ew, "Unable to get journal for global unit %s. Check on a host directly using journalctl.\n", name)
+			continue
+		}
+		machineID, err := c.findUnit(name)
+		if err != nil {
+			fmt.Fprintln(ew, strings.TrimSpace(err.Error()))
+			continue
+		}
+		names = append(names, name)
+		machines = append(machines, machineID)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no journal to print for %v", targets)
 	}
 
-	machineID, err := c.findUnit(name)
-
-	if err != nil {
-		return 1
+	mux := backend.NewJournalMux(out, journalWindow)
+	writers := mux.Writers(names)
+	errs := make([]string, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer writers[i].Close()
+			exit, err := c.streamCommand(journalCommand(names[i], opts), machines[i], writers[i])
+			if err != nil {
+				errs[i] = fmt.Sprintf("Error getting journal for %s: %v", names[i], err)
+			} else if exit != 0 {
+				errs[i] = fmt.Sprintf("journalctl for %s exited with %d", names[i], exit)
+			}
+		}(i)
 	}
+	wg.Wait()
+	for _, msg := range errs {
+		if msg != "" {
+			fmt.Fprintln(ew, msg)
+		}
+	}
+	return mux.Wait()
+}
 
-	command := fmt.Sprintf("journalctl --unit %s --no-pager -n 40 -f", name)
-	return c.runCommand(command, machineID)
+// journalCommand returns the journalctl command printing the journal of a
+// unit. Entries start with ISO 8601 timestamps, to be merged by.
+func journalCommand(name string, opts backend.JournalOptions) string {
+	command := fmt.Sprintf("journalctl --unit %s --no-pager -o short-iso", name)
+	if opts.Lines > 0 {
+		command += fmt.Sprintf(" -n %d", opts.Lines)
+	}
+	if opts.Since != "" {
+		command += fmt.Sprintf(" --since '%s'", opts.Since)
+	}
+	if opts.Follow {
+		command += " -f"
+	}
+	return command
 }
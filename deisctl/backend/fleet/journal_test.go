@@ -3,34 +3,42 @@ package fleet
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/schema"
+
+	"github.com/deis/deis/deisctl/backend"
 )
 
+// mockJournalCommandRunner prints the journals of units, given the commands
+// expected for them.
 type mockJournalCommandRunner struct {
-	validUnits []string
+	journals map[string]string
 }
 
 func (mockJournalCommandRunner) LocalCommand(string) (int, error) {
 	return 0, nil
 }
 
-func (m mockJournalCommandRunner) RemoteCommand(cmd string, addr string, timeout time.Duration) (int, error) {
+func (mockJournalCommandRunner) RemoteCommand(string, string, time.Duration) (int, error) {
+	return 0, nil
+}
+
+func (m mockJournalCommandRunner) StreamCommand(cmd string, addr string, timeout time.Duration, out io.Writer) (int, error) {
 	if addr != "1.1.1.1" || timeout != 0 {
-		return -1, fmt.Errorf("Got %s %d, which is unexpected", cmd, addr, timeout)
+		return -1, fmt.Errorf("Got %s %s %d, which is unexpected", cmd, addr, timeout)
 	}
-
-	for _, unit := range m.validUnits {
-		if fmt.Sprintf("journalctl --unit %s --no-pager -n 40 -f", unit) == cmd {
-			return 0, nil
-		}
+	journal, ok := m.journals[cmd]
+	if !ok {
+		return -1, fmt.Errorf("Didn't find command %s", cmd)
 	}
-
-	return -1, fmt.Errorf("Didn't find command %s to match with units %v", cmd, m.validUnits)
+	_, err := io.WriteString(out, journal)
+	return 0, err
 }
 
 func TestJournal(t *testing.T) {
@@ -58,21 +66,43 @@ func TestJournal(t *testing.T) {
 		},
 	}
 
-	testWriter := bytes.Buffer{}
+	runner := mockJournalCommandRunner{journals: map[string]string{
+		"journalctl --unit deis-router@1.service --no-pager -o short-iso --since '-1h' -f": "" +
+			"2015-06-01T12:00:00+0000 core-1 sh[1]: first\n" +
+			"2015-06-01T12:00:02+0000 core-1 sh[1]: third\n",
+		"journalctl --unit deis-router@2.service --no-pager -o short-iso --since '-1h' -f": "" +
+			"2015-06-01T12:00:01+0000 core-1 sh[2]: second\n" +
+			"2015-06-01T12:00:03+0000 core-1 sh[2]: fourth",
+	}}
 
-	c := &FleetClient{Fleet: &stubFleetClient{testUnits: testUnits, testMachineStates: testMachines,
-		unitsMutex: &sync.Mutex{}}, errWriter: &testWriter, runner: mockJournalCommandRunner{
-		validUnits: []string{"deis-router@1.service", "deis-router@2.service"}}}
+	var out, ew bytes.Buffer
 
-	err := c.Journal("router")
+	c := &FleetClient{Fleet: &stubFleetClient{testUnits: testUnits, testMachineStates: testMachines,
+		unitsMutex: &sync.Mutex{}}, errWriter: &ew, runner: runner}
 
-	if err != nil {
-		t.Error(err)
+	opts := backend.JournalOptions{Follow: true, Since: "-1h"}
+	if err := c.Journal([]string{"router", "router@2"}, opts, &out, &ew); err != nil {
+		t.Fatal(err)
+	}
+	if ew.String() != "" {
+		t.Error(ew.String())
 	}
 
-	commandErr := testWriter.String()
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{"first", "second", "third", "fourth"}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, Got %q", len(expected), lines)
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, expected[i]) {
+			t.Errorf("Expected line %d to be %s, Got %q", i, expected[i], line)
+		}
+	}
+	if !strings.Contains(lines[1], "deis-router@2.service |") {
+		t.Errorf("Expected the entry to be prefixed with its unit, Got %q", lines[1])
+	}
 
-	if commandErr != "" {
-		t.Error(commandErr)
+	if err := c.Journal([]string{"router"}, backend.JournalOptions{Since: "$(evil)"}, &out, &ew); err == nil {
+		t.Error("Expected an unsafe since to be invalid")
 	}
 }
@@ -0,0 +1,131 @@
+package fleet
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/deis/deis/deisctl/config"
+)
+
+// UnitParams customize the unit of a component without changing its template.
+// They are read from /deis/units/<component>/ in the config backend, so unit
+// files refreshed with refresh-units keep them.
+type UnitParams struct {
+	// Image replaces the image the component runs, such as
+	// registry.example.com/deis/router:v1.12.2.
+	Image string
+	// DockerArgs are extra "docker run" flags, such as --dns=10.0.0.2.
+	DockerArgs string
+	// Memory limits the memory of the container, such as 512m.
+	Memory string
+	// CPUShares is the relative CPU weight of the container.
+	CPUShares string
+	// MachineMetadata are the key=value pairs of the machines the unit may
+	// run on. They replace the metadata of the unit's decorator.
+	MachineMetadata []string
+	// Environment are extra KEY=value environment variables of the container.
+	Environment []string
+}
+
+// unsafeRe matches characters that would break out of the shell command of
+// a unit, or that systemd would expand.
+var unsafeRe = regexp.MustCompile("[\"'`$\\\\\n]")
+
+// ReadUnitParams returns the parameters of the unit of a component.
+func ReadUnitParams(cb config.Backend, component string) (UnitParams, error) {
+	var p UnitParams
+	values := map[string]*string{
+		"image": &p.Image, "dockerArgs": &p.DockerArgs, "memory": &p.Memory, "cpuShares": &p.CPUShares,
+	}
+	for key, v := range values {
+		value, err := cb.GetWithDefault(paramsRoot(component)+key, "")
+		if err != nil {
+			return p, err
+		}
+		*v = value
+	}
+	lists := map[string]*[]string{"machineMetadata": &p.MachineMetadata, "environment": &p.Environment}
+	for key, v := range lists {
+		value, err := cb.GetWithDefault(paramsRoot(component)+key, "")
+		if err != nil {
+			return p, err
+		}
+		*v = strings.Fields(value)
+	}
+	return p, p.validate(component)
+}
+
+// paramsRoot is where the parameters of a component's unit are kept.
+func paramsRoot(component string) string {
+	return "/deis/units/" + strings.TrimPrefix(component, "deis-") + "/"
+}
+
+func (p UnitParams) validate(component string) error {
+	values := append([]string{p.Image, p.DockerArgs, p.Memory, p.CPUShares}, p.Environment...)
+	for _, v := range append(values, p.MachineMetadata...) {
+		if unsafeRe.MatchString(v) {
+			return fmt.Errorf("%s contains quotes, $ or \\, which unit parameters of %s cannot", v, component)
+		}
+	}
+	for _, kv := range append(p.Environment, p.MachineMetadata...) {
+		if !strings.Contains(kv, "=") {
+			return fmt.Errorf("%s is not a key=value pair, in the unit parameters of %s", kv, component)
+		}
+	}
+	return nil
+}
+
+// RunFlags returns the "docker run" flags of the parameters, with a leading
+// space, or nothing if there are none, so units without parameters render
+// as they did before.
+func (p UnitParams) RunFlags() string {
+	var flags []string
+	if p.Memory != "" {
+		flags = append(flags, "--memory="+p.Memory)
+	}
+	if p.CPUShares != "" {
+		flags = append(flags, "--cpu-shares="+p.CPUShares)
+	}
+	for _, kv := range p.Environment {
+		flags = append(flags, "-e "+kv)
+	}
+	if p.DockerArgs != "" {
+		flags = append(flags, p.DockerArgs)
+	}
+	if len(flags) == 0 {
+		return ""
+	}
+	return " " + strings.Join(flags, " ")
+}
+
+// renderTemplate executes a unit template with parameters. Templates look up
+// images with {{image "/deis/<component>"}} and add {{.RunFlags}} to their
+// docker run command. Templates without either are used as they are, unless
+// parameters would be ignored.
+func renderTemplate(component string, text []byte, p UnitParams) (string, error) {
+	funcs := template.FuncMap{
+		"image": func(path string) string {
+			if p.Image != "" {
+				return p.Image
+			}
+			return "`/run/deis/bin/get_image " + path + "`"
+		},
+	}
+	tmpl, err := template.New(component).Funcs(funcs).Parse(string(text))
+	if err != nil {
+		return "", fmt.Errorf("unit template of %s: %v", component, err)
+	}
+	// parameters the template would ignore are an error, not a surprise
+	if (p.Image != "" && !bytes.Contains(text, []byte("{{image "))) ||
+		(p.RunFlags() != "" && !bytes.Contains(text, []byte("{{.RunFlags}}"))) {
+		return "", fmt.Errorf("the unit template of %s does not accept parameters, refresh the unit files or remove %s", component, paramsRoot(component))
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, p); err != nil {
+		return "", fmt.Errorf("unit template of %s: %v", component, err)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,105 @@
+package fleet
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/deis/deis/deisctl/config/model"
+	"github.com/deis/deis/deisctl/test/mock"
+)
+
+const routerTemplate = `[Unit]
+Description=deis-router
+
+[Service]
+ExecStart=/bin/sh -c "IMAGE={{image "/deis/router"}} && docker run{{.RunFlags}} --name deis-router $IMAGE"
+`
+
+func TestReadUnitParams(t *testing.T) {
+	t.Parallel()
+
+	cb := mock.ConfigBackend{Expected: mock.Store{
+		&model.ConfigNode{Key: "/deis/units/router/image", Value: "registry.local/router:v2"},
+		&model.ConfigNode{Key: "/deis/units/router/memory", Value: "512m"},
+		&model.ConfigNode{Key: "/deis/units/router/environment", Value: "A=1 B=2"},
+		&model.ConfigNode{Key: "/deis/units/router/machineMetadata", Value: "edge=true"},
+	}}
+
+	p, err := ReadUnitParams(cb, "router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := UnitParams{Image: "registry.local/router:v2", Memory: "512m",
+		Environment: []string{"A=1", "B=2"}, MachineMetadata: []string{"edge=true"}}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("Expected %+v, Got %+v", expected, p)
+	}
+
+	invalid := []mock.Store{
+		{&model.ConfigNode{Key: "/deis/units/router/dockerArgs", Value: "--dns=$(evil)"}},
+		{&model.ConfigNode{Key: "/deis/units/router/environment", Value: "A"}},
+		{&model.ConfigNode{Key: "/deis/units/router/machineMetadata", Value: `edge="true"`}},
+	}
+	for _, store := range invalid {
+		if _, err := ReadUnitParams(mock.ConfigBackend{Expected: store}, "router"); err == nil {
+			t.Errorf("Expected %s=%s to be invalid", store[0].Key, store[0].Value)
+		}
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	t.Parallel()
+
+	out, err := renderTemplate("router", []byte(routerTemplate), UnitParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "IMAGE=`/run/deis/bin/get_image /deis/router` && docker run --name deis-router $IMAGE"
+	if !strings.Contains(out, expected) {
+		t.Errorf("Expected %s to be in:\n%s", expected, out)
+	}
+
+	p := UnitParams{Image: "registry.local/router:v2", Memory: "512m", CPUShares: "512",
+		Environment: []string{"A=1"}, DockerArgs: "--dns=10.0.0.2"}
+	out, err = renderTemplate("router", []byte(routerTemplate), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "IMAGE=registry.local/router:v2 && docker run --memory=512m --cpu-shares=512 -e A=1 --dns=10.0.0.2 --name deis-router $IMAGE"
+	if !strings.Contains(out, expected) {
+		t.Errorf("Expected %s to be in:\n%s", expected, out)
+	}
+
+	// a template without placeholders would silently drop the parameters
+	plain := []byte("[Service]\nExecStart=/usr/bin/docker run deis/router\n")
+	if _, err := renderTemplate("router", plain, UnitParams{Memory: "512m"}); err == nil {
+		t.Error("Expected parameters a template ignores to be an error")
+	}
+	if _, err := renderTemplate("router", plain, UnitParams{}); err != nil {
+		t.Errorf("Expected a template without parameters to render, Got %v", err)
+	}
+}
+
+func TestNewUnitMachineMetadata(t *testing.T) {
+	t.Parallel()
+
+	name, err := ioutil.TempDir("", "deisctl-fleetctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(name)
+	ioutil.WriteFile(path.Join(name, "deis-router.service"), []byte(routerTemplate), 0644)
+
+	uf, err := NewUnit("router", []string{name}, true, UnitParams{MachineMetadata: []string{"edge=true", "zone=a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"edge=true", "zone=a"}
+	if result := uf.Contents["X-Fleet"]["MachineMetadata"]; !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, Got %v", expected, result)
+	}
+}
@@ -3,35 +3,165 @@ package fleet
 import (
 	"fmt"
 	"io"
-	"sync"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/fleet/schema"
+	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/units"
 )
 
-// RollingRestart for instance units
-func (c *FleetClient) RollingRestart(component string, wg *sync.WaitGroup, out, ew io.Writer) {
-	if component != "router" {
-		fmt.Fprint(ew, "invalid component. supported for: router")
-		return
+// healthInterval is how often a rolling restart checks restarted instances.
+var healthInterval = time.Second
+
+// RollingRestart restarts the instances of a templated component in batches,
+// moving on to the next batch once the last one is healthy.
+func (c *FleetClient) RollingRestart(component string, opts backend.RollingRestartOptions, out, ew io.Writer) []backend.Result {
+	targets, err := c.instances(component)
+	if err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return []backend.Result{{Unit: component, Action: "restart", Err: err}}
+	}
+	size := opts.BatchSize
+	if size < 1 {
+		size = 1
+	}
+	var results []backend.Result
+	for i := 0; i < len(targets); i += size {
+		end := i + size
+		if end > len(targets) {
+			end = len(targets)
+		}
+		batchResults, err := c.restartBatch(component, targets[i:end], opts.HealthTimeout, out, ew)
+		results = append(results, batchResults...)
+		if err != nil {
+			fmt.Fprintln(ew, err.Error())
+			if opts.AbortOnFailure {
+				if rest := targets[end:]; len(rest) > 0 {
+					fmt.Fprintf(ew, "Aborted rolling restart, left untouched: %s\n", strings.Join(rest, ", "))
+				}
+				return results
+			}
+		}
+	}
+	return results
+}
+
+// instances returns the targets of the installed instances of a component,
+// such as router@1, in order.
+func (c *FleetClient) instances(component string) ([]string, error) {
+	if _, _, err := splitTarget(component); err != nil || strings.Contains(component, "@") {
+		return nil, fmt.Errorf("invalid component %s", component)
+	}
+	names, err := c.Units(component + "@")
+	if err != nil {
+		return nil, fmt.Errorf("%s has no instances to restart", component)
+	}
+	nums, err := countUnits(names)
+	if err != nil {
+		return nil, err
+	}
+	sort.Ints(nums)
+	targets := make([]string, len(nums))
+	for i, n := range nums {
+		targets[i] = fmt.Sprintf("%s@%d", component, n)
+	}
+	return targets, nil
+}
+
+// restartBatch restarts instances and waits for them to be healthy.
+func (c *FleetClient) restartBatch(component string, batch []string, timeout time.Duration, out, ew io.Writer) ([]backend.Result, error) {
+	names := make([]string, len(batch))
+	hosts := make([]string, len(batch))
+	for i, target := range batch {
+		_, num, err := splitTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		if names[i], err = formatUnitName(component, num); err != nil {
+			return nil, err
+		}
+		if us := c.unitState(names[i]); us != nil {
+			hosts[i] = c.host(us.MachineID)
+		}
 	}
 
-	components, err := c.Units(component)
+	results := c.Stop(batch, out, ew)
+	results = append(results, c.Destroy(batch, out, ew)...)
+	// forget what the old instances published, so the gate sees it refreshed
+	if publishes := units.Components[component].Publishes; publishes != "" {
+		for _, host := range hosts {
+			if host != "" {
+				c.configBackend.Delete(fmt.Sprintf(publishes, host))
+			}
+		}
+	}
+	results = append(results, c.Create(batch, out, ew)...)
+	results = append(results, c.Start(batch, out, ew)...)
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	for _, name := range names {
+		err := c.waitHealthy(component, name, deadline)
+		r := backend.Result{Unit: name, Action: "health", State: "healthy", Err: err, Duration: time.Since(start)}
+		if err != nil {
+			r.State = ""
+			return append(results, r), err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// waitHealthy waits until a unit is running and has published itself in etcd.
+func (c *FleetClient) waitHealthy(component, name string, deadline time.Time) error {
+	publishes := units.Components[component].Publishes
+	for {
+		us := c.unitState(name)
+		switch {
+		case us == nil:
+			return fmt.Errorf("Could not find unit: %s", name)
+		case us.SystemdSubState == "failed":
+			return fmt.Errorf("%s failed while restarting", name)
+		case us.SystemdActiveState == "active" && us.SystemdSubState == "running":
+			if publishes == "" {
+				return nil
+			}
+			if host := c.host(us.MachineID); host != "" {
+				if v, err := c.configBackend.Get(fmt.Sprintf(publishes, host)); err == nil && v != "" {
+					return nil
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s was not healthy in time", name)
+		}
+		time.Sleep(healthInterval)
+	}
+}
+
+// unitState returns the state of a unit, or nil if fleet does not know it.
+func (c *FleetClient) unitState(name string) *schema.UnitState {
+	states, err := c.Fleet.UnitStates()
 	if err != nil {
-		io.WriteString(ew, err.Error())
-		return
+		return nil
 	}
-	if len(components) < 1 {
-		fmt.Fprint(ew, "rolling restart requires at least 1 component")
-		return
+	for _, us := range states {
+		if us.Name == name {
+			return us
+		}
 	}
-	for num := range components {
-		unitName := fmt.Sprintf("%s@%v", component, num+1)
+	return nil
+}
 
-		c.Stop([]string{unitName}, wg, out, ew)
-		wg.Wait()
-		c.Destroy([]string{unitName}, wg, out, ew)
-		wg.Wait()
-		c.Create([]string{unitName}, wg, out, ew)
-		wg.Wait()
-		c.Start([]string{unitName}, wg, out, ew)
-		wg.Wait()
+// host returns the address a machine's units publish themselves under.
+func (c *FleetClient) host(machID string) string {
+	if machID == "" {
+		return ""
+	}
+	if ms := c.cachedMachineState(machID); ms != nil {
+		return ms.PublicIP
 	}
+	return ""
 }
@@ -0,0 +1,173 @@
+package fleet
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/config/model"
+	"github.com/deis/deis/deisctl/test/mock"
+
+	"github.com/coreos/fleet/machine"
+	"github.com/coreos/fleet/schema"
+)
+
+// placingFleetClient schedules units on machines and forgets the states of
+// destroyed units, as fleet does.
+type placingFleetClient struct {
+	stubFleetClient
+	machines  map[string]string
+	destroyed []string
+}
+
+func (c *placingFleetClient) UnitStates() ([]*schema.UnitState, error) {
+	states, _ := c.stubFleetClient.UnitStates()
+
+	c.unitStatesMutex.Lock()
+	defer c.unitStatesMutex.Unlock()
+	for _, us := range states {
+		us.MachineID = c.machines[us.Name]
+	}
+	return states, nil
+}
+
+func (c *placingFleetClient) DestroyUnit(name string) error {
+	c.stubFleetClient.DestroyUnit(name)
+
+	c.unitStatesMutex.Lock()
+	defer c.unitStatesMutex.Unlock()
+	for i := len(c.testUnitStates) - 1; i >= 0; i-- {
+		if c.testUnitStates[i].Name == name {
+			c.testUnitStates = append(c.testUnitStates[:i], c.testUnitStates[i+1:]...)
+		}
+	}
+	c.destroyed = append(c.destroyed, name)
+	return nil
+}
+
+func newRollingRestartClient(t *testing.T, published ...string) (*FleetClient, *placingFleetClient, func()) {
+	name, err := ioutil.TempDir("", "deisctl-fleetctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(path.Join(name, "deis-router.service"), []byte("[Unit]"), 0644)
+
+	testUnits := []*schema.Unit{
+		&schema.Unit{Name: "deis-router@1.service", DesiredState: "launched"},
+		&schema.Unit{Name: "deis-router@2.service", DesiredState: "launched"},
+		&schema.Unit{Name: "deis-router@3.service", DesiredState: "launched"},
+	}
+	testUnitStates := []*schema.UnitState{
+		&schema.UnitState{Name: "deis-router@1.service", SystemdActiveState: "active", SystemdSubState: "running"},
+		&schema.UnitState{Name: "deis-router@2.service", SystemdActiveState: "active", SystemdSubState: "running"},
+		&schema.UnitState{Name: "deis-router@3.service", SystemdActiveState: "active", SystemdSubState: "running"},
+	}
+	testMachines := []machine.MachineState{
+		{ID: "123", PublicIP: "10.0.0.1"},
+		{ID: "456", PublicIP: "10.0.0.2"},
+		{ID: "789", PublicIP: "10.0.0.3"},
+	}
+	testFleetClient := &placingFleetClient{
+		stubFleetClient: stubFleetClient{testUnits: testUnits, testUnitStates: testUnitStates,
+			testMachineStates: testMachines, unitsMutex: &sync.Mutex{}, unitStatesMutex: &sync.Mutex{}},
+		machines: map[string]string{
+			"deis-router@1.service": "123",
+			"deis-router@2.service": "456",
+			"deis-router@3.service": "789",
+		},
+	}
+
+	var store mock.Store
+	for _, host := range published {
+		store = append(store, &model.ConfigNode{Key: "/deis/router/hosts/" + host, Value: host + ":80"})
+	}
+	c := &FleetClient{templatePaths: []string{name}, Fleet: testFleetClient,
+		configBackend: mock.ConfigBackend{Expected: store}}
+
+	healthInterval = 10 * time.Millisecond
+	return c, testFleetClient, func() { os.RemoveAll(name) }
+}
+
+func TestRollingRestart(t *testing.T) {
+	c, testFleetClient, cleanup := newRollingRestartClient(t, "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	defer cleanup()
+
+	oe := newOutErr()
+	opts := backend.RollingRestartOptions{BatchSize: 2, HealthTimeout: time.Second}
+	c.RollingRestart("router", opts, oe.out, oe.ew)
+
+	if oe.ew.String() != "" {
+		t.Fatal(oe.ew.String())
+	}
+	expected := []string{"deis-router@1.service", "deis-router@2.service", "deis-router@3.service"}
+	if !reflect.DeepEqual(testFleetClient.destroyed[:2], expected[:2]) &&
+		!reflect.DeepEqual(testFleetClient.destroyed[:2], []string{expected[1], expected[0]}) {
+		t.Errorf("Expected the first batch to be %v, Got %v", expected[:2], testFleetClient.destroyed)
+	}
+	if len(testFleetClient.destroyed) != 3 || testFleetClient.destroyed[2] != expected[2] {
+		t.Errorf("Expected %v to be restarted, Got %v", expected, testFleetClient.destroyed)
+	}
+	for _, name := range expected {
+		if us := c.unitState(name); us == nil || us.SystemdSubState != "running" {
+			t.Errorf("Expected %s to be running, Got %v", name, us)
+		}
+	}
+}
+
+func TestRollingRestartAbortOnFailure(t *testing.T) {
+	// router@2 never publishes itself
+	c, testFleetClient, cleanup := newRollingRestartClient(t, "10.0.0.1", "10.0.0.3")
+	defer cleanup()
+
+	oe := newOutErr()
+	opts := backend.RollingRestartOptions{BatchSize: 1, HealthTimeout: 50 * time.Millisecond, AbortOnFailure: true}
+	results := c.RollingRestart("router", opts, oe.out, oe.ew)
+
+	if !strings.Contains(oe.ew.String(), "deis-router@2.service was not healthy in time") {
+		t.Errorf("Expected router@2 to be unhealthy, Got %q", oe.ew.String())
+	}
+	if !strings.Contains(oe.ew.String(), "left untouched: router@3") {
+		t.Errorf("Expected router@3 to be left untouched, Got %q", oe.ew.String())
+	}
+	if failed := backend.Failed(results); len(failed) != 1 || failed[0].Unit != "deis-router@2.service" || failed[0].Action != "health" {
+		t.Errorf("Expected the health check of router@2 to fail, Got %v", results)
+	}
+	expected := []string{"deis-router@1.service", "deis-router@2.service"}
+	if !reflect.DeepEqual(testFleetClient.destroyed, expected) {
+		t.Errorf("Expected %v, Got %v", expected, testFleetClient.destroyed)
+	}
+}
+
+func TestRollingRestartContinuesAfterFailure(t *testing.T) {
+	c, testFleetClient, cleanup := newRollingRestartClient(t, "10.0.0.1", "10.0.0.3")
+	defer cleanup()
+
+	oe := newOutErr()
+	opts := backend.RollingRestartOptions{BatchSize: 1, HealthTimeout: 50 * time.Millisecond}
+	c.RollingRestart("router", opts, oe.out, oe.ew)
+
+	if !strings.Contains(oe.ew.String(), "deis-router@2.service was not healthy in time") {
+		t.Errorf("Expected router@2 to be unhealthy, Got %q", oe.ew.String())
+	}
+	if len(testFleetClient.destroyed) != 3 {
+		t.Errorf("Expected every instance to be restarted, Got %v", testFleetClient.destroyed)
+	}
+}
+
+func TestRollingRestartWithoutInstances(t *testing.T) {
+	c, _, cleanup := newRollingRestartClient(t)
+	defer cleanup()
+
+	oe := newOutErr()
+	c.RollingRestart("registry", backend.RollingRestartOptions{}, oe.out, oe.ew)
+
+	if !strings.Contains(oe.ew.String(), "registry has no instances to restart") {
+		t.Errorf("Expected an error, Got %q", oe.ew.String())
+	}
+}
@@ -1,60 +1,86 @@
 package fleet
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"math"
-	"strconv"
 	"strings"
-	"sync"
+
+	"github.com/deis/deis/deisctl/backend"
 )
 
-// Scale creates or destroys units to match the desired number
+// Scale creates or destroys units to match the desired number. New instances
+// are placed as opts ask, and the instances to destroy are picked by their
+// placement.
 func (c *FleetClient) Scale(
-	component string, requested int, wg *sync.WaitGroup, out, ew io.Writer) {
+	component string, requested int, opts backend.ScaleOptions, out, ew io.Writer) []backend.Result {
 
 	if requested < 0 {
 		fmt.Fprintln(ew, "cannot scale below 0")
-		return
+		return []backend.Result{{Unit: component, Action: "scale", Err: errors.New("cannot scale below 0")}}
 	}
 	// check how many currently exist
-	components, err := c.Units(component)
+	states, err := c.UnitStates()
 	if err != nil {
-		// skip checking the first time; we just want a tally
-		if !strings.Contains(err.Error(), "could not find unit") {
-			fmt.Fprintln(ew, err.Error())
-			return
-		}
+		fmt.Fprintln(ew, err.Error())
+		return []backend.Result{{Unit: component, Action: "scale", Err: err}}
 	}
+	instances := backend.Instances(component, states)
 
-	timesToScale := int(math.Abs(float64(requested - len(components))))
 	switch {
-	case timesToScale == 0:
-		return
-	case requested-len(components) > 0:
-		c.scaleUp(component, len(components), timesToScale, wg, out, ew)
+	case requested == len(instances):
+		return nil
+	case requested > len(instances):
+		return c.scaleUp(component, requested, instances, opts, out, ew)
 	default:
-		c.scaleDown(component, len(components), timesToScale, wg, out, ew)
+		return c.scaleDown(component, len(instances)-requested, instances, opts, out, ew)
 	}
 }
 
-func (c *FleetClient) scaleUp(component string, numExistingContainers, numTimesToScale int,
-	wg *sync.WaitGroup, out, ew io.Writer) {
-	for i := 0; i < numTimesToScale; i++ {
-		target := component + "@" + strconv.Itoa(numExistingContainers+i+1)
-		c.Create([]string{target}, wg, out, ew)
+func (c *FleetClient) scaleUp(component string, requested int, instances []backend.UnitState,
+	opts backend.ScaleOptions, out, ew io.Writer) []backend.Result {
+	targets := backend.NewInstances(component, instances, requested-len(instances))
+	if opts.Spread || len(opts.MachineMetadata) > 0 {
+		if err := c.place(component, requested, targets[0], opts); err != nil {
+			fmt.Fprintln(ew, err.Error())
+			return []backend.Result{{Unit: component, Action: "scale", Err: err}}
+		}
+	}
+	results := c.Create(targets, out, ew)
+	if len(backend.Failed(results)) > 0 {
+		return results
 	}
-	wg.Wait()
-	for i := 0; i < numTimesToScale; i++ {
-		target := component + "@" + strconv.Itoa(numExistingContainers+i+1)
-		c.Start([]string{target}, wg, out, ew)
+	return append(results, c.Start(targets, out, ew)...)
+}
+
+func (c *FleetClient) scaleDown(component string, n int, instances []backend.UnitState,
+	opts backend.ScaleOptions, out, ew io.Writer) []backend.Result {
+	machines, err := c.Machines()
+	if err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return []backend.Result{{Unit: component, Action: "scale", Err: err}}
 	}
+	return c.Destroy(backend.PickScaleDown(component, instances, machines, n, opts), out, ew)
 }
 
-func (c *FleetClient) scaleDown(component string, numExistingContainers, numTimesToScale int,
-	wg *sync.WaitGroup, out, ew io.Writer) {
-	for i := 0; i < numTimesToScale; i++ {
-		target := component + "@" + strconv.Itoa(numExistingContainers-i)
-		c.Destroy([]string{target}, wg, out, ew)
+// place returns an error if the machines of the cluster cannot run the
+// requested instances of a component as opts ask. Otherwise it saves the
+// machine metadata of opts as a parameter of the component's unit, which the
+// new instances, and those restarted later, are rendered with.
+func (c *FleetClient) place(component string, requested int, target string, opts backend.ScaleOptions) error {
+	uf, err := c.UnitFile(target)
+	if err != nil {
+		return err
+	}
+	machines, err := c.Machines()
+	if err != nil {
+		return err
+	}
+	if err := backend.CheckPlacement(component, requested, uf.MachineMetadata, machines, opts); err != nil {
+		return err
+	}
+	if metadata := backend.PlacementMetadata(uf.MachineMetadata, opts); metadata != nil {
+		_, err = c.configBackend.Set(backend.PlacementKey(component), strings.Join(metadata, " "))
 	}
+	return err
 }
@@ -1,15 +1,19 @@
 package fleet
 
 import (
+	"fmt"
 	"io/ioutil"
 	"path"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
 
+	"github.com/deis/deis/deisctl/backend"
 	"github.com/deis/deis/deisctl/config/model"
 	"github.com/deis/deis/deisctl/test/mock"
 
+	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/schema"
 )
 
@@ -38,15 +42,12 @@ func TestScaleUp(t *testing.T) {
 	c := &FleetClient{templatePaths: []string{name}, Fleet: &testFleetClient, configBackend: testConfigBackend}
 
 	var errOutput string
-	var wg sync.WaitGroup
 
 	logMutex := sync.Mutex{}
 
 	se := newOutErr()
 
-	c.Scale("router", 3, &wg, se.out, se.ew)
-
-	wg.Wait()
+	c.Scale("router", 3, backend.ScaleOptions{}, se.out, se.ew)
 
 	logMutex.Lock()
 	if errOutput != "" {
@@ -96,14 +97,11 @@ func TestScaleDown(t *testing.T) {
 	c := &FleetClient{Fleet: &testFleetClient}
 
 	var errOutput string
-	var wg sync.WaitGroup
 
 	logMutex := sync.Mutex{}
 
 	se := newOutErr()
-	c.Scale("router", 1, &wg, se.out, se.ew)
-
-	wg.Wait()
+	c.Scale("router", 1, backend.ScaleOptions{}, se.out, se.ew)
 
 	logMutex.Lock()
 	if errOutput != "" {
@@ -135,14 +133,11 @@ func TestScaleError(t *testing.T) {
 	c := &FleetClient{Fleet: &stubFleetClient{}}
 
 	var errOutput string
-	var wg sync.WaitGroup
 
 	logMutex := sync.Mutex{}
 
 	se := newOutErr()
-	c.Scale("router", -1, &wg, se.out, se.ew)
-
-	wg.Wait()
+	c.Scale("router", -1, backend.ScaleOptions{}, se.out, se.ew)
 
 	expected := "cannot scale below 0"
 	errOutput = strings.TrimSpace(se.ew.String())
@@ -153,3 +148,111 @@ func TestScaleError(t *testing.T) {
 	}
 	logMutex.Unlock()
 }
+
+// storeConfigBackend keeps the values set on its keys.
+type storeConfigBackend struct {
+	mock.ConfigBackend
+}
+
+func (cb *storeConfigBackend) Set(key, value string) (string, error) {
+	for _, n := range cb.Expected {
+		if n.Key == key {
+			n.Value = value
+			return value, nil
+		}
+	}
+	cb.Expected = append(cb.Expected, &model.ConfigNode{Key: key, Value: value})
+	return value, nil
+}
+
+func TestScaleUpPlacement(t *testing.T) {
+	t.Parallel()
+
+	name, err := ioutil.TempDir("", "deisctl-fleetctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(path.Join(name, "deis-registry.service"), []byte("[Unit]\nDescription=deis-registry\n"), 0644)
+
+	edge := map[string]string{"edge": "true"}
+	testFleetClient := stubFleetClient{
+		testUnits: []*schema.Unit{
+			{Name: "deis-registry@1.service", DesiredState: "launched"},
+			{Name: "deis-registry@3.service", DesiredState: "launched"},
+		},
+		testMachineStates: []machine.MachineState{{ID: "a", Metadata: edge}, {ID: "b", Metadata: edge}, {ID: "c"}},
+		unitsMutex:        &sync.Mutex{}, unitStatesMutex: &sync.Mutex{}}
+	cb := &storeConfigBackend{}
+	c := &FleetClient{templatePaths: []string{name}, Fleet: &testFleetClient, configBackend: cb}
+
+	se := newOutErr()
+	opts := backend.ScaleOptions{Spread: true, MachineMetadata: []string{"edge=true"}}
+	results := c.Scale("registry", 3, opts, se.out, se.ew)
+	if failed := backend.Failed(results); len(failed) == 0 {
+		t.Error("Expected spreading 3 instances across 2 machines with edge=true to fail")
+	}
+	if len(cb.Expected) != 0 {
+		t.Errorf("Expected no placement to be saved for a failed scale, Got %v", cb.Expected)
+	}
+
+	testFleetClient.testMachineStates = append(testFleetClient.testMachineStates, machine.MachineState{ID: "d", Metadata: edge})
+	results = c.Scale("registry", 3, opts, se.out, se.ew)
+	if failed := backend.Failed(results); len(failed) > 0 {
+		t.Fatal(failed[0].Err)
+	}
+	// the lowest free number is used
+	u, err := testFleetClient.Unit("deis-registry@2.service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uf := schema.MapSchemaUnitOptionsToUnitFile(u.Options)
+	if metadata := uf.Contents["X-Fleet"]["MachineMetadata"]; !reflect.DeepEqual(metadata, []string{"edge=true"}) {
+		t.Errorf("Expected the machine metadata edge=true, Got %v", metadata)
+	}
+	// units rendered later, as by rolling-restart and diff, keep the placement
+	if value, _ := cb.Get("/deis/units/registry/machineMetadata"); value != "edge=true" {
+		t.Errorf("Expected the placement to be saved, Got %q", value)
+	}
+	if later, err := c.UnitFile("registry@1"); err != nil || !reflect.DeepEqual(later.MachineMetadata, []string{"edge=true"}) {
+		t.Errorf("Expected re-rendered units to require edge=true, Got %v, %v", later.MachineMetadata, err)
+	}
+}
+
+func TestScaleDownPlacement(t *testing.T) {
+	t.Parallel()
+
+	var testUnits []*schema.Unit
+	for i := 1; i <= 5; i++ {
+		testUnits = append(testUnits, &schema.Unit{Name: fmt.Sprintf("deis-router@%d.service", i), DesiredState: "launched"})
+	}
+	running := func(name, machineID string) *schema.UnitState {
+		return &schema.UnitState{Name: name, MachineID: machineID, SystemdActiveState: "active", SystemdSubState: "running"}
+	}
+	edge := map[string]string{"edge": "true"}
+	testFleetClient := stubFleetClient{
+		testUnits: testUnits,
+		testUnitStates: []*schema.UnitState{
+			running("deis-router@1.service", "a"),
+			running("deis-router@2.service", "a"),
+			{Name: "deis-router@3.service", MachineID: "b", SystemdActiveState: "failed", SystemdSubState: "failed"},
+			running("deis-router@4.service", "c"),
+			running("deis-router@5.service", "b"),
+		},
+		testMachineStates: []machine.MachineState{{ID: "a", Metadata: edge}, {ID: "b", Metadata: edge}, {ID: "c"}},
+		unitsMutex:        &sync.Mutex{}, unitStatesMutex: &sync.Mutex{}}
+	c := &FleetClient{Fleet: &testFleetClient}
+
+	se := newOutErr()
+	results := c.Scale("router", 2, backend.ScaleOptions{MachineMetadata: []string{"edge=true"}}, se.out, se.ew)
+
+	// the failed instance, then the one without the metadata, then the one
+	// sharing a machine
+	var destroyed []string
+	for _, r := range results {
+		destroyed = append(destroyed, r.Unit)
+	}
+	expected := []string{"deis-router@3.service", "deis-router@4.service", "deis-router@2.service"}
+	if !reflect.DeepEqual(destroyed, expected) {
+		t.Errorf("Expected %v to be destroyed, Got %v", expected, destroyed)
+	}
+}
@@ -2,6 +2,7 @@ package fleet
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/coreos/fleet/machine"
 	"github.com/coreos/fleet/ssh"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 // SSH opens an interactive shell to a machine in the cluster
@@ -101,9 +103,28 @@ func (c *FleetClient) runCommand(cmd string, machID string) (retcode int) {
 	return
 }
 
+// streamCommand runs a command on a given machine like runCommand, writing
+// its output to out instead of the terminal.
+func (c *FleetClient) streamCommand(cmd string, machID string, out io.Writer) (int, error) {
+	if machine.IsLocalMachineID(machID) {
+		return c.runner.StreamCommand(cmd, "", 0, out)
+	}
+	ms, err := c.machineState(machID)
+	if err != nil {
+		return -1, err
+	} else if ms == nil {
+		return -1, fmt.Errorf("machine %s not found", machID)
+	}
+	sshTimeout := time.Duration(Flags.SSHTimeout*1000) * time.Millisecond
+	return c.runner.StreamCommand(cmd, ms.PublicIP, sshTimeout, out)
+}
+
 type commandRunner interface {
 	LocalCommand(string) (int, error)
 	RemoteCommand(string, string, time.Duration) (int, error)
+	// StreamCommand runs a command locally, or over SSH when given an
+	// address, and writes its output to a writer.
+	StreamCommand(string, string, time.Duration, io.Writer) (int, error)
 }
 
 type sshCommandRunner struct{}
@@ -148,6 +169,55 @@ func (sshCommandRunner) RemoteCommand(cmd string, addr string, timeout time.Dura
 	return
 }
 
+// StreamCommand runs the given command with sh locally, or over SSH on the
+// given IP, writing its output to out. It returns any error encountered and
+// the exit status of the command.
+func (sshCommandRunner) StreamCommand(cmd string, addr string, timeout time.Duration, out io.Writer) (int, error) {
+	if addr == "" {
+		osCmd := exec.Command("sh", "-c", cmd)
+		osCmd.Stdout = out
+		osCmd.Stderr = out
+		err := osCmd.Run()
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+				return status.ExitStatus(), nil
+			}
+		}
+		if err != nil {
+			return -1, err
+		}
+		return 0, nil
+	}
+
+	var sshClient *ssh.SSHForwardingClient
+	var err error
+	if tun := getTunnelFlag(); tun != "" {
+		sshClient, err = ssh.NewTunnelledSSHClient("core", tun, addr, getChecker(), false, timeout)
+	} else {
+		sshClient, err = ssh.NewSSHClient("core", addr, getChecker(), false, timeout)
+	}
+	if err != nil {
+		return -1, err
+	}
+	defer sshClient.Close()
+
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return -1, err
+	}
+	defer session.Close()
+	session.Stdout = out
+	session.Stderr = out
+	err = session.Run(cmd)
+	if exiterr, ok := err.(*gossh.ExitError); ok {
+		return exiterr.ExitStatus(), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
 // findUnits returns the machine ID of a running unit
 func (c *FleetClient) findUnit(name string) (machID string, err error) {
 	u, err := c.Fleet.Unit(name)
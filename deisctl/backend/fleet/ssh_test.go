@@ -3,6 +3,7 @@ package fleet
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"reflect"
 	"sync"
 	"testing"
@@ -25,6 +26,10 @@ func (mockCommandRunner) RemoteCommand(cmd string, addr string, timeout time.Dur
 	return 0, nil
 }
 
+func (mockCommandRunner) StreamCommand(string, string, time.Duration, io.Writer) (int, error) {
+	return 0, nil
+}
+
 func TestRunCommand(t *testing.T) {
 	t.Parallel()
 
@@ -3,42 +3,39 @@ package fleet
 import (
 	"fmt"
 	"io"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/coreos/fleet/schema"
+	"github.com/deis/deis/deisctl/backend"
 	"github.com/deis/deis/pkg/prettyprint"
 )
 
 // Start units and wait for their desiredState
-func (c *FleetClient) Start(targets []string, wg *sync.WaitGroup, out, ew io.Writer) {
+func (c *FleetClient) Start(targets []string, out, ew io.Writer) []backend.Result {
 	// expand @* targets
 	expandedTargets, err := c.expandTargets(targets)
 	if err != nil {
 		io.WriteString(ew, err.Error())
-		return
+		return []backend.Result{{Unit: strings.Join(targets, " "), Action: "start", Err: err}}
 	}
 
-	for _, target := range expandedTargets {
-		wg.Add(1)
-		go doStart(c, target, wg, out, ew)
-	}
-	return
+	return backend.Each("start", expandedTargets, func(target string) (string, string, error) {
+		return doStart(c, target, out, ew)
+	})
 }
 
-func doStart(c *FleetClient, target string, wg *sync.WaitGroup, out, ew io.Writer) {
-	defer wg.Done()
-
+func doStart(c *FleetClient, target string, out, ew io.Writer) (string, string, error) {
 	// prepare string representation
 	component, num, err := splitTarget(target)
 	if err != nil {
 		io.WriteString(ew, err.Error())
-		return
+		return "", "", err
 	}
 	name, err := formatUnitName(component, num)
 	if err != nil {
 		io.WriteString(ew, err.Error())
-		return
+		return "", "", err
 	}
 
 	requestState := "launched"
@@ -46,7 +43,7 @@ func doStart(c *FleetClient, target string, wg *sync.WaitGroup, out, ew io.Write
 
 	if err := c.Fleet.SetUnitTargetState(name, requestState); err != nil {
 		io.WriteString(ew, err.Error())
-		return
+		return name, "", err
 	}
 
 	// start with the likely subState to avoid sending it across the channel
@@ -57,7 +54,7 @@ func doStart(c *FleetClient, target string, wg *sync.WaitGroup, out, ew io.Write
 		states, err := c.Fleet.UnitStates()
 		if err != nil {
 			io.WriteString(ew, err.Error())
-			return
+			return name, "", err
 		}
 
 		// FIXME: fleet UnitStates API forces us to iterate for now
@@ -70,7 +67,7 @@ func doStart(c *FleetClient, target string, wg *sync.WaitGroup, out, ew io.Write
 		}
 		if currentState == nil {
 			fmt.Fprintf(ew, "Could not find unit: %v\n", name)
-			return
+			return name, "", fmt.Errorf("Could not find unit: %v", name)
 		}
 
 		// if subState changed, send it across the output channel
@@ -82,7 +79,7 @@ func doStart(c *FleetClient, target string, wg *sync.WaitGroup, out, ew io.Write
 		// break when desired state is reached
 		if currentState.SystemdSubState == desiredState {
 			fmt.Fprintln(out)
-			return
+			return name, desiredState, nil
 		}
 
 		lastSubState = currentState.SystemdSubState
@@ -90,7 +87,7 @@ func doStart(c *FleetClient, target string, wg *sync.WaitGroup, out, ew io.Write
 		if lastSubState == "failed" {
 			o := prettyprint.Colorize("{{.Red}}The service '%s' failed while starting.{{.Default}}\n")
 			fmt.Fprintf(ew, o, target)
-			return
+			return name, lastSubState, fmt.Errorf("%s failed while starting", name)
 		}
 		time.Sleep(250 * time.Millisecond)
 	}
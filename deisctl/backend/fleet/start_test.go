@@ -32,14 +32,11 @@ func TestStart(t *testing.T) {
 	c := &FleetClient{Fleet: &testFleetClient}
 
 	var errOutput string
-	var wg sync.WaitGroup
 
 	logMutex := sync.Mutex{}
 
 	se := newOutErr()
-	c.Start([]string{"controller", "builder", "publisher"}, &wg, se.out, se.ew)
-
-	wg.Wait()
+	c.Start([]string{"controller", "builder", "publisher"}, se.out, se.ew)
 
 	logMutex.Lock()
 	if errOutput != "" {
@@ -76,15 +73,16 @@ func TestStartFail(t *testing.T) {
 		unitStatesMutex: &sync.Mutex{},
 		unitsMutex:      &sync.Mutex{},
 	}}
-	var wg sync.WaitGroup
 	c := &FleetClient{Fleet: fc}
 
 	var b syncBuffer
-	c.Start([]string{"deis-builder.service"}, &wg, &b, &b)
-	wg.Wait()
+	results := c.Start([]string{"deis-builder.service"}, &b, &b)
 
 	if !strings.Contains(b.String(), "failed while starting") {
 		t.Errorf("Expected failure during start. Got '%s'", b.String())
 	}
+	if len(results) != 1 || results[0].Err == nil || results[0].Unit != "deis-builder.service" {
+		t.Errorf("Expected the start of deis-builder.service to fail, Got %v", results)
+	}
 
 }
@@ -3,6 +3,7 @@ package fleet
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"sync"
 	"testing"
 	"time"
@@ -33,6 +34,10 @@ func (m mockStatusCommandRunner) RemoteCommand(cmd string, addr string, timeout
 	return -1, fmt.Errorf("Didn't find command %s to match with units %v", cmd, m.validUnits)
 }
 
+func (mockStatusCommandRunner) StreamCommand(string, string, time.Duration, io.Writer) (int, error) {
+	return 0, nil
+}
+
 func TestStatus(t *testing.T) {
 	t.Parallel()
 
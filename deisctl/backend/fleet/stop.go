@@ -3,44 +3,41 @@ package fleet
 import (
 	"fmt"
 	"io"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/coreos/fleet/schema"
+	"github.com/deis/deis/deisctl/backend"
 	"github.com/deis/deis/pkg/prettyprint"
 )
 
 var stateFmt = prettyprint.Colorize("{{.Yellow}}%v:{{.Default}} %v/%v")
 
 // Stop units and wait for their desiredState
-func (c *FleetClient) Stop(targets []string, wg *sync.WaitGroup, out, ew io.Writer) {
+func (c *FleetClient) Stop(targets []string, out, ew io.Writer) []backend.Result {
 	// expand @* targets
 	expandedTargets, err := c.expandTargets(targets)
 	if err != nil {
 		fmt.Fprintln(ew, err.Error())
-		return
+		return []backend.Result{{Unit: strings.Join(targets, " "), Action: "stop", Err: err}}
 	}
 
-	for _, target := range expandedTargets {
-		wg.Add(1)
-		go doStop(c, target, wg, out, ew)
-	}
-	return
+	return backend.Each("stop", expandedTargets, func(target string) (string, string, error) {
+		return doStop(c, target, out, ew)
+	})
 }
 
-func doStop(c *FleetClient, target string, wg *sync.WaitGroup, out, ew io.Writer) {
-	defer wg.Done()
-
+func doStop(c *FleetClient, target string, out, ew io.Writer) (string, string, error) {
 	// prepare string representation
 	component, num, err := splitTarget(target)
 	if err != nil {
 		fmt.Fprintln(ew, err.Error())
-		return
+		return "", "", err
 	}
 	name, err := formatUnitName(component, num)
 	if err != nil {
 		fmt.Fprintln(ew, err.Error())
-		return
+		return "", "", err
 	}
 
 	requestState := "loaded"
@@ -48,7 +45,7 @@ func doStop(c *FleetClient, target string, wg *sync.WaitGroup, out, ew io.Writer
 
 	if err := c.Fleet.SetUnitTargetState(name, requestState); err != nil {
 		fmt.Fprintln(ew, err.Error())
-		return
+		return name, "", err
 	}
 
 	// start with the likely subState to avoid sending it across the channel
@@ -59,7 +56,7 @@ func doStop(c *FleetClient, target string, wg *sync.WaitGroup, out, ew io.Writer
 		states, err := c.Fleet.UnitStates()
 		if err != nil {
 			fmt.Fprintln(ew, err.Error())
-			return
+			return name, "", err
 		}
 
 		// FIXME: fleet UnitStates API forces us to iterate for now
@@ -72,7 +69,7 @@ func doStop(c *FleetClient, target string, wg *sync.WaitGroup, out, ew io.Writer
 		}
 		if currentState == nil {
 			fmt.Fprintf(ew, "Could not find unit: %v\n", name)
-			return
+			return name, "", fmt.Errorf("Could not find unit: %v", name)
 		}
 
 		// if subState changed, send it across the output channel
@@ -84,7 +81,7 @@ func doStop(c *FleetClient, target string, wg *sync.WaitGroup, out, ew io.Writer
 		// break when desired state is reached
 		if currentState.SystemdSubState == desiredState {
 			fmt.Fprintln(out)
-			return
+			return name, desiredState, nil
 		}
 
 		lastSubState = currentState.SystemdSubState
@@ -92,7 +89,7 @@ func doStop(c *FleetClient, target string, wg *sync.WaitGroup, out, ew io.Writer
 		if lastSubState == "failed" {
 			o := prettyprint.Colorize("{{.Red}}The service '%s' failed while stopping.{{.Default}}\n")
 			fmt.Fprintf(ew, o, target)
-			return
+			return name, lastSubState, fmt.Errorf("%s failed while stopping", name)
 		}
 
 		time.Sleep(250 * time.Millisecond)
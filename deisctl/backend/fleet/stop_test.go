@@ -32,14 +32,11 @@ func TestStop(t *testing.T) {
 	c := &FleetClient{Fleet: &testFleetClient}
 
 	var errOutput string
-	var wg sync.WaitGroup
 
 	logMutex := sync.Mutex{}
 
 	se := newOutErr()
-	c.Stop([]string{"controller", "builder", "publisher"}, &wg, se.out, se.ew)
-
-	wg.Wait()
+	c.Stop([]string{"controller", "builder", "publisher"}, se.out, se.ew)
 
 	logMutex.Lock()
 	if errOutput != "" {
@@ -91,12 +88,10 @@ func TestStopFail(t *testing.T) {
 		unitStatesMutex: &sync.Mutex{},
 		unitsMutex:      &sync.Mutex{},
 	}}
-	var wg sync.WaitGroup
 	c := &FleetClient{Fleet: fc}
 
 	var b syncBuffer
-	c.Stop([]string{"deis-builder.service"}, &wg, &b, &b)
-	wg.Wait()
+	c.Stop([]string{"deis-builder.service"}, &b, &b)
 
 	if !strings.Contains(b.String(), "failed while stopping") {
 		t.Errorf("Expected 'failed while stopping'. Got '%s'", b.String())
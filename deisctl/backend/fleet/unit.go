@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/coreos/fleet/unit"
+	sdunit "github.com/coreos/go-systemd/unit"
 )
 
 // path hierarchy for finding systemd service templates
@@ -90,22 +91,35 @@ func (c *FleetClient) lastUnit(component string) (num int, err error) {
 }
 
 // NewUnit takes a component type and returns a Fleet unit
-// that includes the relevant systemd service template
-func NewUnit(component string, templatePaths []string, decorate bool) (uf *unit.UnitFile, err error) {
+// that includes the relevant systemd service template, rendered with params
+func NewUnit(component string, templatePaths []string, decorate bool, params UnitParams) (uf *unit.UnitFile, err error) {
 	template, err := readTemplate(component, templatePaths)
 	if err != nil {
 		return
 	}
-	if decorate {
+	contents, err := renderTemplate(component, template, params)
+	if err != nil {
+		return
+	}
+	if decorate && len(params.MachineMetadata) == 0 {
 		decorator, err := readDecorator(component)
 		if err != nil {
 			return nil, err
 		}
-		uf, err = unit.NewUnitFile(string(template) + "\n" + string(decorator))
-	} else {
-		uf, err = unit.NewUnitFile(string(template))
+		contents += "\n" + string(decorator)
 	}
-	return
+	uf, err = unit.NewUnitFile(contents)
+	if err != nil || len(params.MachineMetadata) == 0 {
+		return
+	}
+	// placement parameters replace the decorator, and apply even if placement
+	// options are not enabled
+	var metadata []string
+	for _, kv := range params.MachineMetadata {
+		metadata = append(metadata, strconv.Quote(kv))
+	}
+	opts := append(uf.Options, &sdunit.UnitOption{Section: "X-Fleet", Name: "MachineMetadata", Value: strings.Join(metadata, " ")})
+	return unit.NewUnitFromOptions(opts), nil
 }
 
 // formatUnitName returns a properly formatted systemd service name
@@ -141,7 +141,7 @@ Description=deis-controller`
 
 	ioutil.WriteFile(path.Join(name, unit+".service"), []byte(unitFile), 777)
 
-	uf, err := NewUnit(unit[5:], []string{name}, false)
+	uf, err := NewUnit(unit[5:], []string{name}, false, UnitParams{})
 
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,217 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deis/deis/pkg/prettyprint"
+)
+
+// JournalOptions select the journal entries to print.
+type JournalOptions struct {
+	// Follow keeps printing entries as they are written.
+	Follow bool
+	// Since is the time of the first entry, such as "2015-06-01 12:00:00".
+	Since string
+	// Lines is the number of recent entries of each unit to print, or 0 for
+	// all of them.
+	Lines int
+}
+
+// journalColors are the colors of the prefixes of the units, in turn.
+var journalColors = []string{"Cyan", "Green", "Yellow", "Purple", "Blue", "Red",
+	"BoldCyan", "BoldGreen", "BoldYellow", "BoldPurple", "BoldBlue", "BoldRed"}
+
+// journalTimeLayouts are the formats of the timestamps journal entries start
+// with: those of journalctl -o short-iso, and of docker logs --timestamps.
+var journalTimeLayouts = []string{"2006-01-02T15:04:05-0700", time.RFC3339Nano}
+
+// JournalMux merges the journals of several units, written to its writers,
+// into one, prefixing each entry with the unit it came from.
+//
+// The entries of each unit are expected in order. Entries are held until the
+// other units have written entries at least as recent, or for at most the
+// window, so those that arrive close together come out in timestamp order.
+type JournalMux struct {
+	out    io.Writer
+	window time.Duration
+
+	mu      sync.Mutex
+	streams []*journalStream
+	done    chan struct{}
+	stopped chan struct{}
+	err     error
+}
+
+// journalStream is the journal of one unit.
+type journalStream struct {
+	mux     *JournalMux
+	prefix  string
+	partial []byte
+	pending []journalEntry
+	last    time.Time
+	closed  bool
+}
+
+// journalEntry is a line of a journal.
+type journalEntry struct {
+	time    time.Time
+	arrived time.Time
+	line    string
+}
+
+// NewJournalMux returns a JournalMux writing to out, which holds entries for
+// at most window.
+func NewJournalMux(out io.Writer, window time.Duration) *JournalMux {
+	m := &JournalMux{out: out, window: window, done: make(chan struct{}), stopped: make(chan struct{})}
+	go m.run()
+	return m
+}
+
+// Writers returns a writer for the journal of each unit. The mux is done once
+// they are all closed.
+func (m *JournalMux) Writers(units []string) []io.WriteCloser {
+	width := 0
+	for _, u := range units {
+		if len(u) > width {
+			width = len(u)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	writers := make([]io.WriteCloser, len(units))
+	for i, u := range units {
+		color := prettyprint.Colors[journalColors[i%len(journalColors)]]
+		s := &journalStream{mux: m, prefix: fmt.Sprintf("%s%-*s |%s ", color, width, u, prettyprint.Colors["Default"])}
+		m.streams = append(m.streams, s)
+		writers[i] = s
+	}
+	if len(units) == 0 {
+		close(m.done)
+	}
+	return writers
+}
+
+// Wait waits for the writers to be closed and their entries to be written,
+// and returns the first error writing them.
+func (m *JournalMux) Wait() error {
+	<-m.stopped
+	return m.err
+}
+
+func (s *journalStream) Write(p []byte) (int, error) {
+	s.mux.mu.Lock()
+	defer s.mux.mu.Unlock()
+	s.partial = append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		s.add(string(s.partial[:i]))
+		s.partial = s.partial[i+1:]
+	}
+	s.mux.flush(false)
+	return len(p), nil
+}
+
+func (s *journalStream) Close() error {
+	m := s.mux
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	if len(s.partial) > 0 {
+		s.add(string(s.partial))
+		s.partial = nil
+	}
+	s.closed = true
+	m.flush(false)
+	for _, other := range m.streams {
+		if !other.closed {
+			return nil
+		}
+	}
+	close(m.done)
+	return nil
+}
+
+// add queues a line. Lines without a timestamp, such as the continuation of
+// a message, take that of the line before them.
+func (s *journalStream) add(line string) {
+	line = strings.TrimSuffix(line, "\r")
+	if t, ok := entryTime(line); ok {
+		s.last = t
+	}
+	s.pending = append(s.pending, journalEntry{time: s.last, arrived: time.Now(), line: line})
+}
+
+// entryTime parses the timestamp a journal entry starts with.
+func entryTime(line string) (time.Time, bool) {
+	field := line
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		field = line[:i]
+	}
+	for _, layout := range journalTimeLayouts {
+		if t, err := time.Parse(layout, field); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (m *JournalMux) run() {
+	ticker := time.NewTicker(m.window / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.mu.Lock()
+			m.flush(false)
+			m.mu.Unlock()
+		case <-m.done:
+			m.mu.Lock()
+			m.flush(true)
+			m.mu.Unlock()
+			close(m.stopped)
+			return
+		}
+	}
+}
+
+// flush writes the entries that can no longer be preceded by one from
+// another unit, or that have been held for the window. When all is set, it
+// writes every entry. The caller holds mu.
+func (m *JournalMux) flush(all bool) {
+	for {
+		var next *journalStream
+		waiting := false
+		for _, s := range m.streams {
+			if len(s.pending) == 0 {
+				if !s.closed {
+					waiting = true
+				}
+				continue
+			}
+			if next == nil || s.pending[0].time.Before(next.pending[0].time) {
+				next = s
+			}
+		}
+		if next == nil {
+			return
+		}
+		e := next.pending[0]
+		if waiting && !all && time.Since(e.arrived) < m.window {
+			return
+		}
+		next.pending = next.pending[1:]
+		if _, err := fmt.Fprintln(m.out, next.prefix+e.line); err != nil && m.err == nil {
+			m.err = err
+		}
+	}
+}
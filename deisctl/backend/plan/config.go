@@ -0,0 +1,66 @@
+package plan
+
+import (
+	"fmt"
+
+	"github.com/deis/deis/deisctl/config"
+)
+
+// ConfigBackend records the configuration changes of a command in a plan
+// instead of making them. Get sees the recorded changes, GetRecursive does not.
+type ConfigBackend struct {
+	config.Backend
+	plan    *Backend
+	values  map[string]string
+	deleted map[string]bool
+}
+
+// NewConfigBackend returns a ConfigBackend reading from cb and recording
+// changes in the plan of p.
+func NewConfigBackend(cb config.Backend, p *Backend) *ConfigBackend {
+	return &ConfigBackend{Backend: cb, plan: p, values: map[string]string{}, deleted: map[string]bool{}}
+}
+
+// Get returns the planned value of a key.
+func (cb *ConfigBackend) Get(key string) (string, error) {
+	if cb.deleted[key] {
+		return "", fmt.Errorf("%s does not exist", key)
+	}
+	if v, ok := cb.values[key]; ok {
+		return v, nil
+	}
+	return cb.Backend.Get(key)
+}
+
+// GetWithDefault returns the planned value of a key, or defaultValue if it
+// does not exist.
+func (cb *ConfigBackend) GetWithDefault(key, defaultValue string) (string, error) {
+	if cb.deleted[key] {
+		return defaultValue, nil
+	}
+	if v, ok := cb.values[key]; ok {
+		return v, nil
+	}
+	return cb.Backend.GetWithDefault(key, defaultValue)
+}
+
+// Set records setting a key.
+func (cb *ConfigBackend) Set(key, value string) (string, error) {
+	return cb.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL records setting a key with a time to live.
+func (cb *ConfigBackend) SetWithTTL(key, value string, ttl uint64) (string, error) {
+	cb.plan.record(Operation{Action: "set", Key: key, Value: value, TTL: ttl})
+	cb.values[key] = value
+	delete(cb.deleted, key)
+	return value, nil
+}
+
+// Delete records deleting a key.
+func (cb *ConfigBackend) Delete(key string) error {
+	cb.plan.record(Operation{Action: "delete", Key: key})
+	cb.deleted[key] = true
+	delete(cb.values, key)
+	return nil
+}
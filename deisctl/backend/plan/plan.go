@@ -0,0 +1,496 @@
+// Package plan records what a backend would do, for dry runs.
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/units"
+)
+
+// Operation is one step of a plan.
+type Operation struct {
+	// Action is create, start, stop, destroy, restart or wait for units, and
+	// set or delete for configuration keys.
+	Action string
+	Unit   string
+	// Machine describes where the unit runs, if it is known.
+	Machine string
+	// UnitFile is the rendered unit file of a created unit.
+	UnitFile string
+	Key      string
+	Value    string
+	TTL      uint64
+}
+
+func (op Operation) String() string {
+	switch op.Action {
+	case "set":
+		s := fmt.Sprintf("set %s = %s", op.Key, op.Value)
+		if op.TTL > 0 {
+			s += fmt.Sprintf(" (ttl %ds)", op.TTL)
+		}
+		return s
+	case "delete":
+		return "delete " + op.Key
+	case "wait":
+		return fmt.Sprintf("wait for %s to become healthy", op.Unit)
+	}
+	s := op.Action + " " + op.Unit
+	if op.Machine != "" {
+		s += " on " + op.Machine
+	}
+	return s
+}
+
+// unit is the simulated state of an installed unit.
+type unit struct {
+	machine string
+	// machineID is the ID of the unit's machine, if it is scheduled.
+	machineID string
+	// host is the IP of the unit's machine, if it is scheduled.
+	host   string
+	active bool
+}
+
+// errDryRun is returned by the commands a plan cannot record.
+var errDryRun = errors.New("not available in a dry run")
+
+// Backend records the operations of a command instead of performing them.
+//
+// It simulates their effect on the installed units, so a command planned
+// with it takes the same code path, and records the same operations, as it
+// would with the real backend.
+type Backend struct {
+	real backend.Backend
+	// planner is nil if the real backend cannot tell its units, in which
+	// case every operation is recorded as requested.
+	planner  backend.Planner
+	units    map[string]*unit
+	machines []backend.Machine
+
+	mutex      sync.Mutex
+	operations []Operation
+}
+
+// NewBackend returns a Backend planning for b. If b is a backend.Planner,
+// the plan starts from the units it has installed, and includes unit files
+// and machines.
+func NewBackend(b backend.Backend) (*Backend, error) {
+	p := &Backend{real: b, units: map[string]*unit{}}
+	planner, ok := b.(backend.Planner)
+	if !ok {
+		return p, nil
+	}
+	machines, err := planner.Machines()
+	if err != nil {
+		return nil, err
+	}
+	states, err := planner.UnitStates()
+	if err != nil {
+		return nil, err
+	}
+	p.planner = planner
+	p.machines = machines
+	for _, s := range states {
+		u := &unit{machine: s.Machine, machineID: s.Machine, active: s.ActiveState == "active"}
+		for _, m := range machines {
+			if m.ID == s.Machine {
+				u.machine, u.host = label(m), m.IP
+			}
+		}
+		p.units[s.Name] = u
+	}
+	return p, nil
+}
+
+// Operations returns the recorded operations, in order.
+func (p *Backend) Operations() []Operation {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]Operation(nil), p.operations...)
+}
+
+// Print writes the plan to w: the operations in order, then the unit files
+// they create.
+func (p *Backend) Print(w io.Writer) {
+	ops := p.Operations()
+	if len(ops) == 0 {
+		fmt.Fprintln(w, "Nothing to do.")
+		return
+	}
+	fmt.Fprintln(w, "Dry run, nothing was changed. Planned operations:")
+	for i, op := range ops {
+		fmt.Fprintf(w, "%3d. %s\n", i+1, op)
+	}
+	for _, op := range ops {
+		if op.UnitFile == "" {
+			continue
+		}
+		fmt.Fprintf(w, "\n--- %s\n%s", op.Unit, op.UnitFile)
+		if !strings.HasSuffix(op.UnitFile, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// record records an operation, and returns its result in the plan.
+func (p *Backend) record(op Operation) backend.Result {
+	p.mutex.Lock()
+	p.operations = append(p.operations, op)
+	p.mutex.Unlock()
+	return backend.Result{Unit: op.Unit, Action: op.Action, State: planned}
+}
+
+// planned is the state of units operated on in a plan.
+const planned = "planned"
+
+// Create records the units of targets that are not installed yet.
+func (p *Backend) Create(targets []string, out, ew io.Writer) []backend.Result {
+	return p.create(targets, nil, ew)
+}
+
+// create records the units of targets that are not installed yet, placed on
+// machines with the given metadata, or that of their unit if it is nil.
+func (p *Backend) create(targets []string, metadata []string, ew io.Writer) []backend.Result {
+	var results []backend.Result
+	for _, target := range targets {
+		name := unitName(target)
+		if _, installed := p.lookup(name); installed && p.planner != nil {
+			continue
+		}
+		op := Operation{Action: "create", Unit: name}
+		if p.planner != nil {
+			uf, err := p.planner.UnitFile(shortName(target))
+			if err != nil {
+				fmt.Fprintf(ew, "Error creating: %s\n", err)
+				return append(results, backend.Result{Unit: name, Action: "create", Err: err})
+			}
+			required := metadata
+			if required == nil {
+				required = uf.MachineMetadata
+			}
+			op.UnitFile = uf.Contents
+			op.Machine = p.placement(required)
+		}
+		p.setUnit(name, &unit{machine: op.Machine})
+		results = append(results, p.record(op))
+	}
+	return results
+}
+
+// Start records starting the units of targets that are not active.
+func (p *Backend) Start(targets []string, out, ew io.Writer) []backend.Result {
+	return p.transition(targets, "start", true, ew)
+}
+
+// Stop records stopping the units of targets that are active.
+func (p *Backend) Stop(targets []string, out, ew io.Writer) []backend.Result {
+	return p.transition(targets, "stop", false, ew)
+}
+
+func (p *Backend) transition(targets []string, action string, active bool, ew io.Writer) []backend.Result {
+	names, err := p.expand(targets)
+	if err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return []backend.Result{{Unit: strings.Join(targets, " "), Action: action, Err: err}}
+	}
+	var results []backend.Result
+	for _, name := range names {
+		u, installed := p.lookup(name)
+		if !installed {
+			err := fmt.Errorf("cannot %s %s, it is not installed", action, name)
+			fmt.Fprintln(ew, err.Error())
+			results = append(results, backend.Result{Unit: name, Action: action, Err: err})
+			continue
+		}
+		if u != nil {
+			if u.active == active {
+				continue
+			}
+			u.active = active
+		}
+		op := Operation{Action: action, Unit: name}
+		if u != nil {
+			op.Machine = u.machine
+		}
+		results = append(results, p.record(op))
+	}
+	return results
+}
+
+// Destroy records destroying the installed units of targets.
+func (p *Backend) Destroy(targets []string, out, ew io.Writer) []backend.Result {
+	names, err := p.expand(targets)
+	if err != nil {
+		fmt.Fprintln(ew, err.Error())
+		return []backend.Result{{Unit: strings.Join(targets, " "), Action: "destroy", Err: err}}
+	}
+	var results []backend.Result
+	for _, name := range names {
+		u, installed := p.lookup(name)
+		if !installed {
+			continue
+		}
+		op := Operation{Action: "destroy", Unit: name}
+		if u != nil {
+			op.Machine = u.machine
+		}
+		p.setUnit(name, nil)
+		results = append(results, p.record(op))
+	}
+	return results
+}
+
+// Scale records creating and starting, or destroying, the instances of a
+// component to reach the requested number, as the fleet backend does.
+func (p *Backend) Scale(component string, requested int, opts backend.ScaleOptions, out, ew io.Writer) []backend.Result {
+	if requested < 0 {
+		fmt.Fprintln(ew, "cannot scale below 0")
+		return []backend.Result{{Unit: component, Action: "scale", Err: errors.New("cannot scale below 0")}}
+	}
+	instances := p.instanceStates(component)
+	if requested > len(instances) {
+		targets := backend.NewInstances(component, instances, requested-len(instances))
+		var results []backend.Result
+		var metadata []string
+		if p.planner != nil && (opts.Spread || len(opts.MachineMetadata) > 0) {
+			uf, err := p.planner.UnitFile(targets[0])
+			if err == nil {
+				err = backend.CheckPlacement(component, requested, uf.MachineMetadata, p.machines, opts)
+			}
+			if err != nil {
+				fmt.Fprintln(ew, err.Error())
+				return []backend.Result{{Unit: component, Action: "scale", Err: err}}
+			}
+			if metadata = backend.PlacementMetadata(uf.MachineMetadata, opts); metadata != nil {
+				results = append(results, p.record(Operation{Action: "set", Key: backend.PlacementKey(component), Value: strings.Join(metadata, " ")}))
+			}
+		}
+		results = append(results, p.create(targets, metadata, ew)...)
+		return append(results, p.Start(targets, out, ew)...)
+	}
+	var results []backend.Result
+	for _, target := range backend.PickScaleDown(component, instances, p.machines, len(instances)-requested, opts) {
+		results = append(results, p.Destroy([]string{target}, out, ew)...)
+	}
+	return results
+}
+
+// RollingRestart records restarting the instances of a component a batch at
+// a time, as the fleet backend does, assuming every batch becomes healthy.
+func (p *Backend) RollingRestart(component string, opts backend.RollingRestartOptions, out, ew io.Writer) []backend.Result {
+	if p.planner == nil {
+		return []backend.Result{p.record(Operation{Action: "restart", Unit: unitName(component + "@*")})}
+	}
+	targets := p.instances(component)
+	if len(targets) == 0 {
+		err := fmt.Errorf("%s has no instances to restart", component)
+		fmt.Fprintln(ew, err.Error())
+		return []backend.Result{{Unit: component, Action: "restart", Err: err}}
+	}
+	size := opts.BatchSize
+	if size < 1 {
+		size = 1
+	}
+	var results []backend.Result
+	for i := 0; i < len(targets); i += size {
+		end := i + size
+		if end > len(targets) {
+			end = len(targets)
+		}
+		batch := targets[i:end]
+
+		var hosts []string
+		for _, target := range batch {
+			if u, _ := p.lookup(unitName(target)); u != nil && u.host != "" {
+				hosts = append(hosts, u.host)
+			}
+		}
+		results = append(results, p.Stop(batch, out, ew)...)
+		results = append(results, p.Destroy(batch, out, ew)...)
+		if publishes := units.Components[component].Publishes; publishes != "" {
+			for _, host := range hosts {
+				p.record(Operation{Action: "delete", Key: fmt.Sprintf(publishes, host)})
+			}
+		}
+		results = append(results, p.Create(batch, out, ew)...)
+		results = append(results, p.Start(batch, out, ew)...)
+		for _, target := range batch {
+			r := p.record(Operation{Action: "wait", Unit: unitName(target)})
+			r.Action = "health"
+			results = append(results, r)
+		}
+	}
+	return results
+}
+
+// SSH is not available in a dry run.
+func (p *Backend) SSH(target string) error {
+	return errDryRun
+}
+
+// SSHExec is not available in a dry run.
+func (p *Backend) SSHExec(target, command string) error {
+	return errDryRun
+}
+
+// Dock is not available in a dry run.
+func (p *Backend) Dock(target string, command []string) error {
+	return errDryRun
+}
+
+// ListMachines prints the machines of the real backend.
+func (p *Backend) ListMachines() error {
+	return p.real.ListMachines()
+}
+
+// ListUnits prints the units of the real backend.
+func (p *Backend) ListUnits() error {
+	return p.real.ListUnits()
+}
+
+// ListUnitFiles prints the unit files of the real backend.
+func (p *Backend) ListUnitFiles() error {
+	return p.real.ListUnitFiles()
+}
+
+// Status prints the status of a target in the real backend.
+func (p *Backend) Status(target string) error {
+	return p.real.Status(target)
+}
+
+// Journal prints the journals of targets in the real backend.
+func (p *Backend) Journal(targets []string, opts backend.JournalOptions, out, ew io.Writer) error {
+	return p.real.Journal(targets, opts, out, ew)
+}
+
+// lookup returns the simulated state of a unit, and whether it is installed.
+// Without a planner, every unit is assumed installed, with an unknown state.
+func (p *Backend) lookup(name string) (*unit, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.planner == nil {
+		return nil, true
+	}
+	u, ok := p.units[name]
+	return u, ok
+}
+
+// setUnit sets the simulated state of a unit, or uninstalls it if u is nil.
+func (p *Backend) setUnit(name string, u *unit) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if u == nil {
+		delete(p.units, name)
+	} else {
+		p.units[name] = u
+	}
+}
+
+// expand returns the unit names of targets, expanding @* to the installed
+// instances if they are known.
+func (p *Backend) expand(targets []string) ([]string, error) {
+	var names []string
+	for _, t := range targets {
+		if !strings.HasSuffix(t, "@*") || p.planner == nil {
+			names = append(names, unitName(t))
+			continue
+		}
+		component := strings.TrimSuffix(shortName(t), "@*")
+		instances := p.instances(component)
+		if len(instances) == 0 {
+			return nil, fmt.Errorf("could not find unit: %s", t)
+		}
+		for _, i := range instances {
+			names = append(names, unitName(i))
+		}
+	}
+	return names, nil
+}
+
+// instances returns the installed instances of a component, such as
+// router@1, in order.
+func (p *Backend) instances(component string) []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	prefix := "deis-" + component + "@"
+	var nums []int
+	for name := range p.units {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".service")); err == nil {
+			nums = append(nums, n)
+		}
+	}
+	sort.Ints(nums)
+	targets := make([]string, len(nums))
+	for i, n := range nums {
+		targets[i] = fmt.Sprintf("%s@%d", component, n)
+	}
+	return targets
+}
+
+// instanceStates returns the simulated states of the installed instances of
+// a component.
+func (p *Backend) instanceStates(component string) []backend.UnitState {
+	var states []backend.UnitState
+	for _, target := range p.instances(component) {
+		name := unitName(target)
+		s := backend.UnitState{Name: name}
+		if u, _ := p.lookup(name); u != nil {
+			s.Machine = u.machineID
+			if u.active {
+				s.ActiveState = "active"
+			}
+		}
+		states = append(states, s)
+	}
+	return states
+}
+
+// placement describes the machines a unit with the metadata can run on.
+func (p *Backend) placement(metadata []string) string {
+	var candidates []string
+	for _, m := range p.machines {
+		if m.Satisfies(metadata) {
+			candidates = append(candidates, label(m))
+		}
+	}
+	switch {
+	case len(candidates) == 0 && len(metadata) > 0:
+		return "no machine, none has " + strings.Join(metadata, ",")
+	case len(candidates) == 0:
+		return "no machine"
+	case len(candidates) == 1:
+		return candidates[0]
+	case len(candidates) == len(p.machines):
+		return "any machine"
+	}
+	return "one of " + strings.Join(candidates, ", ")
+}
+
+// label names a machine by its IP, if it is known.
+func label(m backend.Machine) string {
+	if m.IP != "" {
+		return m.IP
+	}
+	return m.ID
+}
+
+// shortName returns the target of a unit, such as router@1 for deis-router@1.service.
+func shortName(target string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(target, "deis-"), ".service")
+}
+
+// unitName returns the unit name of a target, such as deis-router@1.service for router@1.
+func unitName(target string) string {
+	return "deis-" + shortName(target) + ".service"
+}
@@ -0,0 +1,235 @@
+package plan
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/config/model"
+	"github.com/deis/deis/deisctl/test/mock"
+)
+
+// stubPlanner is a backend with installed units. The operations of the
+// embedded Backend are never called by a plan.
+type stubPlanner struct {
+	backend.Backend
+	states   []backend.UnitState
+	machines []backend.Machine
+}
+
+func (s *stubPlanner) UnitStates() ([]backend.UnitState, error) {
+	return s.states, nil
+}
+
+func (s *stubPlanner) Machines() ([]backend.Machine, error) {
+	return s.machines, nil
+}
+
+func (s *stubPlanner) UnitFile(target string) (backend.UnitFile, error) {
+	uf := backend.UnitFile{Name: unitName(target), Contents: "[Unit]\nDescription=" + target + "\n"}
+	if strings.HasPrefix(target, "controller") {
+		uf.MachineMetadata = []string{"controlPlane=true"}
+	}
+	return uf, nil
+}
+
+// stubBackend is a backend that cannot plan.
+type stubBackend struct {
+	backend.Backend
+}
+
+func newStubPlanner() *stubPlanner {
+	return &stubPlanner{
+		states: []backend.UnitState{
+			{Name: "deis-router@1.service", Machine: "a", ActiveState: "active", SubState: "running"},
+			{Name: "deis-router@2.service", Machine: "b", ActiveState: "active", SubState: "running"},
+			{Name: "deis-builder.service", Machine: "a", ActiveState: "inactive", SubState: "dead"},
+		},
+		machines: []backend.Machine{
+			{ID: "a", IP: "10.0.0.1", Metadata: map[string]string{"controlPlane": "true"}},
+			{ID: "b", IP: "10.0.0.2"},
+		},
+	}
+}
+
+func operations(p *Backend) string {
+	var lines []string
+	for _, op := range p.Operations() {
+		lines = append(lines, op.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestPlanScale(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewBackend(newStubPlanner())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs bytes.Buffer
+	p.Scale("router", 4, backend.ScaleOptions{}, &bytes.Buffer{}, &errs)
+	p.Scale("router", 1, backend.ScaleOptions{}, &bytes.Buffer{}, &errs)
+
+	expected := `create deis-router@3.service on any machine
+create deis-router@4.service on any machine
+start deis-router@3.service on any machine
+start deis-router@4.service on any machine
+destroy deis-router@4.service on any machine
+destroy deis-router@3.service on any machine
+destroy deis-router@2.service on 10.0.0.2`
+	if actual := operations(p); actual != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+	}
+	if errs.Len() != 0 {
+		t.Errorf("Expected no errors, Got %s", errs.String())
+	}
+}
+
+func TestPlanScaleSpread(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewBackend(newStubPlanner())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs bytes.Buffer
+	results := p.Scale("router", 3, backend.ScaleOptions{Spread: true}, &bytes.Buffer{}, &errs)
+	if len(backend.Failed(results)) == 0 || len(p.Operations()) != 0 {
+		t.Errorf("Expected spreading 3 routers across 2 machines to fail, Got %v", operations(p))
+	}
+	if !strings.Contains(errs.String(), "cannot spread 3 instances of router across 2 machines") {
+		t.Errorf("Expected an error about spreading, Got %q", errs.String())
+	}
+}
+
+func TestPlanScaleMetadata(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewBackend(newStubPlanner())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs bytes.Buffer
+	p.Scale("router", 3, backend.ScaleOptions{MachineMetadata: []string{"controlPlane=true"}}, &bytes.Buffer{}, &errs)
+
+	expected := `set /deis/units/router/machineMetadata = controlPlane=true
+create deis-router@3.service on 10.0.0.1
+start deis-router@3.service on 10.0.0.1`
+	if actual := operations(p); actual != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+	}
+	if errs.Len() != 0 {
+		t.Errorf("Expected no errors, Got %s", errs.String())
+	}
+}
+
+func TestPlanInstallAndStart(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewBackend(newStubPlanner())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs bytes.Buffer
+	p.Create([]string{"builder", "controller", "router@1"}, &bytes.Buffer{}, &errs)
+	p.Start([]string{"builder", "controller", "router@*"}, &bytes.Buffer{}, &errs)
+	p.Start([]string{"registry@1"}, &bytes.Buffer{}, &errs)
+
+	// installed units are not created again, nor active ones started
+	expected := `create deis-controller.service on 10.0.0.1
+start deis-builder.service on 10.0.0.1
+start deis-controller.service on 10.0.0.1`
+	if actual := operations(p); actual != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+	}
+	if !strings.Contains(errs.String(), "cannot start deis-registry@1.service, it is not installed") {
+		t.Errorf("Expected starting a missing unit to fail, Got %q", errs.String())
+	}
+
+	var out bytes.Buffer
+	p.Print(&out)
+	if !strings.Contains(out.String(), "\n--- deis-controller.service\n[Unit]\nDescription=controller\n") {
+		t.Errorf("Expected the unit file of the controller in:\n%s", out.String())
+	}
+}
+
+func TestPlanRollingRestart(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewBackend(newStubPlanner())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := backend.RollingRestartOptions{BatchSize: 2}
+	p.RollingRestart("router", opts, &bytes.Buffer{}, &bytes.Buffer{})
+
+	expected := `stop deis-router@1.service on 10.0.0.1
+stop deis-router@2.service on 10.0.0.2
+destroy deis-router@1.service on 10.0.0.1
+destroy deis-router@2.service on 10.0.0.2
+delete /deis/router/hosts/10.0.0.1
+delete /deis/router/hosts/10.0.0.2
+create deis-router@1.service on any machine
+create deis-router@2.service on any machine
+start deis-router@1.service on any machine
+start deis-router@2.service on any machine
+wait for deis-router@1.service to become healthy
+wait for deis-router@2.service to become healthy`
+	if actual := operations(p); actual != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+	}
+}
+
+func TestPlanWithoutPlanner(t *testing.T) {
+	t.Parallel()
+
+	// without knowing the installed units, operations are recorded as requested
+	p, err := NewBackend(&stubBackend{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Create([]string{"router@1"}, &bytes.Buffer{}, &bytes.Buffer{})
+	p.Start([]string{"router@1"}, &bytes.Buffer{}, &bytes.Buffer{})
+	p.Destroy([]string{"deis-builder.service"}, &bytes.Buffer{}, &bytes.Buffer{})
+
+	expected := `create deis-router@1.service
+start deis-router@1.service
+destroy deis-builder.service`
+	if actual := operations(p); actual != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+	}
+	if err := p.SSH("router@1"); err != errDryRun {
+		t.Errorf("Expected SSH to be unavailable, Got %v", err)
+	}
+}
+
+func TestPlanConfig(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewBackend(newStubPlanner())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := mock.ConfigBackend{Expected: []*model.ConfigNode{{Key: "/deis/platform/domain", Value: "example.com"}}}
+	cb := NewConfigBackend(store, p)
+
+	cb.SetWithTTL("/deis/services/app", "10.0.0.1:5000", 1800)
+	cb.Delete("/deis/platform/domain")
+
+	if v, _ := cb.Get("/deis/services/app"); v != "10.0.0.1:5000" {
+		t.Errorf("Expected a planned key to be set, Got %q", v)
+	}
+	if v, _ := cb.GetWithDefault("/deis/platform/domain", "none"); v != "none" {
+		t.Errorf("Expected a planned key to be deleted, Got %q", v)
+	}
+	if v, _ := store.Get("/deis/platform/domain"); v != "example.com" {
+		t.Errorf("Expected the store to be unchanged, Got %q", v)
+	}
+
+	expected := "set /deis/services/app = 10.0.0.1:5000 (ttl 1800s)\ndelete /deis/platform/domain"
+	if actual := operations(p); actual != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, actual)
+	}
+}
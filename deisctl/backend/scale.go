@@ -0,0 +1,194 @@
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ScaleOptions control where the instances of a scaled component run.
+type ScaleOptions struct {
+	// Spread checks that every instance can run on a machine of its own.
+	// The units of instanced components conflict with each other, so their
+	// instances never share a machine anyway, but without enough machines
+	// the extra ones stay unscheduled.
+	Spread bool
+	// MachineMetadata are key=value pairs the machines of new instances must
+	// have, in addition to those their unit requires. Scaling up saves them
+	// under PlacementKey, so every unit of the component rendered later has
+	// them. When scaling down, instances on machines without them are
+	// removed first.
+	MachineMetadata []string
+}
+
+// PlacementKey is the config key of the machineMetadata parameter of the
+// unit of a component, which scaling up with machine metadata sets.
+func PlacementKey(component string) string {
+	return "/deis/units/" + component + "/machineMetadata"
+}
+
+// PlacementMetadata returns the machine metadata of the unit of a component
+// scaled up with opts: that it requires, with the pairs of opts added or
+// replacing those of the same key. It is nil if opts add nothing.
+func PlacementMetadata(required []string, opts ScaleOptions) []string {
+	merged := append([]string(nil), required...)
+	changed := false
+	for _, kv := range opts.MachineMetadata {
+		key := strings.SplitN(kv, "=", 2)[0] + "="
+		found := false
+		for i, r := range merged {
+			if strings.HasPrefix(r, key) {
+				found = true
+				if r != kv {
+					merged[i], changed = kv, true
+				}
+			}
+		}
+		if !found {
+			merged, changed = append(merged, kv), true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return merged
+}
+
+// Instances returns the states of the installed instances of a component,
+// such as deis-router@1.service.
+func Instances(component string, states []UnitState) []UnitState {
+	var instances []UnitState
+	for _, s := range states {
+		if _, ok := instanceNum(component, s.Name); ok {
+			instances = append(instances, s)
+		}
+	}
+	return instances
+}
+
+// NewInstances returns the targets of n new instances of a component, such
+// as router@3, numbered with the lowest numbers the installed instances do
+// not use.
+func NewInstances(component string, installed []UnitState, n int) []string {
+	used := map[int]bool{}
+	for _, s := range installed {
+		if num, ok := instanceNum(component, s.Name); ok {
+			used[num] = true
+		}
+	}
+	var targets []string
+	for num := 1; len(targets) < n; num++ {
+		if !used[num] {
+			targets = append(targets, component+"@"+strconv.Itoa(num))
+		}
+	}
+	return targets
+}
+
+// PickScaleDown returns the targets of the n instances of a component to
+// remove. Instances that are not running go first, then those on machines
+// without the requested metadata, then those sharing a machine with a lower
+// numbered instance, and then the highest numbered.
+func PickScaleDown(component string, instances []UnitState, machines []Machine, n int, opts ScaleOptions) []string {
+	byID := make(map[string]Machine, len(machines))
+	for _, m := range machines {
+		byID[m.ID] = m
+	}
+
+	var candidates []scaleDownCandidate
+	for _, s := range instances {
+		num, ok := instanceNum(component, s.Name)
+		if !ok {
+			continue
+		}
+		c := scaleDownCandidate{num: num, machine: s.Machine}
+		m, scheduled := byID[s.Machine]
+		switch {
+		case !scheduled || s.ActiveState != "active":
+			c.rank = 0
+		case !m.Satisfies(opts.MachineMetadata):
+			c.rank = 1
+		default:
+			c.rank = 3
+		}
+		candidates = append(candidates, c)
+	}
+	// of the running instances on a machine, the lowest numbered one stays
+	sort.Sort(byNum(candidates))
+	kept := map[string]bool{}
+	for i, c := range candidates {
+		if c.rank != 3 {
+			continue
+		}
+		if kept[c.machine] {
+			candidates[i].rank = 2
+		}
+		kept[c.machine] = true
+	}
+	sort.Stable(byScaleDown(candidates))
+
+	var targets []string
+	for i := 0; i < n && i < len(candidates); i++ {
+		targets = append(targets, component+"@"+strconv.Itoa(candidates[i].num))
+	}
+	return targets
+}
+
+// scaleDownCandidate is an instance PickScaleDown may remove. Instances of
+// a lower rank are removed first.
+type scaleDownCandidate struct {
+	num     int
+	machine string
+	rank    int
+}
+
+type byNum []scaleDownCandidate
+
+func (s byNum) Len() int           { return len(s) }
+func (s byNum) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byNum) Less(i, j int) bool { return s[i].num < s[j].num }
+
+type byScaleDown []scaleDownCandidate
+
+func (s byScaleDown) Len() int      { return len(s) }
+func (s byScaleDown) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byScaleDown) Less(i, j int) bool {
+	if s[i].rank != s[j].rank {
+		return s[i].rank < s[j].rank
+	}
+	return s[i].num > s[j].num
+}
+
+// CheckPlacement returns an error if requested instances of a component
+// whose unit requires metadata cannot be placed as opts ask.
+func CheckPlacement(component string, requested int, metadata []string, machines []Machine, opts ScaleOptions) error {
+	required := PlacementMetadata(metadata, opts)
+	if required == nil {
+		required = metadata
+	}
+	eligible := 0
+	for _, m := range machines {
+		if m.Satisfies(required) {
+			eligible++
+		}
+	}
+	switch {
+	case eligible == 0 && len(required) > 0:
+		return fmt.Errorf("no machine has the metadata %s that %s requires", strings.Join(required, ","), component)
+	case opts.Spread && requested > eligible:
+		return fmt.Errorf("cannot spread %d instances of %s across %d machines", requested, component, eligible)
+	}
+	return nil
+}
+
+// instanceNum returns the number of an instance of a component, given the
+// name of its unit.
+func instanceNum(component, name string) (int, bool) {
+	prefix := "deis-" + component + "@"
+	if !strings.HasPrefix(name, prefix) {
+		return 0, false
+	}
+	num, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".service"))
+	return num, err == nil
+}
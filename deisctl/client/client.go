@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/backend/docker"
 	"github.com/deis/deis/deisctl/backend/fleet"
 	"github.com/deis/deis/deisctl/cmd"
 	"github.com/deis/deis/deisctl/config"
@@ -19,6 +22,8 @@ import (
 // DeisCtlClient manages Deis components, configuration, and related tasks.
 type DeisCtlClient interface {
 	Config(argv []string) error
+	Diff(argv []string) error
+	Doctor(argv []string) error
 	Install(argv []string) error
 	Journal(argv []string) error
 	List(argv []string) error
@@ -31,6 +36,7 @@ type DeisCtlClient interface {
 	Status(argv []string) error
 	Stop(argv []string) error
 	Uninstall(argv []string) error
+	Upgrade(argv []string) error
 	UpgradePrep(argv []string) error
 	UpgradeTakeover(argv []string) error
 	RollingRestart(argv []string) error
@@ -43,7 +49,8 @@ type Client struct {
 }
 
 // NewClient returns a Client using the requested backend.
-// The only backend currently supported is "fleet".
+// The backends supported are "fleet", the default, and "docker", which runs
+// the platform on this host.
 func NewClient(requestedBackend string) (*Client, error) {
 	var backend backend.Backend
 
@@ -63,6 +70,12 @@ func NewClient(requestedBackend string) (*Client, error) {
 			return nil, err
 		}
 		backend = b
+	case "docker":
+		b, err := docker.NewClient(cb)
+		if err != nil {
+			return nil, err
+		}
+		backend = b
 	default:
 		return nil, errors.New("invalid backend")
 	}
@@ -70,15 +83,70 @@ func NewClient(requestedBackend string) (*Client, error) {
 	return &Client{Backend: backend, configBackend: cb}, nil
 }
 
+// run runs a command with the client's backends, or plans it with --dry-run.
+func (c *Client) run(args map[string]interface{}, command func(backend.Backend, config.Backend) error) error {
+	if args["--dry-run"] == true {
+		return cmd.DryRun(c.Backend, c.configBackend, command)
+	}
+	return command(c.Backend, c.configBackend)
+}
+
+// Upgrade upgrades a running cluster to a release, rolling back if it fails
+func (c *Client) Upgrade(argv []string) error {
+	usage := fmt.Sprintf(`Upgrades the platform to a release in one go.
+
+The unit files and configuration are saved to a snapshot directory, the unit
+files of the release are downloaded as with refresh-units, and the platform is
+replaced as with upgrade-prep and upgrade-takeover. After each phase, the
+platform must become healthy: the components running, and none of the checks
+of "deisctl doctor" critical, except that published addresses are not
+connected to. If a phase fails, the saved unit files,
+configuration and platform version are restored and the platform is taken
+over again with them.
+
+Usage:
+  deisctl upgrade --to=<version> [options]
+
+Options:
+  --to=<version>            Release to upgrade to, such as v1.12.2.
+  --stateless               Use when the target platform is stateless.
+  -p --path=<target>        Where to save the unit files of the release [default: $HOME/.deis/units].
+  --snapshot=<dir>          Where to save the unit files and configuration before the upgrade
+                            [default: $HOME/.deis/upgrades/%s].
+  --passphrase-file=<path>  Encrypt the secrets of the saved configuration with this passphrase.
+  --timeout=<duration>      How long the platform has to become healthy after each phase [default: 10m].
+`, time.Now().Format("20060102-150405"))
+	args, err := docopt.Parse(usage, argv, true, "", false)
+	if err != nil {
+		return err
+	}
+
+	timeout, err := time.ParseDuration(args["--timeout"].(string))
+	if err != nil {
+		return fmt.Errorf("invalid --timeout: %v", err)
+	}
+	passphraseFile, _ := args["--passphrase-file"].(string)
+	opts := cmd.UpgradeOptions{
+		Version:        args["--to"].(string),
+		Stateless:      args["--stateless"] == true,
+		UnitDir:        args["--path"].(string),
+		SnapshotDir:    args["--snapshot"].(string),
+		PassphraseFile: passphraseFile,
+		HealthTimeout:  timeout,
+	}
+	return cmd.Upgrade(opts, units.URL, c.Backend, c.configBackend)
+}
+
 // UpgradePrep prepares a running cluster to be upgraded
 func (c *Client) UpgradePrep(argv []string) error {
 	usage := `Prepare platform for graceful upgrade.
 
 Usage:
-  deisctl upgrade-prep [--stateless]
+  deisctl upgrade-prep [--stateless] [--dry-run]
 
 Options:
   --stateless  Use when the target platform is stateless
+  --dry-run    Print the operations of the upgrade preparation instead of performing them
 `
 	args, err := docopt.Parse(usage, argv, true, "", false)
 	if err != nil {
@@ -87,7 +155,9 @@ Options:
 
 	stateless, _ := args["--stateless"].(bool)
 
-	return cmd.UpgradePrep(stateless, c.Backend)
+	return c.run(args, func(b backend.Backend, cb config.Backend) error {
+		return cmd.UpgradePrep(stateless, b)
+	})
 }
 
 // UpgradeTakeover gracefully restarts a cluster prepared with upgrade-prep
@@ -95,10 +165,11 @@ func (c *Client) UpgradeTakeover(argv []string) error {
 	usage := `Complete the upgrade of a prepped cluster.
 
 Usage:
-  deisctl upgrade-takeover [--stateless]
+  deisctl upgrade-takeover [--stateless] [--dry-run]
 
 Options:
   --stateless  Use when the target platform is stateless
+  --dry-run    Print the operations of the takeover instead of performing them
 `
 	args, err := docopt.Parse(usage, argv, true, "", false)
 	if err != nil {
@@ -107,22 +178,44 @@ Options:
 
 	stateless, _ := args["--stateless"].(bool)
 
-	return cmd.UpgradeTakeover(stateless, c.Backend, c.configBackend)
+	return c.run(args, func(b backend.Backend, cb config.Backend) error {
+		return cmd.UpgradeTakeover(stateless, b, cb)
+	})
 }
 
-// RollingRestart attempts a rolling restart of an instance unit
+// RollingRestart restarts the instances of a component in a rolling manner.
 func (c *Client) RollingRestart(argv []string) error {
-	usage := `Perform a rolling restart of an instance unit.
+	usage := fmt.Sprintf(`Restarts the instances of a component, such as router, registry or
+store-gateway, a batch at a time.
+
+Each batch must become healthy before the next one restarts: its units active,
+and the etcd key each instance publishes itself in refreshed.
 
 Usage:
-  deisctl rolling-restart <target>
-`
+  deisctl rolling-restart <target> [options]
+
+Options:
+  --batch-size=<num>    Number of instances to restart at once [default: 1].
+  --timeout=<duration>  How long a batch has to become healthy [default: %v].
+  --abort-on-failure    Leave the remaining instances untouched if a batch is unhealthy.
+`, cmd.DefaultHealthTimeout)
 	args, err := docopt.Parse(usage, argv, true, "", false)
 	if err != nil {
 		return err
 	}
 
-	return cmd.RollingRestart(args["<target>"].(string), c.Backend)
+	batchSize, err := strconv.Atoi(args["--batch-size"].(string))
+	if err != nil || batchSize < 1 {
+		return fmt.Errorf("invalid --batch-size %v, make sure the value is a positive integer", args["--batch-size"])
+	}
+	timeout, err := time.ParseDuration(args["--timeout"].(string))
+	if err != nil {
+		return fmt.Errorf("invalid --timeout: %v", err)
+	}
+	abort, _ := args["--abort-on-failure"].(bool)
+
+	opts := backend.RollingRestartOptions{BatchSize: batchSize, HealthTimeout: timeout, AbortOnFailure: abort}
+	return cmd.RollingRestart(args["<target>"].(string), opts, c.Backend)
 }
 
 // Config gets or sets a configuration value from the cluster.
@@ -141,16 +234,36 @@ enabling TLS for the routers.
 Note: "deisctl config platform set sshPrivateKey=" expects a path
 to a private key.
 
+Values of known keys are checked before they are set, and setting an
+unknown key prints a warning. "deisctl config <target> list" shows the
+known keys of a component, their values or defaults, and what they do.
+
+"deisctl config export" writes the whole configuration under /deis to a
+file, leaving out what components publish while they run, such as
+/deis/services. "deisctl config import" restores it, after printing the keys
+it sets. Given a file holding a passphrase, secrets such as sshPrivateKey
+and sslKey are exported encrypted, and decrypted on import.
+
 Usage:
+  deisctl config export <file> [--passphrase-file=<path>]
+  deisctl config import <file> [--passphrase-file=<path>] [--dry-run]
   deisctl config <target> get [<key>...]
   deisctl config <target> set <key=val>...
   deisctl config <target> rm [<key>...]
+  deisctl config <target> list
 
 Examples:
   deisctl config platform set domain=mydomain.com
   deisctl config platform set sshPrivateKey=$HOME/.ssh/deis
   deisctl config controller get webEnabled
   deisctl config controller rm webEnabled
+  deisctl config router list
+  deisctl config export deis-config.json --passphrase-file=$HOME/.deis/passphrase
+  deisctl config import deis-config.json --passphrase-file=$HOME/.deis/passphrase --dry-run
+
+Options:
+  --passphrase-file=<path>  file holding the passphrase secrets are encrypted with
+  --dry-run                 print the keys import would set without setting them
 `
 	// parse command-line arguments
 	args, err := docopt.Parse(usage, argv, true, "", false)
@@ -158,6 +271,14 @@ Examples:
 		return err
 	}
 
+	passphraseFile, _ := args["--passphrase-file"].(string)
+	switch {
+	case args["export"] == true:
+		return cmd.ConfigExport(args["<file>"].(string), passphraseFile, c.configBackend)
+	case args["import"] == true:
+		return cmd.ConfigImport(args["<file>"].(string), passphraseFile, args["--dry-run"] == true, c.configBackend)
+	}
+
 	var action string
 	var key []string
 
@@ -168,6 +289,8 @@ Examples:
 	case args["rm"] == true:
 		action = "rm"
 		key = args["<key>"].([]string)
+	case args["list"] == true:
+		action = "list"
 	default:
 		action = "get"
 		key = args["<key>"].([]string)
@@ -193,6 +316,7 @@ Usage:
 
 Options:
   --router-mesh-size=<num>  Number of routers to be loaded when installing the platform [default: %d].
+  --dry-run                 Print the units that would be installed, without installing them.
 `, cmd.DefaultRouterMeshSize)
 	// parse command-line arguments
 	args, err := docopt.Parse(usage, argv, true, "", false)
@@ -208,15 +332,76 @@ Options:
 	}
 	cmd.RouterMeshSize = uint8(parsedValue)
 
-	return cmd.Install(args["<target>"].([]string), c.Backend, c.configBackend, cmd.CheckRequiredKeys)
+	return c.run(args, func(b backend.Backend, cb config.Backend) error {
+		return cmd.Install(args["<target>"].([]string), b, cb, cmd.CheckRequiredKeys)
+	})
+}
+
+// Diff compares the installed units with the unit files of the local templates.
+func (c *Client) Diff(argv []string) error {
+	usage := `Compares the installed units with the unit files rendered from the local
+templates and decorators, and prints the differences of the units that drifted,
+such as after refresh-units.
+
+A target is platform, stateless-platform, a component, or an instance such as
+router@1 or router@*. Without targets, every installed unit is compared.
+
+Usage:
+  deisctl diff [<target>...] [--recreate]
+
+Options:
+  --recreate  Destroy the drifted units and create them again from the local
+              templates, starting the ones that were running.
+`
+	// parse command-line arguments
+	args, err := docopt.Parse(usage, argv, true, "", false)
+	if err != nil {
+		return err
+	}
+
+	return cmd.Diff(args["<target>"].([]string), args["--recreate"] == true, c.Backend)
+}
+
+// Doctor checks the health of the cluster and reports the problems it finds.
+func (c *Client) Doctor(argv []string) error {
+	usage := `Checks the health of the cluster: etcd and the required configuration,
+the metadata of machines and the states of units, the keys components publish
+in etcd, and whether the router, builder, controller and logger are reachable.
+
+Problems are reported most urgent first, with hints on how to fix them.
+
+Usage:
+  deisctl doctor [--json]
+
+Options:
+  --json  Print the findings as JSON, for scripts.
+`
+	// parse command-line arguments
+	args, err := docopt.Parse(usage, argv, true, "", false)
+	if err != nil {
+		return err
+	}
+
+	return cmd.Doctor(c.Backend, c.configBackend, args["--json"] == true)
 }
 
 // Journal prints log output for the specified components.
 func (c *Client) Journal(argv []string) error {
 	usage := `Prints log output for the specified components.
 
+The journals of all the target units are printed together, each entry prefixed
+with its unit, and streamed from their machines at the same time. Entries are
+merged in timestamp order where possible.
+
 Usage:
-  deisctl journal [<target>...]
+  deisctl journal <target>... [options]
+
+Options:
+  -f --follow       Keep printing entries as they are written.
+  --since=<time>    Print the entries from this time on, such as "2015-06-01 12:00:00"
+                    or "-1h" (an RFC 3339 timestamp with the docker backend).
+  -n --lines=<num>  Number of recent entries of each unit to print. Defaults to 40
+                    unless --since is given.
 `
 	// parse command-line arguments
 	args, err := docopt.Parse(usage, argv, true, "", false)
@@ -224,7 +409,17 @@ Usage:
 		return err
 	}
 
-	return cmd.Journal(args["<target>"].([]string), c.Backend)
+	opts := backend.JournalOptions{Follow: args["--follow"] == true, Lines: 40}
+	if since, ok := args["--since"].(string); ok {
+		opts.Since, opts.Lines = since, 0
+	}
+	if lines, ok := args["--lines"].(string); ok {
+		if opts.Lines, err = strconv.Atoi(lines); err != nil || opts.Lines < 1 {
+			return fmt.Errorf("invalid number of lines: %s", lines)
+		}
+	}
+
+	return cmd.Journal(args["<target>"].([]string), opts, c.Backend)
 }
 
 // List prints a summary of installed components.
@@ -267,6 +462,9 @@ currently supported.
 - $HOME/.deis/units
 - /var/lib/deis/units
 
+Parameters of units set with "deisctl config units set", such as
+router/memory=512m, are kept in etcd and apply to the refreshed unit files.
+
 Usage:
   deisctl refresh-units [-p <target>] [-t <tag>]
 
@@ -305,10 +503,24 @@ Usage:
 func (c *Client) Scale(argv []string) error {
 	usage := `Grows or shrinks the number of running components.
 
-Currently "router", "registry" and "store-gateway" are the only types that can be scaled.
+Components that run as numbered instances, such as router@1, registry@1 and
+store-gateway@1, can be scaled. New instances take the lowest free numbers.
+
+--metadata schedules new instances only on machines with the given metadata,
+in addition to what their unit file requires. It is saved as the
+machineMetadata unit parameter of the component, so units created later keep
+it. Instances never share a machine, and --spread checks that there are enough
+machines for all of them. When shrinking, instances that are not running are
+removed first, then those on machines without the --metadata, then those
+sharing a machine with another instance, and then the highest numbered.
 
 Usage:
-  deisctl scale [<target>...]
+  deisctl scale [<target>...] [--spread] [--metadata=<key=value>...] [--dry-run]
+
+Options:
+  --spread                  Check that every instance can have a machine of its own.
+  --metadata=<key=value>    Metadata the machines of new instances must have.
+  --dry-run                 Print the operations of scaling instead of performing them.
 `
 	// parse command-line arguments
 	args, err := docopt.Parse(usage, argv, true, "", false)
@@ -316,7 +528,16 @@ Usage:
 		return err
 	}
 
-	return cmd.Scale(args["<target>"].([]string), c.Backend)
+	opts := backend.ScaleOptions{Spread: args["--spread"] == true}
+	for _, kv := range args["--metadata"].([]string) {
+		if !strings.Contains(kv, "=") {
+			return fmt.Errorf("invalid --metadata %s, expected key=value", kv)
+		}
+		opts.MachineMetadata = append(opts.MachineMetadata, kv)
+	}
+	return c.run(args, func(b backend.Backend, cb config.Backend) error {
+		return cmd.Scale(args["<target>"].([]string), opts, b)
+	})
 }
 
 // SSH opens an interactive shell with a machine in the cluster.
@@ -434,7 +655,10 @@ func (c *Client) Uninstall(argv []string) error {
 After uninstall, the components will be unavailable until install is called.
 
 Usage:
-  deisctl uninstall [<target>...]
+  deisctl uninstall [<target>...] [--dry-run]
+
+Options:
+  --dry-run  Print the units that would be uninstalled, without uninstalling them.
 `
 	// parse command-line arguments
 	args, err := docopt.Parse(usage, argv, true, "", false)
@@ -442,5 +666,7 @@ Usage:
 		return err
 	}
 
-	return cmd.Uninstall(args["<target>"].([]string), c.Backend)
+	return c.run(args, func(b backend.Backend, cb config.Backend) error {
+		return cmd.Uninstall(args["<target>"].([]string), b)
+	})
 }
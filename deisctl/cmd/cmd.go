@@ -2,16 +2,20 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/backend/plan"
 	"github.com/deis/deis/deisctl/config"
 	"github.com/deis/deis/deisctl/units"
 	"github.com/deis/deis/deisctl/utils"
@@ -51,27 +55,96 @@ var Stdout io.Writer = os.Stdout
 // Location to write standard error information. By default, this is the os.Stderr.
 var Stderr io.Writer = os.Stderr
 
+// Formats the results of operations on units are reported in.
+const (
+	// TextOutput prints progress as it happens, then the operations that failed.
+	TextOutput = "text"
+	// TableOutput prints progress, then a table of all operations.
+	TableOutput = "table"
+	// JSONOutput prints the operations as JSON, and progress to standard error.
+	JSONOutput = "json"
+)
+
+// Output is the format results are reported in. By default, it's TextOutput.
+var Output = TextOutput
+
+// Location to write results as JSON, while Stdout is moved to Stderr.
+var resultsOut io.Writer
+
+// SetOutputFormat sets the format results are reported in.
+func SetOutputFormat(format string) error {
+	switch format {
+	case TextOutput, TableOutput, JSONOutput:
+	default:
+		return fmt.Errorf("unknown output format %s, use text, table or json", format)
+	}
+	if Output == JSONOutput {
+		Stdout = resultsOut
+	}
+	if format == JSONOutput {
+		resultsOut, Stdout = Stdout, Stderr
+	}
+	Output = format
+	return nil
+}
+
+// report prints the results of operations on units in the Output format,
+// and returns an error if any of them failed.
+func report(results []backend.Result) error {
+	failed := backend.Failed(results)
+	switch Output {
+	case JSONOutput:
+		if results == nil {
+			results = []backend.Result{}
+		}
+		if err := json.NewEncoder(resultsOut).Encode(results); err != nil {
+			return err
+		}
+	case TableOutput:
+		printResults(Stdout, results)
+	default:
+		if len(failed) > 0 {
+			printResults(Stdout, failed)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d operations failed", len(failed), len(results))
+	}
+	return nil
+}
+
+// printResults prints results as a table.
+func printResults(out io.Writer, results []backend.Result) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "UNIT\tACTION\tSTATE\tDURATION\tERROR")
+	for _, r := range results {
+		msg := ""
+		if r.Err != nil {
+			msg = r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.1fs\t%s\n", r.Unit, r.Action, r.State, r.Duration.Seconds(), msg)
+	}
+	w.Flush()
+}
+
 // Number of routers to be installed. By default, it's DefaultRouterMeshSize.
 var RouterMeshSize = DefaultRouterMeshSize
 
 // Scale grows or shrinks the number of running components.
-// Currently "router", "registry" and "store-gateway" are the only types that can be scaled.
-func Scale(targets []string, b backend.Backend) error {
-	var wg sync.WaitGroup
-
+// Components that run as numbered instances, such as router@1, can be scaled.
+func Scale(targets []string, opts backend.ScaleOptions, b backend.Backend) error {
+	var results []backend.Result
 	for _, target := range targets {
 		component, num, err := splitScaleTarget(target)
 		if err != nil {
 			return err
 		}
-		// the router, registry, and store-gateway are the only component that can scale at the moment
-		if !strings.Contains(component, "router") && !strings.Contains(component, "registry") && !strings.Contains(component, "store-gateway") {
+		if !units.Components[component].Instances {
 			return fmt.Errorf("cannot scale %s component", component)
 		}
-		b.Scale(component, num, &wg, Stdout, Stderr)
-		wg.Wait()
+		results = append(results, b.Scale(component, num, opts, Stdout, Stderr)...)
 	}
-	return nil
+	return report(results)
 }
 
 // Start activates the specified components.
@@ -92,21 +165,35 @@ func Start(targets []string, b backend.Backend) error {
 			return StartK8s(b)
 		}
 	}
-	var wg sync.WaitGroup
-
-	b.Start(targets, &wg, Stdout, Stderr)
-	wg.Wait()
 
-	return nil
+	return report(b.Start(targets, Stdout, Stderr))
 }
 
-// RollingRestart restart instance unit in a rolling manner
-func RollingRestart(target string, b backend.Backend) error {
-	var wg sync.WaitGroup
+// DefaultHealthTimeout is how long a rolling restart waits for restarted
+// instances to become healthy.
+const DefaultHealthTimeout = 5 * time.Minute
 
-	b.RollingRestart(target, &wg, Stdout, Stderr)
-	wg.Wait()
+// RollingRestart restarts the instances of a component in a rolling manner.
+func RollingRestart(target string, opts backend.RollingRestartOptions, b backend.Backend) error {
+	return report(b.RollingRestart(target, opts, Stdout, Stderr))
+}
 
+// DryRun runs a command against a backend that records its operations
+// instead of performing them, then prints them as a plan. Its progress
+// messages are not printed, since nothing happens.
+func DryRun(b backend.Backend, cb config.Backend, run func(backend.Backend, config.Backend) error) error {
+	p, err := plan.NewBackend(b)
+	if err != nil {
+		return err
+	}
+	out := Stdout
+	Stdout = ioutil.Discard
+	err = run(p, plan.NewConfigBackend(cb, p))
+	Stdout = out
+	if err != nil {
+		return err
+	}
+	p.Print(Stdout)
 	return nil
 }
 
@@ -125,66 +212,6 @@ deisctl config platform set sshPrivateKey=<path-to-key>
 	return nil
 }
 
-func startDefaultServices(b backend.Backend, stateless bool, wg *sync.WaitGroup, out, err io.Writer) {
-
-	// Wait for groups to come up.
-	// If we're running in stateless mode, we start only a subset of services.
-	if !stateless {
-		fmt.Fprintln(out, "Storage subsystem...")
-		b.Start([]string{"store-monitor"}, wg, out, err)
-		wg.Wait()
-		b.Start([]string{"store-daemon"}, wg, out, err)
-		wg.Wait()
-		b.Start([]string{"store-metadata"}, wg, out, err)
-		wg.Wait()
-
-		// we start gateway first to give metadata time to come up for volume
-		b.Start([]string{"store-gateway@*"}, wg, out, err)
-		wg.Wait()
-		b.Start([]string{"store-volume"}, wg, out, err)
-		wg.Wait()
-	}
-
-	// start logging subsystem first to collect logs from other components
-	fmt.Fprintln(out, "Logging subsystem...")
-	b.Start([]string{"logger"}, wg, out, err)
-	wg.Wait()
-	b.Start([]string{"logspout"}, wg, out, err)
-	wg.Wait()
-
-	// Start these in parallel. This section can probably be removed now.
-	var bgwg sync.WaitGroup
-	var trash bytes.Buffer
-	batch := []string{
-		"database", "registry@*", "controller", "builder",
-		"publisher", "router@*",
-	}
-	if stateless {
-		batch = []string{"registry@*", "controller", "builder", "publisher", "router@*"}
-	}
-	b.Start(batch, &bgwg, &trash, &trash)
-	// End background stuff.
-
-	fmt.Fprintln(Stdout, "Control plane...")
-	batch = []string{"database", "registry@*", "controller"}
-	if stateless {
-		batch = []string{"registry@*", "controller"}
-	}
-	b.Start(batch, wg, out, err)
-	wg.Wait()
-
-	b.Start([]string{"builder"}, wg, out, err)
-	wg.Wait()
-
-	fmt.Fprintln(out, "Data plane...")
-	b.Start([]string{"publisher"}, wg, out, err)
-	wg.Wait()
-
-	fmt.Fprintln(out, "Router mesh...")
-	b.Start([]string{"router@*"}, wg, out, err)
-	wg.Wait()
-}
-
 // Stop deactivates the specified components.
 func Stop(targets []string, b backend.Backend) error {
 
@@ -204,52 +231,7 @@ func Stop(targets []string, b backend.Backend) error {
 		}
 	}
 
-	var wg sync.WaitGroup
-
-	b.Stop(targets, &wg, Stdout, Stderr)
-	wg.Wait()
-
-	return nil
-}
-
-func stopDefaultServices(b backend.Backend, stateless bool, wg *sync.WaitGroup, out, err io.Writer) {
-
-	fmt.Fprintln(out, "Router mesh...")
-	b.Stop([]string{"router@*"}, wg, out, err)
-	wg.Wait()
-
-	fmt.Fprintln(out, "Data plane...")
-	b.Stop([]string{"publisher"}, wg, out, err)
-	wg.Wait()
-
-	fmt.Fprintln(out, "Control plane...")
-	if stateless {
-		b.Stop([]string{"controller", "builder", "registry@*"}, wg, out, err)
-	} else {
-		b.Stop([]string{"controller", "builder", "database", "registry@*"}, wg, out, err)
-	}
-	wg.Wait()
-
-	fmt.Fprintln(out, "Logging subsystem...")
-	if stateless {
-		b.Stop([]string{"logspout"}, wg, out, err)
-	} else {
-		b.Stop([]string{"logger", "logspout"}, wg, out, err)
-	}
-	wg.Wait()
-
-	if !stateless {
-		fmt.Fprintln(out, "Storage subsystem...")
-		b.Stop([]string{"store-volume", "store-gateway@*"}, wg, out, err)
-		wg.Wait()
-		b.Stop([]string{"store-metadata"}, wg, out, err)
-		wg.Wait()
-		b.Stop([]string{"store-daemon"}, wg, out, err)
-		wg.Wait()
-		b.Stop([]string{"store-monitor"}, wg, out, err)
-		wg.Wait()
-	}
-
+	return report(b.Stop(targets, Stdout, Stderr))
 }
 
 // Restart stops and then starts the specified components.
@@ -274,15 +256,14 @@ func Status(targets []string, b backend.Backend) error {
 	return nil
 }
 
-// Journal prints log output for the specified components.
-func Journal(targets []string, b backend.Backend) error {
-
-	for _, target := range targets {
-		if err := b.Journal(target); err != nil {
-			return err
-		}
+// Journal prints log output for the specified components, merged into one
+// stream. A target such as router@* selects every instance of a component.
+func Journal(targets []string, opts backend.JournalOptions, b backend.Backend) error {
+	trimmed := make([]string, len(targets))
+	for i, target := range targets {
+		trimmed[i] = strings.TrimSuffix(target, "*")
 	}
-	return nil
+	return b.Journal(trimmed, opts, Stdout, Stderr)
 }
 
 // Install loads the definitions of components from local unit files.
@@ -304,43 +285,9 @@ func Install(targets []string, b backend.Backend, cb config.Backend, checkKeys f
 			return InstallK8s(b)
 		}
 	}
-	var wg sync.WaitGroup
 
 	// otherwise create the specific targets
-	b.Create(targets, &wg, Stdout, Stderr)
-	wg.Wait()
-
-	return nil
-}
-
-func installDefaultServices(b backend.Backend, stateless bool, wg *sync.WaitGroup, out, err io.Writer) {
-
-	if !stateless {
-		fmt.Fprintln(out, "Storage subsystem...")
-		b.Create([]string{"store-daemon", "store-monitor", "store-metadata", "store-volume", "store-gateway@1"}, wg, out, err)
-		wg.Wait()
-	}
-
-	fmt.Fprintln(out, "Logging subsystem...")
-	b.Create([]string{"logger", "logspout"}, wg, out, err)
-	wg.Wait()
-
-	fmt.Fprintln(out, "Control plane...")
-	if stateless {
-		b.Create([]string{"registry@1", "controller", "builder"}, wg, out, err)
-	} else {
-		b.Create([]string{"database", "registry@1", "controller", "builder"}, wg, out, err)
-	}
-	wg.Wait()
-
-	fmt.Fprintln(out, "Data plane...")
-	b.Create([]string{"publisher"}, wg, out, err)
-	wg.Wait()
-
-	fmt.Fprintln(out, "Router mesh...")
-	b.Create(getRouters(), wg, out, err)
-	wg.Wait()
-
+	return report(b.Create(targets, Stdout, Stderr))
 }
 
 func getRouters() []string {
@@ -369,54 +316,8 @@ func Uninstall(targets []string, b backend.Backend) error {
 		}
 	}
 
-	var wg sync.WaitGroup
-
 	// uninstall the specific target
-	b.Destroy(targets, &wg, Stdout, Stderr)
-	wg.Wait()
-
-	return nil
-}
-
-func uninstallAllServices(b backend.Backend, stateless bool, wg *sync.WaitGroup, out, err io.Writer) error {
-
-	fmt.Fprintln(out, "Router mesh...")
-	b.Destroy([]string{"router@*"}, wg, out, err)
-	wg.Wait()
-
-	fmt.Fprintln(out, "Data plane...")
-	b.Destroy([]string{"publisher"}, wg, out, err)
-	wg.Wait()
-
-	fmt.Fprintln(out, "Control plane...")
-	if stateless {
-		b.Destroy([]string{"controller", "builder", "registry@*"}, wg, out, err)
-	} else {
-		b.Destroy([]string{"controller", "builder", "database", "registry@*"}, wg, out, err)
-	}
-	wg.Wait()
-
-	fmt.Fprintln(out, "Logging subsystem...")
-	if stateless {
-		b.Destroy([]string{"logspout"}, wg, out, err)
-	} else {
-		b.Destroy([]string{"logger", "logspout"}, wg, out, err)
-	}
-	wg.Wait()
-
-	if !stateless {
-		fmt.Fprintln(out, "Storage subsystem...")
-		b.Destroy([]string{"store-volume", "store-gateway@*"}, wg, out, err)
-		wg.Wait()
-		b.Destroy([]string{"store-metadata"}, wg, out, err)
-		wg.Wait()
-		b.Destroy([]string{"store-daemon"}, wg, out, err)
-		wg.Wait()
-		b.Destroy([]string{"store-monitor"}, wg, out, err)
-		wg.Wait()
-	}
-
-	return nil
+	return report(b.Destroy(targets, Stdout, Stderr))
 }
 
 func splitScaleTarget(target string) (c string, num int, err error) {
@@ -446,6 +347,42 @@ func Config(target string, action string, key []string, cb config.Backend) error
 	return nil
 }
 
+// ConfigExport writes the platform configuration to a file, encrypting
+// secrets with the passphrase in passphraseFile, if given.
+func ConfigExport(path, passphraseFile string, cb config.Backend) error {
+	passphrase, err := readPassphrase(passphraseFile)
+	if err != nil {
+		return err
+	}
+	return config.Export(path, passphrase, cb, Stdout, Stderr)
+}
+
+// ConfigImport restores the platform configuration from a file written by
+// ConfigExport. With dryRun, it only prints the keys it would set.
+func ConfigImport(path, passphraseFile string, dryRun bool, cb config.Backend) error {
+	passphrase, err := readPassphrase(passphraseFile)
+	if err != nil {
+		return err
+	}
+	return config.Import(path, passphrase, dryRun, cb, Stdout)
+}
+
+// readPassphrase reads a passphrase from a file, without the trailing newline.
+func readPassphrase(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(utils.ResolvePath(path))
+	if err != nil {
+		return nil, err
+	}
+	passphrase := bytes.TrimRight(data, "\r\n")
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+	return passphrase, nil
+}
+
 // RefreshUnits overwrites local unit files with those requested.
 // Downloading from the Deis project GitHub URL by tag or SHA is the only mechanism
 // currently supported.
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -9,7 +11,6 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"strings"
-	"sync"
 	"testing"
 
 	"github.com/deis/deis/deisctl/backend"
@@ -25,33 +26,49 @@ type backendStub struct {
 	installedUnits   []string
 	uninstalledUnits []string
 	restartedUnits   []string
+	journaledUnits   []string
 	expected         bool
 }
 
-func (backend *backendStub) Create(targets []string, wg *sync.WaitGroup, out, ew io.Writer) {
-	backend.installedUnits = append(backend.installedUnits, targets...)
+// stubResults are the results of an operation on targets that succeeded.
+func stubResults(action string, targets []string) []backend.Result {
+	var results []backend.Result
+	for _, target := range targets {
+		results = append(results, backend.Result{Unit: target, Action: action, State: "done"})
+	}
+	return results
+}
+
+func (b *backendStub) Create(targets []string, out, ew io.Writer) []backend.Result {
+	b.installedUnits = append(b.installedUnits, targets...)
+	return stubResults("create", targets)
 }
-func (backend *backendStub) Destroy(targets []string, wg *sync.WaitGroup, out, ew io.Writer) {
-	backend.uninstalledUnits = append(backend.uninstalledUnits, targets...)
+func (b *backendStub) Destroy(targets []string, out, ew io.Writer) []backend.Result {
+	b.uninstalledUnits = append(b.uninstalledUnits, targets...)
+	return stubResults("destroy", targets)
 }
-func (backend *backendStub) Start(targets []string, wg *sync.WaitGroup, out, ew io.Writer) {
-	backend.startedUnits = append(backend.startedUnits, targets...)
+func (b *backendStub) Start(targets []string, out, ew io.Writer) []backend.Result {
+	b.startedUnits = append(b.startedUnits, targets...)
+	return stubResults("start", targets)
 }
-func (backend *backendStub) Stop(targets []string, wg *sync.WaitGroup, out, ew io.Writer) {
-	backend.stoppedUnits = append(backend.stoppedUnits, targets...)
+func (b *backendStub) Stop(targets []string, out, ew io.Writer) []backend.Result {
+	b.stoppedUnits = append(b.stoppedUnits, targets...)
+	return stubResults("stop", targets)
 }
-func (backend *backendStub) Scale(component string, num int, wg *sync.WaitGroup, out, ew io.Writer) {
+func (b *backendStub) Scale(component string, num int, opts backend.ScaleOptions, out, ew io.Writer) []backend.Result {
 	switch {
 	case component == "router" && num == 3:
-		backend.expected = true
+		b.expected = true
 	case component == "registry" && num == 4:
-		backend.expected = true
+		b.expected = true
 	default:
-		backend.expected = false
+		b.expected = false
 	}
+	return nil
 }
-func (backend *backendStub) RollingRestart(target string, wg *sync.WaitGroup, out, ew io.Writer) {
-	backend.restartedUnits = append(backend.restartedUnits, target)
+func (b *backendStub) RollingRestart(target string, opts backend.RollingRestartOptions, out, ew io.Writer) []backend.Result {
+	b.restartedUnits = append(b.restartedUnits, target)
+	return stubResults("restart", []string{target})
 }
 
 func (backend *backendStub) ListMachines() error {
@@ -70,11 +87,14 @@ func (backend *backendStub) Status(target string) error {
 	}
 	return errors.New("Test Error")
 }
-func (backend *backendStub) Journal(target string) error {
-	if target == "controller" || target == "builder" {
-		return nil
+func (b *backendStub) Journal(targets []string, opts backend.JournalOptions, out, ew io.Writer) error {
+	for _, target := range targets {
+		if target != "controller" && target != "builder" && target != "router@" {
+			return errors.New("Test Error")
+		}
 	}
-	return errors.New("Test Error")
+	b.journaledUnits = append(b.journaledUnits, targets...)
+	return nil
 }
 func (backend *backendStub) SSH(target string) error {
 	if target == "controller" {
@@ -202,7 +222,7 @@ func TestScaling(t *testing.T) {
 	b := backendStub{expected: false}
 	scale := []string{"registry=4", "router=3"}
 
-	Scale(scale, &b)
+	Scale(scale, backend.ScaleOptions{}, &b)
 
 	if b.expected == false {
 		t.Error("b.Scale called with unexpected arguements")
@@ -214,7 +234,7 @@ func TestScalingNonScalableComponent(t *testing.T) {
 
 	b := backendStub{}
 	expected := "cannot scale controller component"
-	err := Scale([]string{"controller=2"}, &b).Error()
+	err := Scale([]string{"controller=2"}, backend.ScaleOptions{}, &b).Error()
 
 	if err != expected {
 		t.Error(fmt.Errorf("Expected '%v', Got '%v'", expected, err))
@@ -226,7 +246,7 @@ func TestScalingInvalidFormat(t *testing.T) {
 
 	b := backendStub{}
 	expected := "Could not parse: controller2"
-	err := Scale([]string{"controller2"}, &b).Error()
+	err := Scale([]string{"controller2"}, backend.ScaleOptions{}, &b).Error()
 
 	if err != expected {
 		t.Error(fmt.Errorf("Expected '%v', Got '%v'", expected, err))
@@ -251,9 +271,8 @@ func TestStartPlatform(t *testing.T) {
 
 	b := backendStub{}
 	expected := []string{"store-monitor", "store-daemon", "store-metadata", "store-gateway@*",
-		"store-volume", "logger", "logspout", "database", "registry@*", "controller",
-		"builder", "publisher", "router@*", "database", "registry@*", "controller",
-		"builder", "publisher", "router@*"}
+		"store-volume", "logger", "logspout", "database", "registry@*", "publisher",
+		"controller", "builder", "router@*"}
 
 	Start([]string{"platform"}, &b)
 
@@ -266,9 +285,8 @@ func TestStartStatelessPlatform(t *testing.T) {
 	t.Parallel()
 
 	b := backendStub{}
-	expected := []string{"logger", "logspout", "registry@*", "controller",
-		"builder", "publisher", "router@*", "registry@*", "controller",
-		"builder", "publisher", "router@*"}
+	expected := []string{"logger", "logspout", "registry@*", "publisher", "controller",
+		"builder", "router@*"}
 
 	Start([]string{"stateless-platform"}, &b)
 
@@ -296,7 +314,7 @@ func TestRollingRestart(t *testing.T) {
 	b := backendStub{}
 	expected := []string{"router"}
 
-	RollingRestart("router", &b)
+	RollingRestart("router", backend.RollingRestartOptions{BatchSize: 1}, &b)
 
 	if !reflect.DeepEqual(b.restartedUnits, expected) {
 		t.Error(fmt.Errorf("Expected %v, Got %v", expected, b.restartedUnits))
@@ -307,7 +325,7 @@ func TestUpgradePrep(t *testing.T) {
 	t.Parallel()
 
 	b := backendStub{}
-	expected := []string{"database", "registry@*", "controller", "builder", "logger", "logspout", "store-volume",
+	expected := []string{"builder", "controller", "database", "registry@*", "logspout", "logger", "store-volume",
 		"store-gateway@*", "store-metadata", "store-daemon", "store-monitor"}
 
 	UpgradePrep(false, &b)
@@ -321,7 +339,7 @@ func TestStatelessUpgradePrep(t *testing.T) {
 	t.Parallel()
 
 	b := backendStub{}
-	expected := []string{"database", "registry@*", "controller", "builder", "logger", "logspout"}
+	expected := []string{"builder", "controller", "registry@*", "logspout", "logger"}
 
 	UpgradePrep(true, &b)
 
@@ -339,10 +357,9 @@ func TestUpgradeTakeover(t *testing.T) {
 	expectedRestarted := []string{"router"}
 	expectedStarted := []string{"publisher", "store-monitor", "store-daemon", "store-metadata",
 		"store-gateway@*", "store-volume", "logger", "logspout", "database", "registry@*",
-		"controller", "builder", "publisher", "database", "registry@*",
-		"controller", "builder", "publisher"}
+		"controller", "builder"}
 
-	if err := doUpgradeTakeOver(false, &b, testMock); err != nil {
+	if _, err := doUpgradeTakeOver(false, &b, testMock); err != nil {
 		t.Error(fmt.Errorf("Takeover failed: %v", err))
 	}
 
@@ -361,11 +378,10 @@ func TestStatelessUpgradeTakeover(t *testing.T) {
 
 	b := backendStub{}
 	expectedRestarted := []string{"router"}
-	expectedStarted := []string{"publisher", "logspout", "registry@*",
-		"controller", "builder", "publisher", "router@*", "registry@*",
-		"controller", "builder", "publisher"}
+	expectedStarted := []string{"publisher", "logger", "logspout", "registry@*",
+		"controller", "builder"}
 
-	if err := doUpgradeTakeOver(true, &b, testMock); err != nil {
+	if _, err := doUpgradeTakeOver(true, &b, testMock); err != nil {
 		t.Error(fmt.Errorf("Takeover failed: %v", err))
 	}
 
@@ -393,8 +409,8 @@ func TestStopPlatform(t *testing.T) {
 	t.Parallel()
 
 	b := backendStub{}
-	expected := []string{"router@*", "publisher", "controller", "builder", "database",
-		"registry@*", "logger", "logspout", "store-volume", "store-gateway@*",
+	expected := []string{"router@*", "builder", "controller", "database", "registry@*",
+		"publisher", "logspout", "logger", "store-volume", "store-gateway@*",
 		"store-metadata", "store-daemon", "store-monitor"}
 	Stop([]string{"platform"}, &b)
 
@@ -407,8 +423,8 @@ func TestStopStatelessPlatform(t *testing.T) {
 	t.Parallel()
 
 	b := backendStub{}
-	expected := []string{"router@*", "publisher", "controller", "builder",
-		"registry@*", "logspout"}
+	expected := []string{"router@*", "builder", "controller", "registry@*",
+		"publisher", "logspout", "logger"}
 	Stop([]string{"stateless-platform"}, &b)
 
 	if !reflect.DeepEqual(b.stoppedUnits, expected) {
@@ -504,9 +520,13 @@ func TestJournal(t *testing.T) {
 
 	b := backendStub{}
 
-	if Journal([]string{"controller", "builder"}, &b) != nil {
+	if Journal([]string{"controller", "router@*"}, backend.JournalOptions{}, &b) != nil {
 		t.Error("Unexpected Error")
 	}
+	expected := []string{"controller", "router@"}
+	if !reflect.DeepEqual(b.journaledUnits, expected) {
+		t.Errorf("Expected %v, Got %v", expected, b.journaledUnits)
+	}
 }
 
 func TestJournalError(t *testing.T) {
@@ -515,7 +535,7 @@ func TestJournalError(t *testing.T) {
 	b := backendStub{}
 
 	expected := "Test Error"
-	err := Journal([]string{"blah"}, &b).Error()
+	err := Journal([]string{"blah"}, backend.JournalOptions{}, &b).Error()
 
 	if err != expected {
 		t.Error(fmt.Errorf("Expected '%v', Got '%v'", expected, err))
@@ -543,9 +563,9 @@ func TestInstallPlatform(t *testing.T) {
 	b := backendStub{}
 	cb := mock.ConfigBackend{}
 
-	expected := []string{"store-daemon", "store-monitor", "store-metadata", "store-volume",
-		"store-gateway@1", "logger", "logspout", "database", "registry@1",
-		"controller", "builder", "publisher", "router@1", "router@2", "router@3"}
+	expected := []string{"store-monitor", "store-daemon", "store-metadata", "store-gateway@1",
+		"store-volume", "logger", "logspout", "database", "registry@1",
+		"publisher", "controller", "builder", "router@1", "router@2", "router@3"}
 
 	Install([]string{"platform"}, &b, &cb, fakeCheckKeys)
 
@@ -560,9 +580,9 @@ func TestInstallPlatformWithCustomRouterMeshSize(t *testing.T) {
 	b := backendStub{}
 	cb := mock.ConfigBackend{}
 
-	expected := []string{"store-daemon", "store-monitor", "store-metadata", "store-volume",
-		"store-gateway@1", "logger", "logspout", "database", "registry@1",
-		"controller", "builder", "publisher", "router@1", "router@2", "router@3", "router@4", "router@5"}
+	expected := []string{"store-monitor", "store-daemon", "store-metadata", "store-gateway@1",
+		"store-volume", "logger", "logspout", "database", "registry@1",
+		"publisher", "controller", "builder", "router@1", "router@2", "router@3", "router@4", "router@5"}
 	RouterMeshSize = 5
 
 	Install([]string{"platform"}, &b, &cb, fakeCheckKeys)
@@ -580,7 +600,7 @@ func TestInstallStatelessPlatform(t *testing.T) {
 	cb := mock.ConfigBackend{}
 
 	expected := []string{"logger", "logspout", "registry@1",
-		"controller", "builder", "publisher", "router@1", "router@2", "router@3"}
+		"publisher", "controller", "builder", "router@1", "router@2", "router@3"}
 
 	Install([]string{"stateless-platform"}, &b, &cb, fakeCheckKeys)
 
@@ -621,8 +641,8 @@ func TestUninstallPlatform(t *testing.T) {
 	t.Parallel()
 
 	b := backendStub{}
-	expected := []string{"router@*", "publisher", "controller", "builder", "database",
-		"registry@*", "logger", "logspout", "store-volume", "store-gateway@*",
+	expected := []string{"router@*", "builder", "controller", "database", "registry@*",
+		"publisher", "logspout", "logger", "store-volume", "store-gateway@*",
 		"store-metadata", "store-daemon", "store-monitor"}
 
 	Uninstall([]string{"platform"}, &b)
@@ -636,8 +656,8 @@ func TestUninstallStatelessPlatform(t *testing.T) {
 	t.Parallel()
 
 	b := backendStub{}
-	expected := []string{"router@*", "publisher", "controller", "builder",
-		"registry@*", "logspout"}
+	expected := []string{"router@*", "builder", "controller", "registry@*",
+		"publisher", "logspout", "logger"}
 
 	Uninstall([]string{"stateless-platform"}, &b)
 
@@ -646,6 +666,121 @@ func TestUninstallStatelessPlatform(t *testing.T) {
 	}
 }
 
+func TestDryRun(t *testing.T) {
+	var out bytes.Buffer
+	stdout := Stdout
+	Stdout = &out
+	defer func() { Stdout = stdout }()
+
+	b := backendStub{}
+	err := DryRun(&b, mock.ConfigBackend{}, func(b backend.Backend, cb config.Backend) error {
+		return Uninstall([]string{"stateless-platform"}, b)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.uninstalledUnits) != 0 {
+		t.Errorf("Expected nothing to be uninstalled, Got %v", b.uninstalledUnits)
+	}
+	expected := `Dry run, nothing was changed. Planned operations:
+  1. destroy deis-router@*.service
+  2. destroy deis-builder.service
+  3. destroy deis-controller.service
+  4. destroy deis-registry@*.service
+  5. destroy deis-publisher.service
+  6. destroy deis-logspout.service
+  7. destroy deis-logger.service
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+}
+
+// failingBackendStub fails to start the router.
+type failingBackendStub struct {
+	backendStub
+}
+
+func (b *failingBackendStub) Start(targets []string, out, ew io.Writer) []backend.Result {
+	results := b.backendStub.Start(targets, out, ew)
+	for i := range results {
+		if strings.HasPrefix(results[i].Unit, "router@") {
+			results[i].State = ""
+			results[i].Err = errors.New(results[i].Unit + " failed while starting")
+		}
+	}
+	return results
+}
+
+func TestReport(t *testing.T) {
+	var out bytes.Buffer
+	stdout := Stdout
+	Stdout = &out
+	defer func() { Stdout = stdout }()
+
+	b := failingBackendStub{}
+	err := Start([]string{"builder", "router@1"}, &b)
+	if err == nil || err.Error() != "1 of 2 operations failed" {
+		t.Errorf("Expected a partial failure, Got %v", err)
+	}
+	// only the failed operations are printed by default
+	if !strings.Contains(out.String(), "router@1") || strings.Contains(out.String(), "builder") {
+		t.Errorf("Expected a table of the failed start of router@1, Got:\n%s", out.String())
+	}
+
+	if err := SetOutputFormat("table"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetOutputFormat(TextOutput)
+	out.Reset()
+	if err := Stop([]string{"builder", "router@1"}, &b); err != nil {
+		t.Error(err)
+	}
+	expected := "UNIT      ACTION  STATE  DURATION  ERROR\n" +
+		"builder   stop    done   0.0s      \n" +
+		"router@1  stop    done   0.0s      \n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+
+	if err := SetOutputFormat("yaml"); err == nil {
+		t.Error("Expected an unknown output format to be rejected")
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	var out, ew bytes.Buffer
+	stdout, stderr := Stdout, Stderr
+	Stdout, Stderr = &out, &ew
+	defer func() { Stdout, Stderr = stdout, stderr }()
+
+	if err := SetOutputFormat(JSONOutput); err != nil {
+		t.Fatal(err)
+	}
+	defer SetOutputFormat(TextOutput)
+
+	b := failingBackendStub{}
+	if err := StartPlatform(&b, true); err == nil {
+		t.Error("Expected starting the router to fail")
+	}
+
+	var results []struct {
+		Unit   string `json:"unit"`
+		Action string `json:"action"`
+		Error  string `json:"error"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatalf("Expected only results on stdout: %v\n%s", err, out.String())
+	}
+	if len(results) != 7 || results[0].Unit != "logger" || results[0].Action != "start" {
+		t.Errorf("Expected the start of each component, Got %v", results)
+	}
+	if !strings.Contains(ew.String(), "Starting Deis") || strings.Contains(ew.String(), "Done.") {
+		t.Errorf("Expected progress on stderr and no success message, Got %q", ew.String())
+	}
+}
+
 func TestUninstallSwarm(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/units"
+)
+
+// diffContext is how many unchanged lines are shown around each change.
+const diffContext = 2
+
+// Diff compares the installed units of targets, or of every component, with
+// the unit files rendered from the local templates, and prints how the ones
+// that drifted differ. If recreate is set, the drifted units are destroyed and
+// created again from the local templates, and started if they were active.
+func Diff(targets []string, recreate bool, b backend.Backend) error {
+	r, ok := b.(backend.Registry)
+	if !ok {
+		return fmt.Errorf("this backend does not keep the unit files it installed")
+	}
+	selected, err := diffTargets(targets)
+	if err != nil {
+		return err
+	}
+	installed, err := r.InstalledUnitFiles()
+	if err != nil {
+		return err
+	}
+
+	var drifted []string
+	compared := 0
+	for _, uf := range installed {
+		if !matchesTarget(uf.Name, selected) {
+			continue
+		}
+		compared++
+		local, err := r.UnitFile(unitTarget(uf.Name))
+		if err != nil {
+			fmt.Fprintf(Stdout, "%s: cannot render the local unit: %v\n", uf.Name, err)
+			continue
+		}
+		if local.Hash == uf.Hash {
+			continue
+		}
+		drifted = append(drifted, uf.Name)
+		fmt.Fprintf(Stdout, "--- %s (installed, %s)\n", uf.Name, shortHash(uf.Hash))
+		fmt.Fprintf(Stdout, "+++ %s (local, %s)\n", uf.Name, shortHash(local.Hash))
+		printDiff(Stdout, lines(uf.Contents), lines(local.Contents))
+	}
+
+	if len(drifted) == 0 {
+		fmt.Fprintf(Stdout, "All %d units match the local templates.\n", compared)
+		return nil
+	}
+	fmt.Fprintf(Stdout, "%d of %d units differ from the local templates.\n", len(drifted), compared)
+	if !recreate {
+		return fmt.Errorf("%d units drifted, use --recreate to install them again", len(drifted))
+	}
+	states, err := r.UnitStates()
+	if err != nil {
+		return err
+	}
+	return report(recreateUnits(b, states, drifted))
+}
+
+// recreateUnits destroys units and creates them again, starting the ones
+// that were active.
+func recreateUnits(b backend.Backend, states []backend.UnitState, names []string) []backend.Result {
+	active := make(map[string]bool, len(states))
+	for _, s := range states {
+		active[s.Name] = s.ActiveState == "active"
+	}
+
+	var targets, running []string
+	for _, name := range names {
+		targets = append(targets, unitTarget(name))
+		if active[name] {
+			running = append(running, unitTarget(name))
+		}
+	}
+	var results []backend.Result
+	if len(running) > 0 {
+		results = b.Stop(running, Stdout, Stderr)
+	}
+	results = append(results, b.Destroy(targets, Stdout, Stderr)...)
+	results = append(results, b.Create(targets, Stdout, Stderr)...)
+	if len(running) > 0 {
+		results = append(results, b.Start(running, Stdout, Stderr)...)
+	}
+	return results
+}
+
+// diffTargets resolves the targets of diff as the other commands do: a stack
+// such as platform or stateless-platform, a component, or an instance such as
+// router@1 or router@*. Components that run as instances select them all.
+func diffTargets(ts []string) ([]string, error) {
+	var resolved []string
+	for _, t := range ts {
+		if components, ok := stacks[t]; ok {
+			resolved = append(resolved, targets(components, false)...)
+			continue
+		}
+		component := t
+		instance := ""
+		if i := strings.Index(t, "@"); i >= 0 {
+			component, instance = t[:i], t[i+1:]
+		}
+		c, ok := units.Components[component]
+		if !ok {
+			return nil, fmt.Errorf("unknown target %s", t)
+		}
+		switch {
+		case instance == "":
+			resolved = append(resolved, targets([]string{component}, false)...)
+		case !c.Instances:
+			return nil, fmt.Errorf("%s does not run as instances", component)
+		case instance == "*":
+			resolved = append(resolved, t)
+		default:
+			if _, err := strconv.Atoi(instance); err != nil {
+				return nil, fmt.Errorf("unknown target %s", t)
+			}
+			resolved = append(resolved, t)
+		}
+	}
+	return resolved, nil
+}
+
+// matchesTarget is true if a unit is one of targets, as resolved by
+// diffTargets, or if there are no targets.
+func matchesTarget(name string, targets []string) bool {
+	if len(targets) == 0 {
+		return true
+	}
+	target := unitTarget(name)
+	for _, t := range targets {
+		if t == target || strings.HasSuffix(t, "@*") && strings.HasPrefix(target, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
+func lines(s string) []string {
+	return strings.Split(strings.TrimRight(s, "\n"), "\n")
+}
+
+// printDiff prints the lines removed from a and added in b, with the
+// unchanged lines around them.
+func printDiff(out io.Writer, a, b []string) {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			diff = append(diff, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			diff = append(diff, "-"+a[i])
+			i++
+		default:
+			diff = append(diff, "+"+b[j])
+			j++
+		}
+	}
+
+	// show only the changes and their context
+	show := make([]bool, len(diff))
+	for k, line := range diff {
+		if line[0] == ' ' {
+			continue
+		}
+		for c := k - diffContext; c <= k+diffContext; c++ {
+			if c >= 0 && c < len(diff) {
+				show[c] = true
+			}
+		}
+	}
+	skipped := false
+	for k, line := range diff {
+		if !show[k] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			fmt.Fprintln(out, "@@")
+			skipped = false
+		}
+		fmt.Fprintln(out, line)
+	}
+}
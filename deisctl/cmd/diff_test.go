@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/deis/deis/deisctl/backend"
+)
+
+// registryStub is a backend that keeps the unit files it installed.
+type registryStub struct {
+	backendStub
+	installed []backend.UnitFile
+	local     map[string]string
+	states    []backend.UnitState
+}
+
+func (r *registryStub) InstalledUnitFiles() ([]backend.UnitFile, error) {
+	return r.installed, nil
+}
+
+func (r *registryStub) UnitFile(target string) (backend.UnitFile, error) {
+	contents := r.local[target]
+	return backend.UnitFile{Name: "deis-" + target + ".service", Contents: contents, Hash: hash(contents)}, nil
+}
+
+func hash(contents string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte(contents)))
+}
+
+func (r *registryStub) UnitStates() ([]backend.UnitState, error) {
+	return r.states, nil
+}
+
+func (r *registryStub) Machines() ([]backend.Machine, error) {
+	return nil, nil
+}
+
+func newRegistryStub() *registryStub {
+	builder := "[Unit]\nDescription=deis-builder\n\n[Service]\nExecStart=/bin/builder\n"
+	router := "[Unit]\nDescription=deis-router\n\n[Service]\nExecStart=/bin/router\nTimeoutStartSec=20m\n"
+	return &registryStub{
+		installed: []backend.UnitFile{
+			{Name: "deis-builder.service", Contents: builder, Hash: hash(builder)},
+			{Name: "deis-router@1.service", Contents: router, Hash: hash(router)},
+			{Name: "deis-router@2.service", Contents: router, Hash: hash(router)},
+		},
+		local: map[string]string{
+			"builder":  builder,
+			"router@1": "[Unit]\nDescription=deis-router\n\n[Service]\nExecStart=/bin/router --port 80\nTimeoutStartSec=20m\n",
+			"router@2": "[Unit]\nDescription=deis-router\n\n[Service]\nExecStart=/bin/router --port 80\nTimeoutStartSec=20m\n",
+		},
+		states: []backend.UnitState{
+			{Name: "deis-router@1.service", ActiveState: "active", SubState: "running"},
+			{Name: "deis-router@2.service", ActiveState: "inactive", SubState: "dead"},
+		},
+	}
+}
+
+func TestDiff(t *testing.T) {
+	var out bytes.Buffer
+	stdout := Stdout
+	Stdout = &out
+	defer func() { Stdout = stdout }()
+
+	b := newRegistryStub()
+	err := Diff([]string{"router@1", "builder"}, false, b)
+	if err == nil {
+		t.Error("Expected drifted units to be an error")
+	}
+
+	expected := "--- deis-router@1.service (installed, 94e23c3)\n" +
+		"+++ deis-router@1.service (local, 3c8bf2c)\n" +
+		"@@\n" +
+		" \n" +
+		" [Service]\n" +
+		"-ExecStart=/bin/router\n" +
+		"+ExecStart=/bin/router --port 80\n" +
+		" TimeoutStartSec=20m\n" +
+		"1 of 2 units differ from the local templates.\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, out.String())
+	}
+	if len(b.uninstalledUnits) != 0 {
+		t.Errorf("Expected nothing to be re-created, Got %v", b.uninstalledUnits)
+	}
+}
+
+func TestDiffRecreate(t *testing.T) {
+	var out bytes.Buffer
+	stdout := Stdout
+	Stdout = &out
+	defer func() { Stdout = stdout }()
+
+	b := newRegistryStub()
+	if err := Diff(nil, true, b); err != nil {
+		t.Fatal(err)
+	}
+
+	drifted := []string{"router@1", "router@2"}
+	if !reflect.DeepEqual(b.uninstalledUnits, drifted) {
+		t.Errorf("Expected %v to be destroyed, Got %v", drifted, b.uninstalledUnits)
+	}
+	if !reflect.DeepEqual(b.installedUnits, drifted) {
+		t.Errorf("Expected %v to be created, Got %v", drifted, b.installedUnits)
+	}
+	// only the unit that was running is started again
+	if !reflect.DeepEqual(b.stoppedUnits, []string{"router@1"}) || !reflect.DeepEqual(b.startedUnits, []string{"router@1"}) {
+		t.Errorf("Expected router@1 to be restarted, Got stopped %v, started %v", b.stoppedUnits, b.startedUnits)
+	}
+}
+
+func TestDiffUnsupported(t *testing.T) {
+	t.Parallel()
+
+	if err := Diff(nil, false, &backendStub{}); err == nil {
+		t.Error("Expected a backend without installed unit files to be an error")
+	}
+}
+
+func TestDiffTargets(t *testing.T) {
+	t.Parallel()
+
+	units := []string{"deis-store-gateway@1.service", "deis-store-volume.service", "deis-database.service",
+		"deis-router@1.service", "deis-router@2.service", "deis-builder.service"}
+	tests := []struct {
+		targets  []string
+		expected []string
+	}{
+		{nil, units},
+		{[]string{"platform"}, units},
+		{[]string{"stateless-platform"}, []string{"deis-router@1.service", "deis-router@2.service", "deis-builder.service"}},
+		{[]string{"store-volume"}, []string{"deis-store-volume.service"}},
+		{[]string{"router"}, []string{"deis-router@1.service", "deis-router@2.service"}},
+		{[]string{"router@*"}, []string{"deis-router@1.service", "deis-router@2.service"}},
+		{[]string{"router@2", "database"}, []string{"deis-database.service", "deis-router@2.service"}},
+	}
+	for _, test := range tests {
+		resolved, err := diffTargets(test.targets)
+		if err != nil {
+			t.Errorf("%v: %v", test.targets, err)
+			continue
+		}
+		var matched []string
+		for _, name := range units {
+			if matchesTarget(name, resolved) {
+				matched = append(matched, name)
+			}
+		}
+		if !reflect.DeepEqual(matched, test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.targets, test.expected, matched)
+		}
+	}
+
+	for _, target := range []string{"store", "deis-builder", "builder@1", "router@x"} {
+		if _, err := diffTargets([]string{target}); err == nil {
+			t.Errorf("Expected %s to be an unknown target", target)
+		}
+	}
+}
+
+func TestDiffUnknownTarget(t *testing.T) {
+	t.Parallel()
+
+	if err := Diff([]string{"store"}, false, newRegistryStub()); err == nil {
+		t.Error("Expected an unknown target to be an error")
+	}
+}
@@ -0,0 +1,351 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/backend/fleet"
+	"github.com/deis/deis/deisctl/config"
+	"github.com/deis/deis/deisctl/config/model"
+)
+
+// Severities of doctor findings, from most to least urgent.
+const (
+	Critical = "critical"
+	Warning  = "warning"
+	Healthy  = "ok"
+)
+
+var severityRank = map[string]int{Critical: 0, Warning: 1, Healthy: 2}
+
+// Finding is the result of one doctor check.
+type Finding struct {
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Message  string `json:"message"`
+	// Hint suggests how to fix the problem.
+	Hint string `json:"hint,omitempty"`
+}
+
+// publishers are the components that publish their host and port in etcd,
+// and the TCP port they can be reached on, if it is not the published one.
+var publishers = []struct {
+	component, path, port string
+}{
+	{"controller", "/deis/controller", ""},
+	{"builder", "/deis/builder", ""},
+	{"logger", "/deis/logs", "8088"},
+	{"database", "/deis/database", ""},
+	{"registry", "/deis/registry", ""},
+}
+
+// reachable are the components whose published address the doctor connects to.
+var reachable = map[string]bool{"controller": true, "builder": true, "logger": true}
+
+// dial connects to a TCP address, to check that it is reachable.
+var dial = func(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, 3*time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Doctor checks the health of the cluster and prints a report, most urgent
+// problems first. It returns an error if any problem is critical.
+func Doctor(b backend.Backend, cb config.Backend, jsonOutput bool) error {
+	findings := diagnose(b, cb, true)
+	if err := printFindings(findings, jsonOutput, Stdout); err != nil {
+		return err
+	}
+	if n := count(findings, Critical); n > 0 {
+		return fmt.Errorf("%d critical problems found", n)
+	}
+	return nil
+}
+
+// diagnose runs every check, skipping those that depend on a failed one.
+// Published addresses are only connected to if reach is set.
+func diagnose(b backend.Backend, cb config.Backend, reach bool) []Finding {
+	var findings []Finding
+	if _, err := cb.GetWithDefault("/deis/platform/domain", ""); err != nil {
+		return append(findings, Finding{Critical, "etcd", fmt.Sprintf("etcd is unreachable: %v", err),
+			"Check --endpoint and --tunnel, and that etcd is running on the machine they point to."})
+	}
+	findings = append(findings, Finding{Healthy, "etcd", "etcd is reachable", ""})
+	findings = append(findings, checkRequiredKeys(cb)...)
+
+	var running map[string]int
+	ins, ok := b.(backend.Inspector)
+	if !ok {
+		findings = append(findings, Finding{Warning, "units", "the backend cannot report unit states, skipped unit checks", ""})
+	} else {
+		machines, err := ins.Machines()
+		if err != nil {
+			return append(findings, Finding{Critical, "machines", fmt.Sprintf("cannot list machines: %v", err),
+				"Check that fleet is running, with deisctl list."})
+		}
+		states, err := ins.UnitStates()
+		if err != nil {
+			return append(findings, Finding{Critical, "units", fmt.Sprintf("cannot list units: %v", err),
+				"Check that fleet is running, with deisctl list."})
+		}
+		findings = append(findings, checkMachines(machines, states)...)
+		var unitFindings []Finding
+		unitFindings, running = checkUnits(states)
+		findings = append(findings, unitFindings...)
+	}
+
+	findings = append(findings, checkPublished(cb, running, reach)...)
+
+	sort.Stable(bySeverity(findings))
+	return findings
+}
+
+// checkRequiredKeys checks the keys CheckRequiredKeys requires before installing.
+func checkRequiredKeys(cb config.Backend) []Finding {
+	var findings []Finding
+	if err := config.CheckConfig("/deis/platform/", "domain", cb); err != nil {
+		findings = append(findings, Finding{Critical, "config", "the platform domain is not set",
+			"deisctl config platform set domain=<your-domain>"})
+	}
+	if err := config.CheckConfig("/deis/platform/", "sshPrivateKey", cb); err != nil {
+		findings = append(findings, Finding{Warning, "config", `sshPrivateKey is not set, "deis run" is unavailable`,
+			"deisctl config platform set sshPrivateKey=<path-to-key>"})
+	}
+	if len(findings) == 0 {
+		findings = append(findings, Finding{Healthy, "config", "required platform keys are set", ""})
+	}
+	return findings
+}
+
+// checkMachines checks that every unit can be scheduled on a machine with
+// the metadata its decorator requires.
+func checkMachines(machines []backend.Machine, states []backend.UnitState) []Finding {
+	if len(machines) == 0 {
+		return []Finding{{Critical, "machines", "the cluster has no machines",
+			"Check that fleet is running on the hosts, with deisctl list machines."}}
+	}
+	var findings []Finding
+	missing := map[string][]string{}
+	var required []string
+	for _, s := range states {
+		if !isPlatformUnit(s.Name) || len(s.MachineMetadata) == 0 {
+			continue
+		}
+		key := strings.Join(s.MachineMetadata, ",")
+		if _, seen := missing[key]; !seen && !anyMachineHas(machines, s.MachineMetadata) {
+			required = append(required, key)
+			missing[key] = nil
+		}
+		if _, ok := missing[key]; ok {
+			missing[key] = append(missing[key], s.Name)
+		}
+	}
+	for _, key := range required {
+		findings = append(findings, Finding{Critical, "machines",
+			fmt.Sprintf("no machine has the metadata %s that %s require", key, strings.Join(missing[key], ", ")),
+			"Set the metadata in the cloud-config of some machines, or run deisctl config platform set " +
+				"enablePlacementOptions=false and reinstall the components."})
+	}
+	if len(findings) == 0 {
+		findings = append(findings, Finding{Healthy, "machines",
+			fmt.Sprintf("%d machines can run the installed units", len(machines)), ""})
+	}
+	return findings
+}
+
+func anyMachineHas(machines []backend.Machine, metadata []string) bool {
+	for _, m := range machines {
+		if m.Satisfies(metadata) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUnits checks the states of platform units. It returns the number of
+// running units of each component.
+func checkUnits(states []backend.UnitState) ([]Finding, map[string]int) {
+	var findings []Finding
+	running := map[string]int{}
+	total := 0
+	for _, s := range states {
+		if !isPlatformUnit(s.Name) {
+			continue
+		}
+		total++
+		target := unitTarget(s.Name)
+		switch {
+		case s.SubState == "auto-restart":
+			findings = append(findings, Finding{Critical, "units", s.Name + " is in a restart loop",
+				fmt.Sprintf("Find out why it exits with deisctl journal %s.", target)})
+		case s.ActiveState == "failed" || s.SubState == "failed":
+			findings = append(findings, Finding{Critical, "units", s.Name + " failed",
+				fmt.Sprintf("Find out why with deisctl journal %s, then deisctl restart %s.", target, target)})
+		case s.ActiveState == "active" && s.SubState == "running":
+			running[strings.SplitN(target, "@", 2)[0]]++
+		default:
+			findings = append(findings, Finding{Warning, "units",
+				fmt.Sprintf("%s is %s/%s", s.Name, s.ActiveState, s.SubState),
+				fmt.Sprintf("Start it with deisctl start %s.", target)})
+		}
+	}
+	if total == 0 {
+		findings = append(findings, Finding{Warning, "units", "no platform units are installed",
+			"deisctl install platform"})
+	} else if len(findings) == 0 {
+		findings = append(findings, Finding{Healthy, "units", fmt.Sprintf("%d platform units are running", total), ""})
+	}
+	return findings, running
+}
+
+// checkPublished checks that running components have published themselves
+// in etcd with a TTL, and, if reach is set, that their published addresses
+// are reachable. If running is nil, every component is expected to be running.
+func checkPublished(cb config.Backend, running map[string]int, reach bool) []Finding {
+	var findings []Finding
+	isRunning := func(component string) bool {
+		return running == nil || running[component] > 0
+	}
+
+	for _, p := range publishers {
+		if !isRunning(p.component) {
+			continue
+		}
+		nodes, _ := cb.GetRecursive(p.path)
+		host, port := findNode(nodes, p.path+"/host"), findNode(nodes, p.path+"/port")
+		switch {
+		case host == nil || host.Value == "":
+			findings = append(findings, Finding{Critical, "published",
+				fmt.Sprintf("%s is running but has not published %s/host", p.component, p.path),
+				fmt.Sprintf("Check its logs with deisctl journal %s.", p.component)})
+			continue
+		case host.Expiration == nil:
+			findings = append(findings, Finding{Warning, "published",
+				fmt.Sprintf("%s/host has no TTL, so it outlives %s", p.path, p.component),
+				fmt.Sprintf("Remove it with etcdctl rm %s/host, %s publishes it again.", p.path, p.component)})
+		}
+		if !reach || !reachable[p.component] {
+			continue
+		}
+		addr := host.Value
+		switch {
+		case p.port != "":
+			addr = net.JoinHostPort(addr, p.port)
+		case port != nil && port.Value != "":
+			addr = net.JoinHostPort(addr, port.Value)
+		default:
+			continue
+		}
+		if err := dial(addr); err != nil {
+			findings = append(findings, unreachable(p.component, addr, err))
+		} else {
+			findings = append(findings, Finding{Healthy, "reachable", fmt.Sprintf("%s is reachable at %s", p.component, addr), ""})
+		}
+	}
+
+	if isRunning("router") {
+		nodes, _ := cb.GetRecursive("/deis/router/hosts")
+		var published []*model.ConfigNode
+		for _, n := range nodes {
+			if !n.Dir && n.Value != "" {
+				published = append(published, n)
+			}
+		}
+		if n := running["router"]; len(published) < n {
+			findings = append(findings, Finding{Critical, "published",
+				fmt.Sprintf("%d routers are running but %d are published in /deis/router/hosts", n, len(published)),
+				"Check their logs with deisctl journal router@*."})
+		}
+		for _, n := range published {
+			if !reach {
+				break
+			}
+			if err := dial(n.Value); err != nil {
+				findings = append(findings, unreachable("router", n.Value, err))
+			} else {
+				findings = append(findings, Finding{Healthy, "reachable", "router is reachable at " + n.Value, ""})
+			}
+		}
+	}
+	return findings
+}
+
+// unreachable is the finding of a component deisctl could not connect to.
+// Through a tunnel, deisctl runs outside the cluster, where the private
+// addresses components publish may not be routed, so it is only a warning.
+func unreachable(component, addr string, err error) Finding {
+	message := fmt.Sprintf("%s is unreachable at %s from this machine: %v", component, addr, err)
+	if tunnel := fleet.Flags.Tunnel; tunnel != "" {
+		return Finding{Warning, "reachable", message,
+			fmt.Sprintf("This machine reaches the cluster through --tunnel %s, and may not reach the addresses inside it. Run deisctl doctor on a machine of the cluster to check them.", tunnel)}
+	}
+	return Finding{Critical, "reachable", message,
+		"Check firewalls and security groups between this machine and the cluster."}
+}
+
+func findNode(nodes []*model.ConfigNode, key string) *model.ConfigNode {
+	for _, n := range nodes {
+		if n.Key == key {
+			return n
+		}
+	}
+	return nil
+}
+
+// isPlatformUnit is true for the units of Deis components, rather than of applications.
+func isPlatformUnit(name string) bool {
+	return strings.HasPrefix(name, "deis-")
+}
+
+// unitTarget returns the deisctl target of a unit, such as router@1.
+func unitTarget(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, "deis-"), ".service")
+}
+
+func count(findings []Finding, severity string) int {
+	n := 0
+	for _, f := range findings {
+		if f.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// printFindings prints a report of findings, or JSON for scripts.
+func printFindings(findings []Finding, jsonOutput bool, w io.Writer) error {
+	if jsonOutput {
+		report := struct {
+			Findings []Finding `json:"findings"`
+			Critical int       `json:"critical"`
+			Warnings int       `json:"warnings"`
+		}{findings, count(findings, Critical), count(findings, Warning)}
+		enc := json.NewEncoder(w)
+		return enc.Encode(report)
+	}
+	for _, f := range findings {
+		fmt.Fprintf(w, "[%s] %s: %s\n", f.Severity, f.Check, f.Message)
+		if f.Hint != "" {
+			fmt.Fprintf(w, "    %s\n", f.Hint)
+		}
+	}
+	fmt.Fprintf(w, "%d critical, %d warnings, %d ok\n",
+		count(findings, Critical), count(findings, Warning), count(findings, Healthy))
+	return nil
+}
+
+type bySeverity []Finding
+
+func (s bySeverity) Len() int      { return len(s) }
+func (s bySeverity) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s bySeverity) Less(i, j int) bool {
+	return severityRank[s[i].Severity] < severityRank[s[j].Severity]
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/backend/fleet"
+	"github.com/deis/deis/deisctl/config/model"
+	"github.com/deis/deis/deisctl/test/mock"
+)
+
+type inspectorStub struct {
+	backendStub
+	states   []backend.UnitState
+	machines []backend.Machine
+}
+
+func (i *inspectorStub) UnitStates() ([]backend.UnitState, error) {
+	return i.states, nil
+}
+
+func (i *inspectorStub) Machines() ([]backend.Machine, error) {
+	return i.machines, nil
+}
+
+// treeConfigBackend lists every key under a directory, unlike mock.ConfigBackend.
+type treeConfigBackend struct {
+	mock.ConfigBackend
+}
+
+func (cb treeConfigBackend) GetRecursive(key string) ([]*model.ConfigNode, error) {
+	var nodes []*model.ConfigNode
+	for _, n := range cb.Expected {
+		if strings.HasPrefix(n.Key, key+"/") {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
+
+type unreachableConfigBackend struct {
+	mock.ConfigBackend
+}
+
+func (unreachableConfigBackend) GetWithDefault(key, defaultValue string) (string, error) {
+	return "", errors.New("connection refused")
+}
+
+func runningUnit(name string) backend.UnitState {
+	return backend.UnitState{Name: name, ActiveState: "active", SubState: "running"}
+}
+
+func healthyCluster() (*inspectorStub, treeConfigBackend) {
+	ttl := time.Now().Add(time.Minute)
+	b := &inspectorStub{
+		states: []backend.UnitState{
+			runningUnit("deis-builder.service"),
+			runningUnit("deis-controller.service"),
+			runningUnit("deis-logger.service"),
+			runningUnit("deis-router@1.service"),
+			runningUnit("myapp_v2.web.1.service"),
+		},
+		machines: []backend.Machine{{ID: "abc", IP: "10.0.0.1"}},
+	}
+	cb := treeConfigBackend{mock.ConfigBackend{Expected: []*model.ConfigNode{
+		{Key: "/deis/platform/domain", Value: "example.com"},
+		{Key: "/deis/platform/sshPrivateKey", Value: "key"},
+		{Key: "/deis/builder/host", Value: "10.0.0.1", Expiration: &ttl},
+		{Key: "/deis/builder/port", Value: "2223"},
+		{Key: "/deis/controller/host", Value: "10.0.0.1", Expiration: &ttl},
+		{Key: "/deis/controller/port", Value: "8000"},
+		{Key: "/deis/logs/host", Value: "10.0.0.1", Expiration: &ttl},
+		{Key: "/deis/router/hosts/10.0.0.1", Value: "10.0.0.1:80", Expiration: &ttl},
+	}}}
+	return b, cb
+}
+
+func findingsOf(findings []Finding, severity string) []string {
+	var messages []string
+	for _, f := range findings {
+		if f.Severity == severity {
+			messages = append(messages, f.Check+": "+f.Message)
+		}
+	}
+	return messages
+}
+
+func TestDoctorHealthy(t *testing.T) {
+	dialed := map[string]bool{}
+	defer func(d func(string) error) { dial = d }(dial)
+	dial = func(addr string) error {
+		dialed[addr] = true
+		return nil
+	}
+
+	b, cb := healthyCluster()
+	findings := diagnose(b, cb, true)
+
+	if problems := append(findingsOf(findings, Critical), findingsOf(findings, Warning)...); len(problems) != 0 {
+		t.Errorf("Expected no problems, Got %v", problems)
+	}
+	for _, addr := range []string{"10.0.0.1:2223", "10.0.0.1:8000", "10.0.0.1:8088", "10.0.0.1:80"} {
+		if !dialed[addr] {
+			t.Errorf("Expected %s to be dialed, Got %v", addr, dialed)
+		}
+	}
+}
+
+func TestDoctorFindsProblems(t *testing.T) {
+	defer func(d func(string) error) { dial = d }(dial)
+	dial = func(addr string) error {
+		if addr == "10.0.0.1:8000" {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	b, cb := healthyCluster()
+	b.states = append(b.states,
+		backend.UnitState{Name: "deis-database.service", ActiveState: "activating", SubState: "auto-restart"},
+		backend.UnitState{Name: "deis-registry@1.service", ActiveState: "failed", SubState: "failed"},
+		backend.UnitState{Name: "deis-router@2.service", ActiveState: "inactive", SubState: "dead",
+			MachineMetadata: []string{"controlPlane=true"}},
+		backend.UnitState{Name: "deis-router@3.service", ActiveState: "active", SubState: "running"},
+	)
+	cb.Expected[2].Expiration = nil
+
+	findings := diagnose(b, cb, true)
+
+	expected := []string{
+		"machines: no machine has the metadata controlPlane=true that deis-router@2.service require",
+		"units: deis-database.service is in a restart loop",
+		"units: deis-registry@1.service failed",
+		"reachable: controller is unreachable at 10.0.0.1:8000 from this machine: connection refused",
+		"published: 2 routers are running but 1 are published in /deis/router/hosts",
+	}
+	critical := findingsOf(findings, Critical)
+	if strings.Join(critical, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected critical findings:\n%s\nGot:\n%s", strings.Join(expected, "\n"), strings.Join(critical, "\n"))
+	}
+
+	expected = []string{
+		"units: deis-router@2.service is inactive/dead",
+		"published: /deis/builder/host has no TTL, so it outlives builder",
+	}
+	warnings := findingsOf(findings, Warning)
+	if strings.Join(warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected warnings:\n%s\nGot:\n%s", strings.Join(expected, "\n"), strings.Join(warnings, "\n"))
+	}
+
+	if findings[0].Severity != Critical || findings[len(findings)-1].Severity != Healthy {
+		t.Errorf("Expected findings to be sorted by severity, Got %v", findings)
+	}
+}
+
+func TestDoctorThroughTunnel(t *testing.T) {
+	defer func(d func(string) error, tunnel string) { dial, fleet.Flags.Tunnel = d, tunnel }(dial, fleet.Flags.Tunnel)
+	dial = func(addr string) error { return errors.New("no route to host") }
+	fleet.Flags.Tunnel = "deis.example.com"
+
+	b, cb := healthyCluster()
+	findings := diagnose(b, cb, true)
+
+	if critical := findingsOf(findings, Critical); len(critical) != 0 {
+		t.Errorf("Expected unreachable addresses not to be critical through a tunnel, Got %v", critical)
+	}
+	for _, f := range findings {
+		if f.Check == "reachable" && (f.Severity != Warning || !strings.Contains(f.Hint, "--tunnel deis.example.com")) {
+			t.Errorf("Expected a warning naming the tunnel, Got %v", f)
+		}
+	}
+}
+
+func TestDoctorUnreachableEtcd(t *testing.T) {
+	t.Parallel()
+
+	findings := diagnose(&backendStub{}, unreachableConfigBackend{}, true)
+	if len(findings) != 1 || findings[0].Check != "etcd" || findings[0].Severity != Critical {
+		t.Errorf("Expected only etcd to be checked, Got %v", findings)
+	}
+}
+
+func TestDoctorJSON(t *testing.T) {
+	t.Parallel()
+
+	findings := []Finding{
+		{Critical, "config", "the platform domain is not set", "deisctl config platform set domain=<your-domain>"},
+		{Healthy, "etcd", "etcd is reachable", ""},
+	}
+	var out bytes.Buffer
+	if err := printFindings(findings, true, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	var report struct {
+		Findings []Finding
+		Critical int
+		Warnings int
+	}
+	if err := json.Unmarshal([]byte(out.String()), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Critical != 1 || report.Warnings != 0 || len(report.Findings) != 2 || report.Findings[0] != findings[0] {
+		t.Errorf("Expected the findings as JSON, Got %s", out.String())
+	}
+}
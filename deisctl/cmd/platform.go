@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 	"io"
-	"sync"
 
 	"github.com/deis/deis/deisctl/backend"
 	"github.com/deis/deis/deisctl/config"
@@ -24,13 +23,15 @@ func InstallPlatform(b backend.Backend, cb config.Backend, checkKeys func(config
 		fmt.Println("http://docs.deis.io/en/latest/managing_deis/running-deis-without-ceph/")
 	}
 
-	var wg sync.WaitGroup
-
 	io.WriteString(Stdout, prettyprint.DeisIfy("Installing Deis..."))
 
-	installDefaultServices(b, stateless, &wg, Stdout, Stderr)
-
-	wg.Wait()
+	results, err := installComponents(b, stacks[platformStack(stateless)], Stdout, Stderr)
+	if err != nil {
+		return err
+	}
+	if err := report(results); err != nil {
+		return err
+	}
 
 	fmt.Fprintln(Stdout, "Done.")
 	fmt.Fprintln(Stdout, "")
@@ -45,13 +46,15 @@ func InstallPlatform(b backend.Backend, cb config.Backend, checkKeys func(config
 // StartPlatform activates all components.
 func StartPlatform(b backend.Backend, stateless bool) error {
 
-	var wg sync.WaitGroup
-
 	io.WriteString(Stdout, prettyprint.DeisIfy("Starting Deis..."))
 
-	startDefaultServices(b, stateless, &wg, Stdout, Stderr)
-
-	wg.Wait()
+	results, err := startComponents(b, stacks[platformStack(stateless)], Stdout, Stderr)
+	if err != nil {
+		return err
+	}
+	if err := report(results); err != nil {
+		return err
+	}
 
 	fmt.Fprintln(Stdout, "Done.\n ")
 	fmt.Fprintln(Stdout, "Please set up an administrative account. See 'deis help register'")
@@ -61,13 +64,15 @@ func StartPlatform(b backend.Backend, stateless bool) error {
 // StopPlatform deactivates all components.
 func StopPlatform(b backend.Backend, stateless bool) error {
 
-	var wg sync.WaitGroup
-
 	io.WriteString(Stdout, prettyprint.DeisIfy("Stopping Deis..."))
 
-	stopDefaultServices(b, stateless, &wg, Stdout, Stderr)
-
-	wg.Wait()
+	results, err := stopComponents(b, stacks[platformStack(stateless)], Stdout, Stderr)
+	if err != nil {
+		return err
+	}
+	if err := report(results); err != nil {
+		return err
+	}
 
 	fmt.Fprintln(Stdout, "Done.\n ")
 	if stateless {
@@ -82,13 +87,15 @@ func StopPlatform(b backend.Backend, stateless bool) error {
 // After UninstallPlatform, all components will be unavailable.
 func UninstallPlatform(b backend.Backend, stateless bool) error {
 
-	var wg sync.WaitGroup
-
 	io.WriteString(Stdout, prettyprint.DeisIfy("Uninstalling Deis..."))
 
-	uninstallAllServices(b, stateless, &wg, Stdout, Stderr)
-
-	wg.Wait()
+	results, err := uninstallComponents(b, stacks[platformStack(stateless)], Stdout, Stderr)
+	if err != nil {
+		return err
+	}
+	if err := report(results); err != nil {
+		return err
+	}
 
 	fmt.Fprintln(Stdout, "Done.")
 	return nil
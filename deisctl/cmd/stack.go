@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/units"
+)
+
+// stacks are the components installed, started, stopped and uninstalled
+// together, as in "deisctl start platform". The order in which they start is
+// computed from units.Components.
+var stacks = map[string][]string{
+	PlatformCommand: {
+		"store-monitor", "store-daemon", "store-metadata", "store-gateway", "store-volume",
+		"logger", "logspout", "database", "registry", "controller", "builder", "publisher", "router",
+	},
+	StatelessPlatformCommand: {
+		"logger", "logspout", "registry", "controller", "builder", "publisher", "router",
+	},
+	mesos: {"zookeeper", "mesos-master", "mesos-marathon", "mesos-slave"},
+	swarm: {"swarm-manager", "swarm-node"},
+	k8s:   {"kube-apiserver", "kube-controller-manager", "kube-scheduler", "kube-kubelet", "kube-proxy"},
+}
+
+// platformStack returns the name of the platform stack.
+func platformStack(stateless bool) string {
+	if stateless {
+		return StatelessPlatformCommand
+	}
+	return PlatformCommand
+}
+
+// waves orders components into waves according to the dependencies in graph.
+// Every component is in a later wave than the components it requires, and the
+// components of a wave are independent of each other, so they can start at once.
+func waves(components []string, graph map[string]units.Component) ([][]string, error) {
+	in := make(map[string]bool, len(components))
+	var pending []string
+	for _, c := range components {
+		if _, ok := graph[c]; !ok {
+			return nil, fmt.Errorf("unknown component %s", c)
+		}
+		if !in[c] {
+			in[c] = true
+			pending = append(pending, c)
+		}
+	}
+
+	done := make(map[string]bool, len(pending))
+	var result [][]string
+	for len(pending) > 0 {
+		var wave, rest []string
+		for _, c := range pending {
+			ready := true
+			for _, r := range graph[c].Requires {
+				if in[r] && !done[r] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				wave = append(wave, c)
+			} else {
+				rest = append(rest, c)
+			}
+		}
+		if len(wave) == 0 {
+			return nil, fmt.Errorf("dependency cycle between %s", strings.Join(rest, ", "))
+		}
+		for _, c := range wave {
+			done[c] = true
+		}
+		result = append(result, wave)
+		pending = rest
+	}
+	return result, nil
+}
+
+// inWaves calls fn with each wave of components, in reverse if stopping, and
+// returns the results of all waves. It announces each subsystem as it is reached.
+func inWaves(components []string, reverse bool, out io.Writer, fn func([]string) []backend.Result) ([]backend.Result, error) {
+	ws, err := waves(components, units.Components)
+	if err != nil {
+		return nil, err
+	}
+	if reverse {
+		for i, j := 0, len(ws)-1; i < j; i, j = i+1, j-1 {
+			ws[i], ws[j] = ws[j], ws[i]
+		}
+	}
+	announced := ""
+	var results []backend.Result
+	for _, wave := range ws {
+		for _, c := range wave {
+			if s := units.Components[c].Subsystem; s != "" && s != announced {
+				fmt.Fprintf(out, "%s...\n", s)
+				announced = s
+			}
+		}
+		results = append(results, fn(wave)...)
+	}
+	return results, nil
+}
+
+// targets returns the unit targets of components. Components that run as
+// instances are targeted as component@*, or by instance when created.
+func targets(components []string, create bool) []string {
+	var ts []string
+	for _, c := range components {
+		switch {
+		case !units.Components[c].Instances:
+			ts = append(ts, c)
+		case !create:
+			ts = append(ts, c+"@*")
+		case c == "router":
+			ts = append(ts, getRouters()...)
+		default:
+			ts = append(ts, c+"@1")
+		}
+	}
+	return ts
+}
+
+// installComponents creates the units of components, in the order they start.
+func installComponents(b backend.Backend, components []string, out, ew io.Writer) ([]backend.Result, error) {
+	return inWaves(components, false, out, func(wave []string) []backend.Result {
+		return b.Create(targets(wave, true), out, ew)
+	})
+}
+
+// startComponents starts components, each once the components it requires are running.
+func startComponents(b backend.Backend, components []string, out, ew io.Writer) ([]backend.Result, error) {
+	return inWaves(components, false, out, func(wave []string) []backend.Result {
+		return b.Start(targets(wave, false), out, ew)
+	})
+}
+
+// stopComponents stops components, each before the components it requires.
+func stopComponents(b backend.Backend, components []string, out, ew io.Writer) ([]backend.Result, error) {
+	return inWaves(components, true, out, func(wave []string) []backend.Result {
+		return b.Stop(targets(wave, false), out, ew)
+	})
+}
+
+// uninstallComponents destroys the units of components, in the order they stop.
+func uninstallComponents(b backend.Backend, components []string, out, ew io.Writer) ([]backend.Result, error) {
+	return inWaves(components, true, out, func(wave []string) []backend.Result {
+		return b.Destroy(targets(wave, false), out, ew)
+	})
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/deis/deis/deisctl/units"
+)
+
+func TestWaves(t *testing.T) {
+	t.Parallel()
+
+	expected := [][]string{
+		{"store-monitor"}, {"store-daemon"}, {"store-metadata"}, {"store-gateway"}, {"store-volume"},
+		{"logger"}, {"logspout"}, {"database", "registry", "publisher"}, {"controller"}, {"builder"},
+		{"router"},
+	}
+	ws, err := waves(stacks[PlatformCommand], units.Components)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ws, expected) {
+		t.Error(fmt.Errorf("Expected %v, Got %v", expected, ws))
+	}
+}
+
+func TestWavesIgnoresMissingRequirements(t *testing.T) {
+	t.Parallel()
+
+	// the stateless platform runs without storage and the database
+	expected := [][]string{
+		{"logger"}, {"logspout"}, {"registry", "publisher"}, {"controller"}, {"builder"}, {"router"},
+	}
+	ws, err := waves(stacks[StatelessPlatformCommand], units.Components)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ws, expected) {
+		t.Error(fmt.Errorf("Expected %v, Got %v", expected, ws))
+	}
+}
+
+func TestWavesErrors(t *testing.T) {
+	t.Parallel()
+
+	graph := map[string]units.Component{
+		"a": {Requires: []string{"c"}},
+		"b": {Requires: []string{"a"}},
+		"c": {Requires: []string{"b"}},
+		"d": {},
+	}
+	if _, err := waves([]string{"a", "b", "c", "d"}, graph); err == nil {
+		t.Error("Expected an error for a dependency cycle")
+	}
+	if _, err := waves([]string{"a", "e"}, graph); err == nil {
+		t.Error("Expected an error for an unknown component")
+	}
+}
+
+func TestStacks(t *testing.T) {
+	t.Parallel()
+
+	for name, components := range stacks {
+		ws, err := waves(components, units.Components)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		n := 0
+		for _, wave := range ws {
+			n += len(wave)
+		}
+		if n != len(components) {
+			t.Errorf("%s: Expected %d components, Got %d", name, len(components), n)
+		}
+	}
+}
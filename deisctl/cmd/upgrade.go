@@ -1,45 +1,28 @@
 package cmd
 
 import (
-	"bytes"
 	"fmt"
-	"io"
-	"sync"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/deis/deis/deisctl/backend"
 	"github.com/deis/deis/deisctl/config"
 	"github.com/deis/deis/deisctl/config/model"
+	"github.com/deis/deis/deisctl/units"
+	"github.com/deis/deis/deisctl/utils"
 )
 
 // UpgradePrep stops and uninstalls all components except router and publisher
 func UpgradePrep(stateless bool, b backend.Backend) error {
-	var wg sync.WaitGroup
-
-	b.Stop([]string{"database", "registry@*", "controller", "builder", "logger", "logspout"}, &wg, Stdout, Stderr)
-	wg.Wait()
-	b.Destroy([]string{"database", "registry@*", "controller", "builder", "logger", "logspout"}, &wg, Stdout, Stderr)
-	wg.Wait()
-
-	if !stateless {
-		b.Stop([]string{"store-volume", "store-gateway@*"}, &wg, Stdout, Stderr)
-		wg.Wait()
-		b.Destroy([]string{"store-volume", "store-gateway@*"}, &wg, Stdout, Stderr)
-		wg.Wait()
-
-		b.Stop([]string{"store-metadata"}, &wg, Stdout, Stderr)
-		wg.Wait()
-		b.Destroy([]string{"store-metadata"}, &wg, Stdout, Stderr)
-		wg.Wait()
-
-		b.Stop([]string{"store-daemon"}, &wg, Stdout, Stderr)
-		wg.Wait()
-		b.Destroy([]string{"store-daemon"}, &wg, Stdout, Stderr)
-		wg.Wait()
-
-		b.Stop([]string{"store-monitor"}, &wg, Stdout, Stderr)
-		wg.Wait()
-		b.Destroy([]string{"store-monitor"}, &wg, Stdout, Stderr)
-		wg.Wait()
+	results, err := doUpgradePrep(stateless, b)
+	if err != nil {
+		return err
+	}
+	if err := report(results); err != nil {
+		return err
 	}
 
 	fmt.Fprintln(Stdout, "The platform has been stopped, but applications are still serving traffic as normal.")
@@ -48,6 +31,25 @@ func UpgradePrep(stateless bool, b backend.Backend) error {
 	return nil
 }
 
+func doUpgradePrep(stateless bool, b backend.Backend) ([]backend.Result, error) {
+	return inWaves(upgradeComponents(stateless), true, Stdout, func(wave []string) []backend.Result {
+		results := b.Stop(targets(wave, false), Stdout, Stderr)
+		return append(results, b.Destroy(targets(wave, false), Stdout, Stderr)...)
+	})
+}
+
+// upgradeComponents returns the components a graceful upgrade replaces: all
+// but the router mesh and publisher, which keep applications serving traffic.
+func upgradeComponents(stateless bool) []string {
+	var components []string
+	for _, c := range stacks[platformStack(stateless)] {
+		if c != "router" && c != "publisher" {
+			components = append(components, c)
+		}
+	}
+	return components
+}
+
 func listPublishedServices(cb config.Backend) ([]*model.ConfigNode, error) {
 	nodes, err := cb.GetRecursive("deis/services")
 	if err != nil {
@@ -70,126 +72,311 @@ func republishServices(ttl uint64, nodes []*model.ConfigNode, cb config.Backend)
 
 // UpgradeTakeover gracefully starts a platform stopped with UpgradePrep
 func UpgradeTakeover(stateless bool, b backend.Backend, cb config.Backend) error {
-	if err := doUpgradeTakeOver(stateless, b, cb); err != nil {
+	results, err := doUpgradeTakeOver(stateless, b, cb)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return report(results)
 }
 
-func doUpgradeTakeOver(stateless bool, b backend.Backend, cb config.Backend) error {
-	var wg sync.WaitGroup
-
+func doUpgradeTakeOver(stateless bool, b backend.Backend, cb config.Backend) ([]backend.Result, error) {
 	nodes, err := listPublishedServices(cb)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	b.Stop([]string{"publisher"}, &wg, Stdout, Stderr)
-	wg.Wait()
-	b.Destroy([]string{"publisher"}, &wg, Stdout, Stderr)
-	wg.Wait()
+	results := b.Stop([]string{"publisher"}, Stdout, Stderr)
+	results = append(results, b.Destroy([]string{"publisher"}, Stdout, Stderr)...)
 
 	if err := republishServices(1800, nodes, cb); err != nil {
-		return err
+		return results, err
 	}
 
-	b.RollingRestart("router", &wg, Stdout, Stderr)
-	wg.Wait()
-	b.Create([]string{"publisher"}, &wg, Stdout, Stderr)
-	wg.Wait()
-	b.Start([]string{"publisher"}, &wg, Stdout, Stderr)
-	wg.Wait()
+	opts := backend.RollingRestartOptions{BatchSize: 1, HealthTimeout: DefaultHealthTimeout}
+	results = append(results, b.RollingRestart("router", opts, Stdout, Stderr)...)
+	results = append(results, b.Create([]string{"publisher"}, Stdout, Stderr)...)
+	results = append(results, b.Start([]string{"publisher"}, Stdout, Stderr)...)
 
-	installUpgradeServices(b, stateless, &wg, Stdout, Stderr)
-	wg.Wait()
+	installed, err := installComponents(b, upgradeComponents(stateless), Stdout, Stderr)
+	results = append(results, installed...)
+	if err != nil {
+		return results, err
+	}
+	started, err := startComponents(b, upgradeComponents(stateless), Stdout, Stderr)
+	return append(results, started...), err
+}
 
-	startUpgradeServices(b, stateless, &wg, Stdout, Stderr)
-	wg.Wait()
-	return nil
+// upgradeCheckInterval is how often Upgrade checks the health of the platform.
+var upgradeCheckInterval = 10 * time.Second
+
+// UpgradeOptions configure Upgrade.
+type UpgradeOptions struct {
+	// Version is the release to upgrade to, such as v1.12.2.
+	Version   string
+	Stateless bool
+	// UnitDir is where the unit files of the release are saved, as with refresh-units.
+	UnitDir string
+	// SnapshotDir is where the unit files and configuration are saved before the upgrade.
+	SnapshotDir string
+	// PassphraseFile holds the passphrase secrets of the saved configuration are encrypted with.
+	PassphraseFile string
+	// HealthTimeout is how long the platform has to become healthy after each phase.
+	HealthTimeout time.Duration
+}
+
+// upgradePhase is a step of Upgrade after which the platform must be healthy,
+// with running being the components that must be running.
+type upgradePhase struct {
+	name    string
+	run     func() ([]backend.Result, error)
+	running []string
 }
 
-func installUpgradeServices(b backend.Backend, stateless bool, wg *sync.WaitGroup, out, err io.Writer) {
-	if !stateless {
-		fmt.Fprintln(out, "Storage subsystem...")
-		b.Create([]string{"store-daemon", "store-monitor", "store-metadata", "store-volume", "store-gateway@1"}, wg, out, err)
-		wg.Wait()
+// Upgrade upgrades the platform to a release in one go: it saves the unit files
+// and configuration, downloads the unit files of the release, and replaces the
+// platform as upgrade-prep and upgrade-takeover do, checking its health after
+// each phase. If a phase fails, the saved unit files, configuration and
+// platform version are restored and the platform is taken over again with them.
+func Upgrade(opts UpgradeOptions, rootURL string, b backend.Backend, cb config.Backend) error {
+	if _, ok := b.(backend.Inspector); !ok {
+		return fmt.Errorf("this backend cannot report unit states, which an upgrade checks")
+	}
+	if err := waitHealthy(b, cb, nil, 0); err != nil {
+		return fmt.Errorf("the platform is unhealthy, fix it before upgrading: %v", err)
+	}
+
+	snap, err := takeSnapshot(opts, cb)
+	if err != nil {
+		return err
 	}
+	fmt.Fprintf(Stdout, "Saved the unit files and configuration of %s to %s\n", snap.displayVersion(), snap.dir)
 
-	fmt.Fprintln(out, "Logging subsystem...")
-	if stateless {
-		b.Create([]string{"logspout"}, wg, out, err)
-	} else {
-		b.Create([]string{"logger", "logspout"}, wg, out, err)
+	if err := RefreshUnits(opts.UnitDir, opts.Version, rootURL); err != nil {
+		if rerr := snap.restoreUnitFiles(); rerr != nil {
+			return fmt.Errorf("%v, and restoring the unit files failed: %v", err, rerr)
+		}
+		return err
 	}
-	wg.Wait()
 
-	fmt.Fprintln(out, "Control plane...")
-	if stateless {
-		b.Create([]string{"registry@1", "controller", "builder"}, wg, out, err)
-	} else {
-		b.Create([]string{"database", "registry@1", "controller", "builder"}, wg, out, err)
+	serving := []string{"router", "publisher"}
+	phases := []upgradePhase{
+		{"prep", func() ([]backend.Result, error) {
+			return doUpgradePrep(opts.Stateless, b)
+		}, serving},
+		{"takeover", func() ([]backend.Result, error) {
+			if _, err := cb.Set("/deis/platform/version", opts.Version); err != nil {
+				return nil, err
+			}
+			return doUpgradeTakeOver(opts.Stateless, b, cb)
+		}, append(serving, upgradeComponents(opts.Stateless)...)},
 	}
-	wg.Wait()
 
-	fmt.Fprintln(out, "Data plane...")
-	b.Create([]string{"publisher"}, wg, out, err)
-	wg.Wait()
+	var results []backend.Result
+	for _, phase := range phases {
+		fmt.Fprintf(Stdout, "Upgrade phase %s...\n", phase.name)
+		r, err := phase.run()
+		results = append(results, r...)
+		if err == nil && len(backend.Failed(r)) > 0 {
+			err = fmt.Errorf("%d of %d operations failed", len(backend.Failed(r)), len(r))
+		}
+		if err == nil {
+			err = waitHealthy(b, cb, phase.running, opts.HealthTimeout)
+		}
+		if err == nil {
+			continue
+		}
+
+		fmt.Fprintf(Stderr, "Upgrade phase %s failed: %v\n", phase.name, err)
+		fmt.Fprintf(Stderr, "Rolling back to %s...\n", snap.displayVersion())
+		rolledBack, rerr := rollBack(snap, opts, b, cb)
+		report(append(results, rolledBack...))
+		if rerr != nil {
+			return fmt.Errorf("upgrade phase %s failed, and so did rolling back: %v. The unit files and configuration before the upgrade are in %s",
+				phase.name, rerr, snap.dir)
+		}
+		return fmt.Errorf("upgrade phase %s failed, rolled back to %s: %v", phase.name, snap.displayVersion(), err)
+	}
+	if err := report(results); err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, "The platform is upgraded to %s.\n", opts.Version)
+	return nil
 }
 
-func startUpgradeServices(b backend.Backend, stateless bool, wg *sync.WaitGroup, out, err io.Writer) {
+// rollBack restores the unit files and configuration of a snapshot, which
+// includes the platform version, and takes over the platform again with them.
+func rollBack(snap *upgradeSnapshot, opts UpgradeOptions, b backend.Backend, cb config.Backend) ([]backend.Result, error) {
+	if err := snap.restoreUnitFiles(); err != nil {
+		return nil, err
+	}
+	passphrase, err := readPassphrase(opts.PassphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Restore(filepath.Join(snap.dir, "config.json"), passphrase, cb, Stdout); err != nil {
+		return nil, fmt.Errorf("restoring the configuration: %v", err)
+	}
 
-	// Wait for groups to come up.
-	// If we're running in stateless mode, we start only a subset of services.
-	if !stateless {
-		fmt.Fprintln(out, "Storage subsystem...")
-		b.Start([]string{"store-monitor"}, wg, out, err)
-		wg.Wait()
-		b.Start([]string{"store-daemon"}, wg, out, err)
-		wg.Wait()
-		b.Start([]string{"store-metadata"}, wg, out, err)
-		wg.Wait()
+	// the failed phase may have left any of the components installed, so
+	// operations on those it did not install are expected to fail
+	states, err := b.(backend.Inspector).UnitStates()
+	if err != nil {
+		return nil, err
+	}
+	installed := map[string]bool{}
+	for _, s := range states {
+		target := unitTarget(s.Name)
+		installed[target] = true
+		if i := strings.Index(target, "@"); i >= 0 {
+			installed[target[:i]+"@*"] = true
+		}
+	}
+	prep, err := doUpgradePrep(opts.Stateless, b)
+	if err != nil {
+		return prep, err
+	}
+	var results []backend.Result
+	for _, r := range prep {
+		if !notInstalled(r, installed) {
+			results = append(results, r)
+		}
+	}
 
-		// we start gateway first to give metadata time to come up for volume
-		b.Start([]string{"store-gateway@*"}, wg, out, err)
-		wg.Wait()
-		b.Start([]string{"store-volume"}, wg, out, err)
-		wg.Wait()
+	takeover, err := doUpgradeTakeOver(opts.Stateless, b, cb)
+	results = append(results, takeover...)
+	if err != nil {
+		return results, err
+	}
+	if failed := backend.Failed(results); len(failed) > 0 {
+		return results, fmt.Errorf("%d of %d operations failed", len(failed), len(results))
+	}
+	return results, waitHealthy(b, cb, append([]string{"router", "publisher"}, upgradeComponents(opts.Stateless)...), opts.HealthTimeout)
+}
+
+// notInstalled is true if an operation failed on units of which none is
+// installed.
+func notInstalled(r backend.Result, installed map[string]bool) bool {
+	if r.Err == nil {
+		return false
+	}
+	for _, unit := range strings.Fields(r.Unit) {
+		if installed[unitTarget(unit)] {
+			return false
+		}
+	}
+	return true
+}
+
+// waitHealthy checks the platform with the checks of the doctor until
+// components are running and no problem is critical, or until timeout.
+func waitHealthy(b backend.Backend, cb config.Backend, components []string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		problems, err := healthProblems(b, cb, components)
+		if err == nil && len(problems) == 0 {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("unhealthy after %v: %s", timeout, strings.Join(problems, "; "))
+		}
+		time.Sleep(upgradeCheckInterval)
 	}
+}
 
-	// start logging subsystem first to collect logs from other components
-	fmt.Fprintln(out, "Logging subsystem...")
-	if !stateless {
-		b.Start([]string{"logger"}, wg, out, err)
-		wg.Wait()
+// healthProblems returns the critical problems of the platform, and the
+// components that are not running. It goes by unit states and the keys
+// components publish in etcd only: deisctl often runs outside the cluster,
+// where the addresses they publish cannot be reached.
+func healthProblems(b backend.Backend, cb config.Backend, components []string) ([]string, error) {
+	states, err := b.(backend.Inspector).UnitStates()
+	if err != nil {
+		return nil, err
 	}
-	b.Start([]string{"logspout"}, wg, out, err)
-	wg.Wait()
+	_, running := checkUnits(states)
 
-	// Start these in parallel. This section can probably be removed now.
-	var bgwg sync.WaitGroup
-	var trash bytes.Buffer
-	batch := []string{
-		"database", "registry@*", "controller", "builder",
-		"publisher",
+	var problems []string
+	for _, c := range components {
+		if running[c] == 0 {
+			problems = append(problems, c+" is not running")
+		}
 	}
-	if stateless {
-		batch = []string{"registry@*", "controller", "builder", "publisher", "router@*"}
+	for _, f := range diagnose(b, cb, false) {
+		if f.Severity == Critical {
+			problems = append(problems, f.Message)
+		}
 	}
-	b.Start(batch, &bgwg, &trash, &trash)
+	return problems, nil
+}
 
-	fmt.Fprintln(Stdout, "Control plane...")
-	batch = []string{"database", "registry@*", "controller"}
-	if stateless {
-		batch = []string{"registry@*", "controller"}
+// upgradeSnapshot is what Upgrade restores if a phase fails.
+type upgradeSnapshot struct {
+	dir     string
+	unitDir string
+	version string
+	// files are the unit files and decorators in unitDir by path relative to
+	// it, nil for those that did not exist.
+	files map[string][]byte
+}
+
+// takeSnapshot saves the unit files in the unit directory and the platform
+// configuration to the snapshot directory.
+func takeSnapshot(opts UpgradeOptions, cb config.Backend) (*upgradeSnapshot, error) {
+	version, err := cb.GetWithDefault("/deis/platform/version", "")
+	if err != nil {
+		return nil, err
+	}
+	snap := &upgradeSnapshot{
+		dir:     utils.ResolvePath(opts.SnapshotDir),
+		unitDir: utils.ResolvePath(opts.UnitDir),
+		version: version,
+		files:   map[string][]byte{},
 	}
-	b.Start(batch, wg, out, err)
-	wg.Wait()
+	if err := os.MkdirAll(filepath.Join(snap.dir, "units", "decorators"), 0755); err != nil {
+		return nil, err
+	}
+	for _, unit := range units.Names {
+		for _, name := range []string{unit + ".service", filepath.Join("decorators", unit+".service.decorator")} {
+			data, err := ioutil.ReadFile(filepath.Join(snap.unitDir, name))
+			if os.IsNotExist(err) {
+				snap.files[name] = nil
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			snap.files[name] = data
+			if err := ioutil.WriteFile(filepath.Join(snap.dir, "units", name), data, 0644); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return snap, ConfigExport(filepath.Join(snap.dir, "config.json"), opts.PassphraseFile, cb)
+}
 
-	b.Start([]string{"builder"}, wg, out, err)
-	wg.Wait()
+// restoreUnitFiles writes the saved unit files back to the unit directory,
+// and removes those that were not there.
+func (s *upgradeSnapshot) restoreUnitFiles() error {
+	for name, data := range s.files {
+		p := filepath.Join(s.unitDir, name)
+		if data == nil {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		if err := ioutil.WriteFile(p, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	fmt.Fprintln(out, "Data plane...")
-	b.Start([]string{"publisher"}, wg, out, err)
-	wg.Wait()
+func (s *upgradeSnapshot) displayVersion() string {
+	if s.version == "" {
+		return "the previous release"
+	}
+	return s.version
 }
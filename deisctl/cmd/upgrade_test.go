@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deis/deis/deisctl/backend"
+	"github.com/deis/deis/deisctl/config/model"
+	"github.com/deis/deis/deisctl/test/mock"
+)
+
+// upgradeConfigBackend keeps the keys set and deleted.
+type upgradeConfigBackend struct {
+	treeConfigBackend
+}
+
+func (cb *upgradeConfigBackend) Set(key, value string) (string, error) {
+	for _, n := range cb.Expected {
+		if n.Key == key {
+			n.Value = value
+			return value, nil
+		}
+	}
+	cb.Expected = append(cb.Expected, &model.ConfigNode{Key: key, Value: value})
+	return value, nil
+}
+
+func (cb *upgradeConfigBackend) Delete(key string) error {
+	for i, n := range cb.Expected {
+		if n.Key == key {
+			cb.Expected = append(cb.Expected[:i], cb.Expected[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s does not exist", key)
+}
+
+// upgradeStub is a cluster whose controller fails on the broken release.
+type upgradeStub struct {
+	inspectorStub
+	version *model.ConfigNode
+	broken  string
+}
+
+func (u *upgradeStub) UnitStates() ([]backend.UnitState, error) {
+	var states []backend.UnitState
+	for _, c := range append([]string{"router@1", "publisher"}, upgradeComponents(true)...) {
+		state := runningUnit("deis-" + c + ".service")
+		if c == "controller" && u.version.Value == u.broken {
+			state.ActiveState, state.SubState = "failed", "failed"
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func newUpgradeCluster(t *testing.T, broken string) (*upgradeStub, *upgradeConfigBackend, UpgradeOptions, func()) {
+	ttl := time.Now().Add(time.Minute)
+	version := &model.ConfigNode{Key: "/deis/platform/version", Value: "v1.7.1"}
+	cb := &upgradeConfigBackend{treeConfigBackend{mock.ConfigBackend{Expected: []*model.ConfigNode{
+		version,
+		{Key: "/deis/platform/domain", Value: "example.com"},
+		{Key: "/deis/builder/host", Value: "10.0.0.1", Expiration: &ttl},
+		{Key: "/deis/controller/host", Value: "10.0.0.1", Expiration: &ttl},
+		{Key: "/deis/logs/host", Value: "10.0.0.1", Expiration: &ttl},
+		{Key: "/deis/registry/host", Value: "10.0.0.1", Expiration: &ttl},
+		{Key: "/deis/router/hosts/10.0.0.1", Value: "10.0.0.1:80", Expiration: &ttl},
+	}}}}
+	b := &upgradeStub{inspectorStub: inspectorStub{machines: []backend.Machine{{ID: "abc", IP: "10.0.0.1"}}},
+		version: version, broken: broken}
+
+	name, err := ioutil.TempDir("", "deisctl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unitDir := filepath.Join(name, "units")
+	os.MkdirAll(unitDir, 0755)
+	ioutil.WriteFile(filepath.Join(unitDir, "deis-router.service"), []byte("v1.7.1 router"), 0644)
+
+	opts := UpgradeOptions{Version: "v1.7.2", Stateless: true, UnitDir: unitDir,
+		SnapshotDir: filepath.Join(name, "snapshot"), HealthTimeout: 10 * time.Millisecond}
+
+	var out bytes.Buffer
+	stdout, stderr, interval, d := Stdout, Stderr, upgradeCheckInterval, dial
+	Stdout, Stderr, upgradeCheckInterval = &out, &out, time.Millisecond
+	// the upgrade must not depend on reaching the cluster's addresses
+	dial = func(addr string) error { return fmt.Errorf("%s is unreachable", addr) }
+	return b, cb, opts, func() {
+		Stdout, Stderr, upgradeCheckInterval, dial = stdout, stderr, interval, d
+		os.RemoveAll(name)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	b, cb, opts, cleanup := newUpgradeCluster(t, "")
+	defer cleanup()
+	server := httptest.NewServer(fakeHTTPServer{})
+	defer server.Close()
+
+	if err := Upgrade(opts, server.URL+"/", b, cb); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.version.Value != "v1.7.2" {
+		t.Errorf("Expected the platform version to be v1.7.2, Got %s", b.version.Value)
+	}
+	if !reflect.DeepEqual(b.restartedUnits, []string{"router"}) {
+		t.Errorf("Expected the routers to be restarted once, Got %v", b.restartedUnits)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(opts.UnitDir, "deis-router.service")); string(data) != "test" {
+		t.Errorf("Expected the unit files of v1.7.2, Got %s", data)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(opts.SnapshotDir, "units", "deis-router.service")); string(data) != "v1.7.1 router" {
+		t.Errorf("Expected the unit files of v1.7.1 to be saved, Got %s", data)
+	}
+	if _, err := os.Stat(filepath.Join(opts.SnapshotDir, "config.json")); err != nil {
+		t.Errorf("Expected the configuration to be saved, Got %v", err)
+	}
+}
+
+func TestUpgradeRollsBack(t *testing.T) {
+	b, cb, opts, cleanup := newUpgradeCluster(t, "v1.7.2")
+	defer cleanup()
+	server := httptest.NewServer(fakeHTTPServer{})
+	defer server.Close()
+
+	err := Upgrade(opts, server.URL+"/", b, cb)
+	if err == nil || !strings.Contains(err.Error(), "upgrade phase takeover failed, rolled back to v1.7.1") {
+		t.Fatalf("Expected the takeover to be rolled back, Got %v", err)
+	}
+
+	if b.version.Value != "v1.7.1" {
+		t.Errorf("Expected the platform version to be restored, Got %s", b.version.Value)
+	}
+	if !reflect.DeepEqual(b.restartedUnits, []string{"router", "router"}) {
+		t.Errorf("Expected the routers to be restarted again, Got %v", b.restartedUnits)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(opts.UnitDir, "deis-router.service")); string(data) != "v1.7.1 router" {
+		t.Errorf("Expected the unit files of v1.7.1 to be restored, Got %s", data)
+	}
+	if _, err := os.Stat(filepath.Join(opts.UnitDir, "deis-controller.service")); !os.IsNotExist(err) {
+		t.Errorf("Expected the unit files that were not there to be removed, Got %v", err)
+	}
+}
+
+func TestRollBackRestoresConfig(t *testing.T) {
+	b, cb, opts, cleanup := newUpgradeCluster(t, "")
+	defer cleanup()
+
+	snap, err := takeSnapshot(opts, cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb.Set("/deis/platform/domain", "example.org")
+	cb.Set("/deis/platform/version", "v1.7.2")
+	cb.Set("/deis/platform/added", "true")
+
+	if _, err := rollBack(snap, opts, b, cb); err != nil {
+		t.Fatal(err)
+	}
+	if domain, _ := cb.Get("/deis/platform/domain"); domain != "example.com" {
+		t.Errorf("Expected the configuration to be restored, Got domain %s", domain)
+	}
+	if _, err := cb.Get("/deis/platform/added"); err == nil {
+		t.Error("Expected the keys added since the snapshot to be deleted")
+	}
+	if _, err := cb.Get("/deis/builder/host"); err != nil {
+		t.Errorf("Expected published keys to be kept, Got %v", err)
+	}
+	if b.version.Value != "v1.7.1" {
+		t.Errorf("Expected the platform version to be restored, Got %s", b.version.Value)
+	}
+}
+
+func TestNotInstalled(t *testing.T) {
+	t.Parallel()
+
+	installed := map[string]bool{"router@1": true, "router@*": true, "builder": true}
+	tests := []struct {
+		result backend.Result
+		expect bool
+	}{
+		{backend.Result{Unit: "deis-controller.service", Err: errors.New("not found")}, true},
+		{backend.Result{Unit: "deis-registry@* deis-database", Err: errors.New("could not find unit")}, true},
+		{backend.Result{Unit: "deis-builder.service", Err: errors.New("timeout")}, false},
+		{backend.Result{Unit: "deis-router@* deis-controller", Err: errors.New("timeout")}, false},
+		{backend.Result{Unit: "deis-controller.service"}, false},
+	}
+	for _, tt := range tests {
+		if actual := notInstalled(tt.result, installed); actual != tt.expect {
+			t.Errorf("Expected notInstalled(%v) to be %t", tt.result, tt.expect)
+		}
+	}
+}
+
+func TestUpgradeUnhealthy(t *testing.T) {
+	b, cb, opts, cleanup := newUpgradeCluster(t, "v1.7.1")
+	defer cleanup()
+
+	if err := Upgrade(opts, "http://localhost/", b, cb); err == nil {
+		t.Error("Expected an unhealthy platform not to be upgraded")
+	}
+	if len(b.stoppedUnits) != 0 {
+		t.Errorf("Expected nothing to be stopped, Got %v", b.stoppedUnits)
+	}
+}
@@ -11,16 +11,12 @@ import (
 	"github.com/deis/deis/deisctl/utils"
 )
 
-// fileKeys define config keys to be read from local files
-var fileKeys = []string{
-	"/deis/platform/sshPrivateKey",
-	"/deis/router/sslCert",
-	"/deis/router/sslKey",
-	"/deis/router/sslDhparam"}
-
 // b64Keys define config keys to be base64 encoded before stored
 var b64Keys = []string{"/deis/platform/sshPrivateKey"}
 
+// errWriter is where warnings about unknown keys are written.
+var errWriter io.Writer = os.Stderr
+
 // Config runs the config subcommand
 func Config(target string, action string, key []string, cb Backend) error {
 	return doConfig(target, action, key, cb, os.Stdout)
@@ -45,10 +41,12 @@ func doConfig(target string, action string, key []string, cb Backend, w io.Write
 	var err error
 
 	switch action {
+	case "list":
+		return doConfigList(cb, target, w)
 	case "rm":
 		vals, err = doConfigRm(cb, rootPath, key)
 	case "set":
-		vals, err = doConfigSet(cb, rootPath, key)
+		vals, err = doConfigSet(cb, target, key)
 	default:
 		vals, err = doConfigGet(cb, rootPath, key)
 	}
@@ -63,16 +61,33 @@ func doConfig(target string, action string, key []string, cb Backend, w io.Write
 	return nil
 }
 
-func doConfigSet(cb Backend, root string, kvs []string) ([]string, error) {
+func doConfigSet(cb Backend, target string, kvs []string) ([]string, error) {
 	var result []string
 	regex := regexp.MustCompile(`^(.+)=([\s\S]+)$`)
+	root := "/deis/" + target + "/"
 
+	// validate every value before setting any
 	for _, kv := range kvs {
 
 		if !regex.MatchString(kv) {
 			return []string{}, fmt.Errorf("'%s' does not match the pattern 'key=var', ex: foo=bar\n", kv)
 		}
 
+		captures := regex.FindStringSubmatch(kv)
+		k, v := captures[1], captures[2]
+		schema, known := LookupKey(target, k)
+		switch {
+		case !known:
+			warnUnknownKey(target, k)
+		case !schema.File:
+			if err := schema.Validate(v); err != nil {
+				return []string{}, err
+			}
+		}
+	}
+
+	for _, kv := range kvs {
+
 		// split k/v from args
 		captures := regex.FindStringSubmatch(kv)
 		k, v := captures[1], captures[2]
@@ -122,26 +137,23 @@ func doConfigRm(cb Backend, root string, keys []string) ([]string, error) {
 // valueForPath returns the canonical value for a user-defined path and value
 func valueForPath(path string, v string) (string, error) {
 
-	// check if path is part of fileKeys
-	for _, p := range fileKeys {
+	// check if the key is read from a file
+	if k, ok := lookupPath(path); ok && k.File {
 
-		if path == p {
-
-			// read value from filesystem
-			bytes, err := ioutil.ReadFile(utils.ResolvePath(v))
-			if err != nil {
-				return "", err
-			}
+		// read value from filesystem
+		bytes, err := ioutil.ReadFile(utils.ResolvePath(v))
+		if err != nil {
+			return "", err
+		}
 
-			// see if we should return base64 encoded value
-			for _, pp := range b64Keys {
-				if path == pp {
-					return base64.StdEncoding.EncodeToString(bytes), nil
-				}
+		// see if we should return base64 encoded value
+		for _, pp := range b64Keys {
+			if path == pp {
+				return base64.StdEncoding.EncodeToString(bytes), nil
 			}
-
-			return string(bytes), nil
 		}
+
+		return string(bytes), nil
 	}
 
 	return v, nil
@@ -64,6 +64,7 @@ func singleNodeToConfigNode(node *etcdlib.Node) *model.ConfigNode {
 	key := model.ConfigNode{
 		Key:        node.Key,
 		Expiration: node.Expiration,
+		Dir:        node.Dir,
 	}
 
 	if node.Dir != true && node.Key != "" {
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/deis/deis/deisctl/utils"
+)
+
+// ExportVersion is the version of the files written by Export. Import reads
+// files of this version or older.
+const ExportVersion = 1
+
+// exportRoot is the keyspace Export snapshots.
+const exportRoot = "/deis"
+
+// ephemeralRe matches keys that running components publish about themselves,
+// such as /deis/services/<app> and /deis/router/hosts/<host>. They are not
+// configuration, so they are not exported. Neither are keys with a TTL.
+var ephemeralRe = regexp.MustCompile(`^/deis/(services/|.+/hosts/)`)
+
+// secretRe matches keys that look like they hold secrets, such as the keys of
+// certificates, in addition to the secret keys of the schema.
+var secretRe = regexp.MustCompile(`(?i)(key|keyring|secret|pass|password|token)$`)
+
+// isSecret is true if a key holds a secret, which is encrypted when exporting
+// with a passphrase and hidden when shown.
+func isSecret(key string) bool {
+	if k, ok := lookupPath(key); ok && k.Secret {
+		return true
+	}
+	return secretRe.MatchString(key)
+}
+
+// snapshot is the platform configuration as written to a file.
+type snapshot struct {
+	Version  int       `json:"version"`
+	Exported time.Time `json:"exported"`
+	// Salt, base64 encoded, derives the key secrets are encrypted with, if
+	// they are.
+	Salt string        `json:"salt,omitempty"`
+	Keys []snapshotKey `json:"keys"`
+}
+
+type snapshotKey struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Encrypted bool   `json:"encrypted,omitempty"`
+}
+
+// Export writes the platform configuration under /deis to a file.
+//
+// If passphrase is not empty, the values of secret keys are encrypted with it.
+// What was exported is printed to out, and warnings to ew.
+func Export(path string, passphrase []byte, cb Backend, out, ew io.Writer) error {
+	f, err := os.OpenFile(utils.ResolvePath(path), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	n, err := doExport(cb, passphrase, f)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Exported %d keys to %s\n", n, path)
+	if len(passphrase) == 0 {
+		fmt.Fprintf(ew, "Warning: secrets are not encrypted, keep %s safe or export with a passphrase\n", path)
+	}
+	return nil
+}
+
+// Import restores the platform configuration from a file written by Export.
+//
+// The keys it adds or changes are printed to w first. With dryRun, nothing is
+// set.
+func Import(path string, passphrase []byte, dryRun bool, cb Backend, w io.Writer) error {
+	data, err := ioutil.ReadFile(utils.ResolvePath(path))
+	if err != nil {
+		return err
+	}
+	return doImport(cb, data, passphrase, dryRun, w)
+}
+
+// Restore imports a file written by Export, as Import does, and deletes the
+// keys under /deis it does not have, except those Export leaves out. The
+// platform configuration is then the same as when it was exported.
+func Restore(path string, passphrase []byte, cb Backend, w io.Writer) error {
+	data, err := ioutil.ReadFile(utils.ResolvePath(path))
+	if err != nil {
+		return err
+	}
+	if err := doImport(cb, data, passphrase, false, w); err != nil {
+		return err
+	}
+	return doPrune(cb, data, w)
+}
+
+func doExport(cb Backend, passphrase []byte, w io.Writer) (int, error) {
+	nodes, err := cb.GetRecursive(exportRoot)
+	if err != nil {
+		return 0, err
+	}
+
+	s := snapshot{Version: ExportVersion, Exported: time.Now().UTC()}
+	var key []byte
+	if len(passphrase) > 0 {
+		salt, err := newSalt()
+		if err != nil {
+			return 0, err
+		}
+		s.Salt = base64.StdEncoding.EncodeToString(salt)
+		key = deriveKey(passphrase, salt)
+	}
+
+	for _, node := range nodes {
+		if node.Dir || node.Expiration != nil || ephemeralRe.MatchString(node.Key) {
+			continue
+		}
+		k := snapshotKey{Key: node.Key, Value: node.Value}
+		if key != nil && isSecret(node.Key) {
+			if k.Value, err = encrypt(key, node.Value); err != nil {
+				return 0, err
+			}
+			k.Encrypted = true
+		}
+		s.Keys = append(s.Keys, k)
+	}
+	sort.Sort(byKey(s.Keys))
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(s.Keys), nil
+}
+
+func doImport(cb Backend, data, passphrase []byte, dryRun bool, w io.Writer) error {
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("not a configuration export: %v", err)
+	}
+	if s.Version < 1 || s.Version > ExportVersion {
+		return fmt.Errorf("unsupported configuration export version %d", s.Version)
+	}
+
+	var key []byte
+	for i, k := range s.Keys {
+		if !strings.HasPrefix(k.Key, exportRoot+"/") {
+			return fmt.Errorf("%s is outside of %s", k.Key, exportRoot)
+		}
+		if !k.Encrypted {
+			continue
+		}
+		if len(passphrase) == 0 {
+			return fmt.Errorf("%s is encrypted, a passphrase is required", k.Key)
+		}
+		if key == nil {
+			salt, err := base64.StdEncoding.DecodeString(s.Salt)
+			if err != nil {
+				return fmt.Errorf("invalid salt: %v", err)
+			}
+			key = deriveKey(passphrase, salt)
+		}
+		v, err := decrypt(key, k.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", k.Key, err)
+		}
+		s.Keys[i].Value = v
+	}
+
+	var changes []snapshotKey
+	for _, k := range s.Keys {
+		current, err := cb.Get(k.Key)
+		switch {
+		case err != nil:
+			fmt.Fprintf(w, "+ %s = %s\n", k.Key, displayValue(k.Key, k.Value))
+		case current != k.Value:
+			fmt.Fprintf(w, "~ %s: %s -> %s\n", k.Key, displayValue(k.Key, current), displayValue(k.Key, k.Value))
+		default:
+			continue
+		}
+		changes = append(changes, k)
+	}
+	fmt.Fprintf(w, "%d keys to set, %d unchanged\n", len(changes), len(s.Keys)-len(changes))
+	if dryRun {
+		return nil
+	}
+
+	for _, k := range changes {
+		if _, err := cb.Set(k.Key, k.Value); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(w, "Imported %d keys\n", len(changes))
+	return nil
+}
+
+// doPrune deletes the keys under /deis that an export does not have and
+// would have been exported.
+func doPrune(cb Backend, data []byte, w io.Writer) error {
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("not a configuration export: %v", err)
+	}
+	exported := make(map[string]bool, len(s.Keys))
+	for _, k := range s.Keys {
+		exported[k.Key] = true
+	}
+
+	nodes, err := cb.GetRecursive(exportRoot)
+	if err != nil {
+		return err
+	}
+	deleted := 0
+	for _, node := range nodes {
+		if node.Dir || node.Expiration != nil || ephemeralRe.MatchString(node.Key) || exported[node.Key] {
+			continue
+		}
+		fmt.Fprintf(w, "- %s\n", node.Key)
+		if err := cb.Delete(node.Key); err != nil {
+			return err
+		}
+		deleted++
+	}
+	fmt.Fprintf(w, "Deleted %d keys\n", deleted)
+	return nil
+}
+
+// displayValue returns a value as shown by list and import. Secrets are
+// hidden and long values, such as certificates, are shortened.
+func displayValue(key, value string) string {
+	if isSecret(key) {
+		return "(secret)"
+	}
+	value = strings.Replace(value, "\n", `\n`, -1)
+	if len(value) > 60 {
+		return value[:57] + "..."
+	}
+	return value
+}
+
+type byKey []snapshotKey
+
+func (s byKey) Len() int           { return len(s) }
+func (s byKey) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byKey) Less(i, j int) bool { return s[i].Key < s[j].Key }
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// doConfigList prints the known keys of a component with their effective
+// values, followed by any other keys set under it.
+func doConfigList(cb Backend, component string, w io.Writer) error {
+	root := "/deis/" + component + "/"
+	if _, ok := Schema[component]; !ok {
+		fmt.Fprintf(errWriter, "Warning: no keys are declared for %s\n", component)
+	}
+
+	tw := new(tabwriter.Writer)
+	tw.Init(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tDESCRIPTION")
+
+	for _, k := range Schema[component] {
+		if strings.Contains(k.Name, "*") {
+			continue
+		}
+		v, err := cb.GetWithDefault(root+k.Name, "")
+		if err != nil {
+			return err
+		}
+		switch {
+		case v != "":
+			v = displayValue(root+k.Name, v)
+		case k.Default != "":
+			v = k.Default + " (default)"
+		default:
+			v = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", k.Name, v, k.Description)
+	}
+
+	// keys matching a pattern, and unknown keys, are only found by listing
+	// the component's keyspace, which does not exist until a key is set
+	nodes, _ := cb.GetRecursive(strings.TrimSuffix(root, "/"))
+	var others []string
+	values := map[string]string{}
+	for _, n := range nodes {
+		name := strings.TrimPrefix(n.Key, root)
+		if n.Dir || n.Expiration != nil || ephemeralRe.MatchString(n.Key) || name == n.Key {
+			continue
+		}
+		if k, ok := LookupKey(component, name); ok && !strings.Contains(k.Name, "*") {
+			continue
+		}
+		others = append(others, name)
+		values[name] = n.Value
+	}
+	sort.Strings(others)
+	for _, name := range others {
+		description := "unknown key"
+		if k, ok := LookupKey(component, name); ok {
+			description = k.Description
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", name, displayValue(root+name, values[name]), description)
+	}
+	return tw.Flush()
+}
+
+// warnUnknownKey warns that a key is not in the schema of a component,
+// suggesting the known key it may be a typo of.
+func warnUnknownKey(component, name string) {
+	msg := fmt.Sprintf("Warning: %s is not a known key of %s", name, component)
+	if s := suggestKey(component, name); s != "" {
+		msg += fmt.Sprintf(", did you mean %s?", s)
+	}
+	fmt.Fprintln(errWriter, msg)
+}
@@ -8,4 +8,5 @@ type ConfigNode struct {
 	Value      string     `json:"value,omitempty"`
 	Expiration *time.Time `json:"expiration,omitempty"`
 	TTL        int64      `json:"ttl,omitempty"`
+	Dir        bool       `json:"dir,omitempty"`
 }
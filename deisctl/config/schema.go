@@ -0,0 +1,307 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeyType is the type of value a config key holds.
+type KeyType string
+
+const (
+	// String values are used as they are.
+	String KeyType = "string"
+	// Int values are whole numbers.
+	Int KeyType = "int"
+	// Bool values are "true" or "false", which is what templates compare against.
+	Bool KeyType = "bool"
+	// Duration values are a number with an optional unit, such as 10m or 1h30m,
+	// including the d, w, M and y units of nginx.
+	Duration KeyType = "duration"
+	// GoDuration values are durations read by Go components, which only know
+	// the units up to h, such as 90s or 1h30m.
+	GoDuration KeyType = "go-duration"
+	// Size values are a number with an optional k, m or g unit, such as 4k.
+	Size KeyType = "size"
+)
+
+var (
+	durationRe = regexp.MustCompile(`^([0-9]+(ms|s|m|h|d|w|M|y)?)+$`)
+	sizeRe     = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+)
+
+// Key describes a config key of a component.
+type Key struct {
+	// Name is the key under /deis/<component>/, such as gzip or hsts/enabled.
+	// A * matches one path element, as in apps/*/webhooks.
+	Name string
+	Type KeyType
+	// Allowed lists the only values the key accepts, if any.
+	Allowed []string
+	// Max is the longest go-duration the key accepts, if any.
+	Max string
+	// Default is what the component uses when the key is not set.
+	Default     string
+	Description string
+	// File is true if "deisctl config set" reads the value from a local file.
+	File bool
+	// Secret is true if the value must not be shown.
+	Secret bool
+}
+
+// Validate returns an error if value is not valid for the key.
+func (k Key) Validate(value string) error {
+	if len(k.Allowed) > 0 {
+		for _, a := range k.Allowed {
+			if value == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid value %q for %s, expected one of %s", value, k.Name, strings.Join(k.Allowed, ", "))
+	}
+	var ok bool
+	switch k.Type {
+	case Int:
+		_, err := strconv.Atoi(value)
+		ok = err == nil
+	case Bool:
+		ok = value == "true" || value == "false"
+	case Duration:
+		ok = durationRe.MatchString(value)
+	case GoDuration:
+		d, err := time.ParseDuration(value)
+		ok = err == nil
+		if max, _ := time.ParseDuration(k.Max); ok && k.Max != "" && d > max {
+			return fmt.Errorf("invalid value %q for %s, expected at most %s", value, k.Name, k.Max)
+		}
+	case Size:
+		ok = sizeRe.MatchString(value)
+	default:
+		ok = true
+	}
+	if !ok {
+		return fmt.Errorf("invalid value %q for %s, expected a %s", value, k.Name, k.Type)
+	}
+	return nil
+}
+
+// Schema declares the known config keys of each component. Keys components
+// publish about themselves, such as host and port, are known but not listed
+// here when they are never set by hand.
+var Schema = map[string][]Key{
+	"platform": {
+		{Name: "domain", Type: String, Description: "domain applications and the controller are served under"},
+		{Name: "enablePlacementOptions", Type: Bool, Default: "false", Description: "schedule components according to the machine metadata of isolated planes"},
+		{Name: "sshPrivateKey", Type: String, File: true, Secret: true, Description: `private key "deis run" connects to hosts with`},
+		{Name: "version", Type: String, Description: "release of the platform images, such as v1.12.2"},
+	},
+	"router": {
+		{Name: "affinityArg", Type: String, Description: "query string variable whose contents pick the backend, for session affinity"},
+		{Name: "bodySize", Type: Size, Default: "1m", Description: "nginx client_max_body_size"},
+		{Name: "builder/timeout/connect", Type: Int, Default: "10000", Description: "proxy_connect_timeout for the builder, in milliseconds"},
+		{Name: "builder/timeout/tcp", Type: Int, Default: "1200000", Description: "proxy_timeout for the builder, in milliseconds"},
+		{Name: "controller/timeout/connect", Type: Duration, Default: "10m", Description: "proxy_connect_timeout for the controller"},
+		{Name: "controller/timeout/read", Type: Duration, Default: "20m", Description: "proxy_read_timeout for the controller"},
+		{Name: "controller/timeout/send", Type: Duration, Default: "20m", Description: "proxy_send_timeout for the controller"},
+		{Name: "controller/whitelist", Type: String, Description: "comma separated IPs or CIDRs allowed to connect to the controller"},
+		{Name: "defaultTimeout", Type: Int, Default: "1300", Description: "timeout in seconds, longer than the load balancer's"},
+		{Name: "enforceHTTPS", Type: Bool, Default: "false", Description: "redirect HTTP traffic to HTTPS"},
+		{Name: "enforceWhitelist", Type: Bool, Default: "false", Description: "deny all connections unless whitelisted"},
+		{Name: "errorLogLevel", Type: String, Default: "error", Allowed: []string{"debug", "info", "notice", "warn", "error", "crit", "alert", "emerg"}, Description: "nginx error_log level"},
+		{Name: "firewall/enabled", Type: Bool, Default: "false", Description: "enable the naxsi firewall"},
+		{Name: "firewall/errorCode", Type: Int, Default: "400", Description: "status code of requests the firewall blocks"},
+		{Name: "gzip", Type: String, Default: "on", Allowed: []string{"on", "off"}, Description: "nginx gzip"},
+		{Name: "gzipCompLevel", Type: Int, Default: "5", Description: "nginx gzip_comp_level"},
+		{Name: "gzipDisable", Type: String, Default: "msie6", Description: "nginx gzip_disable"},
+		{Name: "gzipHttpVersion", Type: String, Default: "1.1", Allowed: []string{"1.0", "1.1"}, Description: "nginx gzip_http_version"},
+		{Name: "gzipMinLength", Type: Int, Default: "256", Description: "nginx gzip_min_length"},
+		{Name: "gzipProxied", Type: String, Default: "any", Description: "nginx gzip_proxied"},
+		{Name: "gzipTypes", Type: String, Description: "nginx gzip_types"},
+		{Name: "gzipVary", Type: String, Default: "on", Allowed: []string{"on", "off"}, Description: "nginx gzip_vary"},
+		{Name: "hsts/enabled", Type: Bool, Default: "false", Description: "send HTTP Strict Transport Security headers"},
+		{Name: "hsts/includeSubDomains", Type: Bool, Default: "false", Description: "enforce HSTS on all subdomains"},
+		{Name: "hsts/maxAge", Type: Int, Default: "10886400", Description: "seconds user agents observe HSTS"},
+		{Name: "hsts/preload", Type: Bool, Default: "false", Description: "allow the domain in the HSTS preload list"},
+		{Name: "maxWorkerConnections", Type: Int, Default: "768", Description: "nginx worker_connections"},
+		{Name: "proxyProtocol", Type: Bool, Default: "false", Description: "accept the PROXY protocol from the load balancer"},
+		{Name: "proxyRealIpCidr", Type: String, Default: "10.0.0.0/8", Description: "CIDR of the load balancer in front of the routers"},
+		{Name: "serverNameHashBucketSize", Type: Int, Default: "64", Description: "nginx server_names_hash_bucket_size"},
+		{Name: "serverNameHashMaxSize", Type: Int, Default: "512", Description: "nginx server_names_hash_max_size"},
+		{Name: "sslBufferSize", Type: Size, Default: "4k", Description: "nginx ssl_buffer_size"},
+		{Name: "sslCert", Type: String, File: true, Description: "cluster-wide SSL certificate"},
+		{Name: "sslCiphers", Type: String, Description: "cluster-wide enabled SSL ciphers"},
+		{Name: "sslDhparam", Type: String, File: true, Description: "cluster-wide SSL dhparam"},
+		{Name: "sslKey", Type: String, File: true, Secret: true, Description: "cluster-wide SSL private key"},
+		{Name: "sslProtocols", Type: String, Default: "TLSv1 TLSv1.1 TLSv1.2", Description: "nginx ssl_protocols"},
+		{Name: "sslSessionCache", Type: String, Description: "nginx ssl_session_cache"},
+		{Name: "sslSessionTickets", Type: String, Default: "on", Allowed: []string{"on", "off"}, Description: "nginx ssl_session_tickets"},
+		{Name: "sslSessionTimeout", Type: Duration, Default: "10m", Description: "nginx ssl_session_timeout"},
+		{Name: "workerProcesses", Type: String, Default: "auto", Description: "nginx worker_processes"},
+	},
+	"controller": {
+		{Name: "auth/ldap/bind/dn", Type: String, Description: "LDAP user to bind as, empty for an anonymous bind"},
+		{Name: "auth/ldap/bind/password", Type: String, Secret: true, Description: "password of the LDAP bind user"},
+		{Name: "auth/ldap/endpoint", Type: String, Description: "LDAP endpoint, such as ldap://ldap.company.com"},
+		{Name: "auth/ldap/group/basedn", Type: String, Description: "base DN of LDAP groups"},
+		{Name: "auth/ldap/group/filter", Type: String, Description: "field LDAP groups are searched by"},
+		{Name: "auth/ldap/group/type", Type: String, Description: "type of LDAP groups, such as groupOfNames"},
+		{Name: "auth/ldap/user/basedn", Type: String, Description: "base DN of LDAP users"},
+		{Name: "auth/ldap/user/filter", Type: String, Description: "field matched against Deis usernames"},
+		{Name: "builderKey", Type: String, Secret: true, Description: "key the builder authenticates with (default: randomly generated)"},
+		{Name: "protocol", Type: String, Default: "http", Allowed: []string{"http", "https"}, Description: "protocol of the controller"},
+		{Name: "registrationMode", Type: String, Default: "enabled", Allowed: []string{"enabled", "disabled", "admin_only"}, Description: "who may register users"},
+		{Name: "schedulerModule", Type: String, Default: "fleet", Allowed: []string{"fleet", "swarm", "mesos_marathon", "k8s"}, Description: "scheduler backend"},
+		{Name: "secretKey", Type: String, Secret: true, Description: "key used for secrets (default: randomly generated)"},
+		{Name: "subdomain", Type: String, Default: "deis", Description: "subdomain the router serves the API under"},
+		{Name: "unitHostname", Type: String, Default: "default", Allowed: []string{"default", "application", "server"}, Description: "hostname of application containers"},
+		{Name: "webEnabled", Type: String, Default: "0", Allowed: []string{"0", "1"}, Description: "enable the web UI"},
+		{Name: "workers", Type: Int, Description: "web worker processes (default: CPU cores * 2 + 1)"},
+	},
+	"builder": {
+		{Name: "apps/*/buildCPUShares", Type: Int, Description: "buildCPUShares of one application"},
+		{Name: "apps/*/buildMemory", Type: Size, Description: "buildMemory of one application"},
+		{Name: "apps/*/buildTimeout", Type: GoDuration, Description: "buildTimeout of one application"},
+		{Name: "apps/*/webhooks", Type: String, Description: "webhooks notified of the builds of one application"},
+		{Name: "branchCreateApps", Type: Bool, Default: "false", Description: "create apps that branches map to if missing"},
+		{Name: "branchMap", Type: String, Default: "master=$APP", Description: "rules mapping pushed branches to apps"},
+		{Name: "buildCPUShares", Type: Int, Description: "relative CPU weight of build containers, not limited if not set"},
+		{Name: "buildLogRetention", Type: Int, Default: "20", Description: `build logs kept per app, "0" keeps all`},
+		{Name: "buildMemory", Type: Size, Description: "memory limit of build containers, such as 1g"},
+		{Name: "buildTimeout", Type: GoDuration, Default: "1h", Description: `time a build may take, "0" for no limit`},
+		{Name: "cacheBudget", Type: Size, Default: "10G", Description: `total size of build caches, "0" for no limit`},
+		{Name: "maxConcurrentBuilds", Type: Int, Default: "4", Description: `builds to run at once, "0" for no limit`},
+		{Name: "shutdownTimeout", Type: GoDuration, Max: "5m", Default: "5m", Description: "time running builds get to finish on shutdown, the unit kills the builder after 6m"},
+		{Name: "slugRetention", Type: Int, Default: "5", Description: `slugs kept per app, "0" keeps all`},
+		{Name: "staleBuildTimeout", Type: GoDuration, Default: "1h", Description: "cancel builds holding their app longer than this"},
+		{Name: "supersedeQueuedPushes", Type: Bool, Default: "false", Description: "a push replaces a queued push to the same app"},
+		{Name: "unmappedBranches", Type: String, Default: "reject", Allowed: []string{"reject", "ignore"}, Description: "what to do with pushes of unmapped branches"},
+		{Name: "users/*/*", Type: String, Description: "SSH keys of users (set by controller)"},
+		{Name: "webhooks", Type: String, Description: "webhooks notified of the builds of all applications"},
+		{Name: "webhookSecret", Type: String, Secret: true, Description: "secret webhook payloads are signed with"},
+	},
+	"registry": {
+		{Name: "bucketName", Type: String, Default: "registry", Description: "store bucket for image layers"},
+		{Name: "s3accessKey", Type: String, Secret: true, Description: "S3 access key, the instance role is used if not set"},
+		{Name: "s3bucket", Type: String, Description: "S3 bucket images are stored in"},
+		{Name: "s3encrypt", Type: Bool, Default: "true", Description: "encrypt images at rest in S3"},
+		{Name: "s3path", Type: String, Default: "/registry", Description: "path in the S3 bucket"},
+		{Name: "s3region", Type: String, Description: "S3 region"},
+		{Name: "s3secretKey", Type: String, Secret: true, Description: "S3 secret key"},
+		{Name: "s3secure", Type: Bool, Default: "true", Description: "connect to S3 securely"},
+		{Name: "smtpFrom", Type: String, Description: "sender of registry emails"},
+		{Name: "smtpHost", Type: String, Description: "SMTP server for registry emails"},
+		{Name: "smtpLogin", Type: String, Description: "SMTP login"},
+		{Name: "smtpPassword", Type: String, Secret: true, Description: "SMTP password"},
+		{Name: "smtpPort", Type: Int, Description: "SMTP port"},
+		{Name: "smtpSecure", Type: Bool, Description: "connect to the SMTP server securely"},
+		{Name: "smtpTo", Type: String, Description: "recipient of registry emails"},
+		{Name: "swiftAuthURL", Type: String, Description: "Swift authentication URL"},
+		{Name: "swiftContainer", Type: String, Description: "Swift container images are stored in"},
+		{Name: "swiftPassword", Type: String, Secret: true, Description: "Swift password"},
+		{Name: "swiftRegionName", Type: String, Description: "Swift region"},
+		{Name: "swiftTenantName", Type: String, Description: "Swift tenant"},
+		{Name: "swiftUser", Type: String, Description: "Swift user"},
+	},
+	"database": {
+		{Name: "adminPass", Type: String, Secret: true, Default: "changeme123", Description: "database admin password"},
+		{Name: "adminUser", Type: String, Default: "postgres", Description: "database admin user"},
+		{Name: "bucketName", Type: String, Default: "db_wal", Description: "store bucket for WAL logs and backups"},
+		{Name: "engine", Type: String, Default: "postgresql_psycopg2", Description: "database engine"},
+		{Name: "name", Type: String, Default: "deis", Description: "database name"},
+		{Name: "password", Type: String, Secret: true, Default: "changeme123", Description: "database password"},
+		{Name: "user", Type: String, Default: "deis", Description: "database user"},
+	},
+	"logs": {
+		{Name: "drain", Type: String, Description: "URL of a service logs are forwarded to"},
+		{Name: "storageAdapterType", Type: String, Default: "file", Description: `"file", "memory" or "memory:<lines>"`},
+	},
+	"store": {
+		{Name: "delayStart", Type: Int, Description: "seconds store daemons wait before starting"},
+		{Name: "maxPGsPerOSDWarning", Type: Int, Description: "placement groups per OSD before Ceph warns"},
+		{Name: "minSize", Type: Int, Description: "store daemons needed to accept writes"},
+		{Name: "pgNum", Type: Int, Description: "placement groups of the storage pools"},
+		{Name: "size", Type: Int, Description: "replicas of stored data"},
+	},
+	"units": {
+		{Name: "*/cpuShares", Type: Int, Description: "relative CPU weight of a component's container"},
+		{Name: "*/dockerArgs", Type: String, Description: `extra "docker run" flags of a component, such as --dns=10.0.0.2`},
+		{Name: "*/environment", Type: String, Description: "space separated KEY=value variables added to a component's container"},
+		{Name: "*/image", Type: String, Description: "image a component runs instead of the platform release"},
+		{Name: "*/machineMetadata", Type: String, Description: "space separated key=value metadata of the machines a component may run on"},
+		{Name: "*/memory", Type: Size, Description: "memory limit of a component's container, such as 512m"},
+	},
+}
+
+// publishedKeys are keys every component publishes about itself.
+var publishedKeys = []string{"host", "port"}
+
+// LookupKey returns the schema of a key under /deis/<component>/.
+func LookupKey(component, name string) (Key, bool) {
+	for _, k := range Schema[component] {
+		if ok, _ := path.Match(k.Name, name); ok {
+			return k, true
+		}
+	}
+	for _, p := range publishedKeys {
+		if name == p {
+			return Key{Name: name, Type: String, Description: "published by " + component}, true
+		}
+	}
+	return Key{}, false
+}
+
+// lookupPath returns the schema of a key by its full path, such as
+// /deis/router/sslKey.
+func lookupPath(p string) (Key, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(p, "/deis/"), "/", 2)
+	if len(parts) < 2 {
+		return Key{}, false
+	}
+	return LookupKey(parts[0], parts[1])
+}
+
+// suggestKey returns the known key of component closest to a misspelled name.
+func suggestKey(component, name string) string {
+	best, bestDist := "", 3
+	for _, k := range Schema[component] {
+		if d := editDistance(strings.ToLower(k.Name), strings.ToLower(name)); d < bestDist {
+			best, bestDist = k.Name, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
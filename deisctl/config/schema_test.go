@@ -0,0 +1,152 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/deis/deis/deisctl/config/model"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	valid := map[string][]string{
+		"router/gzip":                     {"on", "off"},
+		"router/bodySize":                 {"1m", "512k", "10"},
+		"router/enforceHTTPS":             {"true", "false"},
+		"router/hsts/maxAge":              {"10886400"},
+		"router/controller/timeout/read":  {"20m", "90s", "1h30m"},
+		"builder/buildTimeout":            {"0", "1h", "90m"},
+		"builder/apps/myapp/buildMemory":  {"1g"},
+		"controller/registrationMode":     {"admin_only"},
+		"router/hosts/10.0.0.1":           {"10.0.0.1:80"},
+		"controller/auth/ldap/bind/dn":    {"user@company.com"},
+		"platform/enablePlacementOptions": {"true"},
+		"units/router/memory":             {"512m"},
+		"units/router/cpuShares":          {"512"},
+	}
+	invalid := map[string][]string{
+		"router/gzip":                     {"yes", "On"},
+		"router/bodySize":                 {"1 m", "big"},
+		"router/enforceHTTPS":             {"1", "True"},
+		"router/hsts/maxAge":              {"forever"},
+		"router/controller/timeout/read":  {"20 minutes"},
+		"builder/apps/myapp/buildMemory":  {"lots"},
+		"controller/registrationMode":     {"open"},
+		"router/errorLogLevel":            {"verbose"},
+		"units/router/memory":             {"half"},
+		"builder/staleBuildTimeout":       {"1d", "2w"},
+		"builder/apps/myapp/buildTimeout": {"1y"},
+		"builder/shutdownTimeout":         {"10m"},
+	}
+
+	for key, values := range valid {
+		k, ok := lookupPath("/deis/" + key)
+		if !ok && !strings.Contains(key, "hosts") {
+			t.Errorf("Expected %s to be known", key)
+			continue
+		}
+		for _, v := range values {
+			if err := k.Validate(v); err != nil {
+				t.Errorf("Expected %s=%s to be valid, Got %v", key, v, err)
+			}
+		}
+	}
+	for key, values := range invalid {
+		k, ok := lookupPath("/deis/" + key)
+		if !ok {
+			t.Errorf("Expected %s to be known", key)
+			continue
+		}
+		for _, v := range values {
+			if err := k.Validate(v); err == nil {
+				t.Errorf("Expected %s=%s to be invalid", key, v)
+			}
+		}
+	}
+}
+
+func TestSchemaDefaultsAreValid(t *testing.T) {
+	t.Parallel()
+
+	for component, keys := range Schema {
+		for _, k := range keys {
+			if k.Default == "" {
+				continue
+			}
+			if err := k.Validate(k.Default); err != nil {
+				t.Errorf("%s: %v", component, err)
+			}
+		}
+	}
+}
+
+func TestSetConfigValidates(t *testing.T) {
+	t.Parallel()
+
+	cb := &memBackend{}
+	err := doConfig("router", "set", []string{"bodySize=2m", "gzip=yes"}, cb, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), `invalid value "yes" for gzip`) {
+		t.Errorf("Expected gzip=yes to be invalid, Got %v", err)
+	}
+	if len(cb.nodes) != 0 {
+		t.Errorf("Expected nothing to be set when a value is invalid, Got %d keys", len(cb.nodes))
+	}
+}
+
+func TestSetConfigWarnsUnknownKeys(t *testing.T) {
+	var warnings bytes.Buffer
+	stderr := errWriter
+	errWriter = &warnings
+	defer func() { errWriter = stderr }()
+
+	cb := &memBackend{}
+	if err := doConfig("router", "set", []string{"gzipp=on"}, cb, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "Warning: gzipp is not a known key of router, did you mean gzip?\n"
+	if warnings.String() != expected {
+		t.Errorf("Expected %q, Got %q", expected, warnings.String())
+	}
+	if v, _ := cb.Get("/deis/router/gzipp"); v != "on" {
+		t.Error("Expected an unknown key to be set anyway")
+	}
+}
+
+func TestConfigList(t *testing.T) {
+	t.Parallel()
+
+	cb := &memBackend{nodes: []*model.ConfigNode{
+		{Key: "/deis/builder/buildTimeout", Value: "30m"},
+		{Key: "/deis/builder/webhookSecret", Value: "s3cr3t"},
+		{Key: "/deis/builder/apps/myapp/buildMemory", Value: "2g"},
+		{Key: "/deis/builder/buildTimout", Value: "10m"},
+		{Key: "/deis/builder/host", Value: "10.0.0.1"},
+	}}
+	var out bytes.Buffer
+	if err := doConfig("builder", "list", nil, cb, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	// compare lines without the padding of their columns
+	lines := map[string]bool{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		lines[strings.Join(strings.Fields(line), " ")] = true
+	}
+	for _, line := range []string{
+		"buildTimeout 30m time a build may take, \"0\" for no limit",
+		"maxConcurrentBuilds 4 (default) builds to run at once, \"0\" for no limit",
+		"buildMemory - memory limit of build containers, such as 1g",
+		"webhookSecret (secret) secret webhook payloads are signed with",
+		"apps/myapp/buildMemory 2g buildMemory of one application",
+		"buildTimout 10m unknown key",
+	} {
+		if !lines[line] {
+			t.Errorf("Expected %q in:\n%s", line, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("Expected secrets to be hidden, Got:\n%s", out.String())
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/deis/deis/deisctl/backend/fleet"
 	"github.com/deis/deis/deisctl/client"
+	"github.com/deis/deis/deisctl/cmd"
 	"github.com/deis/deis/pkg/prettyprint"
 	"github.com/deis/deis/version"
 
@@ -30,32 +31,37 @@ Usage: deisctl [options] <command> [<args>...]
 
 Commands, use "deisctl help <command>" to learn more:
   config            set platform or component values
+  diff              compare installed units with the local unit files
   dock              open an interactive shell on a container in the cluster
+  doctor            diagnose the health of the cluster
   help              show the help screen for a command
   install           install components, or the entire platform
-  journal           print the log output of a component
+  journal           print the merged log output of components
   list              list installed components
   machines          list the current hosts in the cluster
   refresh-units     refresh unit files from GitHub
   restart           stop, then start components
-  rolling-restart   perform a rolling restart of a Deis component (currently only router is supported)
-  scale             grow or shrink the number of routers, registries or store gateways
+  rolling-restart   restart the instances of a component in batches
+  scale             grow or shrink the number of instances of a component
   ssh               open an interactive shell on a machine in the cluster
   start             start components
   status            view status of components
   stop              stop components
   uninstall         uninstall components
+  upgrade           upgrade the platform to a release, rolling back if it fails
   upgrade-prep      prepare a running cluster for upgrade
   upgrade-takeover  allow an upgrade to gracefully takeover a running cluster
 
 Options:
   -h --help                   show this help screen
+  --backend=<name>            backend to manage components with, "fleet" or "docker" [default: ]
   --endpoint=<url>            etcd endpoint for fleet [default: http://127.0.0.1:4001]
   --etcd-cafile=<path>        etcd CA file authentication [default: ]
   --etcd-certfile=<path>      etcd cert file authentication [default: ]
   --etcd-key-prefix=<path>    keyspace for fleet data in etcd [default: /_coreos.com/fleet/]
   --etcd-keyfile=<path>       etcd key file authentication [default: ]
   --known-hosts-file=<path>   where to store remote fingerprints [default: ~/.ssh/known_hosts]
+  --output=<format>           report operations on units as "text", "table" or "json" [default: text]
   --request-timeout=<secs>    seconds before a request is considered failed [default: 10.0]
   --ssh-timeout=<secs>        seconds before SSH connection is considered failed [default: 10.0]
   --strict-host-key-checking  verify SSH host keys [default: true]
@@ -83,10 +89,14 @@ Options:
 		setTunnel = false
 	}
 	setGlobalFlags(args, setTunnel)
+	if err := cmd.SetOutputFormat(args["--output"].(string)); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
 	// clean up the args so subcommands don't need to reparse them
 	argv = removeGlobalArgs(argv)
 	// construct a client
-	c, err := client.NewClient("fleet")
+	c, err := client.NewClient(backendName(args))
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		return 1
@@ -122,6 +132,12 @@ Options:
 		err = c.SSH(argv)
 	case "dock":
 		err = c.Dock(argv)
+	case "diff":
+		err = c.Diff(argv)
+	case "doctor":
+		err = c.Doctor(argv)
+	case "upgrade":
+		err = c.Upgrade(argv)
 	case "upgrade-prep":
 		err = c.UpgradePrep(argv)
 	case "upgrade-takeover":
@@ -147,6 +163,7 @@ Usage: deisctl <command> [<args>...] [options]`)
 // such as "--tunnel".
 func isGlobalArg(arg string) bool {
 	prefixes := []string{
+		"--backend=",
 		"--endpoint=",
 		"--etcd-key-prefix=",
 		"--etcd-keyfile=",
@@ -154,6 +171,7 @@ func isGlobalArg(arg string) bool {
 		"--etcd-cafile=",
 		// "--experimental-api=",
 		"--known-hosts-file=",
+		"--output=",
 		"--request-timeout=",
 		"--ssh-timeout=",
 		"--strict-host-key-checking=",
@@ -211,6 +229,15 @@ func removeGlobalArgs(argv []string) []string {
 	return v
 }
 
+// backendName returns the backend requested with --backend or $DEISCTL_BACKEND.
+// It is empty if none was, which selects the default backend.
+func backendName(args map[string]interface{}) string {
+	if b, _ := args["--backend"].(string); b != "" {
+		return b
+	}
+	return os.Getenv("DEISCTL_BACKEND")
+}
+
 // setGlobalFlags sets fleet provider options based on deisctl global flags.
 func setGlobalFlags(args map[string]interface{}, setTunnel bool) {
 	fleet.Flags.Endpoint = args["--endpoint"].(string)
@@ -22,7 +22,7 @@ func (cb ConfigBackend) Get(key string) (value string, err error) {
 			return expect.Value, nil
 		}
 	}
-	return "", fmt.Errorf("%s does not exist", cb.Expected)
+	return "", fmt.Errorf("%s does not exist", key)
 }
 
 // GetWithDefault gets a value by key from an in memory config backend and
@@ -43,7 +43,7 @@ func (cb ConfigBackend) Set(key, value string) (returnedValue string, err error)
 			return value, nil
 		}
 	}
-	return "", fmt.Errorf("%s does not exist", cb.Expected)
+	return "", fmt.Errorf("%s does not exist", key)
 }
 
 // Delete a key/value pair by key from an in memory config backend
@@ -53,7 +53,7 @@ func (cb ConfigBackend) Delete(key string) (err error) {
 			return nil
 		}
 	}
-	return fmt.Errorf("%s does not exist", cb.Expected)
+	return fmt.Errorf("%s does not exist", key)
 }
 
 // GetRecursive returns a slice of all key/value pairs "under" a specified key
@@ -81,5 +81,5 @@ func (cb ConfigBackend) SetWithTTL(key string, value string, ttl uint64) (string
 			return expect.Key, nil
 		}
 	}
-	return "", fmt.Errorf("%s does not exist", cb.Expected)
+	return "", fmt.Errorf("%s does not exist", key)
 }
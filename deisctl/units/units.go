@@ -31,3 +31,60 @@ var Names = []string{
 
 // URL is the GitHub url where these units can be refreshed from
 var URL = "https://raw.githubusercontent.com/deis/deis/"
+
+// Component describes how a Deis component relates to the others.
+type Component struct {
+	// Requires are the components that must be running before this one starts,
+	// and that are stopped only after it. Requirements that are not part of
+	// what is being started or stopped are ignored, so the stateless platform
+	// can leave out storage.
+	Requires []string
+	// Subsystem is the part of the cluster the component belongs to.
+	Subsystem string
+	// Instances is true if the component runs as numbered instances, such as
+	// router@1.
+	Instances bool
+	// Publishes is the etcd key each instance publishes itself in, as a
+	// format taking the host address. Rolling restarts wait for it to be
+	// refreshed before moving on.
+	Publishes string
+}
+
+// Components declares the dependencies of the components deisctl starts and
+// stops together. Update it when adding a new Deis unit file.
+var Components = map[string]Component{
+	"store-monitor":  {Subsystem: "Storage subsystem"},
+	"store-daemon":   {Subsystem: "Storage subsystem", Requires: []string{"store-monitor"}},
+	"store-metadata": {Subsystem: "Storage subsystem", Requires: []string{"store-daemon"}},
+	"store-gateway": {Subsystem: "Storage subsystem", Requires: []string{"store-metadata"}, Instances: true,
+		Publishes: "/deis/store/gateway/hosts/%s/host"},
+	// the gateway starts first to give metadata time to come up for the volume
+	"store-volume": {Subsystem: "Storage subsystem", Requires: []string{"store-gateway"}},
+
+	// logging starts first to collect logs from other components
+	"logger":   {Subsystem: "Logging subsystem", Requires: []string{"store-volume"}},
+	"logspout": {Subsystem: "Logging subsystem", Requires: []string{"logger"}},
+
+	"database": {Subsystem: "Control plane", Requires: []string{"logspout", "store-gateway"}},
+	"registry": {Subsystem: "Control plane", Requires: []string{"logspout", "store-gateway"}, Instances: true,
+		Publishes: "/deis/registry/hosts/%s/host"},
+	"controller": {Subsystem: "Control plane", Requires: []string{"logspout", "database", "registry"}},
+	"builder":    {Subsystem: "Control plane", Requires: []string{"controller", "registry"}},
+	"publisher":  {Subsystem: "Data plane", Requires: []string{"logspout"}},
+	"router": {Subsystem: "Router mesh", Requires: []string{"builder", "publisher"}, Instances: true,
+		Publishes: "/deis/router/hosts/%s"},
+
+	"swarm-manager": {Subsystem: "Swarm control plane"},
+	"swarm-node":    {Subsystem: "Swarm data plane", Requires: []string{"swarm-manager"}},
+
+	"zookeeper":      {Subsystem: "Mesos/Marathon control plane"},
+	"mesos-master":   {Subsystem: "Mesos/Marathon control plane", Requires: []string{"zookeeper"}},
+	"mesos-marathon": {Subsystem: "Mesos/Marathon control plane", Requires: []string{"mesos-master"}},
+	"mesos-slave":    {Subsystem: "Mesos/Marathon data plane", Requires: []string{"mesos-marathon"}},
+
+	"kube-apiserver":          {Subsystem: "K8s control plane"},
+	"kube-controller-manager": {Subsystem: "K8s control plane", Requires: []string{"kube-apiserver"}},
+	"kube-scheduler":          {Subsystem: "K8s control plane", Requires: []string{"kube-apiserver"}},
+	"kube-kubelet":            {Subsystem: "K8s data plane", Requires: []string{"kube-controller-manager", "kube-scheduler"}},
+	"kube-proxy":              {Subsystem: "K8s router mesh", Requires: []string{"kube-kubelet"}},
+}